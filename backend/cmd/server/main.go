@@ -10,6 +10,7 @@ import (
 
 	"vibing-backend/config"
 	"vibing-backend/database"
+	"vibing-backend/handlers"
 	"vibing-backend/routes"
 	"vibing-backend/services"
 )
@@ -31,10 +32,22 @@ func main() {
 		log.Fatal("Failed to run migrations:", err)
 	}
 
+	// Convert product file URLs stored before object keys were introduced
+	if err := services.MigrateLegacyFileURLs(cfg.S3.Bucket); err != nil {
+		log.Printf("Failed to migrate legacy product file URLs: %v", err)
+	}
+
 	// Initialize scheduler for auto-confirmations and dispute processing
 	services.InitScheduler()
 	defer services.StopScheduler()
 
+	// Buffer product events in Redis; without it they are stored undeduplicated
+	if err := services.InitEventPipeline(cfg.Redis.URL); err != nil {
+		log.Printf("Failed to initialize product event pipeline: %v", err)
+	} else {
+		defer services.StopEventPipeline()
+	}
+
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
 		BodyLimit: 200 * 1024 * 1024, // 200MB limit for file uploads
@@ -56,7 +69,7 @@ func main() {
 	app.Use(recover.New())
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "http://localhost:3000,https://vibing.com",
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-Visitor-Id",
 		AllowMethods:     "GET, POST, PUT, DELETE, OPTIONS",
 		AllowCredentials: true,
 	}))
@@ -64,6 +77,32 @@ func main() {
 	// Setup routes
 	routes.Setup(app, cfg)
 
+	// Product images used to be saved as presigned URLs that expire after 7 days
+	if err := services.MigrateLegacyImageURLs(services.DefaultObjectStore()); err != nil {
+		log.Printf("Failed to migrate legacy product image URLs: %v", err)
+	}
+
+	// Build the personalized copies buyers request by downloading
+	services.InitBuildWorker()
+	defer services.StopBuildWorker()
+
+	// Verify assembled multipart uploads and attach them to their products
+	services.InitUploadVerifier(handlers.AttachMultipartUpload)
+	defer services.StopUploadVerifier()
+
+	// Generate the release patches the scheduler queues
+	services.InitDeltaWorker()
+	defer services.StopDeltaWorker()
+
+	// Start the malware scan worker once object storage is available
+	scanner, err := services.NewFileScanner(&cfg.Scanner)
+	if err != nil {
+		log.Printf("Failed to initialize file scanner, uploads will stay quarantined: %v", err)
+	} else {
+		services.InitScanWorker(scanner)
+		defer services.StopScanWorker()
+	}
+
 	// Start server
 	port := cfg.Server.Port
 	if port == "" {
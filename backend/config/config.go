@@ -9,6 +9,10 @@ type Config struct {
 	Redis     RedisConfig     `mapstructure:"redis"`
 	JWT       JWTConfig       `mapstructure:"jwt"`
 	S3        S3Config        `mapstructure:"s3"`
+	Storage   StorageConfig   `mapstructure:"storage"`
+	Scanner   ScannerConfig   `mapstructure:"scanner"`
+	Images    ImageConfig     `mapstructure:"images"`
+	Install   InstallConfig   `mapstructure:"install"`
 	PortOne   PortOneConfig   `mapstructure:"portone"`
 	SENS      SENSConfig      `mapstructure:"sens"`
 	ReCAPTCHA ReCAPTCHAConfig `mapstructure:"recaptcha"`
@@ -39,6 +43,40 @@ type S3Config struct {
 	AccessKey string `mapstructure:"access_key"`
 	SecretKey string `mapstructure:"secret_key"`
 	Bucket    string `mapstructure:"bucket"`
+	// Endpoint selects an S3-compatible service such as MinIO or NCP Object Storage
+	Endpoint       string `mapstructure:"endpoint"`
+	ForcePathStyle bool   `mapstructure:"force_path_style"`
+}
+
+type StorageConfig struct {
+	// Backend is one of "s3", "s3-compatible" or "local"
+	Backend    string `mapstructure:"backend"`
+	LocalPath  string `mapstructure:"local_path"`
+	PublicURL  string `mapstructure:"public_url"`
+	SigningKey string `mapstructure:"signing_key"`
+	// MediaURL is the base of stable public image URLs; defaults to {PublicURL}/api/media
+	MediaURL string `mapstructure:"media_url"`
+}
+
+type ScannerConfig struct {
+	// Backend is "clamav" or "none"
+	Backend string `mapstructure:"backend"`
+	// ClamdAddress is "tcp://host:port" or "unix:///path/to/clamd.sock"
+	ClamdAddress string `mapstructure:"clamd_address"`
+	Timeout      string `mapstructure:"timeout"`
+}
+
+type ImageConfig struct {
+	// CWebPPath is the cwebp binary used for WebP renditions; WebP is skipped when it isn't installed
+	CWebPPath   string `mapstructure:"cwebp_path"`
+	WebPQuality int    `mapstructure:"webp_quality"`
+}
+
+type InstallConfig struct {
+	// Enabled serves install scripts and the Homebrew tap; they need SigningKey
+	Enabled bool `mapstructure:"enabled"`
+	// SigningKey seeds the Ed25519 key install scripts are signed with
+	SigningKey string `mapstructure:"signing_key"`
 }
 
 type PortOneConfig struct {
@@ -69,6 +107,9 @@ type SMTPConfig struct {
 type ServerConfig struct {
 	Port string `mapstructure:"port"`
 	Host string `mapstructure:"host"`
+	// PublicURL is the externally reachable base URL of the server. Signed install scripts,
+	// the Homebrew tap and npm metadata link to it; they are refused while it isn't set.
+	PublicURL string `mapstructure:"public_url"`
 }
 
 // Load loads configuration from environment variables
@@ -95,7 +136,25 @@ func Load() (*Config, error) {
 	viper.BindEnv("s3.access_key", "AWS_ACCESS_KEY_ID")
 	viper.BindEnv("s3.secret_key", "AWS_SECRET_ACCESS_KEY")
 	viper.BindEnv("s3.bucket", "S3_BUCKET")
+	viper.BindEnv("s3.endpoint", "S3_ENDPOINT")
+	viper.BindEnv("s3.force_path_style", "S3_FORCE_PATH_STYLE")
+
+	viper.BindEnv("storage.backend", "STORAGE_BACKEND")
+	viper.BindEnv("storage.local_path", "STORAGE_LOCAL_PATH")
+	viper.BindEnv("storage.public_url", "STORAGE_PUBLIC_URL")
+	viper.BindEnv("storage.signing_key", "STORAGE_SIGNING_KEY")
+	viper.BindEnv("storage.media_url", "STORAGE_MEDIA_URL")
+
+	viper.BindEnv("images.cwebp_path", "IMAGE_CWEBP_PATH")
+	viper.BindEnv("images.webp_quality", "IMAGE_WEBP_QUALITY")
+
+	viper.BindEnv("install.enabled", "INSTALL_ENABLED")
+	viper.BindEnv("install.signing_key", "INSTALL_SIGNING_KEY")
 	
+	viper.BindEnv("scanner.backend", "SCANNER_BACKEND")
+	viper.BindEnv("scanner.clamd_address", "CLAMD_ADDRESS")
+	viper.BindEnv("scanner.timeout", "SCANNER_TIMEOUT")
+
 	viper.BindEnv("portone.api_secret", "PORTONE_API_SECRET")
 	viper.BindEnv("portone.store_id", "PORTONE_STORE_ID")
 	viper.BindEnv("portone.webhook_secret", "PORTONE_WEBHOOK_SECRET")
@@ -115,6 +174,7 @@ func Load() (*Config, error) {
 	
 	viper.BindEnv("server.port", "PORT")
 	viper.BindEnv("server.host", "HOST")
+	viper.BindEnv("server.public_url", "PUBLIC_URL")
 
 	// Set defaults
 	viper.SetDefault("server.port", "8080")
@@ -123,6 +183,15 @@ func Load() (*Config, error) {
 	viper.SetDefault("database.host", "localhost")
 	viper.SetDefault("jwt.expiry", "24h")
 	viper.SetDefault("jwt.refresh_token_expiry", "7d")
+	viper.SetDefault("storage.backend", "s3")
+	viper.SetDefault("storage.local_path", "./storage")
+	viper.SetDefault("storage.public_url", "http://localhost:8080")
+	viper.SetDefault("scanner.backend", "none")
+	viper.SetDefault("scanner.clamd_address", "tcp://127.0.0.1:3310")
+	viper.SetDefault("scanner.timeout", "2m")
+	viper.SetDefault("images.cwebp_path", "cwebp")
+	viper.SetDefault("images.webp_quality", 80)
+	viper.SetDefault("install.enabled", true)
 
 	if err := viper.ReadInConfig(); err != nil {
 		// Config file not found; ignore error if desired
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"vibing-backend/models"
+)
+
+// defaultCategories seed an empty taxonomy with the categories the marketplace launched with
+var defaultCategories = []models.Category{
+	{Slug: "libraries", Name: "Libraries & Frameworks", Names: map[string]string{"ko": "라이브러리 & 프레임워크"}, Icon: "Package"},
+	{Slug: "cli-tools", Name: "CLI Tools", Names: map[string]string{"ko": "CLI 도구"}, Icon: "Terminal"},
+	{Slug: "web-templates", Name: "Web Templates", Names: map[string]string{"ko": "웹 템플릿"}, Icon: "Globe"},
+	{Slug: "mobile", Name: "Mobile Apps", Names: map[string]string{"ko": "모바일 앱"}, Icon: "Smartphone"},
+	{Slug: "desktop", Name: "Desktop Apps", Names: map[string]string{"ko": "데스크톱 앱"}, Icon: "Monitor"},
+	{Slug: "design", Name: "Design Assets", Names: map[string]string{"ko": "디자인 에셋"}, Icon: "Palette"},
+	{Slug: "database", Name: "Database Tools", Names: map[string]string{"ko": "데이터베이스 도구"}, Icon: "Database"},
+	{Slug: "ai-ml", Name: "AI & Machine Learning", Names: map[string]string{"ko": "AI & 머신러닝"}, Icon: "Brain"},
+	{Slug: "security", Name: "Security Tools", Names: map[string]string{"ko": "보안 도구"}, Icon: "Shield"},
+}
+
+// seedCategories creates the default categories when the taxonomy is empty
+func seedCategories(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&models.Category{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	categories := make([]models.Category, len(defaultCategories))
+	for i, category := range defaultCategories {
+		category.SortOrder = i + 1
+		category.Active = true
+		categories[i] = category
+	}
+	return db.Create(&categories).Error
+}
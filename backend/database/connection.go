@@ -37,15 +37,55 @@ func Connect(cfg *config.Config) error {
 	return nil
 }
 
+// widenedChecks are check constraints that allow more values than they used to.
+// AutoMigrate only creates missing constraints, so these are dropped and recreated.
+var widenedChecks = []struct {
+	model      interface{}
+	constraint string
+}{
+	{&models.UploadSession{}, "chk_upload_sessions_status"},
+}
+
 // Migrate runs database migrations
 func Migrate() error {
+	for _, check := range widenedChecks {
+		if DB.Migrator().HasConstraint(check.model, check.constraint) {
+			if err := DB.Migrator().DropConstraint(check.model, check.constraint); err != nil {
+				return fmt.Errorf("failed to drop constraint %s: %w", check.constraint, err)
+			}
+		}
+	}
+
 	err := DB.AutoMigrate(
 		&models.User{},
+		&models.Category{},
+		&models.Tag{},
+		&models.TagAlias{},
 		&models.Product{},
 		&models.Purchase{},
 		&models.Conversation{},
 		&models.ChatMessage{},
 		&models.Review{},
+		&models.DownloadToken{},
+		&models.DownloadLog{},
+		&models.FileRetention{},
+		&models.UploadSession{},
+		&models.ProductFileEntry{},
+		&models.ScannedAsset{},
+		&models.SecretFinding{},
+		&models.ProductRelease{},
+		&models.ReleaseAsset{},
+		&models.ReleaseDelta{},
+		&models.ProductMedia{},
+		&models.OrphanedObject{},
+		&models.PersonalizedBuild{},
+		&models.AccessToken{},
+		&models.ProductRecommendation{},
+		&models.ProductViewDay{},
+		&models.TrendingSnapshot{},
+		&models.ProductEvent{},
+		&models.WishlistItem{},
+		&models.Notification{},
 	)
 
 	if err != nil {
@@ -55,6 +95,18 @@ func Migrate() error {
 	// Ensure file_urls and file_sizes are properly formatted as text arrays
 	log.Println("Database schema configured for text arrays")
 
+	if err := seedCategories(DB); err != nil {
+		return fmt.Errorf("failed to seed categories: %w", err)
+	}
+
+	if err := backfillTags(DB); err != nil {
+		return fmt.Errorf("failed to register product tags: %w", err)
+	}
+
+	if err := migrateProductSearch(DB); err != nil {
+		return fmt.Errorf("failed to set up product search: %w", err)
+	}
+
 	log.Println("Database migrations completed")
 	return nil
 }
\ No newline at end of file
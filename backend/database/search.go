@@ -0,0 +1,54 @@
+package database
+
+import "gorm.io/gorm"
+
+// productSearchStatements keep products.search_vector and products.search_document in sync
+// with the listing. The vector is weighted title > tags > author > description and uses the
+// 'simple' configuration so Korean words aren't stemmed away; search_document is a lowercased
+// copy of the same text for pg_trgm substring and similarity matching, which covers Korean
+// words with attached particles that don't match a lexeme.
+var productSearchStatements = []string{
+	`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+	`ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+	`ALTER TABLE products ADD COLUMN IF NOT EXISTS search_document text`,
+	`CREATE OR REPLACE FUNCTION products_search_update() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('simple', coalesce(NEW.title, '')), 'A') ||
+		setweight(to_tsvector('simple', coalesce(array_to_string(NEW.tags, ' '), '')), 'B') ||
+		setweight(to_tsvector('simple', coalesce(NEW.author, '')), 'C') ||
+		setweight(to_tsvector('simple', coalesce(NEW.description, '')), 'D');
+	NEW.search_document := lower(concat_ws(' ', NEW.title, array_to_string(NEW.tags, ' '), NEW.author, NEW.description));
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS products_search_update ON products`,
+	`CREATE TRIGGER products_search_update BEFORE INSERT OR UPDATE OF title, tags, author, description
+	ON products FOR EACH ROW EXECUTE FUNCTION products_search_update()`,
+	`CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector)`,
+	`CREATE INDEX IF NOT EXISTS idx_products_search_document ON products USING GIN (search_document gin_trgm_ops)`,
+	// Tag filters use array containment
+	`CREATE INDEX IF NOT EXISTS idx_products_tags ON products USING GIN (tags)`,
+	// Tag autocomplete matches slug and alias prefixes regardless of the collation
+	`CREATE INDEX IF NOT EXISTS idx_tags_slug_prefix ON tags (slug varchar_pattern_ops)`,
+	`CREATE INDEX IF NOT EXISTS idx_tag_aliases_alias_prefix ON tag_aliases (alias varchar_pattern_ops)`,
+	// Title and tag words of active products for "did you mean", refreshed by the scheduler
+	// so suggestions don't scan every product's vector
+	`CREATE MATERIALIZED VIEW IF NOT EXISTS search_lexicon AS
+	SELECT word, ndoc FROM ts_stat('SELECT search_vector FROM products WHERE status = ''active''', 'AB')`,
+	// Required to refresh the view concurrently
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_search_lexicon_word ON search_lexicon (word)`,
+	`CREATE INDEX IF NOT EXISTS idx_search_lexicon_word_trgm ON search_lexicon USING GIN (word gin_trgm_ops)`,
+	// Backfill rows created before the trigger existed
+	`UPDATE products SET title = title WHERE search_vector IS NULL`,
+}
+
+// migrateProductSearch sets up the full-text search column, trigger and indexes on products
+func migrateProductSearch(db *gorm.DB) error {
+	for _, statement := range productSearchStatements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
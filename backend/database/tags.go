@@ -0,0 +1,64 @@
+package database
+
+import (
+	"slices"
+
+	"gorm.io/gorm"
+	"vibing-backend/models"
+)
+
+// defaultTags seed the registry with common tags whose spellings differ by more than case
+// and separators, which TagKey already folds together
+var defaultTags = []struct {
+	Name    string
+	Aliases []string
+}{
+	{"Go", []string{"golang"}},
+	{"JavaScript", []string{"js"}},
+	{"TypeScript", []string{"ts"}},
+	{"Python", []string{"py", "python3"}},
+	{"Kubernetes", []string{"k8s"}},
+	{"PostgreSQL", []string{"postgres", "psql"}},
+	{"Node.js", []string{"node", "nodejs"}},
+}
+
+// backfillTags seeds the tag registry the first time it's created, registers the tags of
+// existing products and rewrites them to canonical slugs
+func backfillTags(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&models.Tag{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	for _, seed := range defaultTags {
+		tag := models.Tag{Slug: models.TagSlug(seed.Name), Name: seed.Name}
+		if err := db.Create(&tag).Error; err != nil {
+			return err
+		}
+		for _, alias := range append([]string{tag.Slug}, seed.Aliases...) {
+			if err := models.AddTagAlias(db, tag.ID, alias); err != nil {
+				return err
+			}
+		}
+	}
+
+	var products []models.Product
+	if err := db.Unscoped().Select("id", "tags").Where("cardinality(tags) > 0").Find(&products).Error; err != nil {
+		return err
+	}
+	for _, product := range products {
+		tags, err := models.NormalizeTags(db, product.Tags)
+		if err != nil {
+			return err
+		}
+		if !slices.Equal(tags, product.Tags) {
+			if err := db.Unscoped().Model(&product).UpdateColumn("tags", tags).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return models.RefreshTagUsage(db, nil)
+}
@@ -1,11 +1,19 @@
 package handlers
 
 import (
-	"strconv"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 	"vibing-backend/database"
 	"vibing-backend/models"
+	"vibing-backend/pagination"
+	"vibing-backend/services"
 )
 
 type UpdateUserRoleRequest struct {
@@ -48,13 +56,13 @@ func GetAdminStats(c *fiber.Ctx) error {
 
 // GetUsers returns paginated users list for admin
 func GetUsers(c *fiber.Ctx) error {
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	params, err := pagination.Parse(c, 20)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
 	role := c.Query("role", "")
 	search := c.Query("search", "")
 
-	offset := (page - 1) * limit
-
 	query := database.DB.Model(&models.User{})
 
 	if role != "" {
@@ -66,10 +74,12 @@ func GetUsers(c *fiber.Ctx) error {
 	}
 
 	var users []models.User
-	var total int64
 
-	query.Count(&total)
-	query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&users)
+	total := params.Count(query)
+	userKeyset.Apply(query, params).Find(&users)
+	users, meta := pagination.Trim(params, users, total, func(user models.User) (time.Time, string) {
+		return user.CreatedAt, user.ID
+	})
 
 	// Format response to exclude sensitive data
 	var userData []fiber.Map
@@ -85,16 +95,14 @@ func GetUsers(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
-		"users": userData,
-		"pagination": fiber.Map{
-			"currentPage":  page,
-			"totalPages":   (total + int64(limit) - 1) / int64(limit),
-			"totalItems":   total,
-			"itemsPerPage": limit,
-		},
+		"users":      userData,
+		"pagination": meta,
 	})
 }
 
+// userKeyset pages users newest first
+var userKeyset = pagination.Keyset{TimeColumn: "created_at", IDColumn: "id", Desc: true}
+
 // UpdateUserRole updates user role (admin only)
 func UpdateUserRole(c *fiber.Ctx) error {
 	userID := c.Params("id")
@@ -181,13 +189,13 @@ func DeleteUser(c *fiber.Ctx) error {
 
 // GetAdminProducts returns all products for admin review
 func GetAdminProducts(c *fiber.Ctx) error {
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	params, err := pagination.Parse(c, 20)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
 	status := c.Query("status", "")
 	category := c.Query("category", "")
 
-	offset := (page - 1) * limit
-
 	query := database.DB.Model(&models.Product{})
 
 	if status != "" {
@@ -199,23 +207,14 @@ func GetAdminProducts(c *fiber.Ctx) error {
 	}
 
 	var products []models.Product
-	var total int64
 
-	query.Count(&total)
-	query.Preload("AuthorUser").
-		Offset(offset).
-		Limit(limit).
-		Order("created_at DESC").
-		Find(&products)
+	total := params.Count(query)
+	newestProducts.Apply(query, params).Preload("AuthorUser").Find(&products)
+	products, meta := pagination.Trim(params, products, total, productKey)
 
 	return c.JSON(fiber.Map{
-		"products": products,
-		"pagination": fiber.Map{
-			"currentPage":  page,
-			"totalPages":   (total + int64(limit) - 1) / int64(limit),
-			"totalItems":   total,
-			"itemsPerPage": limit,
-		},
+		"products":   products,
+		"pagination": meta,
 	})
 }
 
@@ -243,8 +242,19 @@ func UpdateProductStatus(c *fiber.Ctx) error {
 		})
 	}
 
-	// Update product status
+	// Leaked credentials must be acknowledged by the seller or removed before publishing
+	if req.Status == "active" && product.HasPendingSecretReview() {
+		return c.Status(409).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "SECRETS_PENDING",
+				"message": "The seller must acknowledge the credential findings or upload a cleaned archive first",
+			},
+		})
+	}
+
+	// Update product status; the admin's decision replaces whatever the secret review would restore
 	product.Status = req.Status
+	product.StatusBeforeSecretReview = ""
 	if err := database.DB.Save(&product).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": fiber.Map{
@@ -254,6 +264,12 @@ func UpdateProductStatus(c *fiber.Ctx) error {
 		})
 	}
 
+	if product.Status == "deleted" {
+		if err := models.RetireProductFiles(database.DB, &product, "product_deleted"); err != nil {
+			log.Printf("Failed to retire files for deleted product %s: %v", product.ID, err)
+		}
+	}
+
 	return c.JSON(fiber.Map{
 		"message": "Product status updated successfully",
 		"product": fiber.Map{
@@ -263,37 +279,231 @@ func UpdateProductStatus(c *fiber.Ctx) error {
 	})
 }
 
+// GetOrphanedObjects reconciles storage against the database in dry-run mode and
+// reports unreferenced objects with per-prefix metrics, plus the last scheduled run
+func GetOrphanedObjects(c *fiber.Ctx) error {
+	store := services.DefaultObjectStore()
+	if store == nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "SERVICE_ERROR",
+				"message": "Storage service not available",
+			},
+		})
+	}
+
+	report, err := services.ReconcileObjects(store, true)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to reconcile storage",
+			},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"report":      report,
+		"lastRun":     services.LastOrphanReport(),
+		"gracePeriod": services.OrphanGracePeriod.String(),
+	})
+}
+
+// TraceBuild identifies the purchase behind a leaked copy of a personalized build. The
+// build is looked up by ?fingerprint= or ?sha256=, or from a multipart "file" upload of
+// the leaked archive, whose comment and LICENSE.vibing carry the fingerprint.
+func TraceBuild(c *fiber.Ctx) error {
+	fingerprint := models.NormalizeBuildFingerprint(c.Query("fingerprint"))
+	checksum := strings.ToLower(strings.TrimSpace(c.Query("sha256")))
+
+	if file, err := c.FormFile("file"); err == nil {
+		src, err := file.Open()
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    "VALIDATION_ERROR",
+					"message": "Failed to read uploaded archive",
+				},
+			})
+		}
+		defer src.Close()
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, src); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    "VALIDATION_ERROR",
+					"message": "Failed to read uploaded archive",
+				},
+			})
+		}
+		checksum = hex.EncodeToString(hash.Sum(nil))
+
+		// A repacked copy no longer matches the checksum but may still carry the fingerprint
+		if found, err := services.ReadBuildFingerprint(src, file.Size); err == nil && found != "" {
+			fingerprint = found
+		}
+	}
+
+	if fingerprint == "" && checksum == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "Provide a fingerprint, a sha256 checksum or the archive file",
+			},
+		})
+	}
+
+	query := database.DB.Where("fingerprint = ?", fingerprint)
+	if checksum != "" {
+		query = query.Or("sha256 = ?", checksum)
+	}
+
+	var builds []models.PersonalizedBuild
+	query.Preload("Purchase.User").
+		Preload("Purchase.Product", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped()
+		}).
+		Find(&builds)
+
+	if len(builds) == 0 {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "No personalized build matches",
+			},
+		})
+	}
+
+	var matches []fiber.Map
+	for _, build := range builds {
+		var downloads []models.DownloadLog
+		database.DB.Where("purchase_id = ?", build.PurchaseID).
+			Order("created_at DESC").
+			Limit(20).
+			Find(&downloads)
+
+		purchase := build.Purchase
+		matches = append(matches, fiber.Map{
+			"build":           build,
+			"matchedBy":       traceMatch(&build, fingerprint, checksum),
+			"orderId":         purchase.OrderID,
+			"purchaseDate":    purchase.CreatedAt,
+			"purchaseStatus":  purchase.Status,
+			"buyer":           purchase.User.Public(),
+			"product":         fiber.Map{"id": purchase.Product.ID, "title": purchase.Product.Title},
+			"recentDownloads": downloads,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"fingerprint": fingerprint,
+		"sha256":      checksum,
+		"matches":     matches,
+	})
+}
+
+// traceMatch reports whether a traced build matched on its fingerprint, its exact bytes, or both
+func traceMatch(build *models.PersonalizedBuild, fingerprint, checksum string) string {
+	switch {
+	case build.Fingerprint == fingerprint && build.SHA256 == checksum:
+		return "fingerprint+sha256"
+	case build.Fingerprint == fingerprint:
+		return "fingerprint"
+	default:
+		return "sha256"
+	}
+}
+
 // GetAdminSales returns platform sales data for admin
 func GetAdminSales(c *fiber.Ctx) error {
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	limit, _ := strconv.Atoi(c.Query("limit", "20"))
-
-	offset := (page - 1) * limit
+	params, err := pagination.Parse(c, 20)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
 
 	var purchases []models.Purchase
-	var total int64
 
 	// Count total completed sales
-	database.DB.Model(&models.Purchase{}).
-		Where("status = ?", "completed").
-		Count(&total)
+	total := params.Count(database.DB.Model(&models.Purchase{}).
+		Where("status = ?", "completed"))
 
 	// Get paginated sales with product and user details
-	database.DB.Where("status = ?", "completed").
+	purchaseKeyset.Apply(database.DB.Where("status = ?", "completed"), params).
 		Preload("Product").
 		Preload("User").
-		Order("created_at DESC").
-		Limit(limit).
-		Offset(offset).
 		Find(&purchases)
+	purchases, meta := pagination.Trim(params, purchases, total, purchaseKey)
 
 	return c.JSON(fiber.Map{
-		"sales": purchases,
-		"pagination": fiber.Map{
-			"currentPage":  page,
-			"totalPages":   (total + int64(limit) - 1) / int64(limit),
-			"totalItems":   total,
-			"itemsPerPage": limit,
-		},
+		"sales":      purchases,
+		"pagination": meta,
+	})
+}
+
+// GetInfectedFiles returns uploads flagged by the malware scanner, plus scans that failed permanently
+func GetInfectedFiles(c *fiber.Ctx) error {
+	params, err := pagination.Parse(c, 20)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
+	status := c.Query("status", "infected")
+
+	statuses := []string{"infected", "error"}
+	if status == "infected" || status == "error" {
+		statuses = []string{status}
+	}
+
+	var assets []models.ScannedAsset
+
+	total := params.Count(database.DB.Model(&models.ScannedAsset{}).
+		Where("status IN ?", statuses))
+
+	scannedAssetKeyset.Apply(database.DB.Where("status IN ?", statuses), params).
+		Preload("Product").
+		Preload("Uploader").
+		Find(&assets)
+	assets, meta := pagination.Trim(params, assets, total, func(asset models.ScannedAsset) (time.Time, string) {
+		return asset.UpdatedAt, asset.ID
+	})
+
+	return c.JSON(fiber.Map{
+		"files":      assets,
+		"pagination": meta,
 	})
-}
\ No newline at end of file
+}
+
+// scannedAssetKeyset pages scan results by their last status change
+var scannedAssetKeyset = pagination.Keyset{TimeColumn: "updated_at", IDColumn: "id", Desc: true}
+
+// RescanFile puts a scanned upload back into the scan queue
+func RescanFile(c *fiber.Ctx) error {
+	var asset models.ScannedAsset
+	if err := database.DB.Where("id = ?", c.Params("id")).First(&asset).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "File not found",
+			},
+		})
+	}
+
+	if err := models.QuarantineAsset(database.DB, asset.ObjectKey, asset.Kind, asset.ProductID, asset.UploaderID); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to queue file for scanning",
+			},
+		})
+	}
+	if asset.ProductID != nil {
+		database.DB.Model(&models.Product{}).
+			Where("id = ? AND file_key = ?", *asset.ProductID, asset.ObjectKey).
+			Updates(map[string]interface{}{"scan_status": "quarantined", "scan_error": ""})
+	}
+	services.WakeScanWorker()
+
+	return c.JSON(fiber.Map{
+		"message": "File queued for scanning",
+	})
+}
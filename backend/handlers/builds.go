@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"time"
+
+	"vibing-backend/database"
+	"vibing-backend/models"
+	"vibing-backend/services"
+)
+
+// errBuildFailed is returned once after the build worker gave up on a buyer's copy;
+// the next download requests it again
+var errBuildFailed = errors.New("personalized build failed")
+
+// personalizedBuild returns the buyer's cached copy of an archive of the product (its
+// current file or a release) with the license file embedded. When there is no cached copy
+// for the archive and license, it requests one from the build worker and returns nil.
+// Purchase must have its Product loaded.
+func personalizedBuild(purchase *models.Purchase, sourceKey string) (*models.PersonalizedBuild, error) {
+	product := &purchase.Product
+	key := fmt.Sprintf("%s/%s/%s", models.PersonalizedBuildFolder, purchase.ID, path.Base(sourceKey))
+
+	build, err := models.FindOrCreatePersonalizedBuild(database.DB, purchase, sourceKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	licenseKey := ""
+	if purchase.LicenseKey != nil {
+		licenseKey = *purchase.LicenseKey
+	}
+
+	if build.IsCached(licenseKey, product.BuildWatermark) {
+		if _, err := objectStore.Stat(build.ObjectKey); err == nil {
+			database.DB.Model(build).Update("last_used_at", time.Now())
+			return build, nil
+		}
+		log.Printf("Cached build %s of purchase %s is missing, rebuilding", build.ObjectKey, purchase.ID)
+	}
+
+	if build.BuildFailed() {
+		log.Printf("Personalized build %s of purchase %s failed: %s", build.ID, purchase.ID, build.BuildError)
+		database.DB.Model(build).Update("build_error", "")
+		return nil, errBuildFailed
+	}
+
+	if err := models.RequestPersonalizedBuild(database.DB, build); err != nil {
+		return nil, err
+	}
+	services.WakeBuildWorker()
+	return nil, nil
+}
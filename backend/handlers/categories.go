@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"vibing-backend/database"
+	"vibing-backend/models"
+	"vibing-backend/utils"
+)
+
+// GetCategories returns the active categories with product counts, parents before their
+// subcategories. Counts include subcategories. Names are localized with ?lang= or the
+// Accept-Language header.
+func GetCategories(c *fiber.Ctx) error {
+	tree, err := models.LoadCategoryTree(database.DB)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to fetch categories",
+			},
+		})
+	}
+
+	counts, err := models.CountProductsByCategory(database.DB)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to count products",
+			},
+		})
+	}
+
+	lang := requestLanguage(c)
+
+	var totalCount int64
+	for _, count := range counts {
+		totalCount += count
+	}
+	categories := []fiber.Map{
+		{"id": "all", "name": "All Categories", "count": totalCount},
+	}
+
+	for _, category := range tree.Categories {
+		if !tree.IsVisible(category.Slug) {
+			continue
+		}
+
+		var count int64
+		for _, slug := range tree.Subtree(category.Slug) {
+			count += counts[slug]
+		}
+
+		parent := ""
+		if p := tree.Parent(category); p != nil {
+			parent = p.Slug
+		}
+
+		categories = append(categories, fiber.Map{
+			"id":        category.Slug,
+			"name":      category.LocalizedName(lang),
+			"names":     category.Names,
+			"parent":    parent,
+			"icon":      category.Icon,
+			"sortOrder": category.SortOrder,
+			"count":     count,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"categories": categories,
+	})
+}
+
+// invalidCategory is returned when a product names a category that doesn't exist or is inactive
+func invalidCategory(c *fiber.Ctx) error {
+	return c.Status(400).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "VALIDATION_ERROR",
+			"message": "Validation failed",
+			"details": []map[string]string{
+				{"field": "Category", "message": "Category is not an active category"},
+			},
+		},
+	})
+}
+
+// requestLanguage returns the primary language code requested with ?lang= or Accept-Language
+func requestLanguage(c *fiber.Ctx) string {
+	lang := c.Query("lang")
+	if lang == "" {
+		lang = c.Get(fiber.HeaderAcceptLanguage)
+	}
+	lang, _, _ = strings.Cut(lang, ",")
+	lang, _, _ = strings.Cut(lang, ";")
+	lang, _, _ = strings.Cut(lang, "-")
+	return strings.ToLower(strings.TrimSpace(lang))
+}
+
+// categoryRequest is the body of category create and update requests
+type categoryRequest struct {
+	Slug      string            `json:"slug" validate:"required,max=50"`
+	Name      string            `json:"name" validate:"required,min=1,max=100"`
+	Names     map[string]string `json:"names"`
+	Parent    string            `json:"parent"`
+	SortOrder int               `json:"sortOrder"`
+	Icon      string            `json:"icon" validate:"max=50"`
+	Active    *bool             `json:"active"`
+}
+
+// GetAdminCategories returns every category, including inactive ones (admin only)
+func GetAdminCategories(c *fiber.Ctx) error {
+	tree, err := models.LoadCategoryTree(database.DB)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to fetch categories",
+			},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"categories": tree.Categories,
+	})
+}
+
+// CreateCategory adds a category to the taxonomy (admin only)
+func CreateCategory(c *fiber.Ctx) error {
+	var req categoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "Invalid request body",
+			},
+		})
+	}
+
+	tree, err := models.LoadCategoryTree(database.DB)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to fetch categories",
+			},
+		})
+	}
+
+	category := models.Category{Active: true}
+	if err := applyCategoryRequest(tree, &category, req); err != nil {
+		return categoryRejected(c, err)
+	}
+
+	if err := database.DB.Create(&category).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to create category",
+			},
+		})
+	}
+
+	return c.Status(201).JSON(category)
+}
+
+// UpdateCategory changes a category (admin only). Renaming the slug moves its products along.
+func UpdateCategory(c *fiber.Ctx) error {
+	var category models.Category
+	if err := database.DB.Where("id = ?", c.Params("id")).First(&category).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Category not found",
+			},
+		})
+	}
+
+	var req categoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "Invalid request body",
+			},
+		})
+	}
+
+	tree, err := models.LoadCategoryTree(database.DB)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to fetch categories",
+			},
+		})
+	}
+
+	oldSlug := category.Slug
+	if err := applyCategoryRequest(tree, &category, req); err != nil {
+		return categoryRejected(c, err)
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&category).Error; err != nil {
+			return err
+		}
+		if category.Slug != oldSlug {
+			return tx.Unscoped().Model(&models.Product{}).Where("category = ?", oldSlug).
+				Update("category", category.Slug).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to update category",
+			},
+		})
+	}
+
+	return c.JSON(category)
+}
+
+// DeleteCategory removes a category without products or subcategories (admin only).
+// Categories in use can be deactivated instead.
+func DeleteCategory(c *fiber.Ctx) error {
+	var category models.Category
+	if err := database.DB.Where("id = ?", c.Params("id")).First(&category).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Category not found",
+			},
+		})
+	}
+
+	// Soft-deleted products still reference the slug, as in UpdateCategory
+	var products, children int64
+	if err := database.DB.Unscoped().Model(&models.Product{}).Where("category = ?", category.Slug).Count(&products).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to delete category",
+			},
+		})
+	}
+	if err := database.DB.Model(&models.Category{}).Where("parent_id = ?", category.ID).Count(&children).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to delete category",
+			},
+		})
+	}
+	if products > 0 || children > 0 {
+		return c.Status(409).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "CATEGORY_IN_USE",
+				"message": "Category has products or subcategories; deactivate it instead",
+			},
+		})
+	}
+
+	if err := database.DB.Delete(&category).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to delete category",
+			},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Category deleted successfully",
+	})
+}
+
+var errCategorySlugTaken = errors.New("another category already uses this slug")
+
+// categoryValidationError carries the field errors of a category request
+type categoryValidationError struct {
+	details []map[string]string
+}
+
+func (e *categoryValidationError) Error() string {
+	return "Validation failed"
+}
+
+// categoryRejected responds to an error from applyCategoryRequest
+func categoryRejected(c *fiber.Ctx, err error) error {
+	if err == errCategorySlugTaken {
+		return c.Status(409).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "SLUG_TAKEN",
+				"message": "Another category already uses this slug",
+			},
+		})
+	}
+
+	var validationErr *categoryValidationError
+	if errors.As(err, &validationErr) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": validationErr.Error(),
+				"details": validationErr.details,
+			},
+		})
+	}
+
+	return c.Status(400).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "VALIDATION_ERROR",
+			"message": err.Error(),
+		},
+	})
+}
+
+// applyCategoryRequest validates a create or update request against the taxonomy and copies
+// it onto category
+func applyCategoryRequest(tree *models.CategoryTree, category *models.Category, req categoryRequest) error {
+	req.Slug = strings.ToLower(strings.TrimSpace(req.Slug))
+	req.Name = strings.TrimSpace(req.Name)
+
+	if validationErrors := utils.ValidateStruct(req); len(validationErrors) > 0 {
+		return &categoryValidationError{details: validationErrors}
+	}
+
+	// "all" is the catch-all entry of the public category list
+	if !models.CategorySlugPattern.MatchString(req.Slug) || req.Slug == "all" {
+		return errors.New("Slug must be lowercase letters, digits and single dashes")
+	}
+	if existing := tree.Get(req.Slug); existing != nil && existing.ID != category.ID {
+		return errCategorySlugTaken
+	}
+
+	category.ParentID = nil
+	if req.Parent != "" {
+		parent := tree.Get(req.Parent)
+		if parent == nil {
+			return errors.New("Parent category not found")
+		}
+		// A category can't be moved below itself
+		if category.ID != "" && tree.IsDescendant(parent.Slug, category.Slug) {
+			return errors.New("A category can't be its own ancestor")
+		}
+		category.ParentID = &parent.ID
+	}
+
+	for lang, name := range req.Names {
+		if strings.TrimSpace(name) == "" {
+			delete(req.Names, lang)
+		}
+	}
+
+	category.Slug = req.Slug
+	category.Name = req.Name
+	category.Names = req.Names
+	category.SortOrder = req.SortOrder
+	category.Icon = req.Icon
+	if req.Active != nil {
+		category.Active = *req.Active
+	}
+	return nil
+}
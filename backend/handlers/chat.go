@@ -1,14 +1,18 @@
 package handlers
 
 import (
-	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 	"vibing-backend/database"
 	"vibing-backend/models"
+	"vibing-backend/pagination"
 )
 
+// chatImageURLExpiry is how long presigned chat image URLs stay valid; they are re-signed on every read
+const chatImageURLExpiry = 24 * time.Hour
+
 type CreateConversationRequest struct {
 	SellerID    string  `json:"sellerId" validate:"required"`
 	SellerName  string  `json:"sellerName" validate:"required"`
@@ -27,28 +31,26 @@ type SendImageRequest struct {
 // GetConversations returns user's conversations
 func GetConversations(c *fiber.Ctx) error {
 	user := c.Locals("user").(*models.User)
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	limit, _ := strconv.Atoi(c.Query("limit", "20"))
-
-	offset := (page - 1) * limit
+	params, err := pagination.Parse(c, 20)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
 
 	var conversations []models.Conversation
-	var total int64
 
 	// Count total conversations where user is either buyer or seller
-	database.DB.Model(&models.Conversation{}).
-		Where("buyer_id = ? OR seller_id = ?", user.ID, user.ID).
-		Count(&total)
+	total := params.Count(database.DB.Model(&models.Conversation{}).
+		Where("buyer_id = ? OR seller_id = ?", user.ID, user.ID))
 
-	// Get conversations with recent messages
-	database.DB.Where("buyer_id = ? OR seller_id = ?", user.ID, user.ID).
+	// Get conversations with recent messages, most recently active first
+	conversationKeyset.Apply(database.DB.Where("buyer_id = ? OR seller_id = ?", user.ID, user.ID), params).
 		Preload("Messages", func(db *gorm.DB) *gorm.DB {
 			return db.Order("created_at DESC").Limit(1)
 		}).
-		Order("updated_at DESC").
-		Limit(limit).
-		Offset(offset).
 		Find(&conversations)
+	conversations, meta := pagination.Trim(params, conversations, total, func(conv models.Conversation) (time.Time, string) {
+		return conv.UpdatedAt, conv.ID
+	})
 
 	// Format response
 	var conversationData []fiber.Map
@@ -80,15 +82,14 @@ func GetConversations(c *fiber.Ctx) error {
 
 	return c.JSON(fiber.Map{
 		"conversations": conversationData,
-		"pagination": fiber.Map{
-			"currentPage":  page,
-			"totalPages":   (total + int64(limit) - 1) / int64(limit),
-			"totalItems":   total,
-			"itemsPerPage": limit,
-		},
+		"pagination":    meta,
 	})
 }
 
+// conversationKeyset pages conversations by their last activity. A conversation that gets a
+// new message while a client pages through the list moves to the front and isn't repeated.
+var conversationKeyset = pagination.Keyset{TimeColumn: "updated_at", IDColumn: "id", Desc: true}
+
 // CreateConversation starts a new conversation
 func CreateConversation(c *fiber.Ctx) error {
 	user := c.Locals("user").(*models.User)
@@ -159,8 +160,10 @@ func CreateConversation(c *fiber.Ctx) error {
 func GetMessages(c *fiber.Ctx) error {
 	user := c.Locals("user").(*models.User)
 	conversationID := c.Params("id")
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	params, err := pagination.Parse(c, 50)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
 
 	// Check if user can access this conversation
 	var conversation models.Conversation
@@ -182,32 +185,29 @@ func GetMessages(c *fiber.Ctx) error {
 		})
 	}
 
-	offset := (page - 1) * limit
-
 	var messages []models.ChatMessage
-	var total int64
 
-	database.DB.Model(&models.ChatMessage{}).
-		Where("conversation_id = ?", conversationID).
-		Count(&total)
+	total := params.Count(database.DB.Model(&models.ChatMessage{}).
+		Where("conversation_id = ?", conversationID))
 
-	database.DB.Where("conversation_id = ?", conversationID).
-		Order("created_at ASC").
-		Limit(limit).
-		Offset(offset).
+	messageKeyset.Apply(database.DB.Where("conversation_id = ?", conversationID), params).
 		Find(&messages)
+	messages, meta := pagination.Trim(params, messages, total, func(message models.ChatMessage) (time.Time, string) {
+		return message.CreatedAt, message.ID
+	})
+
+	presignChatImages(messages)
+	models.MaskUnscannedImages(database.DB, messages, user.ID)
 
 	return c.JSON(fiber.Map{
-		"messages": messages,
-		"pagination": fiber.Map{
-			"currentPage":  page,
-			"totalPages":   (total + int64(limit) - 1) / int64(limit),
-			"totalItems":   total,
-			"itemsPerPage": limit,
-		},
+		"messages":   messages,
+		"pagination": meta,
 	})
 }
 
+// messageKeyset pages messages oldest first
+var messageKeyset = pagination.Keyset{TimeColumn: "created_at", IDColumn: "id"}
+
 // SendMessage sends a message in conversation
 func SendMessage(c *fiber.Ctx) error {
 	user := c.Locals("user").(*models.User)
@@ -311,6 +311,31 @@ func SendImage(c *fiber.Ctx) error {
 		})
 	}
 
+	// Only images uploaded by the sender through the chat image endpoint can be sent,
+	// so every image goes through the malware scan
+	imageKey := ""
+	if objectStore != nil {
+		imageKey = objectStore.KeyFromURL(req.ImageURL)
+	}
+	var asset models.ScannedAsset
+	if imageKey == "" || database.DB.Where("object_key = ? AND kind = ? AND uploader_id = ?",
+		imageKey, "chat_image", user.ID).First(&asset).Error != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "Image must be uploaded through the chat image upload first",
+			},
+		})
+	}
+	if asset.Status == "infected" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "FILE_INFECTED",
+				"message": "Image was flagged by the malware scan",
+			},
+		})
+	}
+
 	// Determine sender role
 	senderRole := "buyer"
 	if user.ID == conversation.SellerID {
@@ -318,7 +343,7 @@ func SendImage(c *fiber.Ctx) error {
 	}
 
 	// Create image message
-	message, err := conversation.AddImageMessage(database.DB, user.ID, user.Name, senderRole, req.ImageURL)
+	message, err := conversation.AddImageMessage(database.DB, user.ID, user.Name, senderRole, req.ImageURL, imageKey)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": fiber.Map{
@@ -328,8 +353,12 @@ func SendImage(c *fiber.Ctx) error {
 		})
 	}
 
+	messages := []models.ChatMessage{*message}
+	presignChatImages(messages)
+	models.MaskUnscannedImages(database.DB, messages, user.ID)
+
 	return c.Status(201).JSON(fiber.Map{
-		"message": message,
+		"message": messages[0],
 	})
 }
 
@@ -371,3 +400,17 @@ func MarkAsRead(c *fiber.Ctx) error {
 	})
 }
 
+// presignChatImages replaces stored chat image URLs, which expire, with freshly signed ones
+func presignChatImages(messages []models.ChatMessage) {
+	if objectStore == nil {
+		return
+	}
+	for i := range messages {
+		if messages[i].ImageKey == nil {
+			continue
+		}
+		if url, err := objectStore.Presign(*messages[i].ImageKey, chatImageURLExpiry); err == nil {
+			messages[i].ImageURL = &url
+		}
+	}
+}
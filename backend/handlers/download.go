@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"vibing-backend/database"
+	"vibing-backend/models"
+)
+
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// RedeemDownloadToken streams a purchased file for a single-use download token.
+// Ranged requests from the client that first redeemed the token are allowed until
+// one transfer reaches the end of the file, at which point the token is consumed
+// and the purchase download count is incremented.
+func RedeemDownloadToken(c *fiber.Ctx) error {
+	var token models.DownloadToken
+	if err := database.DB.Where("token_hash = ?", models.HashDownloadToken(c.Params("token"))).
+		Preload("Purchase.Product").First(&token).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Download link not found",
+			},
+		})
+	}
+
+	if !token.IsUsable() {
+		return c.Status(410).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "TOKEN_EXPIRED",
+				"message": "Download link has expired or was already used",
+			},
+		})
+	}
+
+	purchase := token.Purchase
+	if !purchase.CanDownload() {
+		return c.Status(403).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "FORBIDDEN",
+				"message": "Download not allowed",
+			},
+		})
+	}
+
+	// Files that haven't passed the malware scan are never served; personalized
+	// builds and patches inherit the scan result of the archive they produce
+	scannedKey := models.DeltaTargetKey(database.DB, models.BuildSourceKey(database.DB, token.ObjectKey))
+	if models.AssetScanStatus(database.DB, scannedKey) != "clean" {
+		return fileNotCleared(c)
+	}
+	if purchase.Product.HasPendingSecretReview() {
+		return secretReviewPending(c)
+	}
+
+	if objectStore == nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "SERVICE_ERROR",
+				"message": "File download service not available",
+			},
+		})
+	}
+
+	info, err := objectStore.Stat(token.ObjectKey)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "FILE_NOT_FOUND",
+				"message": "File not found",
+			},
+		})
+	}
+	size := info.Size
+
+	start, end, partial, err := parseByteRange(c.Get(fiber.HeaderRange), size)
+	if err != nil {
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+		return c.Status(416).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "RANGE_NOT_SATISFIABLE",
+				"message": "Requested range not satisfiable",
+			},
+		})
+	}
+
+	byteRange := ""
+	if partial {
+		byteRange = fmt.Sprintf("bytes=%d-%d", start, end)
+	}
+
+	// The first client to redeem the token owns it; resumes must come from that client
+	redeemed, err := token.Redeem(database.DB, c.IP(), c.Get(fiber.HeaderUserAgent))
+	if err != nil {
+		log.Printf("Failed to redeem download token %s: %v", token.ID, err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to redeem download link",
+			},
+		})
+	}
+	if !redeemed {
+		return c.Status(410).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "TOKEN_EXPIRED",
+				"message": "Download link has expired or was already used",
+			},
+		})
+	}
+
+	object, err := objectStore.Get(token.ObjectKey, byteRange)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to open file",
+			},
+		})
+	}
+
+	entry := models.DownloadLog{
+		PurchaseID:  purchase.ID,
+		UserID:      purchase.UserID,
+		TokenID:     token.ID,
+		ObjectKey:   token.ObjectKey,
+		IPAddress:   c.IP(),
+		UserAgent:   c.Get(fiber.HeaderUserAgent),
+		RangeHeader: c.Get(fiber.HeaderRange),
+		ObjectSize:  size,
+	}
+	if err := database.DB.Create(&entry).Error; err != nil {
+		log.Printf("Failed to create download log for purchase %s: %v", purchase.ID, err)
+	}
+
+	length := end - start + 1
+	reachesEnd := end == size-1
+	stream := &downloadStream{
+		body: object.Body,
+		onClose: func(served int64) {
+			finishDownload(&token, &purchase, &entry, served, reachesEnd && served == length)
+		},
+	}
+
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, path.Base(token.ObjectKey)))
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	if partial {
+		c.Status(206)
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	}
+
+	return c.SendStream(stream, int(length))
+}
+
+// finishDownload records the outcome of a transfer once the response body is closed.
+// token is nil for transfers that aren't redeemed through a download token.
+func finishDownload(token *models.DownloadToken, purchase *models.Purchase, entry *models.DownloadLog, served int64, completed bool) {
+	if completed {
+		consumed := true
+		if token != nil {
+			var err error
+			consumed, err = token.Consume(database.DB)
+			if err != nil {
+				log.Printf("Failed to consume download token %s: %v", token.ID, err)
+			}
+		}
+		if consumed {
+			if err := purchase.IncrementDownload(database.DB); err != nil {
+				log.Printf("Failed to increment download count for purchase %s: %v", purchase.ID, err)
+			}
+			trackDownloadEvent(purchase)
+		}
+	}
+
+	if entry.ID == "" {
+		return
+	}
+	if err := database.DB.Model(entry).Updates(map[string]interface{}{
+		"bytes_served": served,
+		"completed":    completed,
+		"finished_at":  time.Now(),
+	}).Error; err != nil {
+		log.Printf("Failed to update download log %s: %v", entry.ID, err)
+	}
+}
+
+// downloadStream counts bytes handed to the client and reports them on Close
+type downloadStream struct {
+	body    io.ReadCloser
+	served  int64
+	eof     bool
+	once    sync.Once
+	onClose func(served int64)
+}
+
+func (s *downloadStream) Read(p []byte) (int, error) {
+	n, err := s.body.Read(p)
+	s.served += int64(n)
+	if err == io.EOF {
+		s.eof = true
+	}
+	return n, err
+}
+
+func (s *downloadStream) Close() error {
+	err := s.body.Close()
+	s.once.Do(func() {
+		s.onClose(s.served)
+	})
+	return err
+}
+
+// parseByteRange parses a single-range HTTP Range header against an object size.
+// Multi-range and malformed headers fall back to the full object.
+func parseByteRange(header string, size int64) (int64, int64, bool, error) {
+	if header == "" || !strings.HasPrefix(header, "bytes=") || strings.Contains(header, ",") {
+		return 0, size - 1, false, nil
+	}
+
+	spec := strings.TrimSpace(strings.TrimPrefix(header, "bytes="))
+	dash := strings.Index(spec, "-")
+	if dash < 0 {
+		return 0, size - 1, false, nil
+	}
+	startStr, endStr := strings.TrimSpace(spec[:dash]), strings.TrimSpace(spec[dash+1:])
+
+	// Suffix range: last N bytes
+	if startStr == "" {
+		suffix, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || suffix <= 0 {
+			return 0, 0, false, errRangeNotSatisfiable
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, size - 1, true, nil
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false, errRangeNotSatisfiable
+	}
+
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false, errRangeNotSatisfiable
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+
+	return start, end, true, nil
+}
+
+// fileNotCleared is returned for products whose archive is still being scanned or was flagged
+func fileNotCleared(c *fiber.Ctx) error {
+	return c.Status(409).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "FILE_NOT_CLEARED",
+			"message": "This product's file has not passed the malware scan",
+		},
+	})
+}
+
+// secretReviewPending refuses the files of a product whose possible leaked credentials
+// still await the seller's review
+func secretReviewPending(c *fiber.Ctx) error {
+	return c.Status(409).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "SECRET_REVIEW_PENDING",
+			"message": "This product's file is on hold until the seller reviews possible leaked credentials",
+		},
+	})
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"vibing-backend/database"
+	"vibing-backend/models"
+	"vibing-backend/pagination"
+	"vibing-backend/services"
+)
+
+// visitorIDHeader carries the anonymous ID a client keeps for its visitor
+const visitorIDHeader = "X-Visitor-Id"
+
+var visitorIDPattern = regexp.MustCompile(`^[A-Za-z0-9-]{16,64}$`)
+
+// clientEventTypes are the events clients report themselves; the others are recorded
+// by the endpoints they happen at
+var clientEventTypes = map[string]bool{
+	models.EventDetailOpen: true,
+}
+
+// trackProductEvent records an event by the visitor of the request. Bots and the
+// product's own seller aren't counted, except for completed purchases, which are sales
+// whoever made them.
+func trackProductEvent(c *fiber.Ctx, product *models.Product, eventType string) {
+	sale := eventType == models.EventPurchaseComplete
+	if !sale && services.IsBot(c.Get(fiber.HeaderUserAgent)) {
+		return
+	}
+
+	event := models.ProductEvent{
+		ProductID: product.ID,
+		Type:      eventType,
+		Referrer:  c.Get(fiber.HeaderReferer),
+	}
+	if user, ok := c.Locals("user").(*models.User); ok {
+		if !sale && user.ID == product.AuthorID {
+			return
+		}
+		event.UserID = &user.ID
+		event.VisitorID = "user:" + user.ID
+	} else {
+		event.VisitorID = anonymousVisitorID(c)
+	}
+	services.TrackProductEvent(event)
+}
+
+// trackDownloadEvent records a completed download for the buyer. It runs after the
+// response was sent, so the event is built from the purchase instead of the request.
+func trackDownloadEvent(purchase *models.Purchase) {
+	if purchase.UserID == purchase.Product.AuthorID {
+		return
+	}
+	services.TrackProductEvent(models.ProductEvent{
+		ProductID: purchase.ProductID,
+		Type:      models.EventDownload,
+		UserID:    &purchase.UserID,
+		VisitorID: "user:" + purchase.UserID,
+	})
+}
+
+// anonymousVisitorID identifies a signed-out visitor by the ID their client sends, or
+// by a hash of their address and user agent when it sends none
+func anonymousVisitorID(c *fiber.Ctx) string {
+	if id := c.Get(visitorIDHeader); visitorIDPattern.MatchString(id) {
+		return "anon:" + id
+	}
+	sum := sha256.Sum256([]byte(c.IP() + "|" + c.Get(fiber.HeaderUserAgent)))
+	return "addr:" + hex.EncodeToString(sum[:16])
+}
+
+// TrackProductEvent records an event reported by the client
+func TrackProductEvent(c *fiber.Ctx) error {
+	var req struct {
+		Type string `json:"type"`
+	}
+	if err := c.BodyParser(&req); err != nil || !clientEventTypes[req.Type] {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "Unknown event type",
+			},
+		})
+	}
+
+	var product models.Product
+	if err := database.DB.Select("id", "author_id").
+		Where("id = ? AND status = ?", c.Params("id"), "active").First(&product).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Product not found",
+			},
+		})
+	}
+
+	trackProductEvent(c, &product, req.Type)
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// maxAnalyticsDays bounds the range of product analytics
+const maxAnalyticsDays = 180
+
+// GetProductAnalytics returns the daily event counts and unique visitors of a product
+// to its seller or an admin
+func GetProductAnalytics(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+	days, err := pagination.QueryInt(c, "days", 30, maxAnalyticsDays)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
+
+	var product models.Product
+	if err := database.DB.Select("id", "author_id", "views", "downloads").
+		First(&product, "id = ?", c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Product not found",
+			},
+		})
+	}
+	if product.AuthorID != user.ID && !user.IsAdmin() {
+		return c.Status(403).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "FORBIDDEN",
+				"message": "You can only view analytics of your own products",
+			},
+		})
+	}
+
+	var daily []struct {
+		Day      time.Time `json:"day"`
+		Type     string    `json:"type"`
+		Events   int64     `json:"events"`
+		Visitors int64     `json:"visitors"`
+	}
+	if err := database.DB.Model(&models.ProductEvent{}).
+		Select("date_trunc('day', created_at) AS day, type, count(*) AS events, count(DISTINCT visitor_id) AS visitors").
+		Where("product_id = ? AND created_at >= ?", product.ID, time.Now().AddDate(0, 0, -days)).
+		Group("day, type").Order("day, type").
+		Scan(&daily).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to fetch product analytics",
+			},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"productId": product.ID,
+		"views":     product.Views,
+		"downloads": product.Downloads,
+		"days":      days,
+		"daily":     daily,
+	})
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"vibing-backend/models"
+	"vibing-backend/services"
+)
+
+// ServeGoProxy implements the GOPROXY protocol for purchased Go modules:
+// <module>/@v/list, <module>/@v/<version>.info, .mod, .zip and <module>/@latest.
+// Errors are plain text because the go command prints the response body.
+func ServeGoProxy(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	request := c.Params("*")
+	var escapedModule, file string
+	if strings.HasSuffix(request, "/@latest") {
+		escapedModule, file = strings.TrimSuffix(request, "/@latest"), "@latest"
+	} else if i := strings.LastIndex(request, "/@v/"); i > 0 {
+		escapedModule, file = request[:i], request[i+len("/@v/"):]
+	} else {
+		return c.Status(404).SendString("not found")
+	}
+
+	modulePath, ok := services.UnescapeModulePath(escapedModule)
+	if !ok {
+		return c.Status(400).SendString("invalid escaped module path")
+	}
+
+	access, err := resolvePackage(user, "go_module", modulePath)
+	if err != nil {
+		return c.Status(500).SendString("failed to resolve module")
+	}
+	if access == nil {
+		return c.Status(404).SendString("module " + modulePath + " not found")
+	}
+	if !access.allowed {
+		return c.Status(403).SendString("no active purchase of module " + modulePath)
+	}
+	releases := goModuleVersions(modulePath, access.releases)
+	versions := make([]string, 0, len(releases))
+	for version := range releases {
+		versions = append(versions, version)
+	}
+
+	switch file {
+	case "list":
+		sort.Slice(versions, func(i, j int) bool {
+			return models.CompareVersions(versions[i], versions[j]) < 0
+		})
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		if len(versions) == 0 {
+			return c.SendString("")
+		}
+		return c.SendString(strings.Join(versions, "\n") + "\n")
+
+	case "@latest":
+		latest := latestVersion(versions)
+		if latest == "" {
+			return c.Status(404).SendString("module " + modulePath + " has no versions")
+		}
+		return goVersionInfo(c, latest, releases[latest])
+	}
+
+	dot := strings.LastIndex(file, ".")
+	if dot <= 0 {
+		return c.Status(404).SendString("not found")
+	}
+	version, ok := services.UnescapeModulePath(file[:dot])
+	if !ok {
+		return c.Status(400).SendString("invalid escaped version")
+	}
+	release, found := releases[version]
+	if !found {
+		return c.Status(404).SendString("module " + modulePath + "@" + version + " not found")
+	}
+
+	switch file[dot:] {
+	case ".info":
+		return goVersionInfo(c, version, release)
+	case ".mod":
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		return c.SendString(release.GoMod)
+	case ".zip":
+		return serveGoModuleZip(c, access.purchase, release, version)
+	}
+	return c.Status(404).SendString("not found")
+}
+
+// goModuleVersions maps the Go versions of a module's releases, such as v1.2.3, to the
+// releases. Releases whose major version doesn't match the module path are left out.
+func goModuleVersions(modulePath string, releases []models.ProductRelease) map[string]models.ProductRelease {
+	versions := make(map[string]models.ProductRelease, len(releases))
+	for _, release := range releases {
+		if version, compatible := services.ModuleVersion(modulePath, release.Version); compatible {
+			versions[version] = release
+		}
+	}
+	return versions
+}
+
+func goVersionInfo(c *fiber.Ctx, version string, release models.ProductRelease) error {
+	return c.JSON(fiber.Map{
+		"Version": version,
+		"Time":    release.CreatedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// serveGoModuleZip streams the module zip of a release. Fetches by buyers count as
+// downloads of their purchase.
+func serveGoModuleZip(c *fiber.Ctx, purchase *models.Purchase, release models.ProductRelease, version string) error {
+	if purchase != nil && !purchase.CanDownload() {
+		return c.Status(403).SendString("download limit reached or access expired")
+	}
+	if objectStore == nil {
+		return c.Status(500).SendString("file download service not available")
+	}
+
+	module := &services.GoModule{Path: release.GoModule, Dir: release.GoModuleDir}
+	body, err := services.OpenModuleZip(objectStore, release.ObjectKey, module, version)
+	if err != nil {
+		log.Printf("Failed to build module zip for %s@%s: %v", release.GoModule, version, err)
+		return c.Status(500).SendString("failed to build module zip")
+	}
+
+	stream := packageDownloadStream(c, purchase, release.ObjectKey, body, release.FileSize)
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	return c.SendStream(stream, -1)
+}
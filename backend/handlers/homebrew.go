@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"vibing-backend/database"
+	"vibing-backend/models"
+	"vibing-backend/services"
+)
+
+// ServeHomebrewFormula serves Formula/<command>.rb of the tap, built from the CLI tool's
+// latest release with clean platform assets
+func ServeHomebrewFormula(c *fiber.Ctx) error {
+	if publicURL == "" {
+		return publicURLMissing(c)
+	}
+	command := strings.TrimSuffix(c.Params("file"), ".rb")
+
+	product, err := cliProduct(database.DB.Where("cli_command = ?", command))
+	if err != nil {
+		return c.Status(404).SendString("formula " + command + " not found")
+	}
+	formula, err := productFormula(product)
+	if err != nil {
+		if err != errNoInstallAssets {
+			log.Printf("Failed to render formula for product %s: %v", product.ID, err)
+		}
+		return c.Status(404).SendString("formula " + command + " has no installable release")
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	return c.Send(formula)
+}
+
+// ServeHomebrewTap serves the tap repository as a tarball with a formula for every
+// CLI tool that has an installable release
+func ServeHomebrewTap(c *fiber.Ctx) error {
+	if publicURL == "" {
+		return publicURLMissing(c)
+	}
+	var products []models.Product
+	if err := database.DB.Where("status = ? AND category = ? AND cli_command <> ''", "active", "cli-tools").
+		Find(&products).Error; err != nil {
+		return c.Status(500).SendString("failed to load formulas")
+	}
+
+	formulas := make(map[string][]byte, len(products))
+	for i := range products {
+		formula, err := productFormula(&products[i])
+		if err != nil {
+			if err != errNoInstallAssets {
+				log.Printf("Failed to render formula for product %s: %v", products[i].ID, err)
+			}
+			continue
+		}
+		formulas[products[i].CLICommand] = formula
+	}
+
+	readme := fmt.Sprintf("# Vibing Homebrew tap\n\n"+
+		"Formulas for the CLI tools sold on Vibing, generated from their latest releases.\n\n"+
+		"    export HOMEBREW_VIBING_TOKEN=vbt_...\n"+
+		"    brew install %s/<command>\n\n"+
+		"Install or refresh it with:\n\n"+
+		"    mkdir -p \"$(brew --repository)/Library/Taps/vibing\"\n"+
+		"    curl -fsSL %s/brew/tap.tar.gz | tar -xz -C \"$(brew --repository)/Library/Taps/vibing\"\n",
+		services.HomebrewTapName, publicURL)
+
+	tap, err := services.BuildHomebrewTap(formulas, []byte(readme))
+	if err != nil {
+		return c.Status(500).SendString("failed to build tap")
+	}
+
+	c.Set(fiber.HeaderContentType, "application/gzip")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="homebrew-tap.tar.gz"`)
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	return c.Send(tap)
+}
+
+func productFormula(product *models.Product) ([]byte, error) {
+	release, assets, err := installRelease(product, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return services.RenderHomebrewFormula(&services.HomebrewFormula{
+		Title:       product.Title,
+		Command:     product.CLICommand,
+		Description: product.Title,
+		Homepage:    publicURL + "/api/products/" + product.ID,
+		Version:     release.Version,
+		Assets:      installAssets(product, release, assets),
+	})
+}
@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"vibing-backend/database"
+	"vibing-backend/models"
+	"vibing-backend/services"
+)
+
+var errNoInstallAssets = errors.New("no release with clean platform assets")
+
+// UploadReleaseAsset attaches a prebuilt per-platform file to a release of a CLI tool
+// (seller only). The latest release is used unless a version is given.
+func UploadReleaseAsset(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	var product models.Product
+	if err := database.DB.Where("id = ? AND author_id = ?", c.FormValue("productId"), user.ID).First(&product).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Product not found or access denied",
+			},
+		})
+	}
+	if product.Category != "cli-tools" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_A_CLI_TOOL",
+				"message": "Platform assets can only be uploaded for CLI tools",
+			},
+		})
+	}
+
+	platform := c.FormValue("platform")
+	if !models.IsAssetPlatform(platform) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "platform must be one of darwin-amd64, darwin-arm64, linux-amd64 or linux-arm64",
+			},
+		})
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "No file provided",
+			},
+		})
+	}
+
+	var release models.ProductRelease
+	query := database.DB.Where("product_id = ?", product.ID)
+	if version := c.FormValue("version"); version != "" {
+		normalized, err := models.NormalizeVersion(version)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    "VALIDATION_ERROR",
+					"message": err.Error(),
+				},
+			})
+		}
+		query = query.Where("version = ?", normalized)
+	}
+	if err := query.Order("created_at DESC").First(&release).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "RELEASE_NOT_FOUND",
+				"message": "Upload the release archive before its platform assets",
+			},
+		})
+	}
+
+	if objectStore == nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "SERVICE_ERROR",
+				"message": "File upload service not available",
+			},
+		})
+	}
+
+	if err := models.AssignCLICommand(database.DB, &product); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "DATABASE_ERROR",
+				"message": "Failed to assign a command name",
+			},
+		})
+	}
+
+	stored, err := services.UploadReleaseAsset(objectStore, file, product.ID, release.Version, platform, product.CLICommand)
+	if archiveErr, ok := err.(*services.ArchiveError); ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    archiveErr.Code,
+				"message": archiveErr.Message,
+			},
+		})
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "UPLOAD_ERROR",
+				"message": err.Error(),
+			},
+		})
+	}
+
+	// A replaced asset is left to the orphan sweep, so downloads in flight can finish
+	asset := models.ReleaseAsset{
+		ReleaseID: release.ID,
+		ProductID: product.ID,
+		Platform:  platform,
+		FileName:  file.Filename,
+		Format:    stored.Format,
+		Binary:    stored.Binary,
+		ObjectKey: stored.Key,
+		Size:      stored.Size,
+		SHA256:    stored.SHA256,
+	}
+	productID := product.ID
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("release_id = ? AND platform = ?", release.ID, platform).
+			Delete(&models.ReleaseAsset{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&asset).Error; err != nil {
+			return err
+		}
+		return models.QuarantineAsset(tx, stored.Key, "product_file", &productID, product.AuthorID)
+	})
+	if err != nil {
+		objectStore.Delete(stored.Key)
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "DATABASE_ERROR",
+				"message": "Failed to save release asset",
+			},
+		})
+	}
+
+	services.WakeScanWorker()
+	return c.JSON(fiber.Map{
+		"asset":      asset,
+		"version":    release.Version,
+		"command":    product.CLICommand,
+		"scanStatus": "quarantined",
+		"message":    "Release asset uploaded successfully",
+	})
+}
+
+// ServeInstallScript serves the signed install.sh of a CLI tool, built from its latest
+// release with clean platform assets, or from ?version=
+func ServeInstallScript(c *fiber.Ctx) error {
+	script, err := productInstallScript(c)
+	if err != nil {
+		return installScriptUnavailable(c, err)
+	}
+
+	c.Set("X-Vibing-Signature", base64.StdEncoding.EncodeToString(services.SignInstallScript(script)))
+	c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	return c.Send(script)
+}
+
+// ServeInstallSignature serves the raw Ed25519 signature of a CLI tool's install.sh
+func ServeInstallSignature(c *fiber.Ctx) error {
+	script, err := productInstallScript(c)
+	if err != nil {
+		return installScriptUnavailable(c, err)
+	}
+
+	c.Set(fiber.HeaderContentType, "application/octet-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	return c.Send(services.SignInstallScript(script))
+}
+
+// ServeInstallSigningKey serves the public key install scripts are signed with
+func ServeInstallSigningKey(c *fiber.Ctx) error {
+	key, err := services.InstallSigningKeyPEM()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to encode signing key",
+			},
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/x-pem-file")
+	return c.Send(key)
+}
+
+// DownloadReleaseAsset streams a platform asset to a buyer or the seller, authenticated
+// with a personal access token. Downloads count against the purchase.
+func DownloadReleaseAsset(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	access, err := productAccess(user, []string{c.Params("id")})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to check access",
+			},
+		})
+	}
+	if !access.allowed {
+		return c.Status(403).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "FORBIDDEN",
+				"message": "No active purchase of this product",
+			},
+		})
+	}
+
+	var release models.ProductRelease
+	if err := database.DB.Where("product_id = ? AND version = ?", access.product.ID, c.Params("version")).
+		First(&release).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "RELEASE_NOT_FOUND",
+				"message": "Release not found",
+			},
+		})
+	}
+	if !access.covers(&release) {
+		return c.Status(403).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "OUTSIDE_UPDATE_WINDOW",
+				"message": "This release was published after your update window ended",
+			},
+		})
+	}
+
+	var asset models.ReleaseAsset
+	if err := database.DB.Where("release_id = ? AND platform = ?", release.ID, c.Params("platform")).
+		First(&asset).Error; err != nil || c.Params("file") != asset.DownloadName(access.product.CLICommand) {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "FILE_NOT_FOUND",
+				"message": "No asset for this platform",
+			},
+		})
+	}
+	if models.AssetScanStatus(database.DB, asset.ObjectKey) != "clean" {
+		return fileNotCleared(c)
+	}
+	if access.purchase != nil && access.product.HasPendingSecretReview() {
+		return secretReviewPending(c)
+	}
+	if access.purchase != nil && !access.purchase.CanDownload() {
+		return c.Status(403).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "FORBIDDEN",
+				"message": "Download not allowed",
+			},
+		})
+	}
+
+	if objectStore == nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "SERVICE_ERROR",
+				"message": "File download service not available",
+			},
+		})
+	}
+	object, err := objectStore.Get(asset.ObjectKey, "")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to open file",
+			},
+		})
+	}
+
+	stream := packageDownloadStream(c, access.purchase, asset.ObjectKey, object.Body, asset.Size)
+
+	c.Set(fiber.HeaderContentType, "application/octet-stream")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, asset.DownloadName(access.product.CLICommand)))
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	return c.SendStream(stream, int(asset.Size))
+}
+
+// productInstallScript renders the install script of the product in the :id param
+func productInstallScript(c *fiber.Ctx) ([]byte, error) {
+	if publicURL == "" {
+		return nil, errNoPublicURL
+	}
+	product, err := cliProduct(database.DB.Where("id = ?", c.Params("id")))
+	if err != nil {
+		return nil, err
+	}
+	release, assets, err := installRelease(product, c.Query("version"))
+	if err != nil {
+		return nil, err
+	}
+
+	scriptURL := fmt.Sprintf("%s/install/%s/install.sh", publicURL, product.ID)
+	if c.Query("version") != "" {
+		scriptURL += "?version=" + release.Version
+	}
+	return services.RenderInstallScript(&services.InstallScript{
+		Title:     product.Title,
+		Command:   product.CLICommand,
+		Version:   release.Version,
+		ScriptURL: scriptURL,
+		KeyURL:    publicURL + "/install/signing-key.pem",
+		Assets:    installAssets(product, release, assets),
+	})
+}
+
+// cliProduct loads an active CLI tool that has a command name
+func cliProduct(query *gorm.DB) (*models.Product, error) {
+	var product models.Product
+	if err := query.Where("status = ? AND category = ? AND cli_command <> ''", "active", "cli-tools").
+		First(&product).Error; err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// installRelease picks the latest release of a CLI tool with clean platform assets, or the
+// given version, and returns it with those assets
+func installRelease(product *models.Product, version string) (*models.ProductRelease, []models.ReleaseAsset, error) {
+	query := database.DB.Where("product_id = ?", product.ID).Preload("Assets")
+	if version != "" {
+		normalized, err := models.NormalizeVersion(version)
+		if err != nil {
+			return nil, nil, errNoInstallAssets
+		}
+		query = query.Where("version = ?", normalized)
+	}
+
+	var releases []models.ProductRelease
+	if err := query.Order("created_at DESC").Find(&releases).Error; err != nil {
+		return nil, nil, err
+	}
+	for i := range releases {
+		var assets []models.ReleaseAsset
+		for _, asset := range releases[i].Assets {
+			if models.AssetScanStatus(database.DB, asset.ObjectKey) == "clean" {
+				assets = append(assets, asset)
+			}
+		}
+		if len(assets) > 0 {
+			return &releases[i], assets, nil
+		}
+	}
+	return nil, nil, errNoInstallAssets
+}
+
+func installAssets(product *models.Product, release *models.ProductRelease, assets []models.ReleaseAsset) []services.InstallAsset {
+	result := make([]services.InstallAsset, 0, len(assets))
+	for _, asset := range assets {
+		result = append(result, services.InstallAsset{
+			Platform: asset.Platform,
+			URL: fmt.Sprintf("%s/install/%s/%s/%s/%s", publicURL, product.ID, release.Version,
+				asset.Platform, asset.DownloadName(product.CLICommand)),
+			SHA256: asset.SHA256,
+			Format: asset.Format,
+			Binary: asset.Binary,
+		})
+	}
+	return result
+}
+
+func installScriptUnavailable(c *fiber.Ctx, err error) error {
+	if err == errNoPublicURL {
+		return publicURLMissing(c)
+	}
+	if err != gorm.ErrRecordNotFound && err != errNoInstallAssets {
+		log.Printf("Failed to render install script for product %s: %v", c.Params("id"), err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to render install script",
+			},
+		})
+	}
+
+	return c.Status(404).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "NOT_FOUND",
+			"message": "No installable release of this CLI tool",
+		},
+	})
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"vibing-backend/database"
+	"vibing-backend/models"
+	"vibing-backend/services"
+	"vibing-backend/utils"
+)
+
+type ReorderProductMediaRequest struct {
+	MediaIDs []string `json:"mediaIds" validate:"required,min=1,dive,required"`
+}
+
+// AddProductMedia adds an item to the product gallery (seller only). Multipart form fields:
+// type (image, video or asciinema), caption, altText, and either file (image, .cast
+// recording) or url (YouTube/Vimeo link, asciinema.org recording).
+func AddProductMedia(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	product := findOwnedProduct(c, user)
+	if product == nil {
+		return ownedProductNotFound(c)
+	}
+
+	mediaType := c.FormValue("type")
+	caption := c.FormValue("caption")
+	altText := c.FormValue("altText")
+	if len(caption) > 300 || len(altText) > 300 {
+		return mediaValidationError(c, "Caption and alt text must be at most 300 characters")
+	}
+
+	// Checked again when the item is saved; this only avoids processing uploads for a full gallery
+	count, err := models.CountProductMedia(database.DB, product.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "DATABASE_ERROR",
+				"message": "Failed to load gallery",
+			},
+		})
+	}
+	if count >= models.MaxProductMedia {
+		return mediaValidationError(c, "A product can have at most 20 gallery items")
+	}
+
+	if objectStore == nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "SERVICE_ERROR",
+				"message": "File upload service not available",
+			},
+		})
+	}
+
+	media := models.ProductMedia{
+		ProductID: product.ID,
+		Type:      mediaType,
+		Caption:   caption,
+		AltText:   altText,
+	}
+
+	switch mediaType {
+	case "image":
+		file, err := c.FormFile("file")
+		if err != nil {
+			return mediaValidationError(c, "No image file provided")
+		}
+		image, err := services.StoreImage(objectStore, file, services.PublicImageFolder,
+			services.ProductImageRenditions, webpEncoder)
+		if err != nil {
+			return imageUploadFailed(c, err)
+		}
+		media.URL = image.URL("detail")
+		media.ThumbnailURL = image.URL("thumb")
+		media.StorageKey = image.Prefix + "/"
+		media.Width, media.Height = image.Width, image.Height
+
+	case "video":
+		embed, err := services.ParseVideoEmbed(c.FormValue("url"))
+		if err != nil {
+			return mediaValidationError(c, err.Error())
+		}
+		media.URL, media.SourceURL, media.ThumbnailURL = embed.URL, embed.SourceURL, embed.ThumbnailURL
+
+	case "asciinema":
+		if file, err := c.FormFile("file"); err == nil {
+			cast, err := services.StoreCast(objectStore, file)
+			if _, ok := err.(*services.EmbedError); ok {
+				return mediaValidationError(c, err.Error())
+			}
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{
+					"error": fiber.Map{
+						"code":    "UPLOAD_ERROR",
+						"message": "Failed to store recording",
+					},
+				})
+			}
+			media.URL = services.MediaURL(cast.Key)
+			media.StorageKey = cast.Key
+			media.Width, media.Height = cast.Width, cast.Height
+		} else {
+			embed, err := services.ParseAsciinemaLink(c.FormValue("url"))
+			if err != nil {
+				return mediaValidationError(c, err.Error())
+			}
+			media.URL, media.SourceURL, media.ThumbnailURL = embed.URL, embed.SourceURL, embed.ThumbnailURL
+		}
+
+	default:
+		return mediaValidationError(c, "Type must be one of image, video, asciinema")
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := models.AppendProductMedia(tx, &media); err != nil {
+			return err
+		}
+		// The first gallery image doubles as the product's cover image
+		if media.Type == "image" && product.ImageURL == "" {
+			return tx.Model(product).Update("image_url", media.URL).Error
+		}
+		return nil
+	})
+	if err == models.ErrGalleryFull {
+		deleteMediaObjects(&media)
+		return mediaValidationError(c, "A product can have at most 20 gallery items")
+	}
+	if err != nil {
+		deleteMediaObjects(&media)
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "DATABASE_ERROR",
+				"message": "Failed to save gallery item",
+			},
+		})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"media": media,
+	})
+}
+
+// ReorderProductMedia sets the gallery order from the complete list of media IDs (seller only)
+func ReorderProductMedia(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	product := findOwnedProduct(c, user)
+	if product == nil {
+		return ownedProductNotFound(c)
+	}
+
+	var req ReorderProductMediaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return mediaValidationError(c, "Invalid request body")
+	}
+	if validationErrors := utils.ValidateStruct(req); len(validationErrors) > 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "Validation failed",
+				"details": validationErrors,
+			},
+		})
+	}
+
+	var existing []models.ProductMedia
+	database.DB.Select("id").Where("product_id = ?", product.ID).Find(&existing)
+
+	known := make(map[string]bool, len(existing))
+	for _, media := range existing {
+		known[media.ID] = true
+	}
+	seen := make(map[string]bool, len(req.MediaIDs))
+	for _, id := range req.MediaIDs {
+		if !known[id] || seen[id] {
+			return mediaValidationError(c, "mediaIds must list every gallery item of the product exactly once")
+		}
+		seen[id] = true
+	}
+	if len(seen) != len(known) {
+		return mediaValidationError(c, "mediaIds must list every gallery item of the product exactly once")
+	}
+
+	if err := models.ReorderProductMedia(database.DB, product.ID, req.MediaIDs); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "DATABASE_ERROR",
+				"message": "Failed to reorder gallery",
+			},
+		})
+	}
+
+	var media []models.ProductMedia
+	database.DB.Where("product_id = ?", product.ID).Scopes(models.OrderedMedia).Find(&media)
+
+	return c.JSON(fiber.Map{
+		"media": media,
+	})
+}
+
+// DeleteProductMedia removes a gallery item and its stored files (seller only)
+func DeleteProductMedia(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	product := findOwnedProduct(c, user)
+	if product == nil {
+		return ownedProductNotFound(c)
+	}
+
+	var media models.ProductMedia
+	if err := database.DB.Where("id = ? AND product_id = ?", c.Params("mediaId"), product.ID).
+		First(&media).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Gallery item not found",
+			},
+		})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&media).Error; err != nil {
+			return err
+		}
+
+		// Close the gap in positions
+		if err := tx.Model(&models.ProductMedia{}).
+			Where("product_id = ? AND position > ?", product.ID, media.Position).
+			UpdateColumn("position", gorm.Expr("position - 1")).Error; err != nil {
+			return err
+		}
+
+		// Promote the next gallery image when the cover image is removed
+		if product.ImageURL == media.URL {
+			var next models.ProductMedia
+			cover := ""
+			if tx.Where("product_id = ? AND type = ?", product.ID, "image").
+				Scopes(models.OrderedMedia).First(&next).Error == nil {
+				cover = next.URL
+			}
+			return tx.Model(product).Update("image_url", cover).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "DATABASE_ERROR",
+				"message": "Failed to delete gallery item",
+			},
+		})
+	}
+
+	deleteMediaObjects(&media)
+
+	return c.JSON(fiber.Map{
+		"message": "Gallery item deleted successfully",
+	})
+}
+
+// findOwnedProduct loads the :id product if it belongs to the user, or nil
+func findOwnedProduct(c *fiber.Ctx, user *models.User) *models.Product {
+	var product models.Product
+	if err := database.DB.Where("id = ? AND author_id = ? AND status <> ?", c.Params("id"), user.ID, "deleted").
+		First(&product).Error; err != nil {
+		return nil
+	}
+	return &product
+}
+
+func ownedProductNotFound(c *fiber.Ctx) error {
+	return c.Status(404).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "NOT_FOUND",
+			"message": "Product not found or access denied",
+		},
+	})
+}
+
+func mediaValidationError(c *fiber.Ctx, message string) error {
+	return c.Status(400).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "VALIDATION_ERROR",
+			"message": message,
+		},
+	})
+}
+
+// deleteMediaObjects removes the uploaded files of a gallery item
+func deleteMediaObjects(media *models.ProductMedia) {
+	if media.StorageKey == "" || objectStore == nil {
+		return
+	}
+
+	objects, err := objectStore.List(media.StorageKey)
+	if err != nil {
+		log.Printf("Failed to list files of gallery item %s: %v", media.ID, err)
+		return
+	}
+	for _, object := range objects {
+		if err := objectStore.Delete(object.Key); err != nil {
+			log.Printf("Failed to delete %s: %v", object.Key, err)
+		}
+	}
+}
@@ -0,0 +1,478 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"vibing-backend/database"
+	"vibing-backend/models"
+	"vibing-backend/services"
+	"vibing-backend/utils"
+)
+
+const (
+	multipartMinPartSize     = 5 * 1024 * 1024  // S3 minimum for every part but the last
+	multipartDefaultPartSize = 16 * 1024 * 1024 // 16MB
+	multipartMaxParts        = 10000
+	multipartMaxFileSize     = 5 * 1024 * 1024 * 1024 // 5GB
+	multipartURLExpiry       = time.Hour
+	multipartMaxURLsPerCall  = 100
+)
+
+type InitiateMultipartUploadRequest struct {
+	ProductID      string `json:"productId" validate:"required"`
+	Filename       string `json:"filename" validate:"required"`
+	FileSize       int64  `json:"fileSize" validate:"required,gt=0"`
+	ChecksumSHA256 string `json:"checksumSha256" validate:"required,len=64,hexadecimal"`
+	PartSize       int64  `json:"partSize"`
+	Version        string `json:"version"`
+}
+
+type CompleteMultipartUploadRequest struct {
+	Parts []services.UploadedPart `json:"parts"`
+}
+
+// InitiateMultipartUpload starts a resumable upload for a large product archive
+func InitiateMultipartUpload(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	var req InitiateMultipartUploadRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "Invalid request body",
+			},
+		})
+	}
+
+	if validationErrors := utils.ValidateStruct(req); len(validationErrors) > 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "Validation failed",
+				"details": validationErrors,
+			},
+		})
+	}
+
+	if !services.IsZipFile(req.Filename) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "Only ZIP files are allowed",
+			},
+		})
+	}
+
+	if req.FileSize > multipartMaxFileSize {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "File size exceeds 5GB limit",
+			},
+		})
+	}
+
+	// Verify user owns the product
+	var product models.Product
+	if err := database.DB.Where("id = ? AND author_id = ?", req.ProductID, user.ID).First(&product).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Product not found or access denied",
+			},
+		})
+	}
+
+	version, err := resolveReleaseVersion(product.ID, req.Version)
+	if err != nil {
+		return releaseVersionRejected(c, err)
+	}
+
+	store, ok := objectStore.(services.MultipartStore)
+	if !ok {
+		return multipartNotSupported(c)
+	}
+
+	partSize := multipartPartSize(req.FileSize, req.PartSize)
+	partCount := int((req.FileSize + partSize - 1) / partSize)
+
+	key := services.ProductFileKey(product.ID, req.Filename)
+	uploadID, err := store.CreateMultipartUpload(key, "application/zip")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "SERVICE_ERROR",
+				"message": "Failed to start upload",
+			},
+		})
+	}
+
+	session := models.UploadSession{
+		UserID:         user.ID,
+		ProductID:      product.ID,
+		ObjectKey:      key,
+		UploadID:       uploadID,
+		Filename:       req.Filename,
+		FileSize:       req.FileSize,
+		PartSize:       partSize,
+		PartCount:      partCount,
+		ChecksumSHA256: strings.ToLower(req.ChecksumSHA256),
+		Version:        version,
+		ExpiresAt:      time.Now().Add(models.UploadSessionTTL),
+	}
+
+	if err := database.DB.Create(&session).Error; err != nil {
+		store.AbortMultipartUpload(key, uploadID)
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "DATABASE_ERROR",
+				"message": "Failed to create upload session",
+			},
+		})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"upload": session,
+	})
+}
+
+// GetMultipartUpload returns the session state and the parts already received, so clients can resume
+func GetMultipartUpload(c *fiber.Ctx) error {
+	session := findUploadSession(c)
+	if session == nil {
+		return uploadSessionNotFound(c)
+	}
+
+	var uploaded []services.UploadedPart
+	if store, ok := objectStore.(services.MultipartStore); ok && session.IsOpen() {
+		parts, err := store.ListUploadedParts(session.ObjectKey, session.UploadID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    "SERVICE_ERROR",
+					"message": "Failed to list uploaded parts",
+				},
+			})
+		}
+		uploaded = parts
+	}
+
+	// Once attached, the file's malware scan is reported like any product file's
+	response := fiber.Map{
+		"upload":        session,
+		"uploadedParts": uploaded,
+	}
+	if session.Status == "completed" {
+		response["scanStatus"] = models.AssetScanStatus(database.DB, session.ObjectKey)
+	}
+	return c.JSON(response)
+}
+
+// GetMultipartPartURLs returns presigned PUT URLs for the requested part numbers.
+// Parts are selected with ?parts=1,2,3; by default the first batch of parts is returned.
+func GetMultipartPartURLs(c *fiber.Ctx) error {
+	session := findUploadSession(c)
+	if session == nil {
+		return uploadSessionNotFound(c)
+	}
+
+	if !session.IsOpen() {
+		return c.Status(409).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "UPLOAD_CLOSED",
+				"message": "Upload is no longer accepting parts",
+			},
+		})
+	}
+
+	store, ok := objectStore.(services.MultipartStore)
+	if !ok {
+		return multipartNotSupported(c)
+	}
+
+	var partNumbers []int64
+	if raw := c.Query("parts"); raw != "" {
+		for _, value := range strings.Split(raw, ",") {
+			number, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil || number < 1 || number > int64(session.PartCount) {
+				return c.Status(400).JSON(fiber.Map{
+					"error": fiber.Map{
+						"code":    "VALIDATION_ERROR",
+						"message": fmt.Sprintf("Invalid part number: %s", value),
+					},
+				})
+			}
+			partNumbers = append(partNumbers, number)
+		}
+	} else {
+		for number := int64(1); number <= int64(session.PartCount); number++ {
+			partNumbers = append(partNumbers, number)
+		}
+	}
+
+	if len(partNumbers) > multipartMaxURLsPerCall {
+		partNumbers = partNumbers[:multipartMaxURLsPerCall]
+	}
+
+	var urls []fiber.Map
+	for _, number := range partNumbers {
+		url, err := store.PresignUploadPart(session.ObjectKey, session.UploadID, number, multipartURLExpiry)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    "SERVICE_ERROR",
+					"message": "Failed to generate part URL",
+				},
+			})
+		}
+		urls = append(urls, fiber.Map{
+			"partNumber": number,
+			"url":        url,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"parts":     urls,
+		"expiresIn": int(multipartURLExpiry.Seconds()),
+	})
+}
+
+// CompleteMultipartUpload assembles the parts, verifies size, checksum and
+// archive contents, and attaches the archive to the product
+func CompleteMultipartUpload(c *fiber.Ctx) error {
+	session := findUploadSession(c)
+	if session == nil {
+		return uploadSessionNotFound(c)
+	}
+
+	if !session.IsOpen() {
+		return c.Status(409).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "UPLOAD_CLOSED",
+				"message": "Upload is no longer accepting parts",
+			},
+		})
+	}
+
+	var req CompleteMultipartUploadRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "Invalid request body",
+			},
+		})
+	}
+
+	store, ok := objectStore.(services.MultipartStore)
+	if !ok {
+		return multipartNotSupported(c)
+	}
+
+	// Fall back to what the store has received when the client didn't keep ETags
+	parts := req.Parts
+	if len(parts) == 0 {
+		uploaded, err := store.ListUploadedParts(session.ObjectKey, session.UploadID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    "SERVICE_ERROR",
+					"message": "Failed to list uploaded parts",
+				},
+			})
+		}
+		parts = uploaded
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].PartNumber < parts[j].PartNumber
+	})
+	if len(parts) != session.PartCount {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INCOMPLETE_UPLOAD",
+				"message": fmt.Sprintf("Expected %d parts, got %d", session.PartCount, len(parts)),
+			},
+		})
+	}
+	for i, part := range parts {
+		if part.PartNumber != int64(i+1) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    "INCOMPLETE_UPLOAD",
+					"message": fmt.Sprintf("Missing part %d", i+1),
+				},
+			})
+		}
+	}
+
+	if err := store.CompleteMultipartUpload(session.ObjectKey, session.UploadID, parts); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "UPLOAD_ERROR",
+				"message": "Failed to complete upload",
+			},
+		})
+	}
+
+	// Verify the assembled object before exposing it to buyers
+	info, err := store.Stat(session.ObjectKey)
+	if err != nil {
+		return rejectMultipartUpload(c, session, "UPLOAD_ERROR", "Uploaded object not found")
+	}
+	if info.Size != session.FileSize {
+		return rejectMultipartUpload(c, session, "SIZE_MISMATCH",
+			fmt.Sprintf("Uploaded size %d does not match declared size %d", info.Size, session.FileSize))
+	}
+
+	// Checksum and archive inspection read the whole object, so they run in the background;
+	// clients poll the upload until it is completed or failed
+	session.Status = "verifying"
+	if err := database.DB.Save(session).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "DATABASE_ERROR",
+				"message": "Failed to update upload",
+			},
+		})
+	}
+	services.WakeUploadVerifier()
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"upload":  session,
+		"message": "Upload received, verifying file",
+	})
+}
+
+// AttachMultipartUpload attaches an upload the verifier has checked to its product as a
+// new release. Uploads that can no longer be attached are rejected with a coded error.
+func AttachMultipartUpload(session *models.UploadSession, inspection *services.ArchiveInspection) error {
+	var product models.Product
+	if err := database.DB.Where("id = ?", session.ProductID).First(&product).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return &services.ArchiveError{Code: "NOT_FOUND", Message: "Product not found"}
+		}
+		return err
+	}
+
+	// A verification retried after attaching (e.g. its session failed to save) is done
+	var attached int64
+	if err := database.DB.Model(&models.ProductRelease{}).
+		Where("product_id = ? AND object_key = ?", product.ID, session.ObjectKey).
+		Count(&attached).Error; err != nil {
+		return err
+	}
+	if attached > 0 {
+		return nil
+	}
+
+	_, err := attachProductFile(&product, session.ObjectKey, session.FileSize, session.Version, inspection)
+	if err == errReleaseExists {
+		return &services.ArchiveError{Code: "VERSION_EXISTS", Message: "A release with this version already exists"}
+	}
+	return err
+}
+
+// AbortMultipartUpload cancels an unfinished upload and discards stored parts
+func AbortMultipartUpload(c *fiber.Ctx) error {
+	session := findUploadSession(c)
+	if session == nil {
+		return uploadSessionNotFound(c)
+	}
+
+	if session.Status != "initiated" {
+		return c.Status(409).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "UPLOAD_CLOSED",
+				"message": "Upload is already finished",
+			},
+		})
+	}
+
+	store, ok := objectStore.(services.MultipartStore)
+	if !ok {
+		return multipartNotSupported(c)
+	}
+
+	if err := store.AbortMultipartUpload(session.ObjectKey, session.UploadID); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "SERVICE_ERROR",
+				"message": "Failed to abort upload",
+			},
+		})
+	}
+
+	session.Status = "aborted"
+	database.DB.Save(session)
+
+	return c.JSON(fiber.Map{
+		"message": "Upload aborted",
+	})
+}
+
+// findUploadSession loads the current user's upload session from the :id param
+func findUploadSession(c *fiber.Ctx) *models.UploadSession {
+	user := c.Locals("user").(*models.User)
+
+	var session models.UploadSession
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), user.ID).First(&session).Error; err != nil {
+		return nil
+	}
+	return &session
+}
+
+// multipartNotSupported is returned when the storage backend has no multipart API (local disk)
+func multipartNotSupported(c *fiber.Ctx) error {
+	return c.Status(501).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "NOT_SUPPORTED",
+			"message": services.ErrMultipartNotSupported.Error(),
+		},
+	})
+}
+
+func uploadSessionNotFound(c *fiber.Ctx) error {
+	return c.Status(404).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "NOT_FOUND",
+			"message": "Upload not found",
+		},
+	})
+}
+
+// rejectMultipartUpload deletes an assembled object that failed verification
+func rejectMultipartUpload(c *fiber.Ctx, session *models.UploadSession, code, message string) error {
+	objectStore.Delete(session.ObjectKey)
+	session.Fail(code, message)
+	database.DB.Save(session)
+
+	return c.Status(400).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    code,
+			"message": message,
+		},
+	})
+}
+
+// multipartPartSize picks a part size within S3 limits for the given file size
+func multipartPartSize(fileSize, requested int64) int64 {
+	partSize := requested
+	if partSize <= 0 {
+		partSize = multipartDefaultPartSize
+	}
+	if partSize < multipartMinPartSize {
+		partSize = multipartMinPartSize
+	}
+	if minimum := (fileSize + multipartMaxParts - 1) / multipartMaxParts; partSize < minimum {
+		partSize = minimum
+	}
+	return partSize
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"vibing-backend/database"
+	"vibing-backend/models"
+	"vibing-backend/pagination"
+)
+
+// notificationKeyset pages notifications newest first
+var notificationKeyset = pagination.Keyset{TimeColumn: "created_at", IDColumn: "id", Desc: true}
+
+// GetNotifications returns the user's notifications with the number of unread ones.
+// unread=true lists only unread notifications.
+func GetNotifications(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+	params, err := pagination.Parse(c, 20)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
+
+	query := database.DB.Model(&models.Notification{}).Where("user_id = ?", user.ID)
+	if c.QueryBool("unread") {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var notifications []models.Notification
+	total := params.Count(query)
+	if err := notificationKeyset.Apply(query, params).Find(&notifications).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to fetch notifications",
+			},
+		})
+	}
+	notifications, meta := pagination.Trim(params, notifications, total, func(n models.Notification) (time.Time, string) {
+		return n.CreatedAt, n.ID
+	})
+
+	var unread int64
+	database.DB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", user.ID).Count(&unread)
+
+	return c.JSON(fiber.Map{
+		"notifications": notifications,
+		"unreadCount":   unread,
+		"pagination":    meta,
+	})
+}
+
+// MarkNotificationRead marks one of the user's notifications as read
+func MarkNotificationRead(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	result := database.DB.Model(&models.Notification{}).
+		Where("id = ? AND user_id = ? AND read_at IS NULL", c.Params("id"), user.ID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to update notification",
+			},
+		})
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		database.DB.Model(&models.Notification{}).Where("id = ? AND user_id = ?", c.Params("id"), user.ID).Count(&count)
+		if count == 0 {
+			return c.Status(404).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    "NOT_FOUND",
+					"message": "Notification not found",
+				},
+			})
+		}
+	}
+	return c.JSON(fiber.Map{"message": "Notification marked as read"})
+}
+
+// MarkAllNotificationsRead marks every unread notification of the user as read
+func MarkAllNotificationsRead(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	result := database.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", user.ID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to update notifications",
+			},
+		})
+	}
+	return c.JSON(fiber.Map{"updated": result.RowsAffected})
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"vibing-backend/models"
+	"vibing-backend/services"
+)
+
+// ServeNpmRegistry implements the read side of the npm registry API for purchased
+// packages in the @vibing scope: packuments (<name>), tarballs (<name>/-/<file>.tgz),
+// dist-tags (-/package/<name>/dist-tags), plus -/whoami and -/ping.
+// Errors use npm's {"error": "..."} shape, which the npm client prints.
+func ServeNpmRegistry(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	// Scoped names arrive as @vibing%2fname
+	request, err := url.PathUnescape(c.Params("*"))
+	if err != nil {
+		return npmError(c, 400, "invalid package name")
+	}
+
+	switch {
+	case request == "-/ping":
+		return c.JSON(fiber.Map{})
+	case request == "-/whoami":
+		return c.JSON(fiber.Map{"username": user.Name})
+	case strings.HasPrefix(request, "-/package/") && strings.HasSuffix(request, "/dist-tags"):
+		name := strings.TrimSuffix(strings.TrimPrefix(request, "-/package/"), "/dist-tags")
+		return withNpmPackage(c, user, name, func(access *packageAccess) error {
+			return c.JSON(npmDistTags(access.releases))
+		})
+	}
+
+	if i := strings.Index(request, "/-/"); i > 0 {
+		name, file := request[:i], request[i+len("/-/"):]
+		return withNpmPackage(c, user, name, func(access *packageAccess) error {
+			return serveNpmTarball(c, name, file, access)
+		})
+	}
+
+	return withNpmPackage(c, user, request, func(access *packageAccess) error {
+		return serveNpmPackument(c, request, access)
+	})
+}
+
+// withNpmPackage resolves a package name for the user and calls serve if they may fetch it
+func withNpmPackage(c *fiber.Ctx, user *models.User, name string, serve func(*packageAccess) error) error {
+	if !strings.HasPrefix(name, services.NpmScope+"/") {
+		return npmError(c, 404, "only "+services.NpmScope+" packages are served by this registry")
+	}
+
+	access, err := resolvePackage(user, "npm_package", name)
+	if err != nil {
+		return npmError(c, 500, "failed to resolve package")
+	}
+	if access == nil {
+		return npmError(c, 404, "package "+name+" not found")
+	}
+	if !access.allowed {
+		return npmError(c, 403, "no active purchase of package "+name)
+	}
+	return serve(access)
+}
+
+// serveNpmPackument lists the releases whose tarball the build worker has packed; the
+// digests npm verifies are only known once it is
+func serveNpmPackument(c *fiber.Ctx, name string, access *packageAccess) error {
+	if publicURL == "" {
+		return npmError(c, 503, "registry unavailable: PUBLIC_URL is not configured")
+	}
+	versions := fiber.Map{}
+	times := fiber.Map{}
+	var published []models.ProductRelease
+
+	for i := range access.releases {
+		release := &access.releases[i]
+		if release.NpmTarballKey == "" {
+			services.WakeBuildWorker()
+			continue
+		}
+
+		var manifest map[string]interface{}
+		if err := json.Unmarshal([]byte(release.NpmManifest), &manifest); err != nil {
+			continue
+		}
+		manifest["_id"] = name + "@" + release.Version
+		manifest["dist"] = fiber.Map{
+			"tarball":   npmTarballURL(name, release.Version),
+			"shasum":    release.NpmShasum,
+			"integrity": release.NpmIntegrity,
+		}
+
+		versions[release.Version] = manifest
+		times[release.Version] = release.CreatedAt
+		published = append(published, *release)
+	}
+
+	if len(published) > 0 {
+		times["created"] = published[0].CreatedAt
+		times["modified"] = published[len(published)-1].CreatedAt
+	}
+
+	return c.JSON(fiber.Map{
+		"_id":         name,
+		"name":        name,
+		"description": access.product.Title,
+		"dist-tags":   npmDistTags(published),
+		"versions":    versions,
+		"time":        times,
+	})
+}
+
+// serveNpmTarball streams a packed release. Fetches by buyers count as downloads of their purchase.
+func serveNpmTarball(c *fiber.Ctx, name, file string, access *packageAccess) error {
+	prefix := strings.TrimSuffix(services.NpmTarballName(name, ""), ".tgz")
+	if !strings.HasPrefix(file, prefix) || !strings.HasSuffix(file, ".tgz") {
+		return npmError(c, 404, "tarball not found")
+	}
+	version := strings.TrimSuffix(strings.TrimPrefix(file, prefix), ".tgz")
+
+	var release *models.ProductRelease
+	for i := range access.releases {
+		if access.releases[i].Version == version {
+			release = &access.releases[i]
+		}
+	}
+	if release == nil {
+		return npmError(c, 404, "version "+version+" of "+name+" not found")
+	}
+
+	if access.purchase != nil && !access.purchase.CanDownload() {
+		return npmError(c, 403, "download limit reached or access expired")
+	}
+	if objectStore == nil {
+		return npmError(c, 500, "file download service not available")
+	}
+	if release.NpmTarballKey == "" {
+		services.WakeBuildWorker()
+		c.Set(fiber.HeaderRetryAfter, "30")
+		return npmError(c, 503, "tarball of "+name+"@"+version+" is not packed yet")
+	}
+
+	object, err := objectStore.Get(release.NpmTarballKey, "")
+	if err != nil {
+		return npmError(c, 500, "failed to open tarball")
+	}
+
+	stream := packageDownloadStream(c, access.purchase, release.NpmTarballKey, object.Body, release.NpmTarballSize)
+
+	c.Set(fiber.HeaderContentType, "application/octet-stream")
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	return c.SendStream(stream, int(release.NpmTarballSize))
+}
+
+func npmDistTags(releases []models.ProductRelease) fiber.Map {
+	versions := make([]string, 0, len(releases))
+	for _, release := range releases {
+		versions = append(versions, release.Version)
+	}
+	tags := fiber.Map{}
+	if latest := latestVersion(versions); latest != "" {
+		tags["latest"] = latest
+	}
+	return tags
+}
+
+// npmTarballURL is the tarball URL in the registry's own namespace, so npm sends the
+// .npmrc token along when fetching it
+func npmTarballURL(name, version string) string {
+	return publicURL + "/npm/" + name + "/-/" + services.NpmTarballName(name, version)
+}
+
+func npmError(c *fiber.Ctx, status int, message string) error {
+	return c.Status(status).JSON(fiber.Map{
+		"error": message,
+	})
+}
@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// invalidPagination is returned for malformed page, limit, cursor or other bounded parameters
+func invalidPagination(c *fiber.Ctx, err error) error {
+	return c.Status(400).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "VALIDATION_ERROR",
+			"message": err.Error(),
+		},
+	})
+}
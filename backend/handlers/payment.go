@@ -53,6 +53,11 @@ func CreatePaymentOrder(c *fiber.Ctx) error {
 		})
 	}
 
+	// Products whose archive hasn't passed the malware scan can't be bought
+	if !product.IsScanClean() {
+		return fileNotCleared(c)
+	}
+
 	// Verify amount matches product price
 	if float64(req.Amount) != product.Price {
 		return c.Status(400).JSON(fiber.Map{
@@ -80,6 +85,8 @@ func CreatePaymentOrder(c *fiber.Ctx) error {
 		})
 	}
 
+	trackProductEvent(c, &product, models.EventPurchaseStart)
+
 	// Create customer object for PortOne
 	customer := services.Customer{
 		ID:    user.ID,
@@ -226,8 +233,8 @@ func VerifyPayment(c *fiber.Ctx) error {
 		})
 	}
 	
-	// Update product download count
-	database.DB.Model(&product).UpdateColumn("downloads", product.Downloads+1)
+	// The product's download count is derived from the event
+	trackProductEvent(c, &product, models.EventPurchaseComplete)
 	
 	return c.JSON(fiber.Map{
 		"verified": true,
@@ -284,8 +291,8 @@ func ConfirmPayment(c *fiber.Ctx) error {
 		})
 	}
 
-	// Update purchase status
-	purchase.Status = "completed"
+	// Update purchase status and open the download window
+	purchase.Complete()
 	purchase.TossPaymentKey = req.PaymentKey // Store payment key
 	purchase.DownloadURL = &[]string{purchase.GenerateDownloadURL()}[0]
 	licenseKey := purchase.GenerateLicenseKey()
@@ -300,8 +307,8 @@ func ConfirmPayment(c *fiber.Ctx) error {
 		})
 	}
 
-	// Update product download count
-	database.DB.Model(&purchase.Product).UpdateColumn("downloads", purchase.Product.Downloads+1)
+	// The product's download count is derived from the event
+	trackProductEvent(c, &purchase.Product, models.EventPurchaseComplete)
 
 	return c.JSON(fiber.Map{
 		"purchase": fiber.Map{
@@ -1,51 +1,243 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 	"vibing-backend/database"
 	"vibing-backend/models"
+	"vibing-backend/pagination"
+	"vibing-backend/services"
 	"vibing-backend/utils"
 )
 
-// GetProducts returns paginated products with filters
+// GetProducts returns paginated products with filters, sorting and facet counts
 func GetProducts(c *fiber.Ctx) error {
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	limit, _ := strconv.Atoi(c.Query("limit", "12"))
-	category := c.Query("category")
-	search := c.Query("search")
-	
-	offset := (page - 1) * limit
-	
-	query := database.DB.Model(&models.Product{}).Where("status = ?", "active")
+	params, err := pagination.Parse(c, 12)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
 	
-	if category != "" {
-		query = query.Where("category = ?", category)
+	filter, sort, err := parseProductFilter(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": err.Error(),
+			},
+		})
 	}
 	
-	if search != "" {
-		query = query.Where("title ILIKE ? OR description ILIKE ?", "%"+search+"%", "%"+search+"%")
+	// Cursors only follow the date orders; other orders and searches page by offset
+	keyset, hasKeyset := productKeysets[sort]
+	if !filter.Search.Empty() {
+		hasKeyset = false
+	}
+	if params.IsCursor() && !hasKeyset {
+		return invalidPagination(c, errProductCursorOrder)
 	}
 	
-	var products []models.Product
-	var total int64
+	query := filter.Apply(database.DB.Model(&models.Product{}))
 	
-	query.Count(&total)
-	query.Offset(offset).Limit(limit).Find(&products)
+	var products []models.Product
 	
-	return c.JSON(fiber.Map{
-		"products": products,
-		"pagination": fiber.Map{
-			"currentPage":  page,
-			"totalPages":   (total + int64(limit) - 1) / int64(limit),
-			"totalItems":   total,
-			"itemsPerPage": limit,
-		},
-	})
+	total := params.Count(query)
+
+	// The ID breaks ties so pages don't overlap
+	order := services.ProductSorts[sort] + ", products.id"
+
+	response := fiber.Map{
+		"sortBy": sort,
+	}
+
+	if filter.Search.Empty() {
+		if hasKeyset {
+			keyset.Apply(query, params).Preload("Media", models.OrderedMedia).Find(&products)
+			products, response["pagination"] = pagination.Trim(params, products, total, productKey)
+		} else {
+			params.Window(query.Order(order)).Preload("Media", models.OrderedMedia).Find(&products)
+			products, response["pagination"] = pagination.Trim(params, products, total, nil)
+		}
+		markLiked(c, products)
+		response["products"] = products
+	} else {
+		// Searches return highlighted fragments keyed by product ID
+		hits, err := filter.Search.Hits(query, order, params.Offset(), params.Limit+1)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    "INTERNAL_ERROR",
+					"message": "Failed to search products",
+				},
+			})
+		}
+		hits, response["pagination"] = pagination.Trim(params, hits, total, nil)
+
+		products = make([]models.Product, 0, len(hits))
+		highlights := make(map[string]services.ProductHighlight, len(hits))
+		if len(hits) > 0 {
+			ids := make([]string, len(hits))
+			for i, hit := range hits {
+				ids[i] = hit.ID
+				highlights[hit.ID] = filter.Search.Highlight(hit)
+			}
+
+			var found []models.Product
+			database.DB.Preload("Media", models.OrderedMedia).Where("id IN ?", ids).Find(&found)
+			byID := make(map[string]models.Product, len(found))
+			for _, product := range found {
+				byID[product.ID] = product
+			}
+			for _, id := range ids {
+				if product, ok := byID[id]; ok {
+					products = append(products, product)
+				}
+			}
+		}
+
+		markLiked(c, products)
+		response["products"] = products
+		response["highlights"] = highlights
+		if total < services.SearchSuggestionThreshold {
+			if suggestion := filter.Search.Suggest(database.DB); suggestion != "" {
+				response["suggestion"] = suggestion
+			}
+		}
+	}
+
+	if c.Query("facets") != "false" {
+		facets, err := services.CountProductFacets(database.DB, filter)
+		if err != nil {
+			log.Printf("Failed to count product facets: %v", err)
+		} else {
+			response["facets"] = facets
+		}
+	}
+
+	return c.JSON(response)
+}
+
+// productKeysets are the product sort orders that can be paged with a cursor
+var productKeysets = map[string]pagination.Keyset{
+	"newest": newestProducts,
+	"oldest": {TimeColumn: "products.created_at", IDColumn: "products.id"},
+}
+
+// newestProducts pages products newest first
+var newestProducts = pagination.Keyset{TimeColumn: "products.created_at", IDColumn: "products.id", Desc: true}
+
+var errProductCursorOrder = errors.New("cursor paging is only available for the newest and oldest orders without a search")
+
+func productKey(product models.Product) (time.Time, string) {
+	return product.CreatedAt, product.ID
+}
+
+// parseProductFilter reads the catalog filters and sort order from the query string
+func parseProductFilter(c *fiber.Ctx) (services.ProductFilter, string, error) {
+	filter := services.ProductFilter{
+		Search:  services.ParseProductSearch(c.Query("search")),
+		Pricing: c.Query("price"),
+	}
+
+	// A category includes its subcategories
+	if category := c.Query("category"); category != "" && category != "all" {
+		tree, err := models.LoadCategoryTree(database.DB)
+		if err != nil {
+			return filter, "", err
+		}
+		filter.Categories = tree.Subtree(category)
+		if filter.Categories == nil {
+			return filter, "", fmt.Errorf("unknown category %q", category)
+		}
+	}
+
+	for name, dest := range map[string]**float64{"minPrice": &filter.MinPrice, "maxPrice": &filter.MaxPrice} {
+		if value := c.Query(name); value != "" {
+			price, err := strconv.ParseFloat(value, 64)
+			if err != nil || price < 0 {
+				return filter, "", fmt.Errorf("%s must be a non-negative number", name)
+			}
+			*dest = &price
+		}
+	}
+
+	if filter.Pricing != "" && filter.Pricing != "free" && filter.Pricing != "paid" {
+		return filter, "", fmt.Errorf("price must be free or paid")
+	}
+
+	if value := c.Query("minRating"); value != "" {
+		rating, err := strconv.ParseFloat(value, 64)
+		if err != nil || rating < 0 || rating > 5 {
+			return filter, "", fmt.Errorf("minRating must be between 0 and 5")
+		}
+		filter.MinRating = rating
+	}
+
+	for _, license := range splitQueryList(c.Query("license")) {
+		if !validLicenseTypes[license] {
+			return filter, "", fmt.Errorf("unknown license type %q", license)
+		}
+		filter.Licenses = append(filter.Licenses, license)
+	}
+
+	filter.Tags = splitQueryList(c.Query("tags"))
+	if len(filter.Tags) > maxTagFilters {
+		return filter, "", fmt.Errorf("at most %d tags can be filtered on", maxTagFilters)
+	}
+	if len(filter.Tags) > 0 {
+		tags, err := models.ResolveTags(database.DB, filter.Tags)
+		if err != nil {
+			return filter, "", err
+		}
+		filter.Tags = tags
+	}
+
+	if value := c.Query("pro"); value != "" {
+		isPro, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, "", fmt.Errorf("pro must be true or false")
+		}
+		filter.IsPro = &isPro
+	}
+	filter.Featured = c.QueryBool("featured")
+	filter.OnSale = c.QueryBool("onSale")
+
+	sort := c.Query("sortBy")
+	if sort == "" || (sort == "relevance" && filter.Search.Empty()) {
+		sort = "newest"
+		if !filter.Search.Empty() {
+			sort = "relevance"
+		}
+	}
+	if _, ok := services.ProductSorts[sort]; !ok {
+		return filter, "", fmt.Errorf("unknown sort order %q", sort)
+	}
+
+	return filter, sort, nil
+}
+
+// maxTagFilters bounds the tags a listing can be filtered on
+const maxTagFilters = 10
+
+var validLicenseTypes = map[string]bool{
+	"MIT": true, "Apache": true, "GPL": true, "BSD": true, "Custom": true, "Commercial": true,
+}
+
+// splitQueryList splits a comma-separated query parameter, dropping empty items
+func splitQueryList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 // GetProduct returns single product details
@@ -53,7 +245,8 @@ func GetProduct(c *fiber.Ctx) error {
 	id := c.Params("id")
 	
 	var product models.Product
-	if err := database.DB.Where("id = ? AND status = ?", id, "active").First(&product).Error; err != nil {
+	if err := database.DB.Preload("Media", models.OrderedMedia).
+		Where("id = ? AND status = ?", id, "active").First(&product).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": fiber.Map{
 				"code":    "NOT_FOUND",
@@ -62,10 +255,143 @@ func GetProduct(c *fiber.Ctx) error {
 		})
 	}
 	
-	// Increment view count
-	database.DB.Model(&product).UpdateColumn("views", product.Views+1)
+	// Views are counted when the event is flushed
+	trackProductEvent(c, &product, models.EventView)
 	
-	return c.JSON(product)
+	if user, ok := c.Locals("user").(*models.User); ok {
+		var liked int64
+		database.DB.Model(&models.WishlistItem{}).
+			Where("user_id = ? AND product_id = ?", user.ID, product.ID).Count(&liked)
+		product.Liked = liked > 0
+	}
+	
+	return c.JSON(productDetail{Product: product, Readme: product.Readme})
+}
+
+// productDetail is a product with the fields only its detail response carries
+type productDetail struct {
+	models.Product
+	Readme string `json:"readme,omitempty"`
+}
+
+// GetProductManifest returns the file listing of a product's current archive
+func GetProductManifest(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var product models.Product
+	if err := database.DB.Where("id = ? AND status = ?", id, "active").First(&product).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Product not found",
+			},
+		})
+	}
+
+	var entries []models.ProductFileEntry
+	if err := database.DB.Where("product_id = ? AND object_key = ?", product.ID, product.FileKey).
+		Order("path ASC").Find(&entries).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to fetch manifest",
+			},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"files":        entries,
+		"fileCount":    product.FileCount,
+		"unpackedSize": product.UnpackedSize,
+		"readme":       product.Readme,
+		"readmePath":   product.ReadmePath,
+	})
+}
+
+// GetSecretFindings returns the credential leak findings of a product's archive (seller or admin)
+func GetSecretFindings(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+	id := c.Params("id")
+
+	var product models.Product
+	if err := database.DB.Where("id = ?", id).First(&product).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Product not found",
+			},
+		})
+	}
+
+	if product.AuthorID != user.ID && user.Role != "admin" {
+		return c.Status(403).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "FORBIDDEN",
+				"message": "Access denied",
+			},
+		})
+	}
+
+	var findings []models.SecretFinding
+	if err := database.DB.Where("product_id = ? AND object_key = ?", product.ID, product.FileKey).
+		Order("path ASC, line ASC").Find(&findings).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to fetch findings",
+			},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"findings":       findings,
+		"review":         product.SecretReview,
+		"acknowledgedAt": product.SecretsAcknowledgedAt,
+	})
+}
+
+// AcknowledgeSecretFindings lets the seller confirm the findings are intentional
+// (e.g. test fixtures or revoked keys) and publishes the product again
+func AcknowledgeSecretFindings(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+	id := c.Params("id")
+
+	var product models.Product
+	if err := database.DB.Where("id = ? AND author_id = ?", id, user.ID).First(&product).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Product not found or access denied",
+			},
+		})
+	}
+
+	if !product.HasPendingSecretReview() {
+		return c.Status(409).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOTHING_TO_ACKNOWLEDGE",
+				"message": "There are no findings awaiting acknowledgement",
+			},
+		})
+	}
+
+	now := time.Now()
+	product.EndSecretReview("acknowledged")
+	product.SecretsAcknowledgedAt = &now
+
+	if err := database.DB.Save(&product).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to acknowledge findings",
+			},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"product": product,
+		"message": "Findings acknowledged",
+	})
 }
 
 // CreateProduct creates a new product (seller only)
@@ -86,6 +412,18 @@ func CreateProduct(c *fiber.Ctx) error {
 	product.AuthorID = user.ID
 	product.Author = user.Name
 	product.Status = "active" // Change from "pending" to "active" for immediate visibility
+	// Archive-derived fields are only set by the upload inspection
+	product.Readme = ""
+	product.ReadmePath = ""
+	product.FileCount = 0
+	product.UnpackedSize = 0
+	product.LatestVersion = ""
+	product.ScanStatus = ""
+	product.ScanError = ""
+	product.TrendingScore = 0
+	product.WishlistCount = 0
+	// Presigned storage URLs expire; store the stable media URL instead
+	product.ImageURL = services.StableImageURL(objectStore, product.ImageURL)
 	
 	// Debug: log what we're about to validate
 	fmt.Printf("About to validate product: %+v\n", product)
@@ -104,6 +442,16 @@ func CreateProduct(c *fiber.Ctx) error {
 		})
 	}
 	
+	if !models.IsSelectableCategory(database.DB, product.Category) {
+		return invalidCategory(c)
+	}
+	
+	tags, err := normalizeProductTags(product.Tags)
+	if err != nil {
+		return invalidTags(c, err)
+	}
+	product.Tags = tags
+	
 	if err := database.DB.Create(&product).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": fiber.Map{
@@ -114,6 +462,10 @@ func CreateProduct(c *fiber.Ctx) error {
 		})
 	}
 	
+	if err := models.RefreshTagUsage(database.DB, product.Tags); err != nil {
+		log.Printf("Failed to refresh tag usage for product %s: %v", product.ID, err)
+	}
+	
 	return c.Status(201).JSON(product)
 }
 
@@ -149,6 +501,11 @@ func UpdateProduct(c *fiber.Ctx) error {
 		Price       float64  `json:"price" validate:"gte=0"`
 		Tags        []string `json:"tags"`
 		ImageUrl    string   `json:"imageUrl"`
+		PersonalizedBuilds *bool `json:"personalizedBuilds"`
+		BuildWatermark     *bool `json:"buildWatermark"`
+		UpdateWindowDays   *int  `json:"updateWindowDays" validate:"omitempty,gte=0,lte=3650"`
+		// OriginalPrice above the price puts the product on sale; 0 ends the sale
+		OriginalPrice      *float64 `json:"originalPrice" validate:"omitempty,gte=0"`
 	}
 	
 	if err := c.BodyParser(&updateData); err != nil {
@@ -171,6 +528,18 @@ func UpdateProduct(c *fiber.Ctx) error {
 		})
 	}
 	
+	// Products keep a category that was deactivated after they were listed
+	if updateData.Category != product.Category && !models.IsSelectableCategory(database.DB, updateData.Category) {
+		return invalidCategory(c)
+	}
+	
+	tags, err := normalizeProductTags(updateData.Tags)
+	if err != nil {
+		return invalidTags(c, err)
+	}
+	updateData.Tags = tags
+	touchedTags := append(append([]string{}, product.Tags...), tags...)
+	
 	// Update product fields
 	product.Title = updateData.Title
 	product.Description = updateData.Description
@@ -178,7 +547,22 @@ func UpdateProduct(c *fiber.Ctx) error {
 	product.Price = updateData.Price
 	product.Tags = updateData.Tags
 	if updateData.ImageUrl != "" {
-		product.ImageURL = updateData.ImageUrl
+		product.ImageURL = services.StableImageURL(objectStore, updateData.ImageUrl)
+	}
+	if updateData.PersonalizedBuilds != nil {
+		product.PersonalizedBuilds = *updateData.PersonalizedBuilds
+	}
+	if updateData.BuildWatermark != nil {
+		product.BuildWatermark = *updateData.BuildWatermark
+	}
+	if updateData.UpdateWindowDays != nil {
+		product.UpdateWindowDays = *updateData.UpdateWindowDays
+	}
+	if updateData.OriginalPrice != nil {
+		product.OriginalPrice = updateData.OriginalPrice
+		if *updateData.OriginalPrice == 0 {
+			product.OriginalPrice = nil
+		}
 	}
 	
 	if err := database.DB.Save(&product).Error; err != nil {
@@ -190,6 +574,10 @@ func UpdateProduct(c *fiber.Ctx) error {
 		})
 	}
 	
+	if err := models.RefreshTagUsage(database.DB, touchedTags); err != nil {
+		log.Printf("Failed to refresh tag usage for product %s: %v", product.ID, err)
+	}
+	
 	return c.JSON(product)
 }
 
@@ -228,17 +616,16 @@ func DeleteProduct(c *fiber.Ctx) error {
 		})
 	}
 	
+	// Keep the file for existing buyers until the retention job can purge it
+	if err := models.RetireProductFiles(database.DB, &product, "product_deleted"); err != nil {
+		log.Printf("Failed to retire files for deleted product %s: %v", product.ID, err)
+	}
+	
 	return c.JSON(fiber.Map{
 		"message": "Product deleted successfully",
 	})
 }
 
-// ToggleLike toggles product like
-func ToggleLike(c *fiber.Ctx) error {
-	// Implementation placeholder
-	return c.JSON(fiber.Map{"message": "Not implemented"})
-}
-
 // GetProductReviews retrieves reviews for a specific product
 func GetProductReviews(c *fiber.Ctx) error {
 	productID := c.Params("id")
@@ -249,18 +636,15 @@ func GetProductReviews(c *fiber.Ctx) error {
 	}
 
 	// Parse pagination parameters
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	limit, _ := strconv.Atoi(c.Query("limit", "10"))
-
-	if page < 1 {
-		page = 1
-	}
-	if limit < 1 || limit > 100 {
-		limit = 10
+	params, err := pagination.Parse(c, 10)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
 	}
 
 	// Get product reviews
-	reviews, total, err := models.GetProductReviews(database.DB, productID, page, limit)
+	reviews, total, err := models.GetProductReviews(database.DB, productID, params)
 	if err != nil {
 		log.Printf("Error getting product reviews: %v", err)
 		return c.Status(500).JSON(fiber.Map{
@@ -268,15 +652,21 @@ func GetProductReviews(c *fiber.Ctx) error {
 		})
 	}
 
-	hasMore := int64(page*limit) < total
-
-	return c.JSON(fiber.Map{
-		"reviews": reviews,
-		"total":   total,
-		"page":    page,
-		"limit":   limit,
-		"hasMore": hasMore,
+	reviews, meta := pagination.Trim(params, reviews, total, func(review models.Review) (time.Time, string) {
+		return review.CreatedAt, review.ID
 	})
+
+	response := fiber.Map{
+		"reviews":    reviews,
+		"limit":      params.Limit,
+		"hasMore":    meta.HasMore,
+		"pagination": meta,
+	}
+	if !params.IsCursor() {
+		response["total"] = total
+		response["page"] = params.Page
+	}
+	return c.JSON(response)
 }
 
 // CreateReview creates a new review
@@ -358,44 +748,6 @@ func CreateReview(c *fiber.Ctx) error {
 	return c.Status(201).JSON(review)
 }
 
-// GetCategories returns categories with product counts
-func GetCategories(c *fiber.Ctx) error {
-	type CategoryCount struct {
-		ID    string `json:"id"`
-		Name  string `json:"name"`
-		Count int64  `json:"count"`
-	}
-
-	categories := []CategoryCount{
-		{ID: "all", Name: "All Categories", Count: 0},
-		{ID: "libraries", Name: "Libraries & Frameworks", Count: 0},
-		{ID: "cli-tools", Name: "CLI Tools", Count: 0},
-		{ID: "web-templates", Name: "Web Templates", Count: 0},
-		{ID: "mobile", Name: "Mobile Apps", Count: 0},
-		{ID: "desktop", Name: "Desktop Apps", Count: 0},
-		{ID: "design", Name: "Design Assets", Count: 0},
-		{ID: "database", Name: "Database Tools", Count: 0},
-		{ID: "ai-ml", Name: "AI & Machine Learning", Count: 0},
-		{ID: "security", Name: "Security Tools", Count: 0},
-	}
-
-	// Get total count for "all" category
-	var totalCount int64
-	database.DB.Model(&models.Product{}).Where("status = ?", "active").Count(&totalCount)
-	categories[0].Count = totalCount
-
-	// Get count for each specific category
-	for i := 1; i < len(categories); i++ {
-		var count int64
-		database.DB.Model(&models.Product{}).Where("status = ? AND category = ?", "active", categories[i].ID).Count(&count)
-		categories[i].Count = count
-	}
-
-	return c.JSON(fiber.Map{
-		"categories": categories,
-	})
-}
-
 // GetUserReviewForProduct gets user's review for a specific product
 func GetUserReviewForProduct(c *fiber.Ctx) error {
 	productID := c.Params("productId")
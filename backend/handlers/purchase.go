@@ -1,38 +1,32 @@
 package handlers
 
 import (
-	"fmt"
+	"log"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"vibing-backend/config"
 	"vibing-backend/database"
 	"vibing-backend/models"
-	"vibing-backend/services"
+	"vibing-backend/pagination"
 )
 
 // GetPurchaseHistory returns user's purchase history with pagination
 func GetPurchaseHistory(c *fiber.Ctx) error {
 	user := c.Locals("user").(*models.User)
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	limit, _ := strconv.Atoi(c.Query("limit", "10"))
-	
-	offset := (page - 1) * limit
+	params, err := pagination.Parse(c, 10)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
 	
 	var purchases []models.Purchase
-	var total int64
 	
 	// Count total purchases
-	database.DB.Model(&models.Purchase{}).Where("user_id = ?", user.ID).Count(&total)
+	total := params.Count(database.DB.Model(&models.Purchase{}).Where("user_id = ?", user.ID))
 	
 	// Get paginated purchases with product details
-	if err := database.DB.Where("user_id = ?", user.ID).
+	if err := purchaseKeyset.Apply(database.DB.Where("user_id = ?", user.ID), params).
 		Preload("Product").
-		Order("created_at DESC").
-		Limit(limit).
-		Offset(offset).
 		Find(&purchases).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": fiber.Map{
@@ -42,6 +36,8 @@ func GetPurchaseHistory(c *fiber.Ctx) error {
 		})
 	}
 	
+	purchases, meta := pagination.Trim(params, purchases, total, purchaseKey)
+	
 	// Format response
 	var purchaseHistory []fiber.Map
 	for _, purchase := range purchases {
@@ -73,13 +69,10 @@ func GetPurchaseHistory(c *fiber.Ctx) error {
 		}
 		purchaseData["product"] = productData
 		
-		// Add download URL (generate pre-signed URL for security)
-		if purchase.Status == "completed" {
-			fmt.Printf("DEBUG: Purchase %s is completed, generating download URL\n", purchase.ID)
-			downloadURL := generatePresignedDownloadURLWithExpiry(purchase.Product.FileURL, purchase.ID, purchase.AutoConfirmAt)
-			purchaseData["downloadUrl"] = downloadURL
-		} else {
-			fmt.Printf("DEBUG: Purchase %s status is: %s, not generating download URL\n", purchase.ID, purchase.Status)
+		// Downloads go through short-lived tokens issued by GetDownloadURL
+		if purchase.CanDownload() {
+			purchaseData["downloadUrl"] = purchase.GenerateDownloadURL()
+			purchaseData["remainingDownloads"] = purchase.RemainingDownloads()
 		}
 		
 		if purchase.LicenseKey != nil {
@@ -98,24 +91,31 @@ func GetPurchaseHistory(c *fiber.Ctx) error {
 	}
 	
 	return c.JSON(fiber.Map{
-		"purchases": purchaseHistory,
-		"pagination": fiber.Map{
-			"currentPage":  page,
-			"totalPages":   (total + int64(limit) - 1) / int64(limit),
-			"totalItems":   total,
-			"itemsPerPage": limit,
-		},
+		"purchases":  purchaseHistory,
+		"pagination": meta,
 	})
 }
 
-// GetDownloadURL generates secure download URL for purchased product
+// purchaseKeyset pages purchases newest first
+var purchaseKeyset = pagination.Keyset{TimeColumn: "purchases.created_at", IDColumn: "purchases.id", Desc: true}
+
+func purchaseKey(purchase models.Purchase) (time.Time, string) {
+	return purchase.CreatedAt, purchase.ID
+}
+
+// buildRetryAfter is how many seconds clients wait before asking again for a download
+// whose personalized copy is still being built
+const buildRetryAfter = 5
+
+// GetDownloadURL issues a short-lived, single-use download token for a purchased product.
+// While a personalized copy is being built it responds 202 with a Retry-After header.
 func GetDownloadURL(c *fiber.Ctx) error {
 	user := c.Locals("user").(*models.User)
 	purchaseID := c.Params("id")
 	
 	var purchase models.Purchase
 	if err := database.DB.Where("id = ? AND user_id = ?", purchaseID, user.ID).
-		Preload("Product").First(&purchase).Error; err != nil {
+		Preload("Product").Preload("User").First(&purchase).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": fiber.Map{
 				"code":    "NOT_FOUND",
@@ -134,25 +134,110 @@ func GetDownloadURL(c *fiber.Ctx) error {
 		})
 	}
 	
-	// Increment download count
-	if err := purchase.IncrementDownload(database.DB); err != nil {
+	if purchase.Product.HasPendingSecretReview() {
+		return secretReviewPending(c)
+	}
+
+	// Buyers whose update window ended get the newest release it covers
+	objectKey := purchase.Product.FileKey
+	fileSize := purchase.Product.FileSize
+	release, err := purchase.LatestCoveredRelease(database.DB)
+	if err == models.ErrOutsideUpdateWindow {
+		return c.Status(403).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "OUTSIDE_UPDATE_WINDOW",
+				"message": "Every release was published after your update window ended",
+			},
+		})
+	}
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": fiber.Map{
-				"code":    "INTERNAL_ERROR",
-				"message": "Failed to update download count",
+				"code":    "DATABASE_ERROR",
+				"message": "Failed to load releases",
+			},
+		})
+	}
+	if release != nil && release.ObjectKey != objectKey {
+		if models.AssetScanStatus(database.DB, release.ObjectKey) != "clean" {
+			return fileNotCleared(c)
+		}
+		objectKey = release.ObjectKey
+		fileSize = strconv.FormatInt(release.FileSize, 10)
+	} else if !purchase.Product.IsScanClean() {
+		return fileNotCleared(c)
+	}
+	if objectKey == "" {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "FILE_NOT_FOUND",
+				"message": "No file available for this product",
 			},
 		})
 	}
 	
-	// Generate pre-signed URL for secure download
-	downloadURL := generatePresignedDownloadURL(purchase.Product.FileURL, purchaseID)
-	expiresAt := time.Now().Add(1 * time.Hour)
+	// Sellers can have every buyer download a copy carrying their license
+	var fingerprint string
+	if purchase.Product.PersonalizedBuilds {
+		if objectStore == nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    "SERVICE_ERROR",
+					"message": "File download service not available",
+				},
+			})
+		}
+		build, err := personalizedBuild(&purchase, objectKey)
+		if err != nil {
+			if err != errBuildFailed {
+				log.Printf("Failed to request personalized archive for purchase %s: %v", purchase.ID, err)
+			}
+			return c.Status(500).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    "BUILD_FAILED",
+					"message": "Failed to prepare your personalized download",
+				},
+			})
+		}
+		// The copy is built in the background; the client asks again after a while
+		if build == nil {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(buildRetryAfter))
+			return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+				"status":     "building",
+				"retryAfter": buildRetryAfter,
+				"message":    "Your personalized download is being prepared",
+			})
+		}
+		objectKey = build.ObjectKey
+		fingerprint = build.Fingerprint
+		fileSize = strconv.FormatInt(build.Size, 10)
+	}
 	
-	return c.JSON(fiber.Map{
-		"downloadUrl": downloadURL,
-		"expiresAt":   expiresAt,
-		"fileSize":    purchase.Product.FileSize,
-	})
+	// Only one outstanding token per purchase so MaxDownloads can't be bypassed
+	database.DB.Model(&models.DownloadToken{}).
+		Where("purchase_id = ? AND consumed_at IS NULL AND expires_at > ?", purchase.ID, time.Now()).
+		Update("expires_at", time.Now())
+	
+	token, rawToken := models.NewDownloadToken(&purchase, objectKey)
+	if err := database.DB.Create(token).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to create download token",
+			},
+		})
+	}
+	
+	response := fiber.Map{
+		"downloadUrl":        "/api/dl/" + rawToken,
+		"expiresAt":          token.ExpiresAt,
+		"fileSize":           fileSize,
+		"remainingDownloads": purchase.RemainingDownloads(),
+	}
+	if fingerprint != "" {
+		response["fingerprint"] = fingerprint
+	}
+	return c.JSON(response)
 }
 
 // GenerateLicense generates new license key for purchase
@@ -257,6 +342,10 @@ func CreatePurchase(c *fiber.Ctx) error {
 			},
 		})
 	}
+
+	if !product.IsScanClean() {
+		return fileNotCleared(c)
+	}
 	
 	// Create purchase
 	purchase := models.Purchase{
@@ -463,14 +552,6 @@ func ResolveDispute(c *fiber.Ctx) error {
 		})
 	}
 	
-	// Delete S3 file if dispute is resolved as confirmed (not refunded)
-	if !req.Refund && purchase.Status == "confirmed" {
-		if err := deleteS3FileForPurchase(purchase); err != nil {
-			fmt.Printf("Warning: Failed to delete S3 file for purchase %s: %v\n", purchase.ID, err)
-			// Don't fail the dispute resolution if file deletion fails
-		}
-	}
-	
 	if err := database.DB.Save(&purchase).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": fiber.Map{
@@ -503,22 +584,21 @@ func GetDisputedPurchases(c *fiber.Ctx) error {
 		})
 	}
 	
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	limit, _ := strconv.Atoi(c.Query("limit", "10"))
-	offset := (page - 1) * limit
+	params, err := pagination.ParseOffset(c, 10)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
 	
 	var purchases []models.Purchase
-	var total int64
 	
 	// Get disputed purchases
 	query := database.DB.Model(&models.Purchase{}).
 		Where("status IN ?", []string{"dispute_requested", "dispute_processing"})
 	
-	query.Count(&total)
+	total := params.Count(query)
 	
-	if err := query.Preload("Product").Preload("User").
-		Order("dispute_requested_at DESC").
-		Limit(limit).Offset(offset).
+	if err := params.Window(query.Preload("Product").Preload("User").
+		Order("dispute_requested_at DESC")).
 		Find(&purchases).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": fiber.Map{
@@ -527,6 +607,7 @@ func GetDisputedPurchases(c *fiber.Ctx) error {
 			},
 		})
 	}
+	purchases, meta := pagination.Trim(params, purchases, total, nil)
 	
 	var disputedPurchases []fiber.Map
 	for _, purchase := range purchases {
@@ -559,128 +640,7 @@ func GetDisputedPurchases(c *fiber.Ctx) error {
 	}
 	
 	return c.JSON(fiber.Map{
-		"disputes": disputedPurchases,
-		"pagination": fiber.Map{
-			"currentPage":  page,
-			"totalPages":   (total + int64(limit) - 1) / int64(limit),
-			"totalItems":   total,
-			"itemsPerPage": limit,
-		},
+		"disputes":   disputedPurchases,
+		"pagination": meta,
 	})
 }
-
-// generatePresignedDownloadURLWithExpiry generates a secure pre-signed S3 download URL valid until auto-confirm date
-func generatePresignedDownloadURLWithExpiry(fileURL, purchaseID string, autoConfirmAt *time.Time) string {
-	fmt.Printf("DEBUG: generatePresignedDownloadURLWithExpiry called with fileURL: %s, purchaseID: %s\n", fileURL, purchaseID)
-	
-	if fileURL == "" {
-		fmt.Printf("DEBUG: fileURL is empty, returning fallback\n")
-		return "https://download.vibing.com/secure/" + purchaseID
-	}
-	
-	// Calculate expiry duration (until auto-confirm date, max 7 days for AWS limits)
-	var expiry time.Duration
-	if autoConfirmAt != nil {
-		timeUntilConfirm := time.Until(*autoConfirmAt)
-		fmt.Printf("DEBUG: time until auto-confirm: %v\n", timeUntilConfirm)
-		
-		if timeUntilConfirm > 0 {
-			// AWS pre-signed URLs have a maximum validity of 7 days
-			maxDuration := 7 * 24 * time.Hour
-			if timeUntilConfirm > maxDuration {
-				expiry = maxDuration
-				fmt.Printf("DEBUG: using max duration (7 days) due to AWS limits\n")
-			} else {
-				expiry = timeUntilConfirm
-				fmt.Printf("DEBUG: using time until auto-confirm: %v\n", expiry)
-			}
-		} else {
-			fmt.Printf("DEBUG: auto-confirm time has passed, using 1 hour fallback\n")
-			expiry = 1 * time.Hour
-		}
-	} else {
-		fmt.Printf("DEBUG: no auto-confirm time set, using 1 hour fallback\n")
-		expiry = 1 * time.Hour
-	}
-	
-	// Extract S3 key from the full S3 URL
-	s3Key := extractS3Key(fileURL)
-	fmt.Printf("DEBUG: extracted S3 key: %s\n", s3Key)
-	if s3Key == "" {
-		fmt.Printf("DEBUG: failed to extract S3 key, returning original URL\n")
-		return fileURL
-	}
-	
-	// Load S3 configuration
-	cfg, err := config.Load()
-	if err != nil {
-		fmt.Printf("DEBUG: failed to load config: %v\n", err)
-		return "https://download.vibing.com/secure/" + purchaseID
-	}
-	
-	// Create S3 service
-	s3Service, err := services.NewS3Service(&cfg.S3)
-	if err != nil {
-		fmt.Printf("DEBUG: failed to create S3 service: %v\n", err)
-		return "https://download.vibing.com/secure/" + purchaseID
-	}
-	
-	// Generate pre-signed URL with calculated expiry
-	presignedURL, err := s3Service.GeneratePresignedURL(s3Key, expiry)
-	if err != nil {
-		fmt.Printf("DEBUG: failed to generate pre-signed URL: %v\n", err)
-		return "https://download.vibing.com/secure/" + purchaseID
-	}
-	
-	fmt.Printf("DEBUG: successfully generated pre-signed URL valid for %v: %s\n", expiry, presignedURL[:100]+"...")
-	return presignedURL
-}
-
-// generatePresignedDownloadURL generates a secure pre-signed S3 download URL (backward compatibility)
-func generatePresignedDownloadURL(fileURL, purchaseID string) string {
-	return generatePresignedDownloadURLWithExpiry(fileURL, purchaseID, nil)
-}
-
-// extractS3Key extracts the S3 object key from a full S3 URL
-// Example: https://bucket.s3.region.amazonaws.com/path/to/file.zip -> path/to/file.zip
-func extractS3Key(s3URL string) string {
-	// Split by ".amazonaws.com/"
-	parts := strings.Split(s3URL, ".amazonaws.com/")
-	if len(parts) == 2 {
-		return parts[1]
-	}
-	return ""
-}
-
-// deleteS3FileForPurchase deletes the S3 file for a purchase
-func deleteS3FileForPurchase(purchase models.Purchase) error {
-	if purchase.Product.FileURL == "" {
-		return nil // No file to delete
-	}
-	
-	// Extract S3 key from the full S3 URL
-	s3Key := extractS3Key(purchase.Product.FileURL)
-	if s3Key == "" {
-		return fmt.Errorf("failed to extract S3 key from URL: %s", purchase.Product.FileURL)
-	}
-	
-	// Load S3 configuration
-	cfg, err := config.Load()
-	if err != nil {
-		return fmt.Errorf("failed to load config: %v", err)
-	}
-	
-	// Create S3 service
-	s3Service, err := services.NewS3Service(&cfg.S3)
-	if err != nil {
-		return fmt.Errorf("failed to create S3 service: %v", err)
-	}
-	
-	// Delete the file
-	if err := s3Service.DeleteFile(s3Key); err != nil {
-		return fmt.Errorf("failed to delete S3 file: %v", err)
-	}
-	
-	fmt.Printf("Successfully deleted S3 file for purchase %s: %s\n", purchase.ID, s3Key)
-	return nil
-}
\ No newline at end of file
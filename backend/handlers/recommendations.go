@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"vibing-backend/database"
+	"vibing-backend/models"
+	"vibing-backend/pagination"
+	"vibing-backend/services"
+)
+
+// maxFeedItems bounds the "for you" feed
+const maxFeedItems = 48
+
+// GetProductRecommendations returns the products customers also bought with a product,
+// topped up with similar products. Signed-in users don't see products they own.
+func GetProductRecommendations(c *fiber.Ctx) error {
+	limit, err := pagination.QueryInt(c, "limit", 6, services.MaxRecommendations)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
+
+	var product models.Product
+	if err := database.DB.Where("id = ? AND status = ?", c.Params("id"), "active").First(&product).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Product not found",
+			},
+		})
+	}
+
+	var owned []string
+	if user, ok := c.Locals("user").(*models.User); ok {
+		if owned, err = models.OwnedProductIDs(database.DB, user.ID); err != nil {
+			return recommendationsFailed(c)
+		}
+	}
+
+	recs, err := services.ProductRecommendations(database.DB, product, owned, limit)
+	if err != nil {
+		return recommendationsFailed(c)
+	}
+	return c.JSON(fiber.Map{"recommendations": recs})
+}
+
+// GetRecommendationsForYou returns a feed built from the user's purchase history
+func GetRecommendationsForYou(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+	limit, err := pagination.QueryInt(c, "limit", 12, maxFeedItems)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
+
+	owned, err := models.OwnedProductIDs(database.DB, user.ID)
+	if err != nil {
+		return recommendationsFailed(c)
+	}
+	recs, err := services.RecommendationsFor(database.DB, owned, limit)
+	if err != nil {
+		return recommendationsFailed(c)
+	}
+	return c.JSON(fiber.Map{"recommendations": recs})
+}
+
+func recommendationsFailed(c *fiber.Ctx) error {
+	return c.Status(500).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch recommendations",
+		},
+	})
+}
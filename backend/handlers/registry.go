@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"vibing-backend/config"
+	"vibing-backend/database"
+	"vibing-backend/models"
+)
+
+// publicURL is the base of URLs in signed install scripts, the Homebrew tap and npm
+// metadata. It is configured rather than taken from the Host header, which clients control.
+var publicURL string
+
+var errNoPublicURL = errors.New("PUBLIC_URL is not configured")
+
+// SetPublicURL configures the base of published URLs
+func SetPublicURL(cfg *config.ServerConfig) {
+	publicURL = strings.TrimRight(cfg.PublicURL, "/")
+}
+
+// publicURLMissing refuses endpoints that publish URLs while the base isn't configured
+func publicURLMissing(c *fiber.Ctx) error {
+	return c.Status(503).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "SERVICE_UNAVAILABLE",
+			"message": "This endpoint is not available until PUBLIC_URL is configured",
+		},
+	})
+}
+
+// packageAccess is what a user may fetch of a package served by a registry endpoint
+// (the Go module proxy or the npm registry)
+type packageAccess struct {
+	// allowed is false when the user neither bought nor sells the package
+	allowed bool
+	// purchase is the entitlement the package is served under; nil for the product's seller
+	purchase *models.Purchase
+	product  models.Product
+	// releases are the clean releases of the package inside the buyer's update window.
+	// Buyers get none while the product's secret review is pending.
+	releases []models.ProductRelease
+}
+
+// resolvePackage finds the product behind a package name that the user may fetch: one
+// they hold an active entitlement for, or sell. column is the release column holding
+// the package name. Returns nil if no product declares the package.
+func resolvePackage(user *models.User, column, name string) (*packageAccess, error) {
+	var productIDs []string
+	if err := database.DB.Model(&models.ProductRelease{}).
+		Where(column+" = ?", name).
+		Distinct().
+		Pluck("product_id", &productIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(productIDs) == 0 {
+		return nil, nil
+	}
+
+	access, err := productAccess(user, productIDs)
+	if err != nil || !access.allowed {
+		return access, err
+	}
+	if access.purchase != nil && access.product.HasPendingSecretReview() {
+		return access, nil
+	}
+
+	var releases []models.ProductRelease
+	if err := database.DB.Where("product_id = ? AND "+column+" = ?", access.product.ID, name).
+		Order("created_at ASC").
+		Find(&releases).Error; err != nil {
+		return nil, err
+	}
+	for _, release := range releases {
+		if !access.covers(&release) {
+			continue
+		}
+		if models.AssetScanStatus(database.DB, release.ObjectKey) != "clean" {
+			continue
+		}
+		access.releases = append(access.releases, release)
+	}
+	return access, nil
+}
+
+// productAccess picks the product among productIDs that the user may fetch: the latest
+// they hold an active entitlement for, else one they sell. allowed is false if neither.
+func productAccess(user *models.User, productIDs []string) (*packageAccess, error) {
+	access := &packageAccess{}
+
+	var purchase models.Purchase
+	if err := database.DB.Scopes(models.ActiveEntitlements).
+		Where("user_id = ? AND product_id IN ?", user.ID, productIDs).
+		Preload("Product", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped()
+		}).
+		Order("created_at DESC").
+		First(&purchase).Error; err == nil {
+		access.purchase = &purchase
+		access.product = purchase.Product
+	} else if err := database.DB.Where("id IN ? AND author_id = ?", productIDs, user.ID).
+		First(&access.product).Error; err != nil {
+		return access, nil
+	}
+	access.allowed = true
+	return access, nil
+}
+
+// covers reports whether the release falls inside the buyer's update window
+func (a *packageAccess) covers(release *models.ProductRelease) bool {
+	return a.purchase == nil || a.purchase.CoversRelease(release.CreatedAt, a.product.UpdateWindowDays)
+}
+
+// packageDownloadStream wraps a package download. Fetches by buyers are logged and
+// count as a download of their purchase once the body was read to the end.
+func packageDownloadStream(c *fiber.Ctx, purchase *models.Purchase, objectKey string, body io.ReadCloser, size int64) *downloadStream {
+	stream := &downloadStream{body: body, onClose: func(int64) {}}
+	if purchase == nil {
+		return stream
+	}
+
+	entry := models.DownloadLog{
+		PurchaseID: purchase.ID,
+		UserID:     purchase.UserID,
+		ObjectKey:  objectKey,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get(fiber.HeaderUserAgent),
+		ObjectSize: size,
+	}
+	if err := database.DB.Create(&entry).Error; err != nil {
+		log.Printf("Failed to create download log for purchase %s: %v", purchase.ID, err)
+	}
+	stream.onClose = func(served int64) {
+		finishDownload(nil, purchase, &entry, served, stream.eof)
+	}
+	return stream
+}
+
+// latestVersion picks the highest release, or the highest pre-release if there is no release
+func latestVersion(versions []string) string {
+	latest, latestPre := "", ""
+	for _, version := range versions {
+		if models.IsPrerelease(version) {
+			if latestPre == "" || models.CompareVersions(version, latestPre) > 0 {
+				latestPre = version
+			}
+		} else if latest == "" || models.CompareVersions(version, latest) > 0 {
+			latest = version
+		}
+	}
+	if latest == "" {
+		return latestPre
+	}
+	return latest
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"vibing-backend/database"
+	"vibing-backend/models"
+)
+
+var errReleaseExists = errors.New("a release with this version already exists")
+
+// resolveReleaseVersion validates a seller-supplied release version. An empty version
+// is resolved later to the next patch version when the archive is attached.
+func resolveReleaseVersion(productID, requested string) (string, error) {
+	if requested == "" {
+		return "", nil
+	}
+
+	version, err := models.NormalizeVersion(requested)
+	if err != nil {
+		return "", err
+	}
+
+	var existing int64
+	database.DB.Model(&models.ProductRelease{}).
+		Where("product_id = ? AND version = ?", productID, version).
+		Count(&existing)
+	if existing > 0 {
+		return "", errReleaseExists
+	}
+
+	return version, nil
+}
+
+// releaseVersionRejected responds to an error from resolveReleaseVersion or attachProductFile
+func releaseVersionRejected(c *fiber.Ctx, err error) error {
+	if err == errReleaseExists {
+		return c.Status(409).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VERSION_EXISTS",
+				"message": "A release with this version already exists",
+			},
+		})
+	}
+
+	return c.Status(400).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "VALIDATION_ERROR",
+			"message": err.Error(),
+		},
+	})
+}
+
+// GetProductReleases lists the releases of a product with their license summary
+func GetProductReleases(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var product models.Product
+	if err := database.DB.Where("id = ? AND status = ?", id, "active").First(&product).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Product not found",
+			},
+		})
+	}
+
+	var releases []models.ProductRelease
+	if err := database.DB.Where("product_id = ?", product.ID).Preload("Assets").
+		Order("created_at DESC").Find(&releases).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to fetch releases",
+			},
+		})
+	}
+
+	// Patches from the previous release, keyed by the release they produce
+	var deltas []models.ReleaseDelta
+	database.DB.Where("product_id = ? AND status = ?", product.ID, "ready").Find(&deltas)
+	patches := make(map[string]fiber.Map, len(deltas))
+	for _, delta := range deltas {
+		patches[delta.ToReleaseID] = fiber.Map{
+			"from":         delta.FromVersion,
+			"size":         delta.Size,
+			"sourceSha256": delta.SourceSHA256,
+		}
+	}
+
+	result := make([]fiber.Map, 0, len(releases))
+	for _, release := range releases {
+		result = append(result, fiber.Map{
+			"id":              release.ID,
+			"version":         release.Version,
+			"fileSize":        release.FileSize,
+			"sha256":          release.SHA256,
+			"licenses":        release.Licenses,
+			"licenseWarnings": release.LicenseWarnings,
+			"dependencyCount": release.DependencyCount,
+			"hasSbom":         release.HasSBOM(),
+			"assets":          release.Assets,
+			"patch":           patches[release.ID],
+			"createdAt":       release.CreatedAt,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"releases":    result,
+		"licenseType": product.LicenseType,
+	})
+}
+
+// DownloadProductSBOM streams the CycloneDX SBOM of a release, the latest one unless ?version= is given
+func DownloadProductSBOM(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var product models.Product
+	if err := database.DB.Where("id = ? AND status = ?", id, "active").First(&product).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Product not found",
+			},
+		})
+	}
+
+	var release models.ProductRelease
+	query := database.DB.Where("product_id = ?", product.ID)
+	if version := c.Query("version"); version != "" {
+		normalized, err := models.NormalizeVersion(version)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    "VALIDATION_ERROR",
+					"message": err.Error(),
+				},
+			})
+		}
+		query = query.Where("version = ?", normalized)
+	}
+	if err := query.Order("created_at DESC").First(&release).Error; err != nil || !release.HasSBOM() {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "SBOM_NOT_FOUND",
+				"message": "No SBOM is available for this release",
+			},
+		})
+	}
+
+	if objectStore == nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "SERVICE_ERROR",
+				"message": "Storage service not available",
+			},
+		})
+	}
+
+	object, err := objectStore.Get(release.SBOMKey, "")
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "SBOM_NOT_FOUND",
+				"message": "No SBOM is available for this release",
+			},
+		})
+	}
+	defer object.Body.Close()
+
+	c.Set(fiber.HeaderContentType, "application/vnd.cyclonedx+json")
+	c.Set(fiber.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="%s-%s.cdx.json"`, product.ID, release.Version))
+
+	body, err := io.ReadAll(object.Body)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to read SBOM",
+			},
+		})
+	}
+	return c.Send(body)
+}
+
+// GetReleasePatch issues a download token for the patch from one release to the next.
+// Patches only exist between consecutive releases; clients apply them in sequence and
+// check the result against targetSha256. Redeeming the token counts as a download.
+func GetReleasePatch(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	from, err := models.NormalizeVersion(c.Params("from"))
+	if err != nil {
+		return releaseVersionRejected(c, err)
+	}
+	to, err := models.NormalizeVersion(c.Params("to"))
+	if err != nil {
+		return releaseVersionRejected(c, err)
+	}
+
+	var purchase models.Purchase
+	if err := database.DB.Scopes(models.ActiveEntitlements).
+		Where("user_id = ? AND product_id = ?", user.ID, c.Params("id")).
+		Preload("Product").
+		Order("created_at DESC").
+		First(&purchase).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Purchase not found",
+			},
+		})
+	}
+
+	if !purchase.CanDownload() {
+		return c.Status(403).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "FORBIDDEN",
+				"message": "Download not allowed",
+			},
+		})
+	}
+
+	if purchase.Product.PersonalizedBuilds {
+		return c.Status(409).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "PATCH_UNAVAILABLE",
+				"message": "Patches aren't available for products with personalized builds",
+			},
+		})
+	}
+
+	var delta models.ReleaseDelta
+	if err := database.DB.Where("product_id = ? AND from_version = ? AND to_version = ? AND status = ?",
+		purchase.ProductID, from, to, "ready").
+		First(&delta).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "PATCH_NOT_FOUND",
+				"message": "No patch between these releases; patches only exist between consecutive releases",
+			},
+		})
+	}
+
+	var target models.ProductRelease
+	if err := database.DB.Where("id = ?", delta.ToReleaseID).First(&target).Error; err != nil ||
+		!purchase.CoversRelease(target.CreatedAt, purchase.Product.UpdateWindowDays) {
+		return c.Status(403).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "OUTSIDE_UPDATE_WINDOW",
+				"message": "This release was published after your update window ended",
+			},
+		})
+	}
+	if models.AssetScanStatus(database.DB, target.ObjectKey) != "clean" {
+		return fileNotCleared(c)
+	}
+	if purchase.Product.HasPendingSecretReview() {
+		return secretReviewPending(c)
+	}
+
+	// Only one outstanding token per purchase so MaxDownloads can't be bypassed
+	database.DB.Model(&models.DownloadToken{}).
+		Where("purchase_id = ? AND consumed_at IS NULL AND expires_at > ?", purchase.ID, time.Now()).
+		Update("expires_at", time.Now())
+
+	token, rawToken := models.NewDownloadToken(&purchase, delta.ObjectKey)
+	if err := database.DB.Create(token).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to create download token",
+			},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"downloadUrl":        "/api/dl/" + rawToken,
+		"expiresAt":          token.ExpiresAt,
+		"fromVersion":        delta.FromVersion,
+		"toVersion":          delta.ToVersion,
+		"patchSize":          delta.Size,
+		"patchSha256":        delta.SHA256,
+		"sourceSha256":       delta.SourceSHA256,
+		"targetSha256":       delta.TargetSHA256,
+		"targetSize":         delta.TargetSize,
+		"remainingDownloads": purchase.RemainingDownloads(),
+	})
+}
@@ -1,11 +1,11 @@
 package handlers
 
 import (
-	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 	"vibing-backend/database"
 	"vibing-backend/models"
+	"vibing-backend/pagination"
 )
 
 // GetSellerDashboard returns seller dashboard data
@@ -17,6 +17,8 @@ func GetSellerDashboard(c *fiber.Ctx) error {
 		TotalSales    int64   `json:"totalSales"`
 		TotalProducts int64   `json:"totalProducts"`
 		AvgRating     float64 `json:"avgRating"`
+		// TotalWishlists sums the wishlist counts of the seller's products
+		TotalWishlists int64 `json:"totalWishlists"`
 	}
 
 	// Get total revenue and sales from completed purchases
@@ -37,6 +39,12 @@ func GetSellerDashboard(c *fiber.Ctx) error {
 		Select("COALESCE(AVG(rating), 0)").
 		Row().Scan(&stats.AvgRating)
 
+	// Get how many times the seller's products were liked
+	database.DB.Model(&models.Product{}).
+		Where("author_id = ?", user.ID).
+		Select("COALESCE(SUM(wishlist_count), 0)").
+		Row().Scan(&stats.TotalWishlists)
+
 	// Get recent products
 	var products []models.Product
 	database.DB.Where("author_id = ?", user.ID).
@@ -64,6 +72,7 @@ func GetSellerDashboard(c *fiber.Ctx) error {
 			"revenue":   revenue,
 			"views":     product.Views,
 			"downloads": product.Downloads,
+			"wishlists": product.WishlistCount,
 			"status":    product.Status,
 			"createdAt": product.CreatedAt,
 		})
@@ -78,12 +87,12 @@ func GetSellerDashboard(c *fiber.Ctx) error {
 // GetSellerProducts returns seller's products with pagination
 func GetSellerProducts(c *fiber.Ctx) error {
 	user := c.Locals("user").(*models.User)
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	limit, _ := strconv.Atoi(c.Query("limit", "10"))
+	params, err := pagination.Parse(c, 10)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
 	status := c.Query("status", "")
 
-	offset := (page - 1) * limit
-
 	query := database.DB.Model(&models.Product{}).Where("author_id = ?", user.ID)
 
 	if status != "" {
@@ -91,49 +100,40 @@ func GetSellerProducts(c *fiber.Ctx) error {
 	}
 
 	var products []models.Product
-	var total int64
 
-	query.Count(&total)
-	query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&products)
+	total := params.Count(query)
+	newestProducts.Apply(query, params).Find(&products)
+	products, meta := pagination.Trim(params, products, total, productKey)
 
 	return c.JSON(fiber.Map{
-		"products": products,
-		"pagination": fiber.Map{
-			"currentPage":  page,
-			"totalPages":   (total + int64(limit) - 1) / int64(limit),
-			"totalItems":   total,
-			"itemsPerPage": limit,
-		},
+		"products":   products,
+		"pagination": meta,
 	})
 }
 
 // GetSellerSales returns seller's sales history
 func GetSellerSales(c *fiber.Ctx) error {
 	user := c.Locals("user").(*models.User)
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	limit, _ := strconv.Atoi(c.Query("limit", "10"))
-
-	offset := (page - 1) * limit
+	params, err := pagination.Parse(c, 10)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
 
 	var purchases []models.Purchase
-	var total int64
 
 	// Count total sales
-	database.DB.Model(&models.Purchase{}).
+	total := params.Count(database.DB.Model(&models.Purchase{}).
 		Joins("JOIN products ON purchases.product_id = products.id").
-		Where("products.author_id = ? AND purchases.status = ?", user.ID, "completed").
-		Count(&total)
+		Where("products.author_id = ? AND purchases.status = ?", user.ID, "completed"))
 
 	// Get paginated sales with product and user details
-	database.DB.
+	purchaseKeyset.Apply(database.DB.
 		Joins("JOIN products ON purchases.product_id = products.id").
-		Where("products.author_id = ? AND purchases.status = ?", user.ID, "completed").
+		Where("products.author_id = ? AND purchases.status = ?", user.ID, "completed"), params).
 		Preload("Product").
 		Preload("User").
-		Order("purchases.created_at DESC").
-		Limit(limit).
-		Offset(offset).
 		Find(&purchases)
+	purchases, meta := pagination.Trim(params, purchases, total, purchaseKey)
 
 	// Format response
 	var salesData []fiber.Map
@@ -156,12 +156,7 @@ func GetSellerSales(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
-		"sales": salesData,
-		"pagination": fiber.Map{
-			"currentPage":  page,
-			"totalPages":   (total + int64(limit) - 1) / int64(limit),
-			"totalItems":   total,
-			"itemsPerPage": limit,
-		},
+		"sales":      salesData,
+		"pagination": meta,
 	})
 }
\ No newline at end of file
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"vibing-backend/services"
+)
+
+// ServeLocalObject serves presigned URLs issued by the local storage backend
+func ServeLocalObject(c *fiber.Ctx) error {
+	store, ok := objectStore.(*services.LocalStore)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Not found",
+			},
+		})
+	}
+
+	key, err := url.PathUnescape(c.Params("*"))
+	if err != nil || !store.VerifyPresigned(key, c.Query("expires"), c.Query("signature")) {
+		return c.Status(403).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "FORBIDDEN",
+				"message": "Invalid or expired link",
+			},
+		})
+	}
+
+	info, err := store.Stat(key)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "FILE_NOT_FOUND",
+				"message": "File not found",
+			},
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, info.ContentType)
+	return c.SendFile(store.Path(key))
+}
+
+// ServeMedia serves public product images and recordings under stable URLs. Extensionless variant keys
+// such as images/{id}/card are negotiated: WebP when the client accepts it, JPEG/PNG otherwise.
+func ServeMedia(c *fiber.Ctx) error {
+	key, err := url.PathUnescape(c.Params("*"))
+	if err != nil || objectStore == nil || !services.IsPublicMediaKey(key) ||
+		strings.Contains(key, "..") {
+		return mediaNotFound(c)
+	}
+
+	acceptWebP := strings.Contains(c.Get(fiber.HeaderAccept), "image/webp")
+	resolved, info, err := services.ResolveMediaKey(objectStore, key, acceptWebP)
+	if err != nil {
+		return mediaNotFound(c)
+	}
+
+	object, err := objectStore.Get(resolved, "")
+	if err != nil {
+		return mediaNotFound(c)
+	}
+
+	if resolved != key {
+		c.Set(fiber.HeaderVary, fiber.HeaderAccept)
+	}
+	c.Set(fiber.HeaderContentType, info.ContentType)
+	// Keys are never reused, so responses can be cached indefinitely
+	c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	return c.SendStream(object.Body, int(object.ContentLength))
+}
+
+func mediaNotFound(c *fiber.Ctx) error {
+	return c.Status(404).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "NOT_FOUND",
+			"message": "Image not found",
+		},
+	})
+}
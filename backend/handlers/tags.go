@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"vibing-backend/database"
+	"vibing-backend/models"
+	"vibing-backend/pagination"
+)
+
+const (
+	// maxTagSuggestions bounds the tags returned by autocomplete
+	maxTagSuggestions = 20
+	// maxRelatedTags bounds the related tags of a tag page
+	maxRelatedTags = 10
+)
+
+// normalizeProductTags maps the tags of a product to canonical slugs, registering new ones
+func normalizeProductTags(raw []string) ([]string, error) {
+	tags, err := models.NormalizeTags(database.DB, raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) > models.MaxProductTags {
+		return nil, errTooManyTags
+	}
+	return tags, nil
+}
+
+var errTooManyTags = fmt.Errorf("a product can have at most %d tags", models.MaxProductTags)
+
+// invalidTags responds to an error from normalizeProductTags
+func invalidTags(c *fiber.Ctx, err error) error {
+	if err != errTooManyTags {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to register tags",
+			},
+		})
+	}
+	return c.Status(400).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "VALIDATION_ERROR",
+			"message": "Validation failed",
+			"details": []map[string]string{
+				{"field": "Tags", "message": err.Error()},
+			},
+		},
+	})
+}
+
+// GetTags autocompletes tags by prefix of their slug or an alias, most used first.
+// Without a query it returns the most used tags.
+func GetTags(c *fiber.Ctx) error {
+	limit, err := pagination.QueryInt(c, "limit", 10, maxTagSuggestions)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
+
+	query := database.DB.Model(&models.Tag{})
+	if prefix := models.TagSlug(c.Query("q")); prefix != "" {
+		query = query.Where("slug LIKE ? OR id IN (?)", prefix+"%",
+			database.DB.Model(&models.TagAlias{}).Select("tag_id").Where("alias LIKE ?", models.TagKey(prefix)+"%"))
+	} else {
+		query = query.Where("usage_count > 0")
+	}
+
+	var tags []models.Tag
+	if err := query.Order("usage_count DESC, slug ASC").Limit(limit).Find(&tags).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to fetch tags",
+			},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"tags": tags,
+	})
+}
+
+// GetTag returns a tag landing page: the tag, its products and the tags most often used
+// together with it. Aliases resolve to the canonical tag, whose slug is returned.
+func GetTag(c *fiber.Ctx) error {
+	params, err := pagination.Parse(c, 12)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
+
+	tag, err := models.ResolveTag(database.DB, c.Params("slug"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to fetch tag",
+			},
+		})
+	}
+	if tag == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Tag not found",
+			},
+		})
+	}
+
+	query := database.DB.Model(&models.Product{}).
+		Where("status = ? AND tags @> ARRAY[?]::text[]", "active", tag.Slug)
+
+	var products []models.Product
+	total := params.Count(query)
+	newestProducts.Apply(query, params).Preload("Media", models.OrderedMedia).Find(&products)
+	products, meta := pagination.Trim(params, products, total, productKey)
+
+	related, err := relatedTags(tag.Slug)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to fetch related tags",
+			},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"tag":         tag,
+		"products":    products,
+		"relatedTags": related,
+		"pagination":  meta,
+	})
+}
+
+// relatedTags returns the tags that appear on the most active products together with slug
+func relatedTags(slug string) ([]fiber.Map, error) {
+	var rows []struct {
+		Slug  string
+		Name  string
+		Count int64
+	}
+	err := database.DB.Model(&models.Product{}).
+		Joins("CROSS JOIN LATERAL unnest(products.tags) AS other").
+		Joins("JOIN tags ON tags.slug = other").
+		Where("products.status = ? AND products.tags @> ARRAY[?]::text[] AND other <> ?", "active", slug, slug).
+		Select("tags.slug, tags.name, count(*) AS count").
+		Group("tags.slug, tags.name").
+		Order("count DESC, tags.slug ASC").
+		Limit(maxRelatedTags).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	related := make([]fiber.Map, len(rows))
+	for i, row := range rows {
+		related[i] = fiber.Map{"slug": row.Slug, "name": row.Name, "count": row.Count}
+	}
+	return related, nil
+}
+
+// GetAdminTags lists tags with their aliases, most used first (admin only)
+func GetAdminTags(c *fiber.Ctx) error {
+	params, err := pagination.ParseOffset(c, 50)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
+
+	query := database.DB.Model(&models.Tag{})
+	if prefix := models.TagSlug(c.Query("q")); prefix != "" {
+		query = query.Where("slug LIKE ?", prefix+"%")
+	}
+
+	var tags []models.Tag
+	total := params.Count(query)
+	params.Window(query.Order("usage_count DESC, slug ASC")).Preload("Aliases").Find(&tags)
+	tags, meta := pagination.Trim(params, tags, total, nil)
+
+	return c.JSON(fiber.Map{
+		"tags":       tags,
+		"pagination": meta,
+	})
+}
+
+// RenameTag changes the slug and display name of a tag (admin only). Products are
+// updated and the old spelling stays an alias.
+func RenameTag(c *fiber.Ctx) error {
+	var tag models.Tag
+	if err := database.DB.Where("id = ?", c.Params("id")).First(&tag).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Tag not found",
+			},
+		})
+	}
+
+	var req struct {
+		Slug string `json:"slug"`
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "Invalid request body",
+			},
+		})
+	}
+
+	slug := tag.Slug
+	if req.Slug != "" {
+		slug = models.TagSlug(req.Slug)
+	}
+	name := strings.Join(strings.Fields(req.Name), " ")
+	if name == "" {
+		name = tag.Name
+	}
+	if slug == "" || len(name) > 100 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "Slug must contain letters or digits and the name at most 100 characters",
+			},
+		})
+	}
+
+	if slug != tag.Slug {
+		var taken int64
+		database.DB.Model(&models.Tag{}).Where("slug = ?", slug).Count(&taken)
+		if taken > 0 {
+			return c.Status(409).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    "SLUG_TAKEN",
+					"message": "Another tag already uses this slug; merge the tags instead",
+				},
+			})
+		}
+	}
+
+	oldSlug := tag.Slug
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		tag.Slug = slug
+		tag.Name = name
+		if err := tx.Save(&tag).Error; err != nil {
+			return err
+		}
+		if slug == oldSlug {
+			return nil
+		}
+		if err := models.AddTagAlias(tx, tag.ID, slug); err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&models.Product{}).Where("tags @> ARRAY[?]::text[]", oldSlug).
+			UpdateColumn("tags", gorm.Expr("array_replace(tags, ?, ?)", oldSlug, slug)).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to rename tag",
+			},
+		})
+	}
+
+	return c.JSON(tag)
+}
+
+// MergeTag folds a tag into another one (admin only). Products with the merged tag get the
+// target tag instead, and the merged tag's spellings become aliases of the target.
+func MergeTag(c *fiber.Ctx) error {
+	var source models.Tag
+	if err := database.DB.Where("id = ?", c.Params("id")).First(&source).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Tag not found",
+			},
+		})
+	}
+
+	var req struct {
+		Into string `json:"into"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "Invalid request body",
+			},
+		})
+	}
+
+	var target models.Tag
+	if err := database.DB.Where("slug = ?", models.TagSlug(req.Into)).First(&target).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Target tag not found",
+			},
+		})
+	}
+	if target.ID == source.ID {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "A tag can't be merged into itself",
+			},
+		})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.TagAlias{}).Where("tag_id = ?", source.ID).
+			Update("tag_id", target.ID).Error; err != nil {
+			return err
+		}
+		if err := models.AddTagAlias(tx, target.ID, source.Slug); err != nil {
+			return err
+		}
+
+		// Products with both tags drop the merged one; the rest get it replaced in place
+		if err := tx.Unscoped().Model(&models.Product{}).Where("tags @> ARRAY[?]::text[] AND tags @> ARRAY[?]::text[]", source.Slug, target.Slug).
+			UpdateColumn("tags", gorm.Expr("array_remove(tags, ?)", source.Slug)).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Product{}).Where("tags @> ARRAY[?]::text[]", source.Slug).
+			UpdateColumn("tags", gorm.Expr("array_replace(tags, ?, ?)", source.Slug, target.Slug)).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&source).Error; err != nil {
+			return err
+		}
+		return models.RefreshTagUsage(tx, []string{target.Slug})
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to merge tags",
+			},
+		})
+	}
+
+	database.DB.Where("id = ?", target.ID).Preload("Aliases").First(&target)
+	return c.JSON(target)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"vibing-backend/database"
+	"vibing-backend/models"
+	"vibing-backend/utils"
+)
+
+type CreateAccessTokenRequest struct {
+	Name          string `json:"name" validate:"required,min=1,max=100"`
+	ExpiresInDays int    `json:"expiresInDays" validate:"gte=0,lte=365"`
+}
+
+// GetAccessTokens lists the user's personal access tokens
+func GetAccessTokens(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	var tokens []models.AccessToken
+	database.DB.Where("user_id = ? AND revoked_at IS NULL", user.ID).
+		Order("created_at DESC").
+		Find(&tokens)
+
+	return c.JSON(fiber.Map{
+		"tokens": tokens,
+	})
+}
+
+// CreateAccessToken issues a personal access token. The raw token is only returned here.
+func CreateAccessToken(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	var req CreateAccessTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "Invalid request body",
+			},
+		})
+	}
+	if validationErrors := utils.ValidateStruct(req); len(validationErrors) > 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "VALIDATION_ERROR",
+				"message": "Validation failed",
+				"details": validationErrors,
+			},
+		})
+	}
+
+	var active int64
+	database.DB.Model(&models.AccessToken{}).Scopes(models.ActiveAccessTokens).
+		Where("user_id = ?", user.ID).
+		Count(&active)
+	if active >= models.MaxAccessTokens {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "TOO_MANY_TOKENS",
+				"message": "Revoke an access token before creating another one",
+			},
+		})
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		expiry := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &expiry
+	}
+
+	token, raw := models.NewAccessToken(user.ID, req.Name, expiresAt)
+	if err := database.DB.Create(token).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to create access token",
+			},
+		})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"token":       raw,
+		"accessToken": token,
+	})
+}
+
+// RevokeAccessToken revokes one of the user's personal access tokens
+func RevokeAccessToken(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	result := database.DB.Model(&models.AccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Params("id"), user.ID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to revoke access token",
+			},
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Access token not found",
+			},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Access token revoked",
+	})
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"vibing-backend/database"
+	"vibing-backend/models"
+	"vibing-backend/pagination"
+	"vibing-backend/services"
+)
+
+// GetTrendingProducts returns the products with the highest trending scores, optionally
+// within a category and its subcategories
+func GetTrendingProducts(c *fiber.Ctx) error {
+	limit, err := pagination.QueryInt(c, "limit", 12, services.MaxTrendingProducts)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
+
+	query := database.DB.Where("products.status = ? AND products.trending_score > 0", "active")
+	if category := c.Query("category"); category != "" && category != "all" {
+		tree, err := models.LoadCategoryTree(database.DB)
+		if err != nil {
+			return trendingFailed(c)
+		}
+		categories := tree.Subtree(category)
+		if categories == nil {
+			return invalidCategory(c)
+		}
+		query = query.Where("products.category IN ?", categories)
+	}
+
+	var products []models.Product
+	if err := query.Order("products.trending_score DESC, products.created_at DESC").Limit(limit).Find(&products).Error; err != nil {
+		return trendingFailed(c)
+	}
+	return c.JSON(fiber.Map{"products": products})
+}
+
+// GetProductTrendingHistory shows admins the snapshots of a product's trending score
+// with the activity behind each one, newest first (paginated)
+func GetProductTrendingHistory(c *fiber.Ctx) error {
+	params, err := pagination.ParseOffset(c, 24)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
+
+	var product models.Product
+	if err := database.DB.Select("id", "title", "category", "trending_score").
+		First(&product, "id = ?", c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Product not found",
+			},
+		})
+	}
+
+	query := database.DB.Model(&models.TrendingSnapshot{}).Where("product_id = ?", product.ID)
+	total := params.Count(query)
+
+	var snapshots []models.TrendingSnapshot
+	if err := params.Window(query.Order("computed_at DESC, id DESC")).Find(&snapshots).Error; err != nil {
+		return trendingFailed(c)
+	}
+	snapshots, meta := pagination.Trim(params, snapshots, total, nil)
+	return c.JSON(fiber.Map{
+		"productId":     product.ID,
+		"title":         product.Title,
+		"trendingScore": product.TrendingScore,
+		"snapshots":     snapshots,
+		"pagination":    meta,
+	})
+}
+
+func trendingFailed(c *fiber.Ctx) error {
+	return c.Status(500).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "INTERNAL_ERROR",
+			"message": "Failed to fetch trending products",
+		},
+	})
+}
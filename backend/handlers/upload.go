@@ -1,29 +1,42 @@
 package handlers
 
 import (
+	"bytes"
 	"fmt"
+	"log"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 	"vibing-backend/config"
 	"vibing-backend/database"
 	"vibing-backend/models"
 	"vibing-backend/services"
 )
 
-var s3Service *services.S3Service
+var objectStore services.ObjectStore
 
-// InitS3Service initializes the S3 service
-func InitS3Service(cfg *config.S3Config) error {
-	service, err := services.NewS3Service(cfg)
+// webpEncoder produces WebP image renditions; nil when cwebp isn't installed
+var webpEncoder services.WebPEncoder
+
+// InitObjectStore initializes the configured storage backend and the image pipeline
+func InitObjectStore(cfg *config.Config) error {
+	services.SetMediaBaseURL(&cfg.Storage)
+	webpEncoder = services.NewWebPEncoder(&cfg.Images)
+
+	store, err := services.NewObjectStore(cfg)
 	if err != nil {
 		return err
 	}
-	s3Service = service
+	objectStore = store
+	services.SetDefaultObjectStore(store)
 	return nil
 }
 
-// UploadImage uploads product image
+// UploadImage uploads a product image. The original is stored without metadata along with
+// thumb, card and detail renditions; the returned URLs are stable and never expire.
 func UploadImage(c *fiber.Ctx) error {
 	// Get file from form
 	file, err := c.FormFile("image")
@@ -36,8 +49,8 @@ func UploadImage(c *fiber.Ctx) error {
 		})
 	}
 
-	// Upload to S3
-	if s3Service == nil {
+	// Upload to storage
+	if objectStore == nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": fiber.Map{
 				"code":    "SERVICE_ERROR",
@@ -46,19 +59,23 @@ func UploadImage(c *fiber.Ctx) error {
 		})
 	}
 
-	imageURL, err := s3Service.UploadImage(file, "images")
+	image, err := services.StoreImage(objectStore, file, services.PublicImageFolder,
+		services.ProductImageRenditions, webpEncoder)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": fiber.Map{
-				"code":    "UPLOAD_ERROR",
-				"message": err.Error(),
-			},
-		})
+		return imageUploadFailed(c, err)
 	}
 
 	return c.JSON(fiber.Map{
-		"imageUrl": imageURL,
-		"message":  "Image uploaded successfully",
+		"imageUrl": image.URL("detail"),
+		"images": fiber.Map{
+			"thumb":    image.URL("thumb"),
+			"card":     image.URL("card"),
+			"detail":   image.URL("detail"),
+			"original": image.URL("original"),
+		},
+		"width":   image.Width,
+		"height":  image.Height,
+		"message": "Image uploaded successfully",
 	})
 }
 
@@ -99,8 +116,30 @@ func UploadProductFiles(c *fiber.Ctx) error {
 		})
 	}
 
-	// Upload file to S3 (only ZIP files allowed)
-	fileURL, fileSize, err := s3Service.UploadProductFile(file, productID)
+	if objectStore == nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "SERVICE_ERROR",
+				"message": "File upload service not available",
+			},
+		})
+	}
+
+	version, err := resolveReleaseVersion(product.ID, c.FormValue("version"))
+	if err != nil {
+		return releaseVersionRejected(c, err)
+	}
+
+	// Upload file to storage (only ZIP files allowed)
+	fileKey, fileSize, inspection, err := services.UploadProductFile(objectStore, file, productID)
+	if archiveErr, ok := err.(*services.ArchiveError); ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    archiveErr.Code,
+				"message": archiveErr.Message,
+			},
+		})
+	}
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{
 			"error": fiber.Map{
@@ -110,11 +149,12 @@ func UploadProductFiles(c *fiber.Ctx) error {
 		})
 	}
 
-	// Update product with file URL and size
-	product.FileURL = fileURL
-	product.FileSize = fmt.Sprintf("%d", fileSize)
-	
-	if err := database.DB.Save(&product).Error; err != nil {
+	release, err := attachProductFile(&product, fileKey, fileSize, version, inspection)
+	if err == errReleaseExists {
+		objectStore.Delete(fileKey)
+		return releaseVersionRejected(c, err)
+	}
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": fiber.Map{
 				"code":    "DATABASE_ERROR",
@@ -126,14 +166,19 @@ func UploadProductFiles(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"file": fiber.Map{
 			"filename": file.Filename,
-			"url":      fileURL,
+			"key":      fileKey,
 			"size":     fileSize,
+			"files":    len(inspection.Entries),
+			"readme":   inspection.ReadmePath,
 		},
-		"message": "File uploaded successfully",
+		"release":        release,
+		"scanStatus":     product.ScanStatus,
+		"secretFindings": len(inspection.SecretFindings),
+		"message":        "File uploaded successfully",
 	})
 }
 
-// GetSignedURL generates signed URL for direct S3 upload (for large files)
+// GetSignedURL generates signed URL for direct upload (for large files)
 func GetSignedURL(c *fiber.Ctx) error {
 	filename := c.Query("filename")
 	contentType := c.Query("contentType")
@@ -158,21 +203,16 @@ func GetSignedURL(c *fiber.Ctx) error {
 	}
 
 	// Generate presigned URL (expires in 1 hour)
-	if s3Service == nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": fiber.Map{
-				"code":    "SERVICE_ERROR",
-				"message": "File upload service not available",
-			},
-		})
+	store, ok := objectStore.(services.MultipartStore)
+	if !ok {
+		return multipartNotSupported(c)
 	}
 
-	// For direct upload, generate presigned POST URL
-	// This is a simplified version - in production, use presigned POST
-	timestamp := time.Now().Unix()
-	key := fmt.Sprintf("uploads/%d_%s", timestamp, filename)
+	// Presigned PUT for a direct single-part upload; large archives should
+	// use the multipart endpoints instead
+	key := services.UploadFileKey(filename)
 
-	signedURL, err := s3Service.GeneratePresignedURL(key, time.Hour)
+	signedURL, err := store.PresignPut(key, contentType, time.Hour)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": fiber.Map{
@@ -189,8 +229,11 @@ func GetSignedURL(c *fiber.Ctx) error {
 	})
 }
 
-// UploadChatImage uploads chat image
+// UploadChatImage uploads chat image. The image stays hidden from the other
+// participant until the malware scan has cleared it.
 func UploadChatImage(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
 	// Get file from form
 	file, err := c.FormFile("image")
 	if err != nil {
@@ -202,8 +245,8 @@ func UploadChatImage(c *fiber.Ctx) error {
 		})
 	}
 
-	// Upload to S3
-	if s3Service == nil {
+	// Upload to storage
+	if objectStore == nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": fiber.Map{
 				"code":    "SERVICE_ERROR",
@@ -212,18 +255,199 @@ func UploadChatImage(c *fiber.Ctx) error {
 		})
 	}
 
-	imageURL, err := s3Service.UploadImage(file, "chat-images")
+	// Chat images stay private: only the sanitized original is stored and served through presigned URLs
+	image, err := services.StoreImage(objectStore, file, "chat-images", nil, nil)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{
+		return imageUploadFailed(c, err)
+	}
+	imageKey := image.Key
+
+	imageURL, err := objectStore.Presign(imageKey, chatImageURLExpiry)
+	if err != nil {
+		objectStore.Delete(imageKey)
+		return c.Status(500).JSON(fiber.Map{
 			"error": fiber.Map{
-				"code":    "UPLOAD_ERROR",
-				"message": err.Error(),
+				"code":    "SERVICE_ERROR",
+				"message": "Failed to generate image URL",
 			},
 		})
 	}
 
+	if err := models.QuarantineAsset(database.DB, imageKey, "chat_image", nil, user.ID); err != nil {
+		objectStore.Delete(imageKey)
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "DATABASE_ERROR",
+				"message": "Failed to queue image for scanning",
+			},
+		})
+	}
+	services.WakeScanWorker()
+
 	return c.JSON(fiber.Map{
-		"imageUrl": imageURL,
-		"message":  "Chat image uploaded successfully",
+		"imageUrl":   imageURL,
+		"scanStatus": "quarantined",
+		"message":    "Chat image uploaded successfully",
+	})
+}
+// imageUploadFailed responds to an error from services.StoreImage
+func imageUploadFailed(c *fiber.Ctx, err error) error {
+	if imageErr, ok := err.(*services.ImageError); ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    imageErr.Code,
+				"message": imageErr.Message,
+			},
+		})
+	}
+
+	return c.Status(500).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "UPLOAD_ERROR",
+			"message": "Failed to store image",
+		},
 	})
-}
\ No newline at end of file
+}
+
+// attachProductFile points the product at a newly uploaded, inspected archive as a new release, records
+// its manifest and secret findings and queues it for a malware scan. Findings unpublish an
+// active product until the seller acknowledges them or uploads a clean archive. The previous file may still be needed
+// by existing buyers, so it is retired instead of deleted; the retention job purges it once unreferenced.
+func attachProductFile(product *models.Product, fileKey string, fileSize int64, version string, inspection *services.ArchiveInspection) (*models.ProductRelease, error) {
+	if version == "" {
+		version = models.NextReleaseVersion(database.DB, product.ID)
+	}
+
+	previousKey := product.FileKey
+
+	entries := make([]models.ProductFileEntry, 0, len(inspection.Entries))
+	for _, entry := range inspection.Entries {
+		entries = append(entries, models.ProductFileEntry{
+			ProductID:      product.ID,
+			ObjectKey:      fileKey,
+			Path:           entry.Path,
+			Size:           entry.Size,
+			CompressedSize: entry.CompressedSize,
+			SHA256:         entry.SHA256,
+		})
+	}
+
+	findings := make([]models.SecretFinding, 0, len(inspection.SecretFindings))
+	for _, finding := range inspection.SecretFindings {
+		findings = append(findings, models.SecretFinding{
+			ProductID:   product.ID,
+			ObjectKey:   fileKey,
+			Path:        finding.Path,
+			Line:        finding.Line,
+			RuleID:      finding.RuleID,
+			Description: finding.Description,
+			Match:       finding.Match,
+		})
+	}
+
+	if len(findings) > 0 {
+		product.HoldForSecretReview()
+	} else {
+		product.EndSecretReview("clear")
+		product.SecretsAcknowledgedAt = nil
+	}
+
+	release := buildProductRelease(product, fileKey, fileSize, version, inspection)
+
+	product.FileKey = fileKey
+	product.FileSize = fmt.Sprintf("%d", fileSize)
+	product.LatestVersion = release.Version
+	product.Readme = inspection.Readme
+	product.ReadmePath = inspection.ReadmePath
+	product.FileCount = len(inspection.Entries)
+	product.UnpackedSize = inspection.TotalSize
+	product.ScanStatus = "quarantined"
+	product.ScanError = ""
+
+	productID := product.ID
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&models.ProductRelease{}).
+			Where("product_id = ? AND version = ?", product.ID, release.Version).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return errReleaseExists
+		}
+		if err := tx.Create(release).Error; err != nil {
+			return err
+		}
+		if err := models.ReplaceProductManifest(tx, product.ID, entries); err != nil {
+			return err
+		}
+		if err := models.ReplaceSecretFindings(tx, product.ID, findings); err != nil {
+			return err
+		}
+		if err := models.QuarantineAsset(tx, fileKey, "product_file", &productID, product.AuthorID); err != nil {
+			return err
+		}
+		return tx.Save(product).Error
+	})
+	if err != nil {
+		if release.SBOMKey != "" {
+			objectStore.Delete(release.SBOMKey)
+		}
+		return nil, err
+	}
+
+	// Previous archives stay referenced by their releases; retiring them only
+	// starts the clock for when the product itself goes away
+	if previousKey != "" && previousKey != fileKey {
+		if err := models.RetireProductFile(database.DB, product.ID, previousKey, "replaced"); err != nil {
+			log.Printf("Failed to retire previous file for product %s: %v", product.ID, err)
+		}
+	}
+
+	services.WakeScanWorker()
+	return release, nil
+}
+
+// buildProductRelease analyzes the archive's dependencies and licenses and stores its SBOM.
+// A failure to store the SBOM is logged and leaves the release without one.
+func buildProductRelease(product *models.Product, fileKey string, fileSize int64, version string, inspection *services.ArchiveInspection) *models.ProductRelease {
+	report := services.AnalyzeDependencies(inspection)
+
+	release := &models.ProductRelease{
+		ProductID:       product.ID,
+		Version:         version,
+		ObjectKey:       fileKey,
+		FileSize:        fileSize,
+		SHA256:          inspection.SHA256,
+		Licenses:        report.Licenses,
+		LicenseWarnings: services.LicenseWarnings(product.LicenseType, report),
+		DependencyCount: len(report.Components),
+	}
+	if module := services.FindGoModule(inspection); module != nil {
+		release.GoModule = module.Path
+		release.GoModuleDir = module.Dir
+		release.GoMod = string(module.GoMod)
+	}
+	if pkg := services.FindNpmPackage(inspection, version); pkg != nil {
+		release.NpmPackage = pkg.Name
+		release.NpmPackageDir = pkg.Dir
+		release.NpmManifest = string(pkg.Manifest)
+	}
+
+	sbom, err := services.BuildCycloneDX(product.Title, version, report)
+	if err != nil {
+		log.Printf("Failed to build SBOM for product %s %s: %v", product.ID, version, err)
+		return release
+	}
+
+	// Named after the archive so a rejected upload can never overwrite another release's SBOM
+	archiveName := strings.TrimSuffix(path.Base(fileKey), path.Ext(fileKey))
+	sbomKey := fmt.Sprintf("sboms/%s/%s.cdx.json", product.ID, archiveName)
+	if err := objectStore.Put(sbomKey, bytes.NewReader(sbom), int64(len(sbom)), "application/vnd.cyclonedx+json"); err != nil {
+		log.Printf("Failed to store SBOM for product %s %s: %v", product.ID, version, err)
+		return release
+	}
+	release.SBOMKey = sbomKey
+
+	return release
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"vibing-backend/database"
+	"vibing-backend/models"
+	"vibing-backend/pagination"
+)
+
+// wishlistKeyset pages wishlists most recently liked first
+var wishlistKeyset = pagination.Keyset{TimeColumn: "wishlist_items.created_at", IDColumn: "wishlist_items.id", Desc: true}
+
+// ToggleLike adds a product to the user's wishlist, or removes it if it's already there
+func ToggleLike(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	var product models.Product
+	if err := database.DB.Where("id = ? AND status = ?", c.Params("id"), "active").First(&product).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "NOT_FOUND",
+				"message": "Product not found",
+			},
+		})
+	}
+
+	liked := false
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		removed := tx.Where("user_id = ? AND product_id = ?", user.ID, product.ID).Delete(&models.WishlistItem{})
+		if removed.Error != nil {
+			return removed.Error
+		}
+		if removed.RowsAffected == 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(models.NewWishlistItem(user.ID, &product)).Error; err != nil {
+				return err
+			}
+			liked = true
+		}
+		return models.RefreshWishlistCount(tx, product.ID)
+	}); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to update wishlist",
+			},
+		})
+	}
+
+	var count int
+	database.DB.Model(&models.Product{}).Select("wishlist_count").Where("id = ?", product.ID).Scan(&count)
+	return c.JSON(fiber.Map{
+		"liked":         liked,
+		"wishlistCount": count,
+	})
+}
+
+// GetWishlist returns the active products the user liked
+func GetWishlist(c *fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+	params, err := pagination.Parse(c, 12)
+	if err != nil {
+		return invalidPagination(c, err)
+	}
+
+	query := database.DB.Model(&models.WishlistItem{}).
+		Joins("JOIN products ON products.id = wishlist_items.product_id AND products.status = 'active' AND products.deleted_at IS NULL").
+		Where("wishlist_items.user_id = ?", user.ID)
+
+	var items []models.WishlistItem
+	total := params.Count(query)
+	if err := wishlistKeyset.Apply(query, params).Preload("Product").Find(&items).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to fetch wishlist",
+			},
+		})
+	}
+	items, meta := pagination.Trim(params, items, total, func(item models.WishlistItem) (time.Time, string) {
+		return item.CreatedAt, item.ID
+	})
+	for i := range items {
+		items[i].Product.Liked = true
+	}
+
+	return c.JSON(fiber.Map{
+		"items":      items,
+		"pagination": meta,
+	})
+}
+
+// markLiked flags the products the signed-in user liked
+func markLiked(c *fiber.Ctx, products []models.Product) {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || len(products) == 0 {
+		return
+	}
+	ids := make([]string, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	liked, err := models.LikedProductIDs(database.DB, user.ID, ids)
+	if err != nil {
+		log.Printf("Failed to load liked products of user %s: %v", user.ID, err)
+		return
+	}
+	for i := range products {
+		products[i].Liked = liked[products[i].ID]
+	}
+}
@@ -1,7 +1,9 @@
 package middleware
 
 import (
+	"encoding/base64"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"vibing-backend/database"
@@ -54,6 +56,74 @@ func Auth() fiber.Handler {
 	}
 }
 
+// OptionalAuth middleware stores the user of a valid JWT token, if any. Requests without
+// one, or with an invalid one, continue anonymously.
+func OptionalAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+		if token == "" {
+			return c.Next()
+		}
+
+		claims, err := utils.ValidateJWT(token)
+		if err != nil {
+			return c.Next()
+		}
+
+		var user models.User
+		if err := database.DB.First(&user, "id = ?", claims.UserID).Error; err == nil {
+			c.Locals("user", &user)
+		}
+		return c.Next()
+	}
+}
+
+// TokenAuth middleware validates a personal access token, sent either as the password
+// of HTTP Basic auth (so tools can read it from .netrc) or as a Bearer token
+func TokenAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		credential := ""
+		header := c.Get("Authorization")
+		switch {
+		case strings.HasPrefix(header, "Basic "):
+			decoded, err := base64.StdEncoding.DecodeString(header[6:])
+			if err == nil {
+				if i := strings.IndexByte(string(decoded), ':'); i >= 0 {
+					credential = string(decoded[i+1:])
+				}
+			}
+		case strings.HasPrefix(header, "Bearer "):
+			credential = header[7:]
+		}
+
+		if !models.IsAccessToken(credential) {
+			c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="vibing"`)
+			return c.Status(401).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    "UNAUTHORIZED",
+					"message": "Access token required",
+				},
+			})
+		}
+
+		token, err := models.FindAccessToken(database.DB, credential)
+		if err != nil || token.User.ID == "" {
+			c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="vibing"`)
+			return c.Status(401).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    "UNAUTHORIZED",
+					"message": "Invalid or expired access token",
+				},
+			})
+		}
+
+		database.DB.Model(token).UpdateColumn("last_used_at", time.Now())
+
+		c.Locals("user", &token.User)
+		return c.Next()
+	}
+}
+
 // SellerOnly middleware checks if user is seller or admin
 func SellerOnly() fiber.Handler {
 	return func(c *fiber.Ctx) error {
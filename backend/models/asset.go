@@ -0,0 +1,104 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AssetPlatforms are the os-arch pairs CLI tool assets can be uploaded for
+var AssetPlatforms = []string{"darwin-amd64", "darwin-arm64", "linux-amd64", "linux-arm64"}
+
+var commandNamePattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ReleaseAsset is a prebuilt per-platform file of a CLI tool release, served by the
+// install script and the Homebrew tap
+type ReleaseAsset struct {
+	ID        string `json:"id" gorm:"primaryKey"`
+	ReleaseID string `json:"releaseId" gorm:"not null;uniqueIndex:idx_release_asset_platform"`
+	ProductID string `json:"productId" gorm:"not null;index"`
+	Platform  string `json:"platform" gorm:"type:varchar(20);not null;uniqueIndex:idx_release_asset_platform"`
+	FileName  string `json:"fileName"`
+	// Format is "binary", "tar.gz" or "zip"
+	Format string `json:"format" gorm:"type:varchar(10);not null"`
+	// Binary is the path of the executable inside an archive, or the file name of a bare binary
+	Binary    string    `json:"binary"`
+	ObjectKey string    `json:"-" gorm:"not null;index"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256" gorm:"type:varchar(64)"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// BeforeCreate hook to generate UUID
+func (a *ReleaseAsset) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == "" {
+		a.ID = generateUUID()
+	}
+	return nil
+}
+
+// OS is the operating system half of the platform, e.g. "darwin"
+func (a *ReleaseAsset) OS() string {
+	os, _, _ := strings.Cut(a.Platform, "-")
+	return os
+}
+
+// Arch is the architecture half of the platform, e.g. "arm64"
+func (a *ReleaseAsset) Arch() string {
+	_, arch, _ := strings.Cut(a.Platform, "-")
+	return arch
+}
+
+// DownloadName is the file name the asset is served under for a command
+func (a *ReleaseAsset) DownloadName(command string) string {
+	if a.Format == "binary" {
+		return command
+	}
+	return command + "." + a.Format
+}
+
+// IsAssetPlatform reports whether assets can be uploaded for the platform
+func IsAssetPlatform(platform string) bool {
+	for _, p := range AssetPlatforms {
+		if p == platform {
+			return true
+		}
+	}
+	return false
+}
+
+// AssignCLICommand gives a CLI tool product the command name its installers use, derived
+// from the title and unique across products. Products that already have one keep it.
+func AssignCLICommand(db *gorm.DB, product *Product) error {
+	if product.CLICommand != "" {
+		return nil
+	}
+
+	base := strings.Trim(commandNamePattern.ReplaceAllString(strings.ToLower(product.Title), "-"), "-")
+	if len(base) > 40 {
+		base = strings.TrimRight(base[:40], "-")
+	}
+	if base == "" || base[0] < 'a' || base[0] > 'z' {
+		base = "tool-" + base
+		base = strings.TrimRight(base, "-")
+	}
+
+	command := base
+	for n := 2; ; n++ {
+		var taken int64
+		if err := db.Unscoped().Model(&Product{}).Where("cli_command = ? AND id <> ?", command, product.ID).
+			Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken == 0 {
+			break
+		}
+		command = fmt.Sprintf("%s-%d", base, n)
+	}
+
+	product.CLICommand = command
+	return db.Model(product).Update("cli_command", command).Error
+}
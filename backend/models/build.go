@@ -0,0 +1,133 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PersonalizedBuildIdleTTL is how long a cached buyer build is kept after its last download
+const PersonalizedBuildIdleTTL = 7 * 24 * time.Hour
+
+// PersonalizedBuildFolder holds cached buyer builds as builds/<purchaseID>/<file>
+const PersonalizedBuildFolder = "builds"
+
+// PersonalizedBuild is a buyer-specific copy of a product archive with an embedded
+// license file. The row outlives the cached object so the fingerprint of a leaked
+// copy can always be traced back to the purchase.
+type PersonalizedBuild struct {
+	ID          string `json:"id" gorm:"primaryKey"`
+	PurchaseID  string `json:"purchaseId" gorm:"not null;uniqueIndex:idx_personalized_build_source"`
+	ProductID   string `json:"productId" gorm:"not null;index"`
+	UserID      string `json:"userId" gorm:"not null;index"`
+	SourceKey   string `json:"-" gorm:"not null;uniqueIndex:idx_personalized_build_source"`
+	ObjectKey   string `json:"-" gorm:"not null;index"`
+	Version     string `json:"version,omitempty"`
+	Fingerprint string `json:"fingerprint" gorm:"type:varchar(40);uniqueIndex;not null"`
+	// LicenseKey and Watermarked are what the cached object was built with; a change rebuilds it
+	LicenseKey  string     `json:"-"`
+	Watermarked bool       `json:"watermarked" gorm:"default:false"`
+	SHA256      string     `json:"sha256" gorm:"type:varchar(64);index"`
+	Size        int64      `json:"size" gorm:"default:0"`
+	BuiltAt     *time.Time `json:"builtAt"`
+	LastUsedAt  *time.Time `json:"lastUsedAt"`
+	PurgedAt    *time.Time `json:"purgedAt"`
+	// A download of a missing or outdated copy requests a build; the build worker clears it
+	RequestedAt   *time.Time `json:"-" gorm:"index"`
+	BuildingAt    *time.Time `json:"-"`
+	BuildAttempts int        `json:"-" gorm:"default:0"`
+	BuildError    string     `json:"-"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+
+	// Relations
+	Purchase Purchase `json:"purchase,omitempty" gorm:"foreignKey:PurchaseID"`
+}
+
+// BeforeCreate hook to generate UUID and fingerprint
+func (b *PersonalizedBuild) BeforeCreate(tx *gorm.DB) error {
+	if b.ID == "" {
+		b.ID = generateUUID()
+	}
+	if b.Fingerprint == "" {
+		b.Fingerprint = NewBuildFingerprint()
+	}
+	return nil
+}
+
+// NewBuildFingerprint returns a random fingerprint such as VBF-3f9c0d2a61b84e07a5c2d9e1
+func NewBuildFingerprint() string {
+	raw := make([]byte, 12)
+	rand.Read(raw)
+	return "VBF-" + hex.EncodeToString(raw)
+}
+
+// NormalizeBuildFingerprint fixes the letter case of a fingerprint typed in by hand
+func NormalizeBuildFingerprint(fingerprint string) string {
+	fingerprint = strings.TrimSpace(fingerprint)
+	if len(fingerprint) > 4 && strings.EqualFold(fingerprint[:4], "VBF-") {
+		return "VBF-" + strings.ToLower(fingerprint[4:])
+	}
+	return fingerprint
+}
+
+// IsCached reports whether the build's object is stored and matches the purchase's current license
+func (b *PersonalizedBuild) IsCached(licenseKey string, watermarked bool) bool {
+	return b.PurgedAt == nil && b.BuiltAt != nil && b.SHA256 != "" &&
+		b.LicenseKey == licenseKey && b.Watermarked == watermarked
+}
+
+// BuildFailed reports whether the last requested build gave up without producing a copy
+func (b *PersonalizedBuild) BuildFailed() bool {
+	return b.RequestedAt == nil && b.BuildError != ""
+}
+
+// RequestPersonalizedBuild queues the build for the build worker unless it is already queued
+func RequestPersonalizedBuild(db *gorm.DB, build *PersonalizedBuild) error {
+	return db.Model(&PersonalizedBuild{}).
+		Where("id = ? AND requested_at IS NULL", build.ID).
+		Updates(map[string]interface{}{
+			"requested_at":   time.Now(),
+			"building_at":    nil,
+			"build_attempts": 0,
+			"build_error":    "",
+		}).Error
+}
+
+// FindOrCreatePersonalizedBuild returns the build record of a purchase for a source archive.
+// The fingerprint is assigned once and kept when the build is regenerated.
+func FindOrCreatePersonalizedBuild(db *gorm.DB, purchase *Purchase, sourceKey, objectKey string) (*PersonalizedBuild, error) {
+	build := PersonalizedBuild{
+		PurchaseID: purchase.ID,
+		ProductID:  purchase.ProductID,
+		UserID:     purchase.UserID,
+		SourceKey:  sourceKey,
+		ObjectKey:  objectKey,
+	}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&build).Error; err != nil {
+		return nil, err
+	}
+
+	var stored PersonalizedBuild
+	if err := db.Where("purchase_id = ? AND source_key = ?", purchase.ID, sourceKey).First(&stored).Error; err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// BuildSourceKey maps the object key of a personalized build to the archive it was
+// built from. Other keys are returned unchanged.
+func BuildSourceKey(db *gorm.DB, objectKey string) string {
+	if !strings.HasPrefix(objectKey, PersonalizedBuildFolder+"/") {
+		return objectKey
+	}
+	var build PersonalizedBuild
+	if err := db.Select("source_key").Where("object_key = ?", objectKey).First(&build).Error; err != nil {
+		return objectKey
+	}
+	return build.SourceKey
+}
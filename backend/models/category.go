@@ -0,0 +1,179 @@
+package models
+
+import (
+	"regexp"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CategorySlugPattern is the format of category slugs, which products store as their category
+var CategorySlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Category is a node of the product taxonomy managed by admins
+type Category struct {
+	ID   string `json:"id" gorm:"primaryKey"`
+	Slug string `json:"slug" gorm:"type:varchar(50);uniqueIndex;not null"`
+	// Name is the default (English) name; Names holds translations by language code, e.g. "ko"
+	Name      string            `json:"name" gorm:"not null"`
+	Names     map[string]string `json:"names" gorm:"type:jsonb;serializer:json"`
+	ParentID  *string           `json:"parentId" gorm:"index"`
+	SortOrder int               `json:"sortOrder" gorm:"default:0"`
+	// Icon is a lucide icon name
+	Icon string `json:"icon"`
+	// Inactive categories and their subcategories are hidden and can't be chosen for products
+	Active    bool      `json:"active" gorm:"not null"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// BeforeCreate hook to generate UUID
+func (c *Category) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = generateUUID()
+	}
+	return nil
+}
+
+// LocalizedName returns the name in a language, falling back to the default name
+func (c *Category) LocalizedName(lang string) string {
+	if name := c.Names[lang]; name != "" {
+		return name
+	}
+	return c.Name
+}
+
+// CategoryTree is the loaded taxonomy, ordered depth-first with siblings by sort order
+type CategoryTree struct {
+	Categories []Category
+	bySlug     map[string]int
+	byID       map[string]int
+	children   map[string][]int
+}
+
+// LoadCategoryTree loads every category; the taxonomy is small enough to walk in memory
+func LoadCategoryTree(db *gorm.DB) (*CategoryTree, error) {
+	var categories []Category
+	if err := db.Order("sort_order ASC, name ASC").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	ids := map[string]bool{}
+	childrenOf := map[string][]Category{}
+	for _, category := range categories {
+		ids[category.ID] = true
+		if category.ParentID != nil {
+			childrenOf[*category.ParentID] = append(childrenOf[*category.ParentID], category)
+		}
+	}
+
+	tree := &CategoryTree{bySlug: map[string]int{}, byID: map[string]int{}, children: map[string][]int{}}
+	var visit func(category Category)
+	visit = func(category Category) {
+		if _, seen := tree.byID[category.ID]; seen {
+			return
+		}
+		tree.bySlug[category.Slug] = len(tree.Categories)
+		tree.byID[category.ID] = len(tree.Categories)
+		tree.Categories = append(tree.Categories, category)
+		for _, child := range childrenOf[category.ID] {
+			tree.children[category.Slug] = append(tree.children[category.Slug], len(tree.Categories))
+			visit(child)
+		}
+	}
+	// Categories whose parent is missing are treated as top-level
+	for _, category := range categories {
+		if category.ParentID == nil || !ids[*category.ParentID] {
+			visit(category)
+		}
+	}
+	return tree, nil
+}
+
+// Get returns the category with a slug
+func (t *CategoryTree) Get(slug string) *Category {
+	if i, ok := t.bySlug[slug]; ok {
+		return &t.Categories[i]
+	}
+	return nil
+}
+
+// Parent returns the parent of a category, nil for top-level categories
+func (t *CategoryTree) Parent(category Category) *Category {
+	if category.ParentID == nil {
+		return nil
+	}
+	if i, ok := t.byID[*category.ParentID]; ok {
+		return &t.Categories[i]
+	}
+	return nil
+}
+
+// Children returns the direct subcategories of a category
+func (t *CategoryTree) Children(slug string) []Category {
+	var children []Category
+	for _, i := range t.children[slug] {
+		children = append(children, t.Categories[i])
+	}
+	return children
+}
+
+// Subtree returns the slugs of a category and all of its descendants
+func (t *CategoryTree) Subtree(slug string) []string {
+	if t.Get(slug) == nil {
+		return nil
+	}
+	slugs := []string{slug}
+	for _, child := range t.Children(slug) {
+		slugs = append(slugs, t.Subtree(child.Slug)...)
+	}
+	return slugs
+}
+
+// IsVisible reports whether a category and all of its ancestors are active
+func (t *CategoryTree) IsVisible(slug string) bool {
+	category := t.Get(slug)
+	for category != nil {
+		if !category.Active {
+			return false
+		}
+		category = t.Parent(*category)
+	}
+	return t.Get(slug) != nil
+}
+
+// IsDescendant reports whether slug is the category ancestor or one of its descendants
+func (t *CategoryTree) IsDescendant(slug, ancestor string) bool {
+	for _, s := range t.Subtree(ancestor) {
+		if s == slug {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSelectableCategory reports whether products can be listed under a category
+func IsSelectableCategory(db *gorm.DB, slug string) bool {
+	tree, err := LoadCategoryTree(db)
+	if err != nil {
+		return false
+	}
+	return tree.IsVisible(slug)
+}
+
+// CountProductsByCategory counts active products per category slug in a single grouped query
+func CountProductsByCategory(db *gorm.DB) (map[string]int64, error) {
+	var rows []struct {
+		Category string
+		Count    int64
+	}
+	if err := db.Model(&Product{}).Select("category, count(*) AS count").
+		Where("status = ?", "active").Group("category").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Category] = row.Count
+	}
+	return counts, nil
+}
@@ -30,6 +30,8 @@ type ChatMessage struct {
 	ConversationID string    `json:"conversationId" gorm:"not null"`
 	Text           string    `json:"text" gorm:"type:text"`
 	ImageURL       *string   `json:"imageUrl,omitempty" gorm:"type:text"`
+	ImageKey       *string   `json:"-" gorm:"index"`
+	ImageStatus    string    `json:"imageStatus,omitempty" gorm:"-"`
 	MessageType    string    `json:"messageType" gorm:"type:varchar(20);default:'text';check:message_type IN ('text','image')" validate:"oneof=text image"`
 	SenderID       string    `json:"senderId" gorm:"not null"`
 	SenderName     string    `json:"senderName"`
@@ -130,10 +132,11 @@ func (c *Conversation) AddMessage(db *gorm.DB, senderID, senderName, senderRole,
 }
 
 // AddImageMessage adds a new image message to the conversation
-func (c *Conversation) AddImageMessage(db *gorm.DB, senderID, senderName, senderRole, imageURL string) (*ChatMessage, error) {
+func (c *Conversation) AddImageMessage(db *gorm.DB, senderID, senderName, senderRole, imageURL, imageKey string) (*ChatMessage, error) {
 	message := &ChatMessage{
 		ConversationID: c.ID,
 		ImageURL:       &imageURL,
+		ImageKey:       &imageKey,
 		MessageType:    "image",
 		SenderID:       senderID,
 		SenderName:     senderName,
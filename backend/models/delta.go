@@ -0,0 +1,67 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReleaseDeltaFolder holds patches as deltas/<productID>/<from>_to_<to>.vbdelta
+const ReleaseDeltaFolder = "deltas"
+
+// MaxReleaseDeltaAttempts is how often a failed or stalled patch is generated before giving up
+const MaxReleaseDeltaAttempts = 3
+
+// ReleaseDelta is a binary patch that turns the archive of one release into the archive
+// of the next, so buyers don't download large products in full for every version
+type ReleaseDelta struct {
+	ID            string `json:"id" gorm:"primaryKey"`
+	ProductID     string `json:"productId" gorm:"not null;index"`
+	FromReleaseID string `json:"fromReleaseId" gorm:"not null;uniqueIndex:idx_release_delta_pair"`
+	ToReleaseID   string `json:"toReleaseId" gorm:"not null;uniqueIndex:idx_release_delta_pair;index"`
+	FromVersion   string `json:"fromVersion"`
+	ToVersion     string `json:"toVersion"`
+	// Status is "pending" while queued or generating, "ready", "skipped" when a patch wouldn't save
+	// enough to be worth it, or "failed"
+	Status       string    `json:"status" gorm:"type:varchar(20);default:'pending';check:status IN ('pending','ready','skipped','failed')"`
+	ObjectKey    string    `json:"-" gorm:"index"`
+	Size         int64     `json:"size" gorm:"default:0"`
+	SHA256       string    `json:"sha256" gorm:"type:varchar(64)"`
+	SourceSHA256 string    `json:"sourceSha256" gorm:"type:varchar(64)"`
+	TargetSHA256 string    `json:"targetSha256" gorm:"type:varchar(64)"`
+	TargetSize   int64     `json:"targetSize" gorm:"default:0"`
+	Attempts     int       `json:"attempts" gorm:"default:0"`
+	LastError    string    `json:"lastError,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// BeforeCreate hook to generate UUID
+func (d *ReleaseDelta) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == "" {
+		d.ID = generateUUID()
+	}
+	return nil
+}
+
+// IsReady reports whether the patch can be downloaded
+func (d *ReleaseDelta) IsReady() bool {
+	return d.Status == "ready" && d.ObjectKey != ""
+}
+
+// DeltaTargetKey returns the archive a patch object produces, whose scan result the patch
+// inherits. Other keys are returned unchanged.
+func DeltaTargetKey(db *gorm.DB, objectKey string) string {
+	if !strings.HasPrefix(objectKey, ReleaseDeltaFolder+"/") {
+		return objectKey
+	}
+	var target ProductRelease
+	if err := db.Model(&ProductRelease{}).Select("product_releases.object_key").
+		Joins("JOIN release_deltas ON release_deltas.to_release_id = product_releases.id").
+		Where("release_deltas.object_key = ?", objectKey).
+		First(&target).Error; err != nil {
+		return objectKey
+	}
+	return target.ObjectKey
+}
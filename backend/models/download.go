@@ -0,0 +1,139 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DownloadTokenTTL is how long a freshly issued download token can be redeemed
+const DownloadTokenTTL = 10 * time.Minute
+
+// DownloadToken is a short-lived, single-use credential for /api/dl/:token.
+// Only the SHA-256 hash of the token is stored.
+type DownloadToken struct {
+	ID         string     `json:"id" gorm:"primaryKey"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	PurchaseID string     `json:"purchaseId" gorm:"not null;index"`
+	UserID     string     `json:"userId" gorm:"not null;index"`
+	ObjectKey  string     `json:"-" gorm:"not null"`
+	ExpiresAt  time.Time  `json:"expiresAt" gorm:"not null"`
+	RedeemedAt *time.Time `json:"redeemedAt"`
+	ConsumedAt *time.Time `json:"consumedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+
+	// The client that first redeemed the token; resumes from other clients are refused
+	RedeemedIP        string `json:"-" gorm:"type:varchar(64)"`
+	RedeemedUserAgent string `json:"-" gorm:"type:text"`
+
+	// Relations
+	Purchase Purchase `json:"-" gorm:"foreignKey:PurchaseID"`
+}
+
+// DownloadLog records every transfer served through a download token
+type DownloadLog struct {
+	ID          string     `json:"id" gorm:"primaryKey"`
+	PurchaseID  string     `json:"purchaseId" gorm:"not null;index"`
+	UserID      string     `json:"userId" gorm:"not null;index"`
+	TokenID     string     `json:"tokenId" gorm:"index"`
+	ObjectKey   string     `json:"objectKey"`
+	IPAddress   string     `json:"ipAddress" gorm:"type:varchar(64)"`
+	UserAgent   string     `json:"userAgent" gorm:"type:text"`
+	RangeHeader string     `json:"rangeHeader"`
+	BytesServed int64      `json:"bytesServed" gorm:"default:0"`
+	ObjectSize  int64      `json:"objectSize" gorm:"default:0"`
+	Completed   bool       `json:"completed" gorm:"default:false"`
+	FinishedAt  *time.Time `json:"finishedAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+// BeforeCreate hook to generate UUID for DownloadToken
+func (t *DownloadToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == "" {
+		t.ID = generateUUID()
+	}
+	return nil
+}
+
+// BeforeCreate hook to generate UUID for DownloadLog
+func (l *DownloadLog) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == "" {
+		l.ID = generateUUID()
+	}
+	return nil
+}
+
+// NewDownloadToken creates an unsaved token for the purchase and returns it
+// together with the raw token value that must be handed to the client
+func NewDownloadToken(purchase *Purchase, objectKey string) (*DownloadToken, string) {
+	raw := make([]byte, 32)
+	rand.Read(raw)
+	token := hex.EncodeToString(raw)
+
+	return &DownloadToken{
+		TokenHash:  HashDownloadToken(token),
+		PurchaseID: purchase.ID,
+		UserID:     purchase.UserID,
+		ObjectKey:  objectKey,
+		ExpiresAt:  time.Now().Add(DownloadTokenTTL),
+	}, token
+}
+
+// HashDownloadToken returns the stored representation of a raw token
+func HashDownloadToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsUsable checks if the token can still serve bytes. A token may be redeemed
+// several times for ranged resumes by the same client until one transfer completes.
+func (t *DownloadToken) IsUsable() bool {
+	return t.ConsumedAt == nil && time.Now().Before(t.ExpiresAt)
+}
+
+// Redeem claims the token for the client on its first redemption. Later redemptions,
+// such as ranged resumes, succeed only for that same client. Returns false if the
+// token was consumed or claimed by another client in the meantime.
+func (t *DownloadToken) Redeem(db *gorm.DB, ip, userAgent string) (bool, error) {
+	now := time.Now()
+	result := db.Model(&DownloadToken{}).
+		Where("id = ? AND consumed_at IS NULL AND (redeemed_at IS NULL OR (redeemed_ip = ? AND redeemed_user_agent = ?))",
+			t.ID, ip, userAgent).
+		Updates(map[string]interface{}{
+			"redeemed_at":         gorm.Expr("COALESCE(redeemed_at, ?)", now),
+			"redeemed_ip":         ip,
+			"redeemed_user_agent": userAgent,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	if t.RedeemedAt == nil {
+		t.RedeemedAt = &now
+	}
+	t.RedeemedIP = ip
+	t.RedeemedUserAgent = userAgent
+	return true, nil
+}
+
+// Consume marks the token as used after a completed transfer.
+// Returns false if another transfer already consumed it.
+func (t *DownloadToken) Consume(db *gorm.DB) (bool, error) {
+	now := time.Now()
+	result := db.Model(&DownloadToken{}).
+		Where("id = ? AND consumed_at IS NULL", t.ID).
+		Update("consumed_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	t.ConsumedAt = &now
+	return true, nil
+}
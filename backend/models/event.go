@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Product event types
+const (
+	// EventView is a load of the product page
+	EventView = "view"
+	// EventDetailOpen is reported by the client when a visitor opens the details
+	// (README, files, gallery) of a product
+	EventDetailOpen = "detail_open"
+	// EventDownload is a completed transfer of a purchased file, recorded when the
+	// transfer also counts as a download of the purchase
+	EventDownload = "download"
+	// EventPurchaseStart is a created payment order
+	EventPurchaseStart = "purchase_start"
+	// EventPurchaseComplete is a confirmed payment
+	EventPurchaseComplete = "purchase_complete"
+)
+
+// ProductEvent is a recorded visitor interaction with a product. Product counters are
+// derived from these when buffered events are flushed.
+type ProductEvent struct {
+	ID        string `json:"id" gorm:"primaryKey"`
+	ProductID string `json:"productId" gorm:"not null;index:idx_product_events_product_type,priority:1"`
+	Type      string `json:"type" gorm:"type:varchar(30);not null;index:idx_product_events_product_type,priority:2;check:type IN ('view','detail_open','download','purchase_start','purchase_complete')"`
+	// UserID is empty for anonymous visitors
+	UserID *string `json:"userId" gorm:"index"`
+	// VisitorID identifies the visitor events are deduplicated by: the user, the visitor
+	// cookie, or a hash of the address and user agent
+	VisitorID string    `json:"visitorId" gorm:"type:varchar(80);not null"`
+	Referrer  string    `json:"referrer,omitempty" gorm:"type:text"`
+	CreatedAt time.Time `json:"createdAt" gorm:"not null;index:idx_product_events_product_type,priority:3;index"`
+}
+
+// BeforeCreate hook to generate UUID
+func (e *ProductEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == "" {
+		e.ID = generateUUID()
+	}
+	return nil
+}
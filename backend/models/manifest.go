@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProductFileEntry is one file in the manifest of a product's current archive
+type ProductFileEntry struct {
+	ID             string    `json:"-" gorm:"primaryKey"`
+	ProductID      string    `json:"-" gorm:"not null;index"`
+	ObjectKey      string    `json:"-" gorm:"not null;index"`
+	Path           string    `json:"path" gorm:"not null"`
+	Size           int64     `json:"size"`
+	CompressedSize int64     `json:"compressedSize"`
+	SHA256         string    `json:"sha256" gorm:"type:char(64)"`
+	CreatedAt      time.Time `json:"-"`
+}
+
+// BeforeCreate hook to generate UUID
+func (e *ProductFileEntry) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == "" {
+		e.ID = generateUUID()
+	}
+	return nil
+}
+
+// ReplaceProductManifest swaps the stored manifest of a product for the entries of a new archive
+func ReplaceProductManifest(tx *gorm.DB, productID string, entries []ProductFileEntry) error {
+	if err := tx.Where("product_id = ?", productID).Delete(&ProductFileEntry{}).Error; err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(entries, 500).Error
+}
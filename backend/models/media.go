@@ -0,0 +1,118 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxProductMedia is the maximum number of gallery items per product
+const MaxProductMedia = 20
+
+// ProductMedia is one item of a product's gallery: a processed image, an embedded
+// video or an asciinema terminal recording
+type ProductMedia struct {
+	ID        string `json:"id" gorm:"primaryKey"`
+	ProductID string `json:"productId" gorm:"not null;index"`
+	Type      string `json:"type" gorm:"type:varchar(20);not null;check:type IN ('image','video','asciinema')"`
+	Position  int    `json:"position" gorm:"not null;default:0"`
+	// URL is the stable image URL, the video player embed URL or the asciicast file URL
+	URL          string `json:"url" gorm:"type:text;not null"`
+	SourceURL    string `json:"sourceUrl,omitempty" gorm:"type:text"`
+	ThumbnailURL string `json:"thumbnailUrl,omitempty" gorm:"type:text"`
+	// StorageKey is the key prefix of uploaded objects (all image variants, or the
+	// recording); empty for external media
+	StorageKey string    `json:"-"`
+	Caption    string    `json:"caption" gorm:"type:varchar(300)"`
+	AltText    string    `json:"altText" gorm:"type:varchar(300)"`
+	Width      int       `json:"width,omitempty"`
+	Height     int       `json:"height,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+
+	// Images holds the rendition URLs of image media
+	Images map[string]string `json:"images,omitempty" gorm:"-"`
+}
+
+// TableName keeps "media" from being pluralized
+func (ProductMedia) TableName() string {
+	return "product_media"
+}
+
+// BeforeCreate hook to generate UUID
+func (m *ProductMedia) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == "" {
+		m.ID = generateUUID()
+	}
+	return nil
+}
+
+// AfterFind hook to derive rendition URLs
+func (m *ProductMedia) AfterFind(tx *gorm.DB) error {
+	if m.Type == "image" {
+		m.Images = ImageRenditionURLs(m.URL)
+	}
+	return nil
+}
+
+// AfterSave hook to derive rendition URLs
+func (m *ProductMedia) AfterSave(tx *gorm.DB) error {
+	return m.AfterFind(tx)
+}
+
+// OrderedMedia preloads a product's gallery in display order
+func OrderedMedia(db *gorm.DB) *gorm.DB {
+	return db.Order("product_media.position ASC, product_media.created_at ASC")
+}
+
+// CountProductMedia returns the number of gallery items of a product
+func CountProductMedia(db *gorm.DB, productID string) (int, error) {
+	var count int64
+	if err := db.Model(&ProductMedia{}).Where("product_id = ?", productID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+// AppendProductMedia creates media after the last item of its product's gallery. It must
+// run in a transaction: the product row is locked so concurrent uploads get distinct
+// positions and can't exceed MaxProductMedia. Positions of deleted items aren't reused.
+func AppendProductMedia(tx *gorm.DB, media *ProductMedia) error {
+	var product Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+		First(&product, "id = ?", media.ProductID).Error; err != nil {
+		return err
+	}
+
+	var gallery struct {
+		Count        int
+		NextPosition int
+	}
+	if err := tx.Model(&ProductMedia{}).
+		Select("COUNT(*) AS count, COALESCE(MAX(position), -1) + 1 AS next_position").
+		Where("product_id = ?", media.ProductID).
+		Scan(&gallery).Error; err != nil {
+		return err
+	}
+	if gallery.Count >= MaxProductMedia {
+		return ErrGalleryFull
+	}
+
+	media.Position = gallery.NextPosition
+	return tx.Create(media).Error
+}
+
+// ReorderProductMedia stores the gallery order given as a complete list of media IDs
+func ReorderProductMedia(db *gorm.DB, productID string, mediaIDs []string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for position, id := range mediaIDs {
+			if err := tx.Model(&ProductMedia{}).
+				Where("id = ? AND product_id = ?", id, productID).
+				Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Notification types
+const (
+	NotificationPriceDrop   = "price_drop"
+	NotificationSaleStarted = "sale_started"
+	NotificationNewRelease  = "new_release"
+)
+
+// Notification is an in-app message to a user about a product
+type Notification struct {
+	ID        string     `json:"id" gorm:"primaryKey"`
+	UserID    string     `json:"userId" gorm:"not null;index:idx_notifications_user_created,priority:1"`
+	Type      string     `json:"type" gorm:"type:varchar(30);not null;check:type IN ('price_drop','sale_started','new_release')"`
+	ProductID string     `json:"productId" gorm:"not null;index"`
+	Title     string     `json:"title" gorm:"not null"`
+	Message   string     `json:"message" gorm:"type:text"`
+	ReadAt    *time.Time `json:"readAt"`
+	CreatedAt time.Time  `json:"createdAt" gorm:"index:idx_notifications_user_created,priority:2"`
+}
+
+// BeforeCreate hook to generate UUID
+func (n *Notification) BeforeCreate(tx *gorm.DB) error {
+	if n.ID == "" {
+		n.ID = generateUUID()
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OrphanedObject is a stored object that no database row references. Objects are
+// marked first and only deleted if they are still unreferenced after a grace period.
+type OrphanedObject struct {
+	ID         string     `json:"id" gorm:"primaryKey"`
+	ObjectKey  string     `json:"objectKey" gorm:"uniqueIndex;not null"`
+	Prefix     string     `json:"prefix" gorm:"type:varchar(40);not null;index"`
+	Size       int64      `json:"size"`
+	DetectedAt time.Time  `json:"detectedAt" gorm:"not null;index"`
+	PurgedAt   *time.Time `json:"purgedAt" gorm:"index"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+// BeforeCreate hook to generate UUID
+func (o *OrphanedObject) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == "" {
+		o.ID = generateUUID()
+	}
+	return nil
+}
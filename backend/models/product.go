@@ -1,6 +1,7 @@
 package models
 
 import (
+	"regexp"
 	"time"
 
 	"gorm.io/gorm"
@@ -10,24 +11,57 @@ type Product struct {
 	ID            string         `json:"id" gorm:"primaryKey"`
 	Title         string         `json:"title" gorm:"not null" validate:"required,min=3,max=200"`
 	Description   string         `json:"description" gorm:"type:text" validate:"required,min=10,max=5000"`
-	Price         float64        `json:"price" gorm:"not null" validate:"required,gte=0"`
+	Price         float64        `json:"price" gorm:"not null;index" validate:"required,gte=0"`
 	OriginalPrice *float64       `json:"originalPrice" validate:"omitempty,gt=0"`
-	Rating        float64        `json:"rating" gorm:"default:0"`
+	Rating        float64        `json:"rating" gorm:"default:0;index"`
 	ReviewCount   int            `json:"reviewCount" gorm:"default:0"`
-	Downloads     int            `json:"downloads" gorm:"default:0"`
+	Downloads     int            `json:"downloads" gorm:"default:0;index"`
 	Views         int            `json:"views" gorm:"default:0"`
-	Category      string         `json:"category" gorm:"not null" validate:"required,oneof=libraries cli-tools web-templates mobile desktop design database ai-ml security"`
+	// TrendingScore is recomputed by the scheduler from recent activity; 0 when there is none
+	TrendingScore float64        `json:"trendingScore" gorm:"default:0;index"`
+	// WishlistCount is the number of users who liked the product
+	WishlistCount int            `json:"wishlistCount" gorm:"default:0;index"`
+	// Liked is set for the signed-in user in product responses
+	Liked         bool           `json:"liked" gorm:"-" validate:"-"`
+	// Category is the slug of a Category; handlers check it against the taxonomy
+	Category      string         `json:"category" gorm:"not null;index" validate:"required,max=50"`
 	Author        string         `json:"author" gorm:"not null"`
 	AuthorID      string         `json:"authorId" gorm:"not null"`
 	ImageURL      string         `json:"imageUrl" validate:"omitempty,url"`
+	// Images holds the rendition URLs when ImageURL is a stable media URL
+	Images        map[string]string `json:"images,omitempty" gorm:"-" validate:"-"`
 	IsPro         bool           `json:"isPro" gorm:"default:false"`
 	Featured      bool           `json:"featured" gorm:"default:false"`
 	Tags          []string `json:"tags" gorm:"type:text[]"`
 	Status        string         `json:"status" gorm:"type:varchar(20);default:'pending';check:status IN ('active','pending','rejected','deleted')" validate:"oneof=active pending rejected deleted"`
-	FileURL       string `json:"fileUrl"`
+	FileKey       string `json:"-" gorm:"index"`
 	FileSize      string `json:"fileSize"`
-	LicenseType   string         `json:"licenseType" validate:"omitempty,oneof=MIT Apache GPL BSD Custom Commercial"`
-	CreatedAt     time.Time      `json:"createdAt"`
+	// Derived from the uploaded archive during inspection. The README can be large, so
+	// only the product detail and manifest responses include it.
+	Readme        string `json:"-" gorm:"type:text"`
+	ReadmePath    string `json:"readmePath,omitempty"`
+	FileCount     int    `json:"fileCount" gorm:"default:0"`
+	UnpackedSize  int64  `json:"unpackedSize" gorm:"default:0"`
+	LatestVersion string `json:"latestVersion,omitempty"`
+	// Malware scan state of the current archive; only clean products can be bought or downloaded
+	ScanStatus    string `json:"scanStatus" gorm:"type:varchar(20);default:'clean';check:scan_status IN ('quarantined','scanning','clean','infected','error')"`
+	// Why the scan ended in "error", for the seller
+	ScanError     string `json:"scanError,omitempty"`
+	// Credential leak review of the current archive; "pending" keeps the product unpublished
+	SecretReview  string `json:"-" gorm:"type:varchar(20);default:'clear';check:secret_review IN ('clear','pending','acknowledged')"`
+	SecretsAcknowledgedAt *time.Time `json:"-"`
+	// Status the product had before the secret review unpublished it; empty if it didn't
+	StatusBeforeSecretReview string `json:"-" gorm:"type:varchar(20)"`
+	LicenseType   string         `json:"licenseType" gorm:"index" validate:"omitempty,oneof=MIT Apache GPL BSD Custom Commercial"`
+	// Buyers download a personalized copy with a LICENSE.vibing file naming them
+	PersonalizedBuilds bool      `json:"personalizedBuilds" gorm:"default:false"`
+	// BuildWatermark also names the buyer in the ZIP comment of personalized copies
+	BuildWatermark bool          `json:"buildWatermark" gorm:"default:false"`
+	// Buyers receive releases published up to this many days after their purchase; 0 means all
+	UpdateWindowDays int         `json:"updateWindowDays" gorm:"default:0" validate:"gte=0,lte=3650"`
+	// Command name CLI tools are installed as, assigned when the first release asset is uploaded
+	CLICommand    string         `json:"cliCommand,omitempty" gorm:"index"`
+	CreatedAt     time.Time      `json:"createdAt" gorm:"index"`
 	UpdatedAt     time.Time      `json:"updatedAt"`
 	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
 
@@ -35,6 +69,7 @@ type Product struct {
 	AuthorUser User       `json:"authorUser,omitempty" gorm:"foreignKey:AuthorID" validate:"-"`
 	Purchases  []Purchase `json:"purchases,omitempty" gorm:"foreignKey:ProductID" validate:"-"`
 	Reviews    []Review   `json:"reviews,omitempty" gorm:"foreignKey:ProductID" validate:"-"`
+	Media      []ProductMedia `json:"media,omitempty" gorm:"foreignKey:ProductID" validate:"-"`
 }
 
 // BeforeCreate hook to generate UUID
@@ -45,6 +80,36 @@ func (p *Product) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// stableImagePattern matches media URLs of processed images, e.g. {base}/images/{uuid}/detail
+var stableImagePattern = regexp.MustCompile(`^(.+/images/[0-9a-f-]{36})/(?:thumb|card|detail|original)$`)
+
+// AfterFind hook to derive rendition URLs
+func (p *Product) AfterFind(tx *gorm.DB) error {
+	p.Images = ImageRenditionURLs(p.ImageURL)
+	return nil
+}
+
+// AfterSave hook to derive rendition URLs
+func (p *Product) AfterSave(tx *gorm.DB) error {
+	p.Images = ImageRenditionURLs(p.ImageURL)
+	return nil
+}
+
+// ImageRenditionURLs returns the thumb, card, detail and original URLs of a processed
+// image, or nil for external and legacy image URLs
+func ImageRenditionURLs(imageURL string) map[string]string {
+	match := stableImagePattern.FindStringSubmatch(imageURL)
+	if match == nil {
+		return nil
+	}
+	return map[string]string{
+		"thumb":    match[1] + "/thumb",
+		"card":     match[1] + "/card",
+		"detail":   match[1] + "/detail",
+		"original": match[1] + "/original",
+	}
+}
+
 // GetDiscountPercentage calculates discount percentage if original price exists
 func (p *Product) GetDiscountPercentage() *float64 {
 	if p.OriginalPrice == nil || *p.OriginalPrice <= p.Price {
@@ -54,6 +119,43 @@ func (p *Product) GetDiscountPercentage() *float64 {
 	return &discount
 }
 
+// IsOnSale reports whether the product sells below its original price
+func (p *Product) IsOnSale() bool {
+	return p.GetDiscountPercentage() != nil
+}
+
+// IsScanClean reports whether the product's archive passed the malware scan
+func (p *Product) IsScanClean() bool {
+	return p.ScanStatus == "clean"
+}
+
+// HasPendingSecretReview reports whether leaked-credential findings still await the seller
+func (p *Product) HasPendingSecretReview() bool {
+	return p.SecretReview == "pending"
+}
+
+// HoldForSecretReview marks leaked-credential findings as awaiting the seller and
+// unpublishes an active product until they are resolved
+func (p *Product) HoldForSecretReview() {
+	p.SecretReview = "pending"
+	p.SecretsAcknowledgedAt = nil
+	if p.Status == "active" {
+		p.StatusBeforeSecretReview = p.Status
+		p.Status = "pending"
+	}
+}
+
+// EndSecretReview resolves the secret review as review ("clear" or "acknowledged").
+// A product the review unpublished gets its previous status back; products pending
+// for any other reason stay pending.
+func (p *Product) EndSecretReview(review string) {
+	if p.HasPendingSecretReview() && p.StatusBeforeSecretReview != "" && p.Status == "pending" {
+		p.Status = p.StatusBeforeSecretReview
+	}
+	p.StatusBeforeSecretReview = ""
+	p.SecretReview = review
+}
+
 // IsFree checks if product is free
 func (p *Product) IsFree() bool {
 	return p.Price == 0
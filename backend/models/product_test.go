@@ -0,0 +1,55 @@
+package models
+
+import "testing"
+
+func TestSecretReview(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      string
+		findings    []bool // one per upload, true if it has findings
+		acknowledge bool
+		wantStatus  string
+		wantReview  string
+	}{
+		{"clean upload of active product", "active", []bool{false}, false, "active", "clear"},
+		{"findings unpublish active product", "active", []bool{true}, false, "pending", "pending"},
+		{"clean upload restores status", "active", []bool{true, false}, false, "active", "clear"},
+		{"repeated findings keep status to restore", "active", []bool{true, true, false}, false, "active", "clear"},
+		{"acknowledging restores status", "active", []bool{true}, true, "active", "acknowledged"},
+		{"moderation pending stays pending on clean upload", "pending", []bool{true, false}, false, "pending", "clear"},
+		{"moderation pending stays pending on acknowledge", "pending", []bool{true}, true, "pending", "acknowledged"},
+		{"rejected product stays rejected", "rejected", []bool{true}, true, "rejected", "acknowledged"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product := Product{Status: tt.status, SecretReview: "clear"}
+			for _, findings := range tt.findings {
+				if findings {
+					product.HoldForSecretReview()
+				} else {
+					product.EndSecretReview("clear")
+				}
+			}
+			if tt.acknowledge {
+				product.EndSecretReview("acknowledged")
+			}
+			if product.Status != tt.wantStatus || product.SecretReview != tt.wantReview {
+				t.Errorf("status = %s, review = %s, want %s, %s", product.Status, product.SecretReview, tt.wantStatus, tt.wantReview)
+			}
+		})
+	}
+}
+
+func TestSecretReviewAfterAdminDecision(t *testing.T) {
+	product := Product{Status: "active", SecretReview: "clear"}
+	product.HoldForSecretReview()
+
+	// An admin sends the product back to moderation, as UpdateProductStatus does
+	product.Status = "pending"
+	product.StatusBeforeSecretReview = ""
+
+	product.EndSecretReview("acknowledged")
+	if product.Status != "pending" {
+		t.Errorf("status = %s, want pending", product.Status)
+	}
+}
@@ -16,6 +16,7 @@ type Purchase struct {
 	PaymentMethod         string     `json:"paymentMethod"`
 	TossPaymentKey        string     `json:"tossPaymentKey"`
 	TossOrderID           string     `json:"tossOrderId"`
+	// DownloadURL is the API endpoint that issues download links, not a file URL
 	DownloadURL           *string    `json:"downloadUrl"`
 	LicenseKey            *string    `json:"licenseKey"`
 	IsSubscription        bool       `json:"isSubscription" gorm:"default:false"`
@@ -23,6 +24,10 @@ type Purchase struct {
 	DownloadCount         int        `json:"downloadCount" gorm:"default:0"`
 	MaxDownloads          int        `json:"maxDownloads" gorm:"default:5"`
 	
+	// Download entitlement window
+	AccessExpiresAt       *time.Time `json:"accessExpiresAt"`
+	AccessRevokedAt       *time.Time `json:"accessRevokedAt"`
+	
 	// Dispute system fields
 	DisputeReason         *string    `json:"disputeReason"`
 	DisputeRequestedAt    *time.Time `json:"disputeRequestedAt"`
@@ -49,18 +54,68 @@ func (p *Purchase) BeforeCreate(tx *gorm.DB) error {
 		p.OrderID = generateOrderID()
 	}
 	
-	// Set auto-confirm timer for completed purchases (7 days)
-	if p.Status == "completed" {
-		autoConfirmTime := time.Now().Add(7 * 24 * time.Hour)
-		p.AutoConfirmAt = &autoConfirmTime
+	// Set auto-confirm timer and access window for completed purchases
+	if p.Status == "completed" && p.AutoConfirmAt == nil {
+		p.Complete()
 	}
 	
 	return nil
 }
 
+// PurchaseConfirmPeriod is how long a buyer can download and dispute before auto-confirmation
+const PurchaseConfirmPeriod = 7 * 24 * time.Hour
+
+// ActiveEntitlementStatuses are purchase statuses that may still hold a download entitlement
+var ActiveEntitlementStatuses = []string{"completed", "dispute_requested", "dispute_processing"}
+
+// ActiveEntitlements scopes a purchase query to entitlements that have not been revoked or expired
+func ActiveEntitlements(db *gorm.DB) *gorm.DB {
+	return db.Where("purchases.status IN ? AND purchases.access_revoked_at IS NULL AND (purchases.access_expires_at IS NULL OR purchases.access_expires_at > ?)",
+		ActiveEntitlementStatuses, time.Now())
+}
+
+// OwnedPurchaseStatuses are purchase statuses of paid purchases the buyer keeps, whether
+// or not the download window is still open
+var OwnedPurchaseStatuses = []string{"completed", "confirmed", "dispute_requested", "dispute_processing"}
+
+// OwnedProductIDs lists the products a user has bought and kept
+func OwnedProductIDs(db *gorm.DB, userID string) ([]string, error) {
+	var ids []string
+	err := db.Model(&Purchase{}).Distinct("product_id").
+		Where("user_id = ? AND status IN ?", userID, OwnedPurchaseStatuses).
+		Pluck("product_id", &ids).Error
+	return ids, err
+}
+
+// Complete marks the purchase as paid and opens the download window
+func (p *Purchase) Complete() {
+	p.Status = "completed"
+	windowEnd := time.Now().Add(PurchaseConfirmPeriod)
+	p.AutoConfirmAt = &windowEnd
+	p.AccessExpiresAt = &windowEnd
+	p.AccessRevokedAt = nil
+}
+
+// RevokeAccess ends the buyer's download entitlement
+func (p *Purchase) RevokeAccess() {
+	if p.AccessRevokedAt != nil {
+		return
+	}
+	now := time.Now()
+	p.AccessRevokedAt = &now
+}
+
+// HasAccess checks if the purchase's download window is open
+func (p *Purchase) HasAccess() bool {
+	if p.AccessRevokedAt != nil {
+		return false
+	}
+	return p.AccessExpiresAt == nil || time.Now().Before(*p.AccessExpiresAt)
+}
+
 // CanDownload checks if purchase allows downloading
 func (p *Purchase) CanDownload() bool {
-	if p.Status != "completed" {
+	if p.Status != "completed" || !p.HasAccess() {
 		return false
 	}
 
@@ -79,24 +134,78 @@ func (p *Purchase) CanDownload() bool {
 	return true
 }
 
-// IncrementDownload increments download count if within limits
+// IncrementDownload increments download count if within limits.
+// The limit is enforced in the UPDATE itself so concurrent transfers can't overshoot it.
 func (p *Purchase) IncrementDownload(db *gorm.DB) error {
 	if !p.CanDownload() {
 		return ErrDownloadNotAllowed
 	}
 
-	return db.Model(p).UpdateColumn("download_count", gorm.Expr("download_count + ?", 1)).Error
+	result := db.Model(&Purchase{}).
+		Where("id = ? AND (max_downloads = 0 OR download_count < max_downloads)", p.ID).
+		UpdateColumn("download_count", gorm.Expr("download_count + ?", 1))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDownloadNotAllowed
+	}
+
+	p.DownloadCount++
+	return nil
 }
 
-// GenerateDownloadURL creates a secure download URL
-func (p *Purchase) GenerateDownloadURL() string {
-	// Return the actual file URL from the product
-	// Pre-signed URL generation will be handled in the handler
-	if p.Product.FileURL != "" {
-		return p.Product.FileURL
+// RemainingDownloads returns how many downloads are left, or nil if unlimited
+func (p *Purchase) RemainingDownloads() *int {
+	if p.MaxDownloads <= 0 {
+		return nil
+	}
+	remaining := p.MaxDownloads - p.DownloadCount
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &remaining
+}
+
+// CoversRelease reports whether a release published at releasedAt falls in the purchase's
+// update window. Releases published before the purchase are always covered.
+func (p *Purchase) CoversRelease(releasedAt time.Time, updateWindowDays int) bool {
+	if updateWindowDays <= 0 {
+		return true
+	}
+	return releasedAt.Before(p.CreatedAt.AddDate(0, 0, updateWindowDays))
+}
+
+// LatestCoveredRelease returns the newest release of the purchased product inside the
+// update window. It returns nil for products without releases and ErrOutsideUpdateWindow
+// when every release is newer than the window. Purchase must have its Product loaded.
+func (p *Purchase) LatestCoveredRelease(db *gorm.DB) (*ProductRelease, error) {
+	query := db.Where("product_id = ?", p.ProductID)
+	if days := p.Product.UpdateWindowDays; days > 0 {
+		query = query.Where("created_at < ?", p.CreatedAt.AddDate(0, 0, days))
+	}
+	var releases []ProductRelease
+	if err := query.Order("created_at DESC").Limit(1).Find(&releases).Error; err != nil {
+		return nil, err
+	}
+	if len(releases) > 0 {
+		return &releases[0], nil
+	}
+
+	var count int64
+	if err := db.Model(&ProductRelease{}).Where("product_id = ?", p.ProductID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrOutsideUpdateWindow
 	}
-	// Fallback placeholder if no file URL
-	return "https://download.vibing.com/secure/" + p.ID
+	return nil, nil
+}
+
+// GenerateDownloadURL returns the endpoint that issues download tokens for this purchase.
+// Raw storage URLs are never handed out.
+func (p *Purchase) GenerateDownloadURL() string {
+	return "/api/purchase/" + p.ID + "/download"
 }
 
 // GenerateLicenseKey creates a license key for the purchase
@@ -168,8 +277,9 @@ func (p *Purchase) ResolveDispute(resolution string, refund bool) error {
 		p.Status = "refunded"
 	} else {
 		p.Status = "confirmed"
-		// Note: S3 file deletion will be handled in the service layer
 	}
+	// Either outcome ends the buyer's download entitlement
+	p.RevokeAccess()
 	
 	return nil
 }
@@ -193,7 +303,7 @@ func (p *Purchase) AutoConfirm() error {
 	}
 	
 	p.Status = "confirmed"
-	// Note: S3 file deletion will be handled in the service layer
+	p.RevokeAccess()
 	return nil
 }
 
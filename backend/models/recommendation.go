@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sources of a product recommendation
+const (
+	// RecommendationSourcePurchases are products bought by the same customers
+	RecommendationSourcePurchases = "purchases"
+	// RecommendationSourceSimilar are products sharing tags or the category
+	RecommendationSourceSimilar = "similar"
+)
+
+// ProductRecommendation is a precomputed "customers also bought" entry. The scheduler
+// replaces the rows of every product on each run.
+type ProductRecommendation struct {
+	ID            string `json:"id" gorm:"primaryKey"`
+	ProductID     string `json:"productId" gorm:"not null;uniqueIndex:idx_product_recommendation"`
+	RecommendedID string `json:"recommendedId" gorm:"not null;uniqueIndex:idx_product_recommendation;index"`
+	// Score is the cosine similarity of the buyers of both products for purchase
+	// recommendations, and a lower tag and category similarity otherwise
+	Score  float64 `json:"score" gorm:"not null"`
+	Source string  `json:"source" gorm:"type:varchar(20);not null;check:source IN ('purchases','similar')"`
+	// Rank orders the recommendations of a product, starting at 1
+	Rank      int       `json:"rank" gorm:"not null"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"index"`
+
+	// Relations
+	Recommended Product `json:"recommended,omitempty" gorm:"foreignKey:RecommendedID"`
+}
+
+// BeforeCreate hook to generate UUID
+func (r *ProductRecommendation) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = generateUUID()
+	}
+	return nil
+}
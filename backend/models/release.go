@@ -0,0 +1,159 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// semverPattern accepts versions like 1.2.3, v1.2.3 and 1.2.3-beta.1
+var semverPattern = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z.-]+)?$`)
+
+// ProductRelease is one uploaded version of a product archive
+type ProductRelease struct {
+	ID              string   `json:"id" gorm:"primaryKey"`
+	ProductID       string   `json:"productId" gorm:"not null;uniqueIndex:idx_product_release_version"`
+	Version         string   `json:"version" gorm:"not null;uniqueIndex:idx_product_release_version"`
+	ObjectKey       string   `json:"-" gorm:"not null;index"`
+	FileSize        int64    `json:"fileSize"`
+	SHA256          string   `json:"sha256" gorm:"type:varchar(64)"`
+	SBOMKey         string   `json:"-"`
+	Licenses        []string `json:"licenses" gorm:"type:text[]"`
+	LicenseWarnings []string `json:"licenseWarnings" gorm:"type:text[]"`
+	DependencyCount int      `json:"dependencyCount" gorm:"default:0"`
+	// Go module declared by the archive's go.mod, served by the module proxy
+	GoModule    string `json:"goModule,omitempty" gorm:"index"`
+	GoModuleDir string `json:"-"`
+	GoMod       string `json:"-" gorm:"type:text"`
+	// npm package declared by the archive's package.json, served by the npm registry
+	NpmPackage     string `json:"npmPackage,omitempty" gorm:"index"`
+	NpmPackageDir  string `json:"-"`
+	NpmManifest    string `json:"-" gorm:"type:text"`
+	NpmTarballKey  string `json:"-"`
+	NpmTarballSize int64  `json:"-"`
+	NpmShasum      string `json:"-" gorm:"type:varchar(40)"`
+	NpmIntegrity   string `json:"-"`
+	// The build worker packs the tarball once the archive is clean
+	NpmPackAttempts int        `json:"-" gorm:"default:0"`
+	NpmPackingAt    *time.Time `json:"-"`
+	CreatedAt       time.Time  `json:"createdAt"`
+
+	// Relations
+	Assets []ReleaseAsset `json:"assets,omitempty" gorm:"foreignKey:ReleaseID"`
+}
+
+// BeforeCreate hook to generate UUID
+func (r *ProductRelease) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = generateUUID()
+	}
+	return nil
+}
+
+// HasSBOM reports whether an SBOM was generated for the release
+func (r *ProductRelease) HasSBOM() bool {
+	return r.SBOMKey != ""
+}
+
+// NormalizeVersion validates a semantic version and strips a leading "v"
+func NormalizeVersion(version string) (string, error) {
+	version = strings.TrimSpace(version)
+	if !semverPattern.MatchString(version) {
+		return "", fmt.Errorf("version must be a semantic version such as 1.2.3")
+	}
+	return strings.TrimPrefix(version, "v"), nil
+}
+
+// NextReleaseVersion returns the version for an upload that didn't specify one:
+// the latest release with its patch number bumped, or 1.0.0 for the first release
+func NextReleaseVersion(db *gorm.DB, productID string) string {
+	var latest ProductRelease
+	if err := db.Where("product_id = ?", productID).Order("created_at DESC").First(&latest).Error; err != nil {
+		return "1.0.0"
+	}
+
+	match := semverPattern.FindStringSubmatch(latest.Version)
+	if match == nil {
+		return "1.0.0"
+	}
+	patch, _ := strconv.Atoi(match[3])
+	return fmt.Sprintf("%s.%s.%d", match[1], match[2], patch+1)
+}
+
+// LatestRelease returns the most recent release of a product
+func LatestRelease(db *gorm.DB, productID string) (*ProductRelease, error) {
+	var release ProductRelease
+	if err := db.Where("product_id = ?", productID).Order("created_at DESC").First(&release).Error; err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// CompareVersions orders two semantic versions, returning -1, 0 or 1. Pre-releases sort
+// before the release they precede; their identifiers are compared numerically when both
+// are numbers and as strings otherwise.
+func CompareVersions(a, b string) int {
+	ma, mb := semverPattern.FindStringSubmatch(a), semverPattern.FindStringSubmatch(b)
+	if ma == nil || mb == nil {
+		return strings.Compare(a, b)
+	}
+
+	for i := 1; i <= 3; i++ {
+		x, _ := strconv.Atoi(ma[i])
+		y, _ := strconv.Atoi(mb[i])
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	pa, pb := strings.TrimPrefix(ma[4], "-"), strings.TrimPrefix(mb[4], "-")
+	switch {
+	case pa == pb:
+		return 0
+	case pa == "":
+		return 1
+	case pb == "":
+		return -1
+	}
+
+	ia, ib := strings.Split(pa, "."), strings.Split(pb, ".")
+	for i := 0; i < len(ia) && i < len(ib); i++ {
+		if ia[i] == ib[i] {
+			continue
+		}
+		x, errX := strconv.Atoi(ia[i])
+		y, errY := strconv.Atoi(ib[i])
+		switch {
+		case errX == nil && errY == nil:
+			if x < y {
+				return -1
+			}
+			return 1
+		case errX == nil:
+			return -1
+		case errY == nil:
+			return 1
+		}
+		return strings.Compare(ia[i], ib[i])
+	}
+	switch {
+	case len(ia) < len(ib):
+		return -1
+	case len(ia) > len(ib):
+		return 1
+	}
+	return 0
+}
+
+// IsPrerelease reports whether a semantic version has a pre-release suffix
+func IsPrerelease(version string) bool {
+	match := semverPattern.FindStringSubmatch(version)
+	return match != nil && match[4] != ""
+}
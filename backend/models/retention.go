@@ -0,0 +1,90 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FileRetentionPeriod is the minimum time a retired product file is kept in storage
+const FileRetentionPeriod = 30 * 24 * time.Hour
+
+// FileRetention tracks a product file that is no longer the current listing file.
+// The object is only purged once the retention period has passed and nothing references it.
+type FileRetention struct {
+	ID          string     `json:"id" gorm:"primaryKey"`
+	ObjectKey   string     `json:"objectKey" gorm:"uniqueIndex;not null"`
+	ProductID   string     `json:"productId" gorm:"not null;index"`
+	Reason      string     `json:"reason" gorm:"type:varchar(30);check:reason IN ('replaced','product_deleted')"`
+	RetainUntil time.Time  `json:"retainUntil" gorm:"not null;index"`
+	PurgedAt    *time.Time `json:"purgedAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+// BeforeCreate hook to generate UUID
+func (r *FileRetention) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = generateUUID()
+	}
+	return nil
+}
+
+// RetireProductFile schedules an object for retention-based garbage collection.
+// Retiring an object that is already tracked restarts its retention period.
+func RetireProductFile(db *gorm.DB, productID, objectKey, reason string) error {
+	if objectKey == "" {
+		return nil
+	}
+
+	retention := FileRetention{
+		ObjectKey:   objectKey,
+		ProductID:   productID,
+		Reason:      reason,
+		RetainUntil: time.Now().Add(FileRetentionPeriod),
+	}
+
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "object_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"reason", "retain_until", "updated_at"}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "file_retentions.purged_at IS NULL"}}},
+	}).Create(&retention).Error
+}
+
+// RetireProductFiles retires the current file and every release archive, SBOM, asset and patch of a product
+func RetireProductFiles(db *gorm.DB, product *Product, reason string) error {
+	keys := []string{product.FileKey}
+
+	var releases []ProductRelease
+	if err := db.Select("object_key, sbom_key, npm_tarball_key").Where("product_id = ?", product.ID).Find(&releases).Error; err != nil {
+		return err
+	}
+	for _, release := range releases {
+		keys = append(keys, release.ObjectKey, release.SBOMKey, release.NpmTarballKey)
+	}
+
+	var assetKeys []string
+	if err := db.Model(&ReleaseAsset{}).Where("product_id = ?", product.ID).Pluck("object_key", &assetKeys).Error; err != nil {
+		return err
+	}
+	keys = append(keys, assetKeys...)
+
+	var deltaKeys []string
+	if err := db.Model(&ReleaseDelta{}).Where("product_id = ? AND object_key <> ''", product.ID).Pluck("object_key", &deltaKeys).Error; err != nil {
+		return err
+	}
+	keys = append(keys, deltaKeys...)
+
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if err := RetireProductFile(db, product.ID, key, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"vibing-backend/pagination"
 )
 
 type Review struct {
@@ -101,27 +102,28 @@ func GetUserReviewForProduct(db *gorm.DB, userID, productID string) (*Review, er
 }
 
 // GetProductReviews gets paginated reviews for a product
-func GetProductReviews(db *gorm.DB, productID string, page, limit int) ([]Review, int64, error) {
+func GetProductReviews(db *gorm.DB, productID string, params pagination.Params) ([]Review, int64, error) {
 	var reviews []Review
 	var total int64
 
-	// Count total reviews
-	if err := db.Model(&Review{}).Where("product_id = ?", productID).Count(&total).Error; err != nil {
-		return nil, 0, err
+	// Count total reviews; cursor pages skip the count
+	if !params.IsCursor() {
+		if err := db.Model(&Review{}).Where("product_id = ?", productID).Count(&total).Error; err != nil {
+			return nil, 0, err
+		}
 	}
 
-	// Get paginated reviews
-	offset := (page - 1) * limit
-	err := db.Where("product_id = ?", productID).
+	// Get the page plus one lookahead review, newest first
+	err := reviewKeyset.Apply(db.Where("product_id = ?", productID), params).
 		Preload("User").
-		Order("created_at DESC").
-		Limit(limit).
-		Offset(offset).
 		Find(&reviews).Error
 
 	return reviews, total, err
 }
 
+// reviewKeyset pages reviews newest first
+var reviewKeyset = pagination.Keyset{TimeColumn: "created_at", IDColumn: "id", Desc: true}
+
 // GetRatingDistribution gets rating distribution for a product
 func GetRatingDistribution(db *gorm.DB, productID string) (map[int]int64, error) {
 	distribution := make(map[int]int64)
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxScanAttempts is how often a scan is retried after scanner errors before giving up
+const MaxScanAttempts = 3
+
+// ScannedAsset tracks the malware scan state of an uploaded object. Uploads start
+// quarantined and only become visible to other users once the scan comes back clean.
+type ScannedAsset struct {
+	ID         string     `json:"id" gorm:"primaryKey"`
+	ObjectKey  string     `json:"objectKey" gorm:"uniqueIndex;not null"`
+	Kind       string     `json:"kind" gorm:"type:varchar(20);not null;check:kind IN ('product_file','chat_image')"`
+	ProductID  *string    `json:"productId" gorm:"index"`
+	UploaderID string     `json:"uploaderId" gorm:"not null;index"`
+	Status     string     `json:"status" gorm:"type:varchar(20);default:'quarantined';index;check:status IN ('quarantined','scanning','clean','infected','error')"`
+	Signature  string     `json:"signature,omitempty"`
+	Scanner    string     `json:"scanner,omitempty"`
+	Attempts   int        `json:"attempts" gorm:"default:0"`
+	LastError  string     `json:"lastError,omitempty"`
+	ScannedAt  *time.Time `json:"scannedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+
+	// Relations
+	Product  *Product `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	Uploader User     `json:"uploader,omitempty" gorm:"foreignKey:UploaderID"`
+}
+
+// BeforeCreate hook to generate UUID
+func (a *ScannedAsset) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == "" {
+		a.ID = generateUUID()
+	}
+	return nil
+}
+
+// IsClean reports whether the asset passed its scan
+func (a *ScannedAsset) IsClean() bool {
+	return a.Status == "clean"
+}
+
+// QuarantineAsset records a freshly uploaded object as awaiting a scan.
+// Re-uploading to the same key resets the scan.
+func QuarantineAsset(db *gorm.DB, objectKey, kind string, productID *string, uploaderID string) error {
+	asset := ScannedAsset{
+		ObjectKey:  objectKey,
+		Kind:       kind,
+		ProductID:  productID,
+		UploaderID: uploaderID,
+		Status:     "quarantined",
+	}
+
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "object_key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"status":     "quarantined",
+			"signature":  "",
+			"attempts":   0,
+			"last_error": "",
+			"scanned_at": nil,
+			"updated_at": time.Now(),
+		}),
+	}).Create(&asset).Error
+}
+
+// AssetScanStatus returns the scan status of an object, or "quarantined" if it was never recorded
+func AssetScanStatus(db *gorm.DB, objectKey string) string {
+	var asset ScannedAsset
+	if err := db.Select("status").Where("object_key = ?", objectKey).First(&asset).Error; err != nil {
+		return "quarantined"
+	}
+	return asset.Status
+}
+
+// MaskUnscannedImages hides image URLs of chat messages whose image has not passed its scan.
+// Senders still see their own images.
+func MaskUnscannedImages(db *gorm.DB, messages []ChatMessage, viewerID string) {
+	var keys []string
+	for _, message := range messages {
+		if message.ImageKey != nil {
+			keys = append(keys, *message.ImageKey)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	var assets []ScannedAsset
+	db.Select("object_key, status").Where("object_key IN ?", keys).Find(&assets)
+	statuses := make(map[string]string, len(assets))
+	for _, asset := range assets {
+		statuses[asset.ObjectKey] = asset.Status
+	}
+
+	for i := range messages {
+		if messages[i].ImageKey == nil {
+			continue
+		}
+		status, ok := statuses[*messages[i].ImageKey]
+		if !ok {
+			status = "quarantined"
+		}
+		messages[i].ImageStatus = status
+		if status != "clean" && messages[i].SenderID != viewerID {
+			messages[i].ImageURL = nil
+		}
+	}
+}
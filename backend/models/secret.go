@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SecretFinding is a likely leaked credential found in a product archive during inspection.
+// Findings are only shown to the seller and admins.
+type SecretFinding struct {
+	ID          string    `json:"id" gorm:"primaryKey"`
+	ProductID   string    `json:"productId" gorm:"not null;index"`
+	ObjectKey   string    `json:"-" gorm:"not null"`
+	Path        string    `json:"path" gorm:"not null"`
+	Line        int       `json:"line"`
+	RuleID      string    `json:"ruleId" gorm:"type:varchar(50);not null"`
+	Description string    `json:"description"`
+	Match       string    `json:"match"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// BeforeCreate hook to generate UUID
+func (f *SecretFinding) BeforeCreate(tx *gorm.DB) error {
+	if f.ID == "" {
+		f.ID = generateUUID()
+	}
+	return nil
+}
+
+// ReplaceSecretFindings swaps the stored findings of a product for those of a new archive
+func ReplaceSecretFindings(tx *gorm.DB, productID string, findings []SecretFinding) error {
+	if err := tx.Where("product_id = ?", productID).Delete(&SecretFinding{}).Error; err != nil {
+		return err
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+	return tx.Create(&findings).Error
+}
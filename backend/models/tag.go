@@ -0,0 +1,203 @@
+package models
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// MaxProductTags bounds the tags of a product
+	MaxProductTags = 10
+	// maxTagSlugLength matches the slug column
+	maxTagSlugLength = 50
+)
+
+// Tag is the canonical form of a product tag. Products store tag slugs.
+type Tag struct {
+	ID   string `json:"id" gorm:"primaryKey"`
+	Slug string `json:"slug" gorm:"type:varchar(50);uniqueIndex;not null"`
+	// Name is the display name, the spelling the tag was first used with
+	Name string `json:"name" gorm:"not null"`
+	// UsageCount is the number of active products with the tag
+	UsageCount int        `json:"usageCount" gorm:"default:0;index"`
+	Aliases    []TagAlias `json:"aliases,omitempty" gorm:"foreignKey:TagID"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+// TagAlias maps a spelling to a tag. Aliases are stored as TagKey, so spellings that
+// only differ in case or separators ("go-lang", "GoLang") share one alias.
+type TagAlias struct {
+	ID        string    `json:"id" gorm:"primaryKey"`
+	Alias     string    `json:"alias" gorm:"type:varchar(50);uniqueIndex;not null"`
+	TagID     string    `json:"tagId" gorm:"not null;index"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// BeforeCreate hook to generate UUID
+func (t *Tag) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == "" {
+		t.ID = generateUUID()
+	}
+	return nil
+}
+
+// BeforeCreate hook to generate UUID
+func (a *TagAlias) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == "" {
+		a.ID = generateUUID()
+	}
+	return nil
+}
+
+// TagSlug normalizes a tag to lowercase letters and digits separated by single dashes.
+// "+" and "#" are kept for names like "c++" and "c#".
+func TagSlug(raw string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(raw)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '+' || r == '#' {
+			separator := ""
+			if dash && b.Len() > 0 {
+				separator = "-"
+			}
+			dash = false
+			// Stop at the first character that doesn't fit, so slugs never end on a dash
+			if b.Len()+len(separator)+utf8.RuneLen(r) > maxTagSlugLength {
+				break
+			}
+			b.WriteString(separator)
+			b.WriteRune(r)
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// TagKey is the alias form of a slug, without separators
+func TagKey(slug string) string {
+	return strings.ReplaceAll(slug, "-", "")
+}
+
+// ResolveTag returns the tag a spelling refers to, or nil when it's unknown
+func ResolveTag(db *gorm.DB, raw string) (*Tag, error) {
+	slug := TagSlug(raw)
+	if slug == "" {
+		return nil, nil
+	}
+
+	var tag Tag
+	err := db.Where("slug = ? OR id IN (?)", slug,
+		db.Model(&TagAlias{}).Select("tag_id").Where("alias = ?", TagKey(slug))).
+		Order(clause.OrderBy{Expression: clause.Expr{SQL: "slug = ? DESC", Vars: []interface{}{slug}}}).
+		First(&tag).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// ResolveTags maps spellings to canonical slugs without registering new tags. Unknown
+// tags are returned normalized.
+func ResolveTags(db *gorm.DB, raw []string) ([]string, error) {
+	var slugs []string
+	seen := map[string]bool{}
+	for _, value := range raw {
+		tag, err := ResolveTag(db, value)
+		if err != nil {
+			return nil, err
+		}
+		slug := TagSlug(value)
+		if tag != nil {
+			slug = tag.Slug
+		}
+		if slug != "" && !seen[slug] {
+			seen[slug] = true
+			slugs = append(slugs, slug)
+		}
+	}
+	return slugs, nil
+}
+
+// NormalizeTags maps spellings to canonical slugs, registering tags that don't exist yet
+func NormalizeTags(db *gorm.DB, raw []string) ([]string, error) {
+	var slugs []string
+	seen := map[string]bool{}
+	for _, value := range raw {
+		tag, err := ResolveTag(db, value)
+		if err != nil {
+			return nil, err
+		}
+		if tag == nil {
+			if tag, err = registerTag(db, value); err != nil {
+				return nil, err
+			}
+		}
+		if tag != nil && !seen[tag.Slug] {
+			seen[tag.Slug] = true
+			slugs = append(slugs, tag.Slug)
+		}
+	}
+	return slugs, nil
+}
+
+// registerTag creates a tag and its alias. A tag registered concurrently under the same
+// slug is returned instead.
+func registerTag(db *gorm.DB, raw string) (*Tag, error) {
+	slug := TagSlug(raw)
+	if slug == "" {
+		return nil, nil
+	}
+
+	name := strings.Join(strings.Fields(raw), " ")
+	if len(name) > 100 {
+		name = slug
+	}
+	tag := Tag{Slug: slug, Name: name}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&tag).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("slug = ?", slug).First(&tag).Error; err != nil {
+		return nil, err
+	}
+	if err := AddTagAlias(db, tag.ID, slug); err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// AddTagAlias points a spelling at a tag, taking it over from any other tag
+func AddTagAlias(db *gorm.DB, tagID, slug string) error {
+	alias := TagAlias{Alias: TagKey(slug), TagID: tagID}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "alias"}},
+		DoUpdates: clause.AssignmentColumns([]string{"tag_id"}),
+	}).Create(&alias).Error
+}
+
+// tagUsage counts the active products with a tag
+const tagUsage = "(SELECT count(*) FROM products WHERE products.status = 'active' AND products.deleted_at IS NULL AND products.tags @> ARRAY[tags.slug]::text[])"
+
+// RefreshTagUsage recounts the products of the tags with the given slugs, or of every
+// tag when slugs is nil
+func RefreshTagUsage(db *gorm.DB, slugs []string) error {
+	query := db.Model(&Tag{})
+	if slugs == nil {
+		query = query.Session(&gorm.Session{AllowGlobalUpdate: true})
+	} else {
+		if len(slugs) == 0 {
+			return nil
+		}
+		query = query.Where("slug IN ?", slugs)
+	}
+	return query.UpdateColumn("usage_count", gorm.Expr(tagUsage)).Error
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTagSlug(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"Go", "go"},
+		{"  React Native  ", "react-native"},
+		{"react_native", "react-native"},
+		{"React--Native!!", "react-native"},
+		{"--leading and trailing--", "leading-and-trailing"},
+		{"node.js", "node-js"},
+		{"C++", "c++"},
+		{"C#", "c#"},
+		{"Vue 3", "vue-3"},
+		{"머신 러닝", "머신-러닝"},
+		{"日本語", "日本語"},
+		{"ÉCOLE", "école"},
+		{"!!!", ""},
+		{"", ""},
+		{"   ", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if got := TagSlug(tt.raw); got != tt.want {
+				t.Errorf("TagSlug(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagSlugLength(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"at the limit", strings.Repeat("a", maxTagSlugLength), strings.Repeat("a", maxTagSlugLength)},
+		{"over the limit", strings.Repeat("a", maxTagSlugLength+10), strings.Repeat("a", maxTagSlugLength)},
+		{"separator at the limit", strings.Repeat("a", maxTagSlugLength-1) + " b", strings.Repeat("a", maxTagSlugLength-1)},
+		{"separator after the limit", strings.Repeat("a", maxTagSlugLength) + " b", strings.Repeat("a", maxTagSlugLength)},
+		// A multi-byte character that would cross the limit is left out whole
+		{"multi-byte at the limit", strings.Repeat("a", maxTagSlugLength-1) + "가", strings.Repeat("a", maxTagSlugLength-1)},
+		{"multi-byte words", strings.Repeat("가나 ", 20), strings.Repeat("가나-", 6) + "가나"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TagSlug(tt.raw)
+			if got != tt.want {
+				t.Errorf("TagSlug = %q, want %q", got, tt.want)
+			}
+			if len(got) > maxTagSlugLength || !utf8.ValidString(got) || strings.HasSuffix(got, "-") {
+				t.Errorf("TagSlug = %q is not a valid slug", got)
+			}
+		})
+	}
+}
+
+func TestTagKey(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"golang", "golang"},
+		{"go-lang", "golang"},
+		{"Go Lang", "golang"},
+		{"GO_LANG", "golang"},
+		{"react-native-web", "reactnativeweb"},
+		{"C++", "c++"},
+		{"머신 러닝", "머신러닝"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if got := TagKey(TagSlug(tt.raw)); got != tt.want {
+				t.Errorf("TagKey(TagSlug(%q)) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
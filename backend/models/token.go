@@ -0,0 +1,83 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AccessTokenPrefix marks personal access tokens, so they can be told apart from JWTs
+const AccessTokenPrefix = "vbt_"
+
+// MaxAccessTokens is how many active access tokens a user can hold
+const MaxAccessTokens = 20
+
+// AccessToken is a long-lived personal credential for tools that can't log in, such
+// as the go command fetching purchased modules. Only the SHA-256 hash is stored.
+type AccessToken struct {
+	ID        string `json:"id" gorm:"primaryKey"`
+	UserID    string `json:"userId" gorm:"not null;index"`
+	Name      string `json:"name" gorm:"not null"`
+	TokenHash string `json:"-" gorm:"uniqueIndex;not null"`
+	// Hint is the start of the token, shown so users can tell their tokens apart
+	Hint       string     `json:"hint" gorm:"type:varchar(16)"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+
+	// Relations
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// BeforeCreate hook to generate UUID
+func (t *AccessToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == "" {
+		t.ID = generateUUID()
+	}
+	return nil
+}
+
+// NewAccessToken creates an unsaved token and returns it together with the raw
+// value, which is only shown to the user once
+func NewAccessToken(userID, name string, expiresAt *time.Time) (*AccessToken, string) {
+	raw := make([]byte, 20)
+	rand.Read(raw)
+	token := AccessTokenPrefix + hex.EncodeToString(raw)
+
+	return &AccessToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: HashDownloadToken(token),
+		Hint:      token[:len(AccessTokenPrefix)+6],
+		ExpiresAt: expiresAt,
+	}, token
+}
+
+// IsAccessToken reports whether a credential looks like a personal access token
+func IsAccessToken(credential string) bool {
+	return strings.HasPrefix(credential, AccessTokenPrefix)
+}
+
+// IsActive checks that the token was neither revoked nor has expired
+func (t *AccessToken) IsActive() bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || time.Now().Before(*t.ExpiresAt))
+}
+
+// ActiveAccessTokens scopes a query to tokens that can still be used
+func ActiveAccessTokens(db *gorm.DB) *gorm.DB {
+	return db.Where("revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", time.Now())
+}
+
+// FindAccessToken loads an active token and its user from the raw token value
+func FindAccessToken(db *gorm.DB, raw string) (*AccessToken, error) {
+	var token AccessToken
+	if err := db.Scopes(ActiveAccessTokens).Where("token_hash = ?", HashDownloadToken(raw)).
+		Preload("User").First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
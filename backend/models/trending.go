@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ProductViewDay counts the views of a product on a day, the windowed view signal of
+// trending scores
+type ProductViewDay struct {
+	ProductID string    `json:"productId" gorm:"primaryKey"`
+	Day       time.Time `json:"day" gorm:"primaryKey;type:date;index"`
+	Views     int       `json:"views" gorm:"not null;default:0"`
+}
+
+// AddProductViews adds views to the count of a product on a day
+func AddProductViews(db *gorm.DB, productID string, day time.Time, views int) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"views": gorm.Expr("product_view_days.views + ?", views)}),
+	}).Create(&ProductViewDay{ProductID: productID, Day: day.UTC().Truncate(24 * time.Hour), Views: views}).Error
+}
+
+// TrendingSnapshot records how a trending score was computed, so admins can see which
+// activity put a product on the trending list
+type TrendingSnapshot struct {
+	ID        string `json:"id" gorm:"primaryKey"`
+	ProductID string `json:"productId" gorm:"not null;index"`
+	Category  string `json:"category"`
+	// Signals are the decayed event counts in the trending window, by signal name
+	Signals map[string]float64 `json:"signals" gorm:"type:jsonb;serializer:json"`
+	// RawScore is the weighted sum of the decayed counts
+	RawScore float64 `json:"rawScore"`
+	// Baseline is the average raw score of the category the raw score is divided by
+	Baseline   float64   `json:"baseline"`
+	Score      float64   `json:"score"`
+	Rank       int       `json:"rank"`
+	ComputedAt time.Time `json:"computedAt" gorm:"not null;index"`
+}
+
+// BeforeCreate hook to generate UUID
+func (s *TrendingSnapshot) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = generateUUID()
+	}
+	return nil
+}
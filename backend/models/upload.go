@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UploadSessionTTL is how long a multipart upload may stay unfinished before it is aborted
+const UploadSessionTTL = 24 * time.Hour
+
+// UploadSession tracks a resumable multipart upload of a product archive. Assembled
+// uploads stay "verifying" until the upload verifier has checked and inspected them.
+type UploadSession struct {
+	ID             string     `json:"id" gorm:"primaryKey"`
+	UserID         string     `json:"userId" gorm:"not null;index"`
+	ProductID      string     `json:"productId" gorm:"not null;index"`
+	ObjectKey      string     `json:"objectKey" gorm:"not null"`
+	UploadID       string     `json:"-" gorm:"not null;uniqueIndex"`
+	Filename       string     `json:"filename" gorm:"not null"`
+	FileSize       int64      `json:"fileSize" gorm:"not null"`
+	PartSize       int64      `json:"partSize" gorm:"not null"`
+	PartCount      int        `json:"partCount" gorm:"not null"`
+	ChecksumSHA256 string     `json:"checksumSha256" gorm:"type:varchar(64);not null"`
+	Version        string     `json:"version,omitempty" gorm:"type:varchar(40)"`
+	Status         string     `json:"status" gorm:"type:varchar(20);default:'initiated';check:status IN ('initiated','verifying','completed','aborted','failed')"`
+	FailureCode    string     `json:"failureCode,omitempty" gorm:"type:varchar(40)"`
+	FailureReason  *string    `json:"failureReason"`
+	VerifyAttempts int        `json:"-" gorm:"default:0"`
+	VerifyingAt    *time.Time `json:"-"`
+	ExpiresAt      time.Time  `json:"expiresAt" gorm:"not null;index"`
+	CompletedAt    *time.Time `json:"completedAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+// BeforeCreate hook to generate UUID
+func (u *UploadSession) BeforeCreate(tx *gorm.DB) error {
+	if u.ID == "" {
+		u.ID = generateUUID()
+	}
+	return nil
+}
+
+// IsOpen checks if parts can still be uploaded to this session
+func (u *UploadSession) IsOpen() bool {
+	return u.Status == "initiated" && time.Now().Before(u.ExpiresAt)
+}
+
+// Fail marks the session as failed with an error code and a reason
+func (u *UploadSession) Fail(code, reason string) {
+	u.Status = "failed"
+	u.FailureCode = code
+	u.FailureReason = &reason
+}
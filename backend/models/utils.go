@@ -21,6 +21,8 @@ var (
 	ErrDisputeNotAllowed    = errors.New("dispute not allowed")
 	ErrInvalidDisputeStatus = errors.New("invalid dispute status")
 	ErrAutoConfirmNotAllowed = errors.New("auto-confirm not allowed")
+	ErrGalleryFull          = errors.New("gallery is full")
+	ErrOutsideUpdateWindow  = errors.New("no release inside the update window")
 )
 
 // generateUUID generates a new UUID string
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WishlistItem is a product a user liked. The notifier compares the product with the
+// state it last told the user about.
+type WishlistItem struct {
+	ID        string `json:"id" gorm:"primaryKey"`
+	UserID    string `json:"userId" gorm:"not null;uniqueIndex:idx_wishlist_user_product"`
+	ProductID string `json:"productId" gorm:"not null;uniqueIndex:idx_wishlist_user_product;index"`
+	// Product state the user was last notified of, starting with the state when liked
+	NotifiedPrice   float64   `json:"-" gorm:"not null"`
+	NotifiedSale    bool      `json:"-" gorm:"not null;default:false"`
+	NotifiedVersion string    `json:"-"`
+	CreatedAt       time.Time `json:"createdAt" gorm:"index"`
+
+	// Relations
+	Product Product `json:"product" gorm:"foreignKey:ProductID"`
+}
+
+// BeforeCreate hook to generate UUID
+func (w *WishlistItem) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == "" {
+		w.ID = generateUUID()
+	}
+	return nil
+}
+
+// NewWishlistItem likes product for a user, remembering its current state
+func NewWishlistItem(userID string, product *Product) *WishlistItem {
+	return &WishlistItem{
+		UserID:          userID,
+		ProductID:       product.ID,
+		NotifiedPrice:   product.Price,
+		NotifiedSale:    product.IsOnSale(),
+		NotifiedVersion: product.LatestVersion,
+	}
+}
+
+// RefreshWishlistCount recounts the users who liked a product
+func RefreshWishlistCount(db *gorm.DB, productID string) error {
+	return db.Model(&Product{}).Where("id = ?", productID).
+		UpdateColumn("wishlist_count", gorm.Expr("(SELECT count(*) FROM wishlist_items WHERE wishlist_items.product_id = ?)", productID)).Error
+}
+
+// LikedProductIDs returns which of the products a user liked
+func LikedProductIDs(db *gorm.DB, userID string, productIDs []string) (map[string]bool, error) {
+	liked := map[string]bool{}
+	if len(productIDs) == 0 {
+		return liked, nil
+	}
+	var ids []string
+	if err := db.Model(&WishlistItem{}).Where("user_id = ? AND product_id IN ?", userID, productIDs).
+		Pluck("product_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		liked[id] = true
+	}
+	return liked, nil
+}
@@ -0,0 +1,192 @@
+// Package pagination parses page requests of list endpoints and pages queries either by
+// offset or by an opaque cursor over a (timestamp, id) keyset.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxLimit bounds the items of a single page
+	MaxLimit = 100
+	// MaxPage bounds offset paging; deeper pages should follow nextCursor
+	MaxPage = 10000
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Params is the page requested from a list endpoint. Without a cursor the page is
+// selected by offset, which keeps ?page= working for existing clients.
+type Params struct {
+	Page   int
+	Limit  int
+	cursor *cursor
+}
+
+// cursor is the position after the last item of the previous page
+type cursor struct {
+	Time time.Time `json:"t"`
+	ID   string    `json:"id"`
+}
+
+// Meta is the pagination metadata of a list response. Offset pages report the page
+// number and totals; cursor pages skip the count and only report whether more follow.
+type Meta struct {
+	CurrentPage  *int   `json:"currentPage,omitempty"`
+	TotalPages   *int64 `json:"totalPages,omitempty"`
+	TotalItems   *int64 `json:"totalItems,omitempty"`
+	ItemsPerPage int    `json:"itemsPerPage"`
+	HasMore      bool   `json:"hasMore"`
+	NextCursor   string `json:"nextCursor,omitempty"`
+}
+
+// Parse reads page, limit and cursor from the query string. Missing values use page 1
+// and defaultLimit, limits above MaxLimit are lowered, and malformed values are errors.
+func Parse(c *fiber.Ctx, defaultLimit int) (Params, error) {
+	p := Params{Page: 1, Limit: defaultLimit}
+
+	limit, err := QueryInt(c, "limit", defaultLimit, MaxLimit)
+	if err != nil {
+		return p, err
+	}
+	p.Limit = limit
+
+	if value := c.Query("cursor"); value != "" {
+		decoded, err := decodeCursor(value)
+		if err != nil {
+			return p, err
+		}
+		p.cursor = decoded
+		return p, nil
+	}
+
+	if value := c.Query("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 || page > MaxPage {
+			return p, fmt.Errorf("page must be between 1 and %d", MaxPage)
+		}
+		p.Page = page
+	}
+	return p, nil
+}
+
+// QueryInt reads a positive number from the query string for lists that return a single
+// bounded batch. A missing value uses defaultValue, values above max are lowered, and
+// malformed values are errors.
+func QueryInt(c *fiber.Ctx, name string, defaultValue, max int) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive number", name)
+	}
+	return min(n, max), nil
+}
+
+// ParseOffset is Parse for lists that aren't ordered by a keyset and only page by offset
+func ParseOffset(c *fiber.Ctx, defaultLimit int) (Params, error) {
+	p, err := Parse(c, defaultLimit)
+	if err == nil && p.IsCursor() {
+		return p, fmt.Errorf("cursor paging isn't supported for this list")
+	}
+	return p, err
+}
+
+// IsCursor reports whether the page continues from a cursor
+func (p Params) IsCursor() bool {
+	return p.cursor != nil
+}
+
+// Offset is the number of items before an offset page
+func (p Params) Offset() int {
+	return (p.Page - 1) * p.Limit
+}
+
+// Count counts a query for offset pages. Cursor pages skip the count, which would
+// scan every matching row.
+func (p Params) Count(db *gorm.DB) int64 {
+	var total int64
+	if !p.IsCursor() {
+		db.Count(&total)
+	}
+	return total
+}
+
+// Keyset is the order of a list: a timestamp column with the ID column breaking ties
+type Keyset struct {
+	TimeColumn string
+	IDColumn   string
+	Desc       bool
+}
+
+// Apply orders a query by the keyset and selects the requested page plus one lookahead
+// item, which Trim uses to tell whether more pages follow
+func (k Keyset) Apply(db *gorm.DB, p Params) *gorm.DB {
+	dir, cmp := "ASC", ">"
+	if k.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	db = db.Order(fmt.Sprintf("%s %s, %s %s", k.TimeColumn, dir, k.IDColumn, dir))
+	if p.cursor != nil {
+		db = db.Where(fmt.Sprintf("(%s, %s) %s (?, ?)", k.TimeColumn, k.IDColumn, cmp), p.cursor.Time, p.cursor.ID)
+	} else {
+		db = db.Offset(p.Offset())
+	}
+	return db.Limit(p.Limit + 1)
+}
+
+// Window selects an offset page plus one lookahead item for lists that aren't ordered
+// by a keyset
+func (p Params) Window(db *gorm.DB) *gorm.DB {
+	return db.Offset(p.Offset()).Limit(p.Limit + 1)
+}
+
+// Trim drops the lookahead item of a page and builds its metadata. key returns the
+// keyset values of an item; nil leaves out nextCursor for lists without a keyset.
+func Trim[T any](p Params, items []T, total int64, key func(T) (time.Time, string)) ([]T, Meta) {
+	meta := Meta{ItemsPerPage: p.Limit}
+	if len(items) > p.Limit {
+		items = items[:p.Limit]
+		meta.HasMore = true
+	}
+	if meta.HasMore && key != nil && len(items) > 0 {
+		t, id := key(items[len(items)-1])
+		meta.NextCursor = encodeCursor(cursor{Time: t, ID: id})
+	}
+
+	if !p.IsCursor() {
+		page := p.Page
+		totalPages := (total + int64(p.Limit) - 1) / int64(p.Limit)
+		meta.CurrentPage = &page
+		meta.TotalPages = &totalPages
+		meta.TotalItems = &total
+	}
+	return items, meta
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" || c.Time.IsZero() {
+		return nil, errInvalidCursor
+	}
+	return &c, nil
+}
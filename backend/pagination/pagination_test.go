@@ -0,0 +1,296 @@
+package pagination
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// parseQuery runs parse on a request with the given query string
+func parseQuery(t *testing.T, query string, parse func(*fiber.Ctx, int) (Params, error)) (Params, error) {
+	t.Helper()
+	var p Params
+	var err error
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		p, err = parse(c, 20)
+		return nil
+	})
+	if _, testErr := app.Test(httptest.NewRequest("GET", "/?"+query, nil)); testErr != nil {
+		t.Fatalf("request: %v", testErr)
+	}
+	return p, err
+}
+
+// dryRun returns a session that builds SQL without a database
+func dryRun(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatalf("opening dry run session: %v", err)
+	}
+	return db
+}
+
+type item struct {
+	ID        string
+	CreatedAt time.Time
+}
+
+func itemKey(i item) (time.Time, string) {
+	return i.CreatedAt, i.ID
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 30, 45, 123456789, time.FixedZone("KST", 9*60*60))
+	tests := []struct {
+		name string
+		c    cursor
+	}{
+		{"nanoseconds and zone", cursor{Time: at, ID: "0b6c2f0e-8a43-4e43-9f5e-0d5b8b1c2a11"}},
+		{"utc", cursor{Time: at.UTC(), ID: "a"}},
+		{"id with url characters", cursor{Time: at, ID: "id/with+chars=?&"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encodeCursor(tt.c)
+			if strings.ContainsAny(encoded, "+/=") {
+				t.Errorf("cursor %q isn't URL safe", encoded)
+			}
+
+			p, err := parseQuery(t, "cursor="+encoded, Parse)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !p.IsCursor() {
+				t.Fatal("Parse dropped the cursor")
+			}
+			if !p.cursor.Time.Equal(tt.c.Time) || p.cursor.ID != tt.c.ID {
+				t.Errorf("cursor = %v %q, want %v %q", p.cursor.Time, p.cursor.ID, tt.c.Time, tt.c.ID)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"not base64", "not a cursor!"},
+		{"padded base64", encodeCursor(cursor{Time: time.Now(), ID: "a"}) + "="},
+		{"not json", "bm90IGpzb24"},
+		{"missing id", encodeCursor(cursor{Time: time.Now()})},
+		{"missing time", encodeCursor(cursor{ID: "a"})},
+		{"wrong types", "eyJ0IjoxLCJpZCI6Mn0"}, // {"t":1,"id":2}
+		{"empty object", "e30"},                // {}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.value); err != errInvalidCursor {
+				t.Errorf("err = %v, want %v", err, errInvalidCursor)
+			}
+			if _, err := parseQuery(t, "cursor="+url.QueryEscape(tt.value), Parse); err == nil {
+				t.Error("Parse accepted the cursor")
+			}
+		})
+	}
+}
+
+func TestParseBounds(t *testing.T) {
+	tests := []struct {
+		query   string
+		page    int
+		limit   int
+		wantErr bool
+	}{
+		{"", 1, 20, false},
+		{"limit=1", 1, 1, false},
+		{"limit=100", 1, 100, false},
+		{"limit=101", 1, MaxLimit, false},
+		{"limit=0", 0, 0, true},
+		{"limit=-5", 0, 0, true},
+		{"limit=ten", 0, 0, true},
+		{"page=1", 1, 20, false},
+		{"page=10000&limit=50", 10000, 50, false},
+		{"page=10001", 0, 0, true},
+		{"page=0", 0, 0, true},
+		{"page=-1", 0, 0, true},
+		{"page=2.5", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			p, err := parseQuery(t, tt.query, Parse)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Parse accepted %q as page %d limit %d", tt.query, p.Page, p.Limit)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if p.Page != tt.page || p.Limit != tt.limit || p.IsCursor() {
+				t.Errorf("page = %d, limit = %d, cursor = %v, want %d, %d, false", p.Page, p.Limit, p.IsCursor(), tt.page, tt.limit)
+			}
+		})
+	}
+}
+
+func TestQueryInt(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{"", 12, false},
+		{"limit=1", 1, false},
+		{"limit=48", 48, false},
+		{"limit=49", 48, false},
+		{"limit=0", 0, true},
+		{"limit=-1", 0, true},
+		{"limit=many", 0, true},
+		{"limit=2.5", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			p, err := parseQuery(t, tt.query, func(c *fiber.Ctx, _ int) (Params, error) {
+				limit, err := QueryInt(c, "limit", 12, 48)
+				return Params{Limit: limit}, err
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("QueryInt accepted %q as %d", tt.query, p.Limit)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("QueryInt: %v", err)
+			}
+			if p.Limit != tt.want {
+				t.Errorf("QueryInt = %d, want %d", p.Limit, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOffsetRejectsCursor(t *testing.T) {
+	value := encodeCursor(cursor{Time: time.Now(), ID: "a"})
+	if _, err := parseQuery(t, "cursor="+value, ParseOffset); err == nil {
+		t.Error("ParseOffset accepted a cursor")
+	}
+	if p, err := parseQuery(t, "page=3&limit=10", ParseOffset); err != nil || p.Offset() != 20 {
+		t.Errorf("offset = %d, err = %v, want 20", p.Offset(), err)
+	}
+}
+
+func TestKeysetApply(t *testing.T) {
+	at := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		keyset Keyset
+		params Params
+		sql    string
+		// limitVar is the position of the LIMIT value in the statement's vars
+		limitVar int
+	}{
+		{
+			"first page descending",
+			Keyset{TimeColumn: "created_at", IDColumn: "id", Desc: true},
+			Params{Page: 1, Limit: 20},
+			`SELECT * FROM "items" ORDER BY created_at DESC, id DESC LIMIT $1`,
+			0,
+		},
+		{
+			"offset page ascending",
+			Keyset{TimeColumn: "created_at", IDColumn: "id"},
+			Params{Page: 3, Limit: 20},
+			`SELECT * FROM "items" ORDER BY created_at ASC, id ASC LIMIT $1 OFFSET $2`,
+			0,
+		},
+		{
+			// Rows sharing the cursor's timestamp continue after its ID instead of being
+			// skipped or repeated
+			"cursor descending",
+			Keyset{TimeColumn: "created_at", IDColumn: "id", Desc: true},
+			Params{Limit: 20, cursor: &cursor{Time: at, ID: "m"}},
+			`SELECT * FROM "items" WHERE (created_at, id) < ($1, $2) ORDER BY created_at DESC, id DESC LIMIT $3`,
+			2,
+		},
+		{
+			"cursor ascending",
+			Keyset{TimeColumn: "created_at", IDColumn: "id"},
+			Params{Limit: 20, cursor: &cursor{Time: at, ID: "m"}},
+			`SELECT * FROM "items" WHERE (created_at, id) > ($1, $2) ORDER BY created_at ASC, id ASC LIMIT $3`,
+			2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var items []item
+			stmt := tt.keyset.Apply(dryRun(t).Table("items"), tt.params).Find(&items).Statement
+			if got := stmt.SQL.String(); got != tt.sql {
+				t.Errorf("sql = %s\nwant  %s", got, tt.sql)
+			}
+			// The lookahead item tells Trim whether more pages follow
+			if limit := stmt.Vars[tt.limitVar]; limit != tt.params.Limit+1 {
+				t.Errorf("limit = %v, want %d", limit, tt.params.Limit+1)
+			}
+			if tt.params.cursor != nil && (stmt.Vars[0] != at || stmt.Vars[1] != "m") {
+				t.Errorf("cursor vars = %v", stmt.Vars[:2])
+			}
+		})
+	}
+}
+
+func TestTrim(t *testing.T) {
+	at := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	// Items sharing a timestamp are told apart by their ID in the cursor
+	page := []item{{"c", at}, {"b", at}, {"a", at}}
+	tests := []struct {
+		name       string
+		params     Params
+		items      []item
+		total      int64
+		key        func(item) (time.Time, string)
+		kept       int
+		hasMore    bool
+		nextCursor string
+		totalPages int64
+	}{
+		{"offset page with more", Params{Page: 1, Limit: 2}, page, 5, itemKey, 2, true, encodeCursor(cursor{Time: at, ID: "b"}), 3},
+		{"offset last page", Params{Page: 3, Limit: 2}, page[:1], 5, itemKey, 1, false, "", 3},
+		{"exactly one page", Params{Page: 1, Limit: 3}, page, 3, itemKey, 3, false, "", 1},
+		{"empty list", Params{Page: 1, Limit: 20}, nil, 0, itemKey, 0, false, "", 0},
+		{"without keyset", Params{Page: 1, Limit: 2}, page, 5, nil, 2, true, "", 3},
+		{"cursor page", Params{Limit: 2, cursor: &cursor{Time: at, ID: "d"}}, page, 0, itemKey, 2, true, encodeCursor(cursor{Time: at, ID: "b"}), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, meta := Trim(tt.params, tt.items, tt.total, tt.key)
+			if len(items) != tt.kept || meta.HasMore != tt.hasMore || meta.NextCursor != tt.nextCursor {
+				t.Errorf("kept %d, hasMore %v, nextCursor %q, want %d, %v, %q", len(items), meta.HasMore, meta.NextCursor, tt.kept, tt.hasMore, tt.nextCursor)
+			}
+			if meta.ItemsPerPage != tt.params.Limit {
+				t.Errorf("itemsPerPage = %d", meta.ItemsPerPage)
+			}
+			if tt.params.IsCursor() {
+				if meta.CurrentPage != nil || meta.TotalPages != nil || meta.TotalItems != nil {
+					t.Error("cursor page reports totals")
+				}
+				return
+			}
+			if meta.CurrentPage == nil || *meta.CurrentPage != tt.params.Page ||
+				meta.TotalPages == nil || *meta.TotalPages != tt.totalPages ||
+				meta.TotalItems == nil || *meta.TotalItems != tt.total {
+				t.Errorf("meta = %+v, want page %d of %d", meta, tt.params.Page, tt.totalPages)
+			}
+		})
+	}
+}
@@ -17,9 +17,22 @@ func Setup(app *fiber.App, cfg *config.Config) {
 		log.Printf("Failed to initialize SMS service: %v", err)
 	}
 
-	// Initialize S3 service
-	if err := handlers.InitS3Service(&cfg.S3); err != nil {
-		log.Fatalf("Failed to initialize S3 service: %v", err)
+	// Initialize object storage; uploads and downloads report the service as unavailable without it
+	if err := handlers.InitObjectStore(cfg); err != nil {
+		log.Printf("Failed to initialize object storage: %v", err)
+	}
+	// Install scripts, the Homebrew tap and npm metadata link to the configured public URL
+	handlers.SetPublicURL(&cfg.Server)
+	if cfg.Server.PublicURL == "" {
+		log.Printf("PUBLIC_URL is not set; install scripts, the Homebrew tap and the npm registry are unavailable")
+	}
+	// Install scripts are signed with a dedicated key; without one they stay unavailable
+	installEnabled := cfg.Install.Enabled
+	if installEnabled {
+		if err := services.InitInstallSigner(cfg); err != nil {
+			log.Printf("Failed to initialize install script signing, install scripts and the Homebrew tap are disabled: %v", err)
+			installEnabled = false
+		}
 	}
 
 	// Add security headers
@@ -41,18 +54,50 @@ func Setup(app *fiber.App, cfg *config.Config) {
 	authRoutes.Post("/refresh", handlers.RefreshToken)
 	authRoutes.Get("/me", middleware.Auth(), handlers.GetMe)
 	authRoutes.Put("/profile", middleware.Auth(), handlers.UpdateProfile)
+	authRoutes.Get("/tokens", middleware.Auth(), handlers.GetAccessTokens)
+	authRoutes.Post("/tokens", middleware.Auth(), handlers.CreateAccessToken)
+	authRoutes.Delete("/tokens/:id", middleware.Auth(), handlers.RevokeAccessToken)
 	authRoutes.Post("/send-verification-code", middleware.SMSRateLimit(), middleware.PhoneNumberRateLimit(3, time.Hour), handlers.SendVerificationCode)
 	authRoutes.Post("/verify-phone", handlers.VerifyPhone)
 
 	// Product routes
 	productRoutes := api.Group("/products")
-	productRoutes.Get("/", handlers.GetProducts)
+	productRoutes.Get("/", middleware.OptionalAuth(), handlers.GetProducts)
 	productRoutes.Get("/categories", handlers.GetCategories)
-	productRoutes.Get("/:id", handlers.GetProduct)
+	productRoutes.Get("/trending", handlers.GetTrendingProducts)
+	productRoutes.Get("/:id", middleware.OptionalAuth(), handlers.GetProduct)
+	productRoutes.Post("/:id/events", middleware.OptionalAuth(), handlers.TrackProductEvent)
+	productRoutes.Get("/:id/analytics", middleware.Auth(), handlers.GetProductAnalytics)
+	productRoutes.Get("/:id/manifest", handlers.GetProductManifest)
+	productRoutes.Get("/:id/releases", handlers.GetProductReleases)
+	productRoutes.Get("/:id/sbom", handlers.DownloadProductSBOM)
+	productRoutes.Get("/:id/recommendations", middleware.OptionalAuth(), handlers.GetProductRecommendations)
+	productRoutes.Get("/:id/releases/:from/patch/:to", middleware.Auth(), handlers.GetReleasePatch)
+	productRoutes.Post("/:id/media", middleware.Auth(), middleware.SellerOnly(), handlers.AddProductMedia)
+	productRoutes.Put("/:id/media/order", middleware.Auth(), middleware.SellerOnly(), handlers.ReorderProductMedia)
+	productRoutes.Delete("/:id/media/:mediaId", middleware.Auth(), middleware.SellerOnly(), handlers.DeleteProductMedia)
 	productRoutes.Post("/", middleware.Auth(), middleware.SellerOnly(), handlers.CreateProduct)
 	productRoutes.Put("/:id", middleware.Auth(), handlers.UpdateProduct)
 	productRoutes.Delete("/:id", middleware.Auth(), handlers.DeleteProduct)
 	productRoutes.Post("/:id/like", middleware.Auth(), handlers.ToggleLike)
+	productRoutes.Get("/:id/secret-findings", middleware.Auth(), handlers.GetSecretFindings)
+	productRoutes.Post("/:id/secret-findings/acknowledge", middleware.Auth(), handlers.AcknowledgeSecretFindings)
+	// Tag routes
+	tagRoutes := api.Group("/tags")
+	tagRoutes.Get("/", handlers.GetTags)
+	tagRoutes.Get("/:slug", handlers.GetTag)
+
+	// Recommendation routes
+	api.Get("/recommendations/for-you", middleware.Auth(), handlers.GetRecommendationsForYou)
+
+	// Wishlist and notification routes
+	api.Get("/wishlist", middleware.Auth(), handlers.GetWishlist)
+	notificationRoutes := api.Group("/notifications")
+	notificationRoutes.Use(middleware.Auth())
+	notificationRoutes.Get("/", handlers.GetNotifications)
+	notificationRoutes.Put("/read-all", handlers.MarkAllNotificationsRead)
+	notificationRoutes.Put("/:id/read", handlers.MarkNotificationRead)
+
 	// Review routes
 	reviewRoutes := api.Group("/reviews")
 	reviewRoutes.Get("/product/:id", handlers.GetProductReviews)
@@ -87,6 +132,31 @@ func Setup(app *fiber.App, cfg *config.Config) {
 	purchaseRoutes.Post("/:id/generate-license", handlers.GenerateLicense)
 	purchaseRoutes.Post("/:id/dispute", handlers.RequestDispute)
 
+	// Token-based downloads (the token itself is the credential)
+	api.Get("/dl/:token", handlers.RedeemDownloadToken)
+
+	// Presigned URLs for the local storage backend
+	api.Get("/storage/*", handlers.ServeLocalObject)
+
+	// Stable public URLs for product images
+	api.Get("/media/*", handlers.ServeMedia)
+
+	// Go module proxy for purchased modules, authenticated with access tokens from .netrc
+	app.Get("/goproxy/*", middleware.TokenAuth(), handlers.ServeGoProxy)
+
+	// npm registry for purchased @vibing packages, authenticated with access tokens from .npmrc
+	app.Get("/npm/*", middleware.TokenAuth(), handlers.ServeNpmRegistry)
+
+	// Signed install scripts and a Homebrew tap for CLI tools; assets are fetched with access tokens
+	if installEnabled {
+		app.Get("/install/signing-key.pem", handlers.ServeInstallSigningKey)
+		app.Get("/install/:id/install.sh", handlers.ServeInstallScript)
+		app.Get("/install/:id/install.sh.sig", handlers.ServeInstallSignature)
+		app.Get("/install/:id/:version/:platform/:file", middleware.TokenAuth(), handlers.DownloadReleaseAsset)
+		app.Get("/brew/tap.tar.gz", handlers.ServeHomebrewTap)
+		app.Get("/brew/Formula/:file", handlers.ServeHomebrewFormula)
+	}
+
 	// Seller routes
 	sellerRoutes := api.Group("/seller")
 	sellerRoutes.Use(middleware.Auth(), middleware.SellerOnly())
@@ -114,7 +184,20 @@ func Setup(app *fiber.App, cfg *config.Config) {
 	adminRoutes.Delete("/users/:id", handlers.DeleteUser)
 	adminRoutes.Get("/products", handlers.GetAdminProducts)
 	adminRoutes.Put("/products/:id/status", handlers.UpdateProductStatus)
+	adminRoutes.Get("/products/:id/trending", handlers.GetProductTrendingHistory)
+	adminRoutes.Get("/categories", handlers.GetAdminCategories)
+	adminRoutes.Post("/categories", handlers.CreateCategory)
+	adminRoutes.Put("/categories/:id", handlers.UpdateCategory)
+	adminRoutes.Delete("/categories/:id", handlers.DeleteCategory)
+	adminRoutes.Get("/tags", handlers.GetAdminTags)
+	adminRoutes.Put("/tags/:id", handlers.RenameTag)
+	adminRoutes.Post("/tags/:id/merge", handlers.MergeTag)
 	adminRoutes.Get("/sales", handlers.GetAdminSales)
+	adminRoutes.Get("/scans/infected", handlers.GetInfectedFiles)
+	adminRoutes.Post("/scans/:id/rescan", handlers.RescanFile)
+	adminRoutes.Get("/storage/orphans", handlers.GetOrphanedObjects)
+	adminRoutes.Get("/builds/trace", handlers.TraceBuild)
+	adminRoutes.Post("/builds/trace", handlers.TraceBuild)
 	adminRoutes.Get("/disputes", handlers.GetDisputedPurchases)
 	adminRoutes.Put("/disputes/:id/process", handlers.ProcessDispute)
 	adminRoutes.Put("/disputes/:id/resolve", handlers.ResolveDispute)
@@ -124,9 +207,18 @@ func Setup(app *fiber.App, cfg *config.Config) {
 	uploadRoutes.Use(middleware.Auth(), middleware.UploadRateLimit())
 	uploadRoutes.Post("/image", middleware.SellerOnly(), handlers.UploadImage)
 	uploadRoutes.Post("/product-files", middleware.SellerOnly(), handlers.UploadProductFiles)
+	uploadRoutes.Post("/release-assets", middleware.SellerOnly(), handlers.UploadReleaseAsset)
 	uploadRoutes.Post("/chat-image", handlers.UploadChatImage)
 	uploadRoutes.Get("/signed-url", middleware.SellerOnly(), handlers.GetSignedURL)
 
+	// Resumable multipart uploads for large product archives
+	multipartRoutes := uploadRoutes.Group("/multipart", middleware.SellerOnly())
+	multipartRoutes.Post("/", handlers.InitiateMultipartUpload)
+	multipartRoutes.Get("/:id", handlers.GetMultipartUpload)
+	multipartRoutes.Get("/:id/parts", handlers.GetMultipartPartURLs)
+	multipartRoutes.Post("/:id/complete", handlers.CompleteMultipartUpload)
+	multipartRoutes.Delete("/:id", handlers.AbortMultipartUpload)
+
 	// Security routes
 	securityRoutes := api.Group("/security")
 	securityRoutes.Post("/verify-recaptcha", handlers.VerifyReCAPTCHA)
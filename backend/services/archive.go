@@ -0,0 +1,291 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Limits applied when inspecting uploaded product archives
+const (
+	MaxArchiveEntries          = 20000
+	MaxArchiveUncompressedSize = 4 * 1024 * 1024 * 1024 // 4GB
+	MaxArchiveCompressionRatio = 100                    // uncompressed:compressed, per entry and overall
+	MaxReadmeSize              = 256 * 1024             // 256KB
+)
+
+// ArchiveError is returned when an archive fails inspection. Code is the API error code.
+type ArchiveError struct {
+	Code    string
+	Message string
+}
+
+func (e *ArchiveError) Error() string {
+	return e.Message
+}
+
+func archiveError(code, format string, args ...interface{}) *ArchiveError {
+	return &ArchiveError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// ArchiveEntry is one file in an inspected archive
+type ArchiveEntry struct {
+	Path           string
+	Size           int64
+	CompressedSize int64
+	SHA256         string
+}
+
+// ArchiveInspection is the result of a successful archive inspection
+type ArchiveInspection struct {
+	Entries        []ArchiveEntry
+	TotalSize      int64
+	CompressedSize int64
+	Readme         string
+	ReadmePath     string
+	ArchiveSize    int64
+	SHA256         string
+	SecretFindings []SecretFinding
+	// Inputs for dependency and license analysis
+	Manifests    []ManifestFile
+	LicenseFiles []LicenseFile
+}
+
+// InspectArchive validates a ZIP archive and builds its manifest. It rejects malformed
+// archives, zip bombs and entries that would extract outside the target directory.
+// Entry contents are read and hashed, so declared sizes can't be used to sneak past the limits.
+// Text files are also scanned for leaked credentials; findings don't reject the archive.
+func InspectArchive(r io.ReaderAt, size int64) (*ArchiveInspection, error) {
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, archiveError("INVALID_ARCHIVE", "File is not a valid ZIP archive")
+	}
+
+	if len(reader.File) == 0 {
+		return nil, archiveError("INVALID_ARCHIVE", "Archive is empty")
+	}
+	if len(reader.File) > MaxArchiveEntries {
+		return nil, archiveError("ARCHIVE_TOO_LARGE", "Archive contains more than %d entries", MaxArchiveEntries)
+	}
+
+	inspection := &ArchiveInspection{ArchiveSize: size}
+	seen := make(map[string]bool)
+	readmeDepth := -1
+
+	for _, file := range reader.File {
+		name, err := sanitizeEntryName(file.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		mode := file.Mode()
+		if mode&os.ModeSymlink != 0 {
+			return nil, archiveError("UNSAFE_ARCHIVE", "Archive contains a symbolic link: %s", name)
+		}
+		if mode.IsDir() || strings.HasSuffix(file.Name, "/") {
+			continue
+		}
+
+		if seen[strings.ToLower(name)] {
+			return nil, archiveError("UNSAFE_ARCHIVE", "Archive contains duplicate entry: %s", name)
+		}
+		seen[strings.ToLower(name)] = true
+
+		// Cheap checks on declared sizes before decompressing anything
+		if exceedsRatio(file.UncompressedSize64, file.CompressedSize64) {
+			return nil, archiveError("ZIP_BOMB", "Entry %s exceeds the maximum compression ratio", name)
+		}
+		if inspection.TotalSize+int64(file.UncompressedSize64) > MaxArchiveUncompressedSize {
+			return nil, archiveError("ZIP_BOMB", "Archive exceeds the maximum uncompressed size")
+		}
+
+		scanSecrets := file.UncompressedSize64 <= MaxSecretScanFileSize
+		keep := 0
+		if scanSecrets {
+			keep = MaxSecretScanFileSize
+		} else if isReadme(name) {
+			keep = MaxReadmeSize
+		}
+
+		entry, content, err := inspectEntry(file, name, keep)
+		if err != nil {
+			return nil, err
+		}
+
+		if scanSecrets && len(inspection.SecretFindings) < MaxSecretFindings {
+			inspection.SecretFindings = append(inspection.SecretFindings, ScanForSecrets(name, content)...)
+		}
+		if scanSecrets && isDependencyManifest(name) {
+			inspection.Manifests = append(inspection.Manifests, ManifestFile{Path: name, Content: content})
+		}
+		if scanSecrets && isLicenseFile(name) {
+			inspection.LicenseFiles = append(inspection.LicenseFiles, LicenseFile{Path: name, License: DetectLicense(content)})
+		}
+
+		readme := ""
+		if isReadme(name) {
+			if len(content) > MaxReadmeSize {
+				content = content[:MaxReadmeSize]
+			}
+			// A truncated README may end mid-character
+			readme = strings.ToValidUTF8(string(content), "")
+		}
+
+		inspection.TotalSize += entry.Size
+		inspection.CompressedSize += entry.CompressedSize
+		inspection.Entries = append(inspection.Entries, *entry)
+
+		// Prefer the README closest to the archive root
+		if readme != "" {
+			depth := strings.Count(name, "/")
+			if readmeDepth == -1 || depth < readmeDepth {
+				readmeDepth = depth
+				inspection.Readme = readme
+				inspection.ReadmePath = name
+			}
+		}
+	}
+
+	if exceedsRatio(uint64(inspection.TotalSize), uint64(inspection.CompressedSize)) {
+		return nil, archiveError("ZIP_BOMB", "Archive exceeds the maximum compression ratio")
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(r, 0, size)); err != nil {
+		return nil, err
+	}
+	inspection.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	sort.Slice(inspection.Entries, func(i, j int) bool {
+		return inspection.Entries[i].Path < inspection.Entries[j].Path
+	})
+	if len(inspection.SecretFindings) > MaxSecretFindings {
+		inspection.SecretFindings = inspection.SecretFindings[:MaxSecretFindings]
+	}
+
+	return inspection, nil
+}
+
+// InspectStoredArchive copies an object to a temporary file and inspects it
+func InspectStoredArchive(store ObjectStore, key string) (*ArchiveInspection, error) {
+	object, err := store.Get(key, "")
+	if err != nil {
+		return nil, err
+	}
+	defer object.Body.Close()
+
+	tmp, err := os.CreateTemp("", "archive-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, object.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return InspectArchive(tmp, size)
+}
+
+// inspectEntry hashes one entry, enforcing the size limits on the bytes actually produced.
+// Up to keep bytes of the content are returned.
+func inspectEntry(file *zip.File, name string, keep int) (*ArchiveEntry, []byte, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, nil, archiveError("INVALID_ARCHIVE", "Failed to read entry %s: %v", name, err)
+	}
+	defer rc.Close()
+
+	hash := sha256.New()
+	var content bytes.Buffer
+	writer := io.Writer(hash)
+	if keep > 0 {
+		writer = io.MultiWriter(hash, &limitedBuffer{buffer: &content, limit: keep})
+	}
+
+	// Read one byte past the declared size to detect entries that lie about it
+	limit := int64(file.UncompressedSize64) + 1
+	n, err := io.Copy(writer, io.LimitReader(rc, limit))
+	if err != nil {
+		return nil, nil, archiveError("INVALID_ARCHIVE", "Entry %s is corrupt: %v", name, err)
+	}
+	if n != int64(file.UncompressedSize64) {
+		return nil, nil, archiveError("ZIP_BOMB", "Entry %s does not match its declared size", name)
+	}
+
+	entry := &ArchiveEntry{
+		Path:           name,
+		Size:           n,
+		CompressedSize: int64(file.CompressedSize64),
+		SHA256:         hex.EncodeToString(hash.Sum(nil)),
+	}
+
+	return entry, content.Bytes(), nil
+}
+
+// sanitizeEntryName rejects absolute paths, parent references and other names that could
+// escape the extraction directory, and returns the cleaned slash-separated path
+func sanitizeEntryName(name string) (string, error) {
+	if name == "" || strings.ContainsRune(name, 0) {
+		return "", archiveError("UNSAFE_ARCHIVE", "Archive contains an invalid entry name")
+	}
+	if strings.Contains(name, "\\") {
+		return "", archiveError("PATH_TRAVERSAL", "Entry uses backslashes in its path: %s", name)
+	}
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return "", archiveError("PATH_TRAVERSAL", "Entry has an absolute path: %s", name)
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			return "", archiveError("PATH_TRAVERSAL", "Entry escapes the archive root: %s", name)
+		}
+	}
+
+	return path.Clean(name), nil
+}
+
+func exceedsRatio(uncompressed, compressed uint64) bool {
+	// Tiny entries compress extremely well without being dangerous
+	if uncompressed < 1024*1024 {
+		return false
+	}
+	if compressed == 0 {
+		return true
+	}
+	return uncompressed/compressed > MaxArchiveCompressionRatio
+}
+
+func isReadme(name string) bool {
+	base := strings.ToLower(path.Base(name))
+	switch base {
+	case "readme", "readme.md", "readme.markdown", "readme.txt", "readme.rst":
+		return true
+	}
+	return false
+}
+
+// limitedBuffer keeps at most limit bytes and silently discards the rest
+type limitedBuffer struct {
+	buffer *bytes.Buffer
+	limit  int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - b.buffer.Len(); remaining > 0 {
+		if len(p) > remaining {
+			b.buffer.Write(p[:remaining])
+		} else {
+			b.buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+)
+
+type testEntry struct {
+	name    string
+	content string
+	mode    os.FileMode
+}
+
+// buildZip returns a deflated archive of the given entries
+func buildZip(t *testing.T, entries []testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		if entry.mode != 0 {
+			header.SetMode(entry.mode)
+		}
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatalf("creating %s: %v", entry.name, err)
+		}
+		if _, err := f.Write([]byte(entry.content)); err != nil {
+			t.Fatalf("writing %s: %v", entry.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("closing archive: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestInspectArchiveRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		archive []byte
+		code    string
+	}{
+		{"not a zip", []byte("plain text"), "INVALID_ARCHIVE"},
+		{"empty", buildZip(t, nil), "INVALID_ARCHIVE"},
+		{"parent reference", buildZip(t, []testEntry{{name: "../evil.sh", content: "x"}}), "PATH_TRAVERSAL"},
+		{"nested parent reference", buildZip(t, []testEntry{{name: "src/../../evil.sh", content: "x"}}), "PATH_TRAVERSAL"},
+		{"absolute path", buildZip(t, []testEntry{{name: "/etc/passwd", content: "x"}}), "PATH_TRAVERSAL"},
+		{"drive letter", buildZip(t, []testEntry{{name: "C:evil.exe", content: "x"}}), "PATH_TRAVERSAL"},
+		{"backslash", buildZip(t, []testEntry{{name: `src\evil.sh`, content: "x"}}), "PATH_TRAVERSAL"},
+		{"symlink", buildZip(t, []testEntry{{name: "link", content: "/etc/passwd", mode: os.ModeSymlink | 0777}}), "UNSAFE_ARCHIVE"},
+		{"duplicate entry", buildZip(t, []testEntry{{name: "a.txt", content: "1"}, {name: "A.txt", content: "2"}}), "UNSAFE_ARCHIVE"},
+		{"compression ratio", buildZip(t, []testEntry{{name: "zeros.bin", content: strings.Repeat("\x00", 4*1024*1024)}}), "ZIP_BOMB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := InspectArchive(bytes.NewReader(tt.archive), int64(len(tt.archive)))
+			archiveErr, ok := err.(*ArchiveError)
+			if !ok {
+				t.Fatalf("err = %v, want *ArchiveError", err)
+			}
+			if archiveErr.Code != tt.code {
+				t.Errorf("code = %s, want %s (%s)", archiveErr.Code, tt.code, archiveErr.Message)
+			}
+		})
+	}
+}
+
+func TestInspectArchiveManifest(t *testing.T) {
+	archive := buildZip(t, []testEntry{
+		{name: "src/", mode: os.ModeDir | 0755},
+		{name: "src/main.go", content: "package main\n"},
+		{name: "docs/README.md", content: "# Docs\n"},
+		{name: "README.md", content: "# Plugin\n"},
+	})
+
+	inspection, err := InspectArchive(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("InspectArchive: %v", err)
+	}
+
+	var paths []string
+	for _, entry := range inspection.Entries {
+		paths = append(paths, entry.Path)
+	}
+	if got, want := strings.Join(paths, ","), "README.md,docs/README.md,src/main.go"; got != want {
+		t.Errorf("entries = %s, want %s", got, want)
+	}
+	if inspection.ReadmePath != "README.md" || inspection.Readme != "# Plugin\n" {
+		t.Errorf("readme = %q (%s), want the root README", inspection.Readme, inspection.ReadmePath)
+	}
+	if inspection.TotalSize != int64(len("package main\n# Docs\n# Plugin\n")) {
+		t.Errorf("total size = %d", inspection.TotalSize)
+	}
+
+	sum := sha256.Sum256([]byte("package main\n"))
+	if got := inspection.Entries[2].SHA256; got != hex.EncodeToString(sum[:]) {
+		t.Errorf("entry sha256 = %s", got)
+	}
+	sum = sha256.Sum256(archive)
+	if inspection.SHA256 != hex.EncodeToString(sum[:]) || inspection.ArchiveSize != int64(len(archive)) {
+		t.Errorf("archive sha256 = %s, size = %d", inspection.SHA256, inspection.ArchiveSize)
+	}
+}
+
+func TestInspectArchiveTruncatesReadme(t *testing.T) {
+	// A multi-byte character straddling the limit must not leave invalid UTF-8
+	content := strings.Repeat("a", MaxReadmeSize-1) + "가" + strings.Repeat("b", 1024)
+	archive := buildZip(t, []testEntry{{name: "README.md", content: content}})
+
+	inspection, err := InspectArchive(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("InspectArchive: %v", err)
+	}
+	if len(inspection.Readme) != MaxReadmeSize-1 {
+		t.Errorf("readme length = %d, want %d", len(inspection.Readme), MaxReadmeSize-1)
+	}
+	if inspection.Entries[0].Size != int64(len(content)) {
+		t.Errorf("entry size = %d, want the full %d", inspection.Entries[0].Size, len(content))
+	}
+}
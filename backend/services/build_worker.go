@@ -0,0 +1,268 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"vibing-backend/database"
+	"vibing-backend/models"
+)
+
+const (
+	buildPollInterval = time.Minute
+	buildBatchSize    = 10
+	// Builds stuck this long (e.g. after a restart) are retried
+	buildStaleAfter  = 30 * time.Minute
+	buildRetryDelay  = 2 * time.Minute
+	buildMaxAttempts = 3
+)
+
+// BuildWorker builds the personalized copies buyers requested by downloading and packs
+// the npm tarballs of clean releases. The database is the queue; Wake only shortens the
+// wait for new requests.
+type BuildWorker struct {
+	wake     chan struct{}
+	stopChan chan bool
+}
+
+// NewBuildWorker creates a personalized build worker
+func NewBuildWorker() *BuildWorker {
+	return &BuildWorker{
+		wake:     make(chan struct{}, 1),
+		stopChan: make(chan bool),
+	}
+}
+
+// Start begins processing requested builds
+func (w *BuildWorker) Start() {
+	go w.run()
+}
+
+// Stop terminates the worker
+func (w *BuildWorker) Stop() {
+	w.stopChan <- true
+}
+
+// Wake asks the worker to check for requested builds now
+func (w *BuildWorker) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *BuildWorker) run() {
+	ticker := time.NewTicker(buildPollInterval)
+	defer ticker.Stop()
+
+	log.Println("Build worker started")
+	w.processQueue()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.processQueue()
+		case <-w.wake:
+			w.processQueue()
+		case <-w.stopChan:
+			log.Println("Build worker stopped")
+			return
+		}
+	}
+}
+
+// processQueue builds requested copies, oldest request first, until none are left,
+// then packs the npm tarballs that are missing
+func (w *BuildWorker) processQueue() {
+	if defaultStore == nil {
+		return
+	}
+
+	w.buildRequested()
+	w.packNpmReleases()
+}
+
+func (w *BuildWorker) buildRequested() {
+	for {
+		var builds []models.PersonalizedBuild
+		if err := database.DB.Where("requested_at IS NOT NULL AND (building_at IS NULL OR building_at <= ?)",
+			time.Now().Add(-buildStaleAfter)).
+			Where("build_attempts = 0 OR updated_at <= ?", time.Now().Add(-buildRetryDelay)).
+			Order("requested_at ASC").Limit(buildBatchSize).
+			Find(&builds).Error; err != nil {
+			log.Printf("Error finding requested personalized builds: %v", err)
+			return
+		}
+		if len(builds) == 0 {
+			return
+		}
+
+		for i := range builds {
+			if w.claim(&builds[i]) {
+				w.build(&builds[i])
+			}
+		}
+	}
+}
+
+// claim marks the build as in progress so other instances skip it
+func (w *BuildWorker) claim(build *models.PersonalizedBuild) bool {
+	now := time.Now()
+	result := database.DB.Model(&models.PersonalizedBuild{}).
+		Where("id = ? AND requested_at IS NOT NULL AND build_attempts = ?", build.ID, build.BuildAttempts).
+		Updates(map[string]interface{}{"building_at": now, "build_attempts": build.BuildAttempts + 1})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	build.BuildingAt = &now
+	build.BuildAttempts++
+	return true
+}
+
+// build writes the buyer's copy and marks it cached, or records why it failed
+func (w *BuildWorker) build(build *models.PersonalizedBuild) {
+	// Builds that never finished count as attempts too
+	var err error
+	if build.BuildAttempts > buildMaxAttempts {
+		err = fmt.Errorf("build did not finish after %d attempts", buildMaxAttempts)
+	} else if err = buildPersonalizedCopy(build); err == nil {
+		return
+	}
+
+	updates := map[string]interface{}{"building_at": nil, "build_error": err.Error()}
+	if build.BuildAttempts >= buildMaxAttempts {
+		updates["requested_at"] = nil
+		log.Printf("Personalized build %s failed permanently: %v", build.ID, err)
+	} else {
+		log.Printf("Personalized build %s failed (attempt %d), will retry: %v", build.ID, build.BuildAttempts, err)
+	}
+	if err := database.DB.Model(build).Updates(updates).Error; err != nil {
+		log.Printf("Error saving result of personalized build %s: %v", build.ID, err)
+	}
+}
+
+// packNpmReleases packs the npm packages of releases whose archive passed its scan
+func (w *BuildWorker) packNpmReleases() {
+	for {
+		var releases []models.ProductRelease
+		if err := database.DB.Where("npm_package <> '' AND npm_tarball_key = '' AND npm_pack_attempts < ?", buildMaxAttempts).
+			Where("npm_packing_at IS NULL OR npm_packing_at <= ?", time.Now().Add(-buildRetryDelay)).
+			Where("object_key IN (?)", database.DB.Model(&models.ScannedAsset{}).Select("object_key").Where("status = ?", "clean")).
+			Order("created_at ASC").Limit(buildBatchSize).
+			Find(&releases).Error; err != nil {
+			log.Printf("Error finding npm releases to pack: %v", err)
+			return
+		}
+		if len(releases) == 0 {
+			return
+		}
+
+		for i := range releases {
+			release := &releases[i]
+			// Claim atomically; a failed pack is retried after buildRetryDelay
+			result := database.DB.Model(&models.ProductRelease{}).
+				Where("id = ? AND npm_pack_attempts = ?", release.ID, release.NpmPackAttempts).
+				Updates(map[string]interface{}{"npm_packing_at": time.Now(), "npm_pack_attempts": release.NpmPackAttempts + 1})
+			if result.Error != nil || result.RowsAffected == 0 {
+				continue
+			}
+			if err := PackNpmRelease(defaultStore, release); err != nil {
+				log.Printf("Failed to pack %s@%s (attempt %d): %v", release.NpmPackage, release.Version, release.NpmPackAttempts+1, err)
+			}
+		}
+	}
+}
+
+// buildPersonalizedCopy builds the copy of an archive of the purchased product with the
+// license file embedded. Requests for an archive that is neither the product's current
+// file nor one of its releases are dropped.
+func buildPersonalizedCopy(build *models.PersonalizedBuild) error {
+	var purchase models.Purchase
+	if err := database.DB.Preload("Product").Preload("User").
+		First(&purchase, "id = ?", build.PurchaseID).Error; err != nil {
+		return err
+	}
+	product := &purchase.Product
+
+	version := product.LatestVersion
+	if product.FileKey != build.SourceKey {
+		var releases []models.ProductRelease
+		if err := database.DB.Where("product_id = ? AND object_key = ?", product.ID, build.SourceKey).
+			Limit(1).Find(&releases).Error; err != nil {
+			return err
+		}
+		if len(releases) == 0 {
+			return database.DB.Model(build).Updates(map[string]interface{}{
+				"requested_at": nil,
+				"building_at":  nil,
+			}).Error
+		}
+		version = releases[0].Version
+	}
+
+	licenseKey := ""
+	if purchase.LicenseKey != nil {
+		licenseKey = *purchase.LicenseKey
+	}
+	licenseType := product.LicenseType
+	if licenseType == "" {
+		licenseType = "Standard"
+	}
+	license := &BuildLicense{
+		ProductTitle: product.Title,
+		Version:      version,
+		Seller:       product.Author,
+		LicenseType:  licenseType,
+		Buyer:        purchase.User.Name,
+		OrderID:      purchase.OrderID,
+		LicenseKey:   licenseKey,
+		Fingerprint:  build.Fingerprint,
+		PurchasedAt:  purchase.CreatedAt,
+		IssuedAt:     build.CreatedAt,
+		Watermark:    product.BuildWatermark,
+	}
+
+	built, err := BuildPersonalizedArchive(defaultStore, build.SourceKey, build.ObjectKey, license)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return database.DB.Model(build).Updates(map[string]interface{}{
+		"version":      version,
+		"license_key":  licenseKey,
+		"watermarked":  product.BuildWatermark,
+		"sha256":       built.SHA256,
+		"size":         built.Size,
+		"built_at":     now,
+		"last_used_at": now,
+		"purged_at":    nil,
+		"requested_at": nil,
+		"building_at":  nil,
+		"build_error":  "",
+	}).Error
+}
+
+// Global build worker instance
+var PersonalizedBuildWorker *BuildWorker
+
+// InitBuildWorker starts the global personalized build worker
+func InitBuildWorker() {
+	PersonalizedBuildWorker = NewBuildWorker()
+	PersonalizedBuildWorker.Start()
+}
+
+// StopBuildWorker stops the global personalized build worker
+func StopBuildWorker() {
+	if PersonalizedBuildWorker != nil {
+		PersonalizedBuildWorker.Stop()
+	}
+}
+
+// WakeBuildWorker notifies the worker that a build was requested
+func WakeBuildWorker() {
+	if PersonalizedBuildWorker != nil {
+		PersonalizedBuildWorker.Wake()
+	}
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"vibing-backend/database"
+	"vibing-backend/models"
+)
+
+// Facet groups of the catalog filters. Facet counts of a group ignore the group's own
+// filter, so every option shows how many products selecting it would give.
+const (
+	FacetCategory = "category"
+	FacetPrice    = "price"
+	FacetRating   = "rating"
+	FacetLicense  = "license"
+	FacetTags     = "tags"
+	FacetPro      = "pro"
+	FacetFeatured = "featured"
+	FacetOnSale   = "onSale"
+	// facetSearch isn't counted; it applies to every facet
+	facetSearch = "search"
+)
+
+// maxTagFacets bounds the tags returned with counts
+const maxTagFacets = 20
+
+// ProductSorts maps the sortBy values of the catalog to their order
+var ProductSorts = map[string]string{
+	"newest":     "products.created_at DESC",
+	"oldest":     "products.created_at ASC",
+	"price-low":  "products.price ASC",
+	"price-high": "products.price DESC",
+	"rating":     "products.rating DESC, products.review_count DESC",
+	"downloads":  "products.downloads DESC",
+	"popular":    "products.downloads DESC, products.views DESC",
+	"trending":   "products.trending_score DESC, products.created_at DESC",
+	// relevance is only meaningful for searches and falls back to newest otherwise
+	"relevance": "rank DESC, products.created_at DESC",
+}
+
+// ProductFilter holds the catalog filters of a product listing
+type ProductFilter struct {
+	// Categories are the slugs of a category and its subcategories
+	Categories []string
+	Search     ProductSearch
+	MinPrice   *float64
+	MaxPrice   *float64
+	// Pricing is "free" or "paid"
+	Pricing   string
+	MinRating float64
+	// Licenses match any of the license types
+	Licenses []string
+	// Tags must all be present
+	Tags     []string
+	IsPro    *bool
+	Featured bool
+	OnSale   bool
+}
+
+// FacetCount is the number of products with a filter value
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// ProductFacets are the counts shown next to the filter options
+type ProductFacets struct {
+	Categories []FacetCount `json:"categories"`
+	Price      []FacetCount `json:"price"`
+	Rating     []FacetCount `json:"rating"`
+	Licenses   []FacetCount `json:"licenses"`
+	Tags       []FacetCount `json:"tags"`
+	Pro        []FacetCount `json:"pro"`
+	Featured   int64        `json:"featured"`
+	OnSale     int64        `json:"onSale"`
+}
+
+type filterCondition struct {
+	facet string
+	expr  clause.Expr
+}
+
+// facetOption is a filter value counted in the single aggregate facet query
+type facetOption struct {
+	facet string
+	value string
+	expr  clause.Expr
+}
+
+// facetOptions are the price buckets of the price filter, rating thresholds and flags.
+// Price buckets match the minPrice/maxPrice ranges the catalog UI sends.
+var facetOptions = []facetOption{
+	{FacetPrice, "free", clause.Expr{SQL: "products.price = 0"}},
+	{FacetPrice, "paid", clause.Expr{SQL: "products.price > 0"}},
+	{FacetPrice, "under-10", clause.Expr{SQL: "products.price <= 10"}},
+	{FacetPrice, "10-50", clause.Expr{SQL: "products.price >= 10 AND products.price <= 50"}},
+	{FacetPrice, "50-100", clause.Expr{SQL: "products.price >= 50 AND products.price <= 100"}},
+	{FacetPrice, "over-100", clause.Expr{SQL: "products.price >= 100"}},
+	{FacetRating, "4", clause.Expr{SQL: "products.rating >= 4"}},
+	{FacetRating, "3", clause.Expr{SQL: "products.rating >= 3"}},
+	{FacetRating, "2", clause.Expr{SQL: "products.rating >= 2"}},
+	{FacetRating, "1", clause.Expr{SQL: "products.rating >= 1"}},
+	{FacetPro, "true", clause.Expr{SQL: "products.is_pro"}},
+	{FacetPro, "false", clause.Expr{SQL: "NOT products.is_pro"}},
+	{FacetFeatured, "true", clause.Expr{SQL: "products.featured"}},
+	{FacetOnSale, "true", clause.Expr{SQL: onSaleCondition}},
+}
+
+const onSaleCondition = "products.original_price IS NOT NULL AND products.original_price > products.price"
+
+// conditions lists the active filters by facet group
+func (f ProductFilter) conditions() []filterCondition {
+	var conds []filterCondition
+	add := func(facet, sql string, vars ...interface{}) {
+		conds = append(conds, filterCondition{facet, clause.Expr{SQL: sql, Vars: vars}})
+	}
+
+	if len(f.Categories) > 0 {
+		add(FacetCategory, "products.category IN ?", f.Categories)
+	}
+	if !f.Search.Empty() {
+		add(facetSearch, f.Search.condition().SQL, f.Search.condition().Vars...)
+	}
+	if f.MinPrice != nil {
+		add(FacetPrice, "products.price >= ?", *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		add(FacetPrice, "products.price <= ?", *f.MaxPrice)
+	}
+	switch f.Pricing {
+	case "free":
+		add(FacetPrice, "products.price = 0")
+	case "paid":
+		add(FacetPrice, "products.price > 0")
+	}
+	if f.MinRating > 0 {
+		add(FacetRating, "products.rating >= ?", f.MinRating)
+	}
+	if len(f.Licenses) > 0 {
+		add(FacetLicense, "products.license_type IN ?", f.Licenses)
+	}
+	if len(f.Tags) > 0 {
+		add(FacetTags, "products.tags @> ?::text[]", tagArray(f.Tags))
+	}
+	if f.IsPro != nil {
+		add(FacetPro, "products.is_pro = ?", *f.IsPro)
+	}
+	if f.Featured {
+		add(FacetFeatured, "products.featured")
+	}
+	if f.OnSale {
+		add(FacetOnSale, onSaleCondition)
+	}
+	return conds
+}
+
+// Apply restricts a products query to active products matching every filter
+func (f ProductFilter) Apply(db *gorm.DB) *gorm.DB {
+	return f.apply(db, func(string) bool { return true })
+}
+
+// apply adds the filters of the facet groups include accepts
+func (f ProductFilter) apply(db *gorm.DB, include func(facet string) bool) *gorm.DB {
+	db = db.Where("products.status = ?", "active")
+	for _, cond := range f.conditions() {
+		if include(cond.facet) {
+			db = db.Where(cond.expr.SQL, cond.expr.Vars...)
+		}
+	}
+	return db
+}
+
+// conjunction joins the filters of the facet groups include accepts, TRUE without any
+func (f ProductFilter) conjunction(include func(facet string) bool) clause.Expr {
+	var parts []string
+	var vars []interface{}
+	for _, cond := range f.conditions() {
+		if include(cond.facet) {
+			parts = append(parts, "("+cond.expr.SQL+")")
+			vars = append(vars, cond.expr.Vars...)
+		}
+	}
+	if len(parts) == 0 {
+		return clause.Expr{SQL: "TRUE"}
+	}
+	return clause.Expr{SQL: strings.Join(parts, " AND "), Vars: vars}
+}
+
+// CountProductFacets counts products per filter option. Grouped facets (category,
+// license, tags) take one query each; price, rating and flag options are counted in a
+// single aggregate with per-option FILTER clauses.
+func CountProductFacets(db *gorm.DB, f ProductFilter) (*ProductFacets, error) {
+	facets := &ProductFacets{}
+	except := func(facet string) func(string) bool {
+		return func(other string) bool { return other != facet }
+	}
+
+	if err := f.apply(db.Model(&models.Product{}), except(FacetCategory)).
+		Select("products.category AS value, count(*) AS count").
+		Group("products.category").Order("count DESC, value").
+		Scan(&facets.Categories).Error; err != nil {
+		return nil, err
+	}
+
+	if err := f.apply(db.Model(&models.Product{}), except(FacetLicense)).
+		Where("products.license_type <> ''").
+		Select("products.license_type AS value, count(*) AS count").
+		Group("products.license_type").Order("count DESC, value").
+		Scan(&facets.Licenses).Error; err != nil {
+		return nil, err
+	}
+
+	if err := f.apply(db.Model(&models.Product{}), except(FacetTags)).
+		Joins("CROSS JOIN LATERAL unnest(products.tags) AS tag").
+		Select("tag AS value, count(*) AS count").
+		Group("tag").Order("count DESC, value").Limit(maxTagFacets).
+		Scan(&facets.Tags).Error; err != nil {
+		return nil, err
+	}
+
+	// Filters that aren't counted here narrow the scan; the counted ones move into FILTER
+	counted := map[string]bool{}
+	for _, option := range facetOptions {
+		counted[option.facet] = true
+	}
+	selects := make([]string, len(facetOptions))
+	vars := make([]interface{}, 0, len(facetOptions)*2)
+	for i, option := range facetOptions {
+		selects[i] = fmt.Sprintf("count(*) FILTER (WHERE (?) AND (?)) AS f%d", i)
+		others := f.conjunction(func(facet string) bool { return counted[facet] && facet != option.facet })
+		vars = append(vars, others, option.expr)
+	}
+	row := map[string]interface{}{}
+	if err := f.apply(db.Model(&models.Product{}), func(facet string) bool { return !counted[facet] }).
+		Select(strings.Join(selects, ", "), vars...).
+		Scan(&row).Error; err != nil {
+		return nil, err
+	}
+
+	for i, option := range facetOptions {
+		count := toInt64(row[fmt.Sprintf("f%d", i)])
+		switch option.facet {
+		case FacetPrice:
+			facets.Price = append(facets.Price, FacetCount{option.value, count})
+		case FacetRating:
+			facets.Rating = append(facets.Rating, FacetCount{option.value, count})
+		case FacetPro:
+			facets.Pro = append(facets.Pro, FacetCount{option.value, count})
+		case FacetFeatured:
+			facets.Featured = count
+		case FacetOnSale:
+			facets.OnSale = count
+		}
+	}
+	return facets, nil
+}
+
+// tagArray renders tags as a text[] literal for array operators
+func tagArray(tags []string) string {
+	quoted := make([]string, len(tags))
+	for i, tag := range tags {
+		quoted[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(tag) + `"`
+	}
+	return "{" + strings.Join(quoted, ",") + "}"
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int32:
+		return int64(n)
+	case int:
+		return int64(n)
+	}
+	return 0
+}
+
+// processTagUsage recounts the active products of every tag, which catches the status
+// changes and deletions that don't refresh the counts of their tags
+func (s *SchedulerService) processTagUsage() {
+	if err := models.RefreshTagUsage(database.DB, nil); err != nil {
+		log.Printf("Error refreshing tag usage counts: %v", err)
+	}
+}
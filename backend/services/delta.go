@@ -0,0 +1,596 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"vibing-backend/database"
+	"vibing-backend/models"
+)
+
+// DeltaMagic starts every patch file
+const DeltaMagic = "VBDELTA1"
+
+const (
+	// MinDeltaArchiveSize is the smallest target archive worth generating a patch for
+	MinDeltaArchiveSize = 1024 * 1024
+	// maxDeltaIndexBlocks bounds the source index; larger sources use larger blocks
+	maxDeltaIndexBlocks = 1 << 18
+	// maxDeltaCandidates bounds the source blocks compared per checksum hit, which keeps
+	// repetitive data such as zero padding from slowing the scan down
+	maxDeltaCandidates = 8
+	// maxDeltaLiteral is the largest chunk of new data in a single add instruction
+	maxDeltaLiteral = 64 * 1024
+)
+
+// Patch instructions, following the gzip-compressed header
+const (
+	deltaOpEnd  = 0
+	deltaOpCopy = 1
+	deltaOpAdd  = 2
+)
+
+// ErrDeltaNotWorthwhile is returned when the target archive is too small or the patch
+// would save less than 10% of a full download
+var ErrDeltaNotWorthwhile = errors.New("patch would not save enough to be worthwhile")
+
+// DeltaHeader identifies the archives a patch converts between
+type DeltaHeader struct {
+	SourceSize   int64
+	SourceSHA256 string
+	TargetSize   int64
+	TargetSHA256 string
+}
+
+// GeneratedDelta describes a patch stored by GenerateReleaseDelta
+type GeneratedDelta struct {
+	DeltaHeader
+	Size   int64
+	SHA256 string
+}
+
+// GenerateReleaseDelta computes a patch from the archive at sourceKey to the archive at
+// targetKey and stores it under key. The patch is applied once before it is stored to
+// check that it reproduces the target.
+//
+// A patch file is DeltaMagic, the source and target sizes (uint64, big endian) each
+// followed by their SHA-256, then a gzip stream of instructions: copy (1, offset and length
+// as uvarints) copies bytes of the source, add (2, length, bytes) inserts new bytes and
+// end (0) closes the stream. Unchanged ZIP entries keep their compressed bytes between
+// releases, so they become copies even when they moved within the archive.
+func GenerateReleaseDelta(store ObjectStore, sourceKey, targetKey, key string) (*GeneratedDelta, error) {
+	source, sourceSize, sourceSum, err := downloadTemp(store, sourceKey)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(source.Name())
+	defer source.Close()
+
+	target, targetSize, targetSum, err := downloadTemp(store, targetKey)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(target.Name())
+	defer target.Close()
+
+	if targetSize < MinDeltaArchiveSize {
+		return nil, ErrDeltaNotWorthwhile
+	}
+
+	header := DeltaHeader{
+		SourceSize:   sourceSize,
+		SourceSHA256: sourceSum,
+		TargetSize:   targetSize,
+		TargetSHA256: targetSum,
+	}
+
+	patch, err := os.CreateTemp("", "delta-*.vbdelta")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(patch.Name())
+	defer patch.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	if err := WriteDelta(source, target, &header, io.MultiWriter(patch, hash, counter)); err != nil {
+		return nil, err
+	}
+	if counter.n*10 >= targetSize*9 {
+		return nil, ErrDeltaNotWorthwhile
+	}
+
+	if _, err := patch.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := ApplyDelta(source, patch, io.Discard); err != nil {
+		return nil, fmt.Errorf("generated patch does not reproduce the target: %w", err)
+	}
+
+	if _, err := patch.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := store.Put(key, patch, counter.n, "application/octet-stream"); err != nil {
+		return nil, err
+	}
+
+	return &GeneratedDelta{
+		DeltaHeader: header,
+		Size:        counter.n,
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// downloadTemp copies an object to a temporary file and returns it with its size and SHA-256
+func downloadTemp(store ObjectStore, key string) (*os.File, int64, string, error) {
+	object, err := store.Get(key, "")
+	if err != nil {
+		return nil, 0, "", err
+	}
+	defer object.Body.Close()
+
+	file, err := os.CreateTemp("", "delta-*.zip")
+	if err != nil {
+		return nil, 0, "", err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), object.Body)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, 0, "", err
+	}
+	return file, size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// WriteDelta writes a patch that turns source into target. Sizes are taken from the header.
+//
+// The source is indexed in fixed-size blocks by a rolling checksum (as in rsync). The target
+// is scanned byte by byte; when its window matches a source block the match is extended in
+// both directions and emitted as a copy, and everything between matches is added verbatim.
+func WriteDelta(source, target io.ReaderAt, header *DeltaHeader, dst io.Writer) error {
+	if err := writeDeltaHeader(dst, header); err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	ops := &deltaEncoder{w: bufio.NewWriterSize(gz, 256*1024)}
+
+	if err := writeDeltaOps(source, header.SourceSize, target, header.TargetSize, ops); err != nil {
+		return err
+	}
+	if err := ops.w.WriteByte(deltaOpEnd); err != nil {
+		return err
+	}
+	if err := ops.w.Flush(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ApplyDelta writes the target of a patch, reading copied bytes from source, and checks
+// the result against the target size and SHA-256 in the patch header. Callers should
+// compare the source SHA-256 in the returned header with their copy beforehand.
+func ApplyDelta(source io.ReaderAt, patch io.Reader, target io.Writer) (*DeltaHeader, error) {
+	header, err := readDeltaHeader(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(patch)
+	if err != nil {
+		return nil, fmt.Errorf("invalid patch: %w", err)
+	}
+	ops := bufio.NewReader(gz)
+
+	hash := sha256.New()
+	out := io.MultiWriter(target, hash)
+	var written int64
+
+	for {
+		op, err := ops.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("invalid patch: %w", err)
+		}
+		if op == deltaOpEnd {
+			break
+		}
+
+		var n int64
+		switch op {
+		case deltaOpCopy:
+			offset, err := binary.ReadUvarint(ops)
+			if err != nil {
+				return nil, fmt.Errorf("invalid patch: %w", err)
+			}
+			length, err := binary.ReadUvarint(ops)
+			if err != nil {
+				return nil, fmt.Errorf("invalid patch: %w", err)
+			}
+			if offset+length > uint64(header.SourceSize) {
+				return nil, fmt.Errorf("invalid patch: copy beyond the end of the source")
+			}
+			n, err = io.Copy(out, io.NewSectionReader(source, int64(offset), int64(length)))
+			if err != nil {
+				return nil, err
+			}
+			if n != int64(length) {
+				return nil, fmt.Errorf("source is shorter than the patch expects")
+			}
+		case deltaOpAdd:
+			length, err := binary.ReadUvarint(ops)
+			if err != nil {
+				return nil, fmt.Errorf("invalid patch: %w", err)
+			}
+			n, err = io.CopyN(out, ops, int64(length))
+			if err != nil {
+				return nil, fmt.Errorf("invalid patch: %w", err)
+			}
+		default:
+			return nil, fmt.Errorf("invalid patch: unknown instruction %d", op)
+		}
+
+		written += n
+		if written > header.TargetSize {
+			return nil, fmt.Errorf("patch produces more than the target size")
+		}
+	}
+
+	if written != header.TargetSize {
+		return nil, fmt.Errorf("patch produced %d bytes, expected %d", written, header.TargetSize)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != header.TargetSHA256 {
+		return nil, fmt.Errorf("target checksum mismatch: expected %s, got %s", header.TargetSHA256, sum)
+	}
+	return header, nil
+}
+
+func writeDeltaHeader(w io.Writer, header *DeltaHeader) error {
+	sourceSum, err := hex.DecodeString(header.SourceSHA256)
+	if err != nil || len(sourceSum) != sha256.Size {
+		return fmt.Errorf("invalid source checksum")
+	}
+	targetSum, err := hex.DecodeString(header.TargetSHA256)
+	if err != nil || len(targetSum) != sha256.Size {
+		return fmt.Errorf("invalid target checksum")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(DeltaMagic)
+	binary.Write(&buf, binary.BigEndian, uint64(header.SourceSize))
+	buf.Write(sourceSum)
+	binary.Write(&buf, binary.BigEndian, uint64(header.TargetSize))
+	buf.Write(targetSum)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func readDeltaHeader(r io.Reader) (*DeltaHeader, error) {
+	raw := make([]byte, len(DeltaMagic)+2*(8+sha256.Size))
+	if _, err := io.ReadFull(r, raw); err != nil || string(raw[:len(DeltaMagic)]) != DeltaMagic {
+		return nil, fmt.Errorf("not a patch file")
+	}
+	fields := raw[len(DeltaMagic):]
+	return &DeltaHeader{
+		SourceSize:   int64(binary.BigEndian.Uint64(fields[0:8])),
+		SourceSHA256: hex.EncodeToString(fields[8:40]),
+		TargetSize:   int64(binary.BigEndian.Uint64(fields[40:48])),
+		TargetSHA256: hex.EncodeToString(fields[48:80]),
+	}, nil
+}
+
+// deltaEncoder writes patch instructions
+type deltaEncoder struct {
+	w     *bufio.Writer
+	buf   [2 * binary.MaxVarintLen64]byte
+	chunk []byte
+}
+
+func (e *deltaEncoder) copy(offset, length int64) error {
+	if err := e.w.WriteByte(deltaOpCopy); err != nil {
+		return err
+	}
+	n := binary.PutUvarint(e.buf[:], uint64(offset))
+	n += binary.PutUvarint(e.buf[n:], uint64(length))
+	_, err := e.w.Write(e.buf[:n])
+	return err
+}
+
+// add emits target[from:to] as new data
+func (e *deltaEncoder) add(target io.ReaderAt, from, to int64) error {
+	if e.chunk == nil {
+		e.chunk = make([]byte, maxDeltaLiteral)
+	}
+	chunk := e.chunk
+	for from < to {
+		n := to - from
+		if n > maxDeltaLiteral {
+			n = maxDeltaLiteral
+		}
+		if _, err := target.ReadAt(chunk[:n], from); err != nil {
+			return err
+		}
+		if err := e.w.WriteByte(deltaOpAdd); err != nil {
+			return err
+		}
+		m := binary.PutUvarint(e.buf[:], uint64(n))
+		if _, err := e.w.Write(e.buf[:m]); err != nil {
+			return err
+		}
+		if _, err := e.w.Write(chunk[:n]); err != nil {
+			return err
+		}
+		from += n
+	}
+	return nil
+}
+
+// deltaBlockSize picks the index block size for a source: 4KB, doubled until the index
+// stays within maxDeltaIndexBlocks
+func deltaBlockSize(sourceSize int64) int {
+	block := 4096
+	for sourceSize/int64(block) > maxDeltaIndexBlocks {
+		block *= 2
+	}
+	return block
+}
+
+// rollingChecksum is the rsync weak checksum of a window
+type rollingChecksum struct {
+	a, b uint32
+	n    uint32
+}
+
+func newRollingChecksum(window []byte) rollingChecksum {
+	sum := rollingChecksum{n: uint32(len(window))}
+	for i, x := range window {
+		sum.a += uint32(x)
+		sum.b += uint32(len(window)-i) * uint32(x)
+	}
+	return sum
+}
+
+func (s *rollingChecksum) roll(out, in byte) {
+	s.a = s.a - uint32(out) + uint32(in)
+	s.b = s.b - s.n*uint32(out) + s.a
+}
+
+func (s rollingChecksum) value() uint32 {
+	return s.a&0xffff | s.b<<16
+}
+
+func indexDeltaSource(source io.ReaderAt, size int64, block int) (map[uint32][]uint32, error) {
+	index := make(map[uint32][]uint32, size/int64(block))
+	reader := bufio.NewReaderSize(io.NewSectionReader(source, 0, size), 1<<20)
+	buf := make([]byte, block)
+	for i := uint32(0); int64(i+1)*int64(block) <= size; i++ {
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		sum := newRollingChecksum(buf).value()
+		if len(index[sum]) < maxDeltaCandidates {
+			index[sum] = append(index[sum], i)
+		}
+	}
+	return index, nil
+}
+
+func writeDeltaOps(source io.ReaderAt, sourceSize int64, target io.ReaderAt, targetSize int64, ops *deltaEncoder) error {
+	block := deltaBlockSize(sourceSize)
+	index, err := indexDeltaSource(source, sourceSize, block)
+	if err != nil {
+		return err
+	}
+
+	// Separate readers for the bytes entering and leaving the window, and for extending
+	// a match through the source, keep every read sequential
+	in := newPagedReader(target)
+	out := newPagedReader(target)
+	src := newPagedReader(source)
+
+	window := make([]byte, block)
+	candidate := make([]byte, block)
+
+	var literalStart, p int64
+	var sum rollingChecksum
+	fresh := true
+
+	for p+int64(block) <= targetSize {
+		if fresh {
+			if _, err := target.ReadAt(window, p); err != nil {
+				return err
+			}
+			sum = newRollingChecksum(window)
+			fresh = false
+		}
+
+		if blocks, ok := index[sum.value()]; ok {
+			if _, err := target.ReadAt(window, p); err != nil {
+				return err
+			}
+			matched := int64(-1)
+			for _, b := range blocks {
+				offset := int64(b) * int64(block)
+				if _, err := source.ReadAt(candidate, offset); err != nil {
+					return err
+				}
+				if bytes.Equal(candidate, window) {
+					matched = offset
+					break
+				}
+			}
+
+			if matched >= 0 {
+				start, offset, length := p, matched, int64(block)
+				for start+length < targetSize && offset+length < sourceSize &&
+					src.at(offset+length) == in.at(start+length) {
+					length++
+				}
+				back, err := matchBackward(source, target, offset, start, start-literalStart, block)
+				if err != nil {
+					return err
+				}
+				start, offset, length = start-back, offset-back, length+back
+
+				if err := ops.add(target, literalStart, start); err != nil {
+					return err
+				}
+				if err := ops.copy(offset, length); err != nil {
+					return err
+				}
+				p = start + length
+				literalStart = p
+				fresh = true
+				continue
+			}
+		}
+
+		if p+int64(block) < targetSize {
+			sum.roll(out.at(p), in.at(p+int64(block)))
+		}
+		p++
+	}
+
+	if err := firstError(in.err, out.err, src.err); err != nil {
+		return err
+	}
+	return ops.add(target, literalStart, targetSize)
+}
+
+// matchBackward counts how many bytes before a match also match, looking back at most
+// limit bytes and no further than the start of the pending literal
+func matchBackward(source, target io.ReaderAt, sourceOffset, targetOffset, pending int64, limit int) (int64, error) {
+	n := int64(limit)
+	if pending < n {
+		n = pending
+	}
+	if sourceOffset < n {
+		n = sourceOffset
+	}
+	if n <= 0 {
+		return 0, nil
+	}
+
+	a, b := make([]byte, n), make([]byte, n)
+	if _, err := source.ReadAt(a, sourceOffset-n); err != nil {
+		return 0, err
+	}
+	if _, err := target.ReadAt(b, targetOffset-n); err != nil {
+		return 0, err
+	}
+	var back int64
+	for back < n && a[n-1-back] == b[n-1-back] {
+		back++
+	}
+	return back, nil
+}
+
+// pagedReader gives byte access to a ReaderAt through a 1MB page. The first read error
+// is kept in err and reads after it return 0.
+type pagedReader struct {
+	r    io.ReaderAt
+	page []byte
+	off  int64
+	n    int
+	err  error
+}
+
+func newPagedReader(r io.ReaderAt) *pagedReader {
+	return &pagedReader{r: r, page: make([]byte, 1<<20), off: -1}
+}
+
+func (p *pagedReader) at(i int64) byte {
+	if p.off < 0 || i < p.off || i >= p.off+int64(p.n) {
+		n, err := p.r.ReadAt(p.page, i)
+		if n == 0 {
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			if p.err == nil {
+				p.err = err
+			}
+			return 0
+		}
+		p.off, p.n = i, n
+	}
+	return p.page[i-p.off]
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processReleaseDeltas queues patches between consecutive releases of listed products once
+// both archives passed the malware scan; the delta worker generates them. Products with
+// personalized builds are left out because every buyer's archive differs.
+func (s *SchedulerService) processReleaseDeltas() {
+	if defaultStore == nil {
+		return
+	}
+
+	var releases []models.ProductRelease
+	if err := database.DB.Select("product_releases.*").
+		Joins("JOIN products ON products.id = product_releases.product_id").
+		Where("products.status <> ? AND products.personalized_builds = ?", "deleted", false).
+		Order("product_releases.product_id, product_releases.created_at").
+		Find(&releases).Error; err != nil {
+		log.Printf("Error finding releases for patches: %v", err)
+		return
+	}
+
+	var deltas []models.ReleaseDelta
+	if err := database.DB.Select("from_release_id, to_release_id").Find(&deltas).Error; err != nil {
+		log.Printf("Error finding release patches: %v", err)
+		return
+	}
+	known := make(map[[2]string]bool, len(deltas))
+	for _, delta := range deltas {
+		known[[2]string{delta.FromReleaseID, delta.ToReleaseID}] = true
+	}
+
+	queued := 0
+	for i := 1; i < len(releases); i++ {
+		from, to := &releases[i-1], &releases[i]
+		if from.ProductID != to.ProductID || from.ObjectKey == to.ObjectKey || known[[2]string{from.ID, to.ID}] {
+			continue
+		}
+		if models.AssetScanStatus(database.DB, from.ObjectKey) != "clean" ||
+			models.AssetScanStatus(database.DB, to.ObjectKey) != "clean" {
+			continue
+		}
+
+		delta := models.ReleaseDelta{
+			ProductID:     to.ProductID,
+			FromReleaseID: from.ID,
+			ToReleaseID:   to.ID,
+			FromVersion:   from.Version,
+			ToVersion:     to.Version,
+			Status:        "pending",
+		}
+		if err := database.DB.Where("from_release_id = ? AND to_release_id = ?", from.ID, to.ID).
+			FirstOrCreate(&delta).Error; err != nil {
+			log.Printf("Error queuing patch %s -> %s: %v", from.ID, to.ID, err)
+			continue
+		}
+		queued++
+	}
+
+	if queued > 0 {
+		log.Printf("Queued %d release patches", queued)
+		WakeDeltaWorker()
+	}
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// randomBytes returns n bytes that don't repeat, so every block matches only itself
+func randomBytes(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeTestDelta returns the patch from source to target
+func writeTestDelta(t *testing.T, source, target []byte) []byte {
+	t.Helper()
+	header := &DeltaHeader{
+		SourceSize:   int64(len(source)),
+		SourceSHA256: sha256Hex(source),
+		TargetSize:   int64(len(target)),
+		TargetSHA256: sha256Hex(target),
+	}
+	var patch bytes.Buffer
+	if err := WriteDelta(bytes.NewReader(source), bytes.NewReader(target), header, &patch); err != nil {
+		t.Fatalf("WriteDelta: %v", err)
+	}
+	return patch.Bytes()
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	const block = 4096
+	old := randomBytes(1, 16*block)
+	extra := randomBytes(2, 2*block)
+
+	tests := []struct {
+		name   string
+		source []byte
+		target []byte
+		// maxSize bounds the patch, showing unchanged data was copied instead of added
+		maxSize int
+	}{
+		{"identical", old, old, 1024},
+		{"empty source", nil, old, len(old) + 1024},
+		{"empty target", old, nil, 1024},
+		{"both empty", nil, nil, 1024},
+		{"appended blocks", old, concat(old, extra), len(extra) + 1024},
+		{"prepended blocks", old, concat(extra, old), len(extra) + 1024},
+		{"inserted blocks", old, concat(old[:5*block], extra, old[5*block:]), len(extra) + 1024},
+		{"inserted bytes off block boundary", old, concat(old[:5*block+17], []byte("changed"), old[5*block+17:]), 1024},
+		{"deleted blocks", old, concat(old[:3*block], old[7*block:]), 1024},
+		{"deleted tail", old, old[:10*block+100], 1024},
+		{"moved blocks", old, concat(old[8*block:], old[:8*block]), 1024},
+		{"replaced block", old, concat(old[:4*block], extra[:block], old[5*block:]), block + 1024},
+		{"source shorter than a block", old[:100], concat(old[:100], extra[:50]), 1024},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch := writeTestDelta(t, tt.source, tt.target)
+			if !strings.HasPrefix(string(patch), DeltaMagic) {
+				t.Fatalf("patch does not start with %s", DeltaMagic)
+			}
+			if len(patch) > tt.maxSize {
+				t.Errorf("patch size = %d, want at most %d", len(patch), tt.maxSize)
+			}
+
+			var out bytes.Buffer
+			header, err := ApplyDelta(bytes.NewReader(tt.source), bytes.NewReader(patch), &out)
+			if err != nil {
+				t.Fatalf("ApplyDelta: %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), tt.target) {
+				t.Fatalf("ApplyDelta produced %d bytes that differ from the %d byte target", out.Len(), len(tt.target))
+			}
+			if header.SourceSize != int64(len(tt.source)) || header.SourceSHA256 != sha256Hex(tt.source) {
+				t.Errorf("header source = %d %s", header.SourceSize, header.SourceSHA256)
+			}
+		})
+	}
+}
+
+func TestApplyDeltaRejects(t *testing.T) {
+	const block = 4096
+	source := randomBytes(3, 8*block)
+	target := concat(source[:4*block], randomBytes(4, block), source[4*block:])
+	patch := writeTestDelta(t, source, target)
+	headerSize := len(DeltaMagic) + 2*(8+sha256.Size)
+
+	modify := func(f func(p []byte) []byte) []byte {
+		return f(append([]byte(nil), patch...))
+	}
+
+	tests := []struct {
+		name   string
+		source []byte
+		patch  []byte
+	}{
+		{"empty", source, nil},
+		{"truncated header", source, patch[:headerSize-1]},
+		{"wrong magic", source, modify(func(p []byte) []byte { p[7] = '2'; return p })},
+		{"header only", source, patch[:headerSize]},
+		{"truncated instructions", source, patch[:len(patch)-64]},
+		{"corrupt instructions", source, modify(func(p []byte) []byte {
+			for i := headerSize + 32; i < headerSize+64; i++ {
+				p[i] ^= 0xff
+			}
+			return p
+		})},
+		{"wrong target checksum", source, modify(func(p []byte) []byte { p[headerSize-1] ^= 0xff; return p })},
+		{"wrong target size", source, modify(func(p []byte) []byte { p[len(DeltaMagic)+8+sha256.Size+7]++; return p })},
+		{"source size too small", source, modify(func(p []byte) []byte {
+			// Copies past the declared source size are rejected
+			copy(p[len(DeltaMagic):len(DeltaMagic)+8], []byte{0, 0, 0, 0, 0, 0, 0, 1})
+			return p
+		})},
+		{"different source", randomBytes(5, 8*block), patch},
+		{"shorter source", source[:6*block], patch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ApplyDelta(bytes.NewReader(tt.source), bytes.NewReader(tt.patch), &bytes.Buffer{}); err == nil {
+				t.Error("ApplyDelta accepted the patch")
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"vibing-backend/database"
+	"vibing-backend/models"
+)
+
+const (
+	deltaPollInterval = 5 * time.Minute
+	// Patches stuck in generation this long (e.g. after a restart) are retried
+	deltaStaleAfter = 2 * time.Hour
+	deltaRetryDelay = time.Hour
+)
+
+// DeltaWorker generates the release patches queued by the scheduler. Each patch downloads
+// two full archives, so patches are generated one at a time outside the scheduler. Like
+// the scan worker, the database is the queue.
+type DeltaWorker struct {
+	wake     chan struct{}
+	stopChan chan bool
+}
+
+// NewDeltaWorker creates a release patch worker
+func NewDeltaWorker() *DeltaWorker {
+	return &DeltaWorker{
+		wake:     make(chan struct{}, 1),
+		stopChan: make(chan bool),
+	}
+}
+
+// Start begins generating queued patches
+func (w *DeltaWorker) Start() {
+	go w.run()
+}
+
+// Stop terminates the worker
+func (w *DeltaWorker) Stop() {
+	w.stopChan <- true
+}
+
+// Wake asks the worker to check for queued patches now
+func (w *DeltaWorker) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *DeltaWorker) run() {
+	ticker := time.NewTicker(deltaPollInterval)
+	defer ticker.Stop()
+
+	log.Println("Delta worker started")
+	w.processQueue()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.processQueue()
+		case <-w.wake:
+			w.processQueue()
+		case <-w.stopChan:
+			log.Println("Delta worker stopped")
+			return
+		}
+	}
+}
+
+// processQueue generates queued patches one at a time, oldest first. New patches are
+// picked up right away, pending patches whose generation stalled after deltaStaleAfter
+// and failed ones after deltaRetryDelay, until they used up their attempts.
+func (w *DeltaWorker) processQueue() {
+	if defaultStore == nil {
+		return
+	}
+
+	for {
+		now := time.Now()
+		var deltas []models.ReleaseDelta
+		if err := database.DB.Where("(status = ? AND (attempts = 0 OR updated_at <= ?)) OR (status = ? AND attempts < ? AND updated_at <= ?)",
+			"pending", now.Add(-deltaStaleAfter),
+			"failed", models.MaxReleaseDeltaAttempts, now.Add(-deltaRetryDelay)).
+			Order("updated_at ASC").Limit(1).
+			Find(&deltas).Error; err != nil {
+			log.Printf("Error finding queued release patches: %v", err)
+			return
+		}
+		if len(deltas) == 0 {
+			return
+		}
+		if w.claim(&deltas[0]) {
+			w.generate(&deltas[0])
+		}
+	}
+}
+
+// claim counts the attempt and marks the patch pending so other instances skip it
+func (w *DeltaWorker) claim(delta *models.ReleaseDelta) bool {
+	result := database.DB.Model(&models.ReleaseDelta{}).
+		Where("id = ? AND status = ? AND attempts = ?", delta.ID, delta.Status, delta.Attempts).
+		Updates(map[string]interface{}{"status": "pending", "attempts": delta.Attempts + 1})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	delta.Status = "pending"
+	delta.Attempts++
+	return true
+}
+
+// generate stores the patch and records whether it is ready, skipped or failed
+func (w *DeltaWorker) generate(delta *models.ReleaseDelta) {
+	// Generations that never finished count as attempts too
+	if delta.Attempts > models.MaxReleaseDeltaAttempts {
+		w.fail(delta, fmt.Errorf("patch generation did not finish after %d attempts", models.MaxReleaseDeltaAttempts))
+		return
+	}
+
+	var from, to models.ProductRelease
+	if err := database.DB.First(&from, "id = ?", delta.FromReleaseID).Error; err != nil {
+		w.fail(delta, err)
+		return
+	}
+	if err := database.DB.First(&to, "id = ?", delta.ToReleaseID).Error; err != nil {
+		w.fail(delta, err)
+		return
+	}
+
+	key := fmt.Sprintf("%s/%s/%s_to_%s.vbdelta", models.ReleaseDeltaFolder, to.ProductID, from.Version, to.Version)
+	result, err := GenerateReleaseDelta(defaultStore, from.ObjectKey, to.ObjectKey, key)
+
+	updates := map[string]interface{}{}
+	switch {
+	case err == ErrDeltaNotWorthwhile:
+		updates["status"] = "skipped"
+		updates["last_error"] = ""
+	case err != nil:
+		w.fail(delta, err)
+		return
+	default:
+		updates["status"] = "ready"
+		updates["last_error"] = ""
+		updates["object_key"] = key
+		updates["size"] = result.Size
+		updates["sha256"] = result.SHA256
+		updates["source_sha256"] = result.SourceSHA256
+		updates["target_sha256"] = result.TargetSHA256
+		updates["target_size"] = result.TargetSize
+	}
+	if err := database.DB.Model(delta).Updates(updates).Error; err != nil {
+		log.Printf("Error updating patch %s: %v", delta.ID, err)
+	}
+}
+
+func (w *DeltaWorker) fail(delta *models.ReleaseDelta, err error) {
+	log.Printf("Error generating patch %s -> %s of product %s (attempt %d): %v",
+		delta.FromVersion, delta.ToVersion, delta.ProductID, delta.Attempts, err)
+	if err := database.DB.Model(delta).Updates(map[string]interface{}{
+		"status":     "failed",
+		"last_error": err.Error(),
+	}).Error; err != nil {
+		log.Printf("Error updating patch %s: %v", delta.ID, err)
+	}
+}
+
+// Global delta worker instance
+var ReleaseDeltaWorker *DeltaWorker
+
+// InitDeltaWorker starts the global release patch worker
+func InitDeltaWorker() {
+	ReleaseDeltaWorker = NewDeltaWorker()
+	ReleaseDeltaWorker.Start()
+}
+
+// StopDeltaWorker stops the global release patch worker
+func StopDeltaWorker() {
+	if ReleaseDeltaWorker != nil {
+		ReleaseDeltaWorker.Stop()
+	}
+}
+
+// WakeDeltaWorker notifies the worker that patches were queued
+func WakeDeltaWorker() {
+	if ReleaseDeltaWorker != nil {
+		ReleaseDeltaWorker.Wake()
+	}
+}
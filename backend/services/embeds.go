@@ -0,0 +1,186 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// MaxCastSize is the largest asciinema recording that can be uploaded
+const MaxCastSize = 10 * 1024 * 1024
+
+// PublicCastFolder holds uploaded asciinema recordings, served by the media endpoint
+const PublicCastFolder = "casts"
+
+// EmbedError is returned when a media link or recording is rejected
+type EmbedError struct {
+	Message string
+}
+
+func (e *EmbedError) Error() string {
+	return e.Message
+}
+
+// Embed is an external media item normalized for the product gallery
+type Embed struct {
+	// URL is the player embed URL (video) or the asciicast file URL (asciinema)
+	URL          string
+	SourceURL    string
+	ThumbnailURL string
+}
+
+var (
+	youTubeIDPattern   = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	numericIDPattern   = regexp.MustCompile(`^[0-9]+$`)
+	asciinemaIDPattern = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+)
+
+// ParseVideoEmbed accepts YouTube and Vimeo links and returns privacy-friendly embed URLs
+func ParseVideoEmbed(rawURL string) (*Embed, error) {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || parsed.Scheme != "https" {
+		return nil, &EmbedError{Message: "video URL must be an https YouTube or Vimeo link"}
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(parsed.Host), "www.")
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+
+	switch host {
+	case "youtube.com", "m.youtube.com", "youtube-nocookie.com", "youtu.be":
+		id := ""
+		switch {
+		case host == "youtu.be":
+			id = segments[0]
+		case len(segments) == 1 && segments[0] == "watch":
+			id = parsed.Query().Get("v")
+		case len(segments) == 2 && (segments[0] == "embed" || segments[0] == "shorts"):
+			id = segments[1]
+		}
+		if !youTubeIDPattern.MatchString(id) {
+			break
+		}
+		return &Embed{
+			URL:          "https://www.youtube-nocookie.com/embed/" + id,
+			SourceURL:    "https://www.youtube.com/watch?v=" + id,
+			ThumbnailURL: "https://i.ytimg.com/vi/" + id + "/hqdefault.jpg",
+		}, nil
+
+	case "vimeo.com", "player.vimeo.com":
+		id := segments[len(segments)-1]
+		if !numericIDPattern.MatchString(id) {
+			break
+		}
+		return &Embed{
+			URL:       "https://player.vimeo.com/video/" + id,
+			SourceURL: "https://vimeo.com/" + id,
+		}, nil
+	}
+
+	return nil, &EmbedError{Message: "video URL must be an https YouTube or Vimeo link"}
+}
+
+// ParseAsciinemaLink accepts asciinema.org recording links
+func ParseAsciinemaLink(rawURL string) (*Embed, error) {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || parsed.Scheme != "https" || strings.TrimPrefix(parsed.Host, "www.") != "asciinema.org" {
+		return nil, &EmbedError{Message: "recording URL must be an https asciinema.org link"}
+	}
+
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	if len(segments) != 2 || segments[0] != "a" {
+		return nil, &EmbedError{Message: "recording URL must look like https://asciinema.org/a/<id>"}
+	}
+	id := strings.TrimSuffix(segments[1], ".cast")
+	if !asciinemaIDPattern.MatchString(id) {
+		return nil, &EmbedError{Message: "recording URL must look like https://asciinema.org/a/<id>"}
+	}
+
+	return &Embed{
+		URL:          "https://asciinema.org/a/" + id + ".cast",
+		SourceURL:    "https://asciinema.org/a/" + id,
+		ThumbnailURL: "https://asciinema.org/a/" + id + ".svg",
+	}, nil
+}
+
+// StoredCast is an uploaded asciinema recording
+type StoredCast struct {
+	Key    string
+	Width  int
+	Height int
+}
+
+// StoreCast validates an asciicast v2 recording and stores it under a fresh UUID
+func StoreCast(store ObjectStore, file *multipart.FileHeader) (*StoredCast, error) {
+	if file.Size > MaxCastSize {
+		return nil, &EmbedError{Message: "recording exceeds 10MB limit"}
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, MaxCastSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxCastSize {
+		return nil, &EmbedError{Message: "recording exceeds 10MB limit"}
+	}
+
+	width, height, err := validateAsciicast(data)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("%s/%s.cast", PublicCastFolder, uuid.New().String())
+	if err := store.Put(key, bytes.NewReader(data), int64(len(data)), "application/x-asciicast"); err != nil {
+		return nil, err
+	}
+
+	return &StoredCast{Key: key, Width: width, Height: height}, nil
+}
+
+// validateAsciicast checks the asciicast v2 format: a JSON header line followed by
+// [time, type, data] event lines
+func validateAsciicast(data []byte) (int, int, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), MaxCastSize)
+
+	if !scanner.Scan() {
+		return 0, 0, &EmbedError{Message: "recording is empty"}
+	}
+	var header struct {
+		Version int `json:"version"`
+		Width   int `json:"width"`
+		Height  int `json:"height"`
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Version != 2 || header.Width <= 0 || header.Height <= 0 {
+		return 0, 0, &EmbedError{Message: "recording must be an asciicast v2 file"}
+	}
+
+	for line := 2; scanner.Scan(); line++ {
+		event := bytes.TrimSpace(scanner.Bytes())
+		if len(event) == 0 {
+			continue
+		}
+		var fields []json.RawMessage
+		if err := json.Unmarshal(event, &fields); err != nil || len(fields) != 3 {
+			return 0, 0, &EmbedError{Message: fmt.Sprintf("recording has an invalid event on line %d", line)}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, &EmbedError{Message: "recording could not be read"}
+	}
+
+	return header.Width, header.Height, nil
+}
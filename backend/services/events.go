@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+	"vibing-backend/database"
+	"vibing-backend/models"
+)
+
+const (
+	// eventBufferKey is the Redis list events wait in until they are flushed
+	eventBufferKey = "events:buffer"
+	// eventSeenPrefix prefixes the keys marking a visitor's recent events
+	eventSeenPrefix    = "events:seen:"
+	eventFlushInterval = 10 * time.Second
+	eventBatchSize     = 500
+	// productEventRetention is how long events are kept
+	productEventRetention = 180 * 24 * time.Hour
+)
+
+// eventDedupeWindows are how long repeats of an event type by the same visitor are
+// ignored. Completed purchases are never repeats.
+var eventDedupeWindows = map[string]time.Duration{
+	models.EventView:          30 * time.Minute,
+	models.EventDetailOpen:    30 * time.Minute,
+	models.EventDownload:      time.Hour,
+	models.EventPurchaseStart: 10 * time.Minute,
+}
+
+// botPattern matches the user agents of crawlers, link previews, monitors and HTTP libraries
+var botPattern = regexp.MustCompile(`(?i)bot|crawl|spider|slurp|preview|facebookexternalhit|monitor|headless|lighthouse|curl|wget|python-|go-http-client|okhttp|java/|libwww|scrapy|axios/|node-fetch`)
+
+// IsBot reports whether a user agent belongs to an automated client. Browsers always send one.
+func IsBot(userAgent string) bool {
+	return strings.TrimSpace(userAgent) == "" || botPattern.MatchString(userAgent)
+}
+
+// EventPipeline deduplicates product events and buffers them in Redis until they are
+// flushed to the database in batches
+type EventPipeline struct {
+	redis    *redis.Client
+	stopChan chan bool
+}
+
+var productEvents *EventPipeline
+
+// InitEventPipeline starts buffering product events in the Redis at redisURL. Without a
+// pipeline, events are stored as they happen and aren't deduplicated.
+func InitEventPipeline(redisURL string) error {
+	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return err
+	}
+	productEvents = &EventPipeline{redis: redis.NewClient(opt), stopChan: make(chan bool)}
+	go productEvents.run()
+	return nil
+}
+
+// StopEventPipeline flushes the buffered events and stops the pipeline
+func StopEventPipeline() {
+	if productEvents != nil {
+		productEvents.stopChan <- true
+	}
+}
+
+func (p *EventPipeline) run() {
+	ticker := time.NewTicker(eventFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.flush()
+		case <-p.stopChan:
+			p.flush()
+			return
+		}
+	}
+}
+
+// TrackProductEvent records an event unless the visitor had one of the same type for
+// the product within its dedupe window. Events that can't be buffered are stored directly.
+func TrackProductEvent(event models.ProductEvent) {
+	event.CreatedAt = time.Now()
+	if productEvents != nil {
+		err := productEvents.push(event)
+		if err == nil {
+			return
+		}
+		log.Printf("Failed to buffer %s event of product %s, storing it directly: %v", event.Type, event.ProductID, err)
+	}
+	if err := storeProductEvents(database.DB, []models.ProductEvent{event}); err != nil {
+		log.Printf("Failed to store %s event of product %s: %v", event.Type, event.ProductID, err)
+	}
+}
+
+func (p *EventPipeline) push(event models.ProductEvent) error {
+	ctx := context.Background()
+	if window := eventDedupeWindows[event.Type]; window > 0 {
+		key := eventSeenPrefix + event.Type + ":" + event.ProductID + ":" + event.VisitorID
+		first, err := p.redis.SetNX(ctx, key, 1, window).Result()
+		if err != nil {
+			return err
+		}
+		if !first {
+			return nil
+		}
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return p.redis.RPush(ctx, eventBufferKey, data).Err()
+}
+
+// flush moves the buffered events to the database a batch at a time. Taking a batch off
+// the list is atomic, so several servers can flush the same buffer.
+func (p *EventPipeline) flush() {
+	ctx := context.Background()
+	for {
+		var batch *redis.StringSliceCmd
+		if _, err := p.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			batch = pipe.LRange(ctx, eventBufferKey, 0, eventBatchSize-1)
+			pipe.LTrim(ctx, eventBufferKey, eventBatchSize, -1)
+			return nil
+		}); err != nil {
+			log.Printf("Error reading buffered product events: %v", err)
+			return
+		}
+
+		raw := batch.Val()
+		if len(raw) == 0 {
+			return
+		}
+		events := make([]models.ProductEvent, 0, len(raw))
+		for _, item := range raw {
+			var event models.ProductEvent
+			if err := json.Unmarshal([]byte(item), &event); err != nil {
+				log.Printf("Dropping malformed buffered product event: %v", err)
+				continue
+			}
+			events = append(events, event)
+		}
+
+		if err := storeProductEvents(database.DB, events); err != nil {
+			log.Printf("Error storing %d product events, returning them to the buffer: %v", len(events), err)
+			requeue := make([]interface{}, len(raw))
+			for i, item := range raw {
+				requeue[i] = item
+			}
+			if err := p.redis.RPush(ctx, eventBufferKey, requeue...).Err(); err != nil {
+				log.Printf("Error returning product events to the buffer, %d events lost: %v", len(raw), err)
+			}
+			return
+		}
+		if len(raw) < eventBatchSize {
+			return
+		}
+	}
+}
+
+// storeProductEvents inserts events and adds them to the counters derived from them:
+// product views and daily views from views, and product downloads from completed purchases
+func storeProductEvents(db *gorm.DB, events []models.ProductEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	type productDay struct {
+		productID string
+		day       time.Time
+	}
+	views := map[string]int{}
+	dailyViews := map[productDay]int{}
+	purchases := map[string]int{}
+	for _, event := range events {
+		switch event.Type {
+		case models.EventView:
+			views[event.ProductID]++
+			dailyViews[productDay{event.ProductID, event.CreatedAt.UTC().Truncate(24 * time.Hour)}]++
+		case models.EventPurchaseComplete:
+			purchases[event.ProductID]++
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(&events, 100).Error; err != nil {
+			return err
+		}
+		for id, n := range views {
+			if err := tx.Model(&models.Product{}).Where("id = ?", id).
+				UpdateColumn("views", gorm.Expr("views + ?", n)).Error; err != nil {
+				return err
+			}
+		}
+		for key, n := range dailyViews {
+			if err := models.AddProductViews(tx, key.productID, key.day, n); err != nil {
+				return err
+			}
+		}
+		for id, n := range purchases {
+			if err := tx.Model(&models.Product{}).Where("id = ?", id).
+				UpdateColumn("downloads", gorm.Expr("downloads + ?", n)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// processEventRetention deletes product events past productEventRetention
+func (s *SchedulerService) processEventRetention() {
+	result := database.DB.Where("created_at < ?", time.Now().Add(-productEventRetention)).Delete(&models.ProductEvent{})
+	if result.Error != nil {
+		log.Printf("Error deleting expired product events: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Deleted %d expired product events", result.RowsAffected)
+	}
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxModuleZipSize is the largest module the go command accepts, measured unpacked
+const MaxModuleZipSize = 500 << 20
+
+var (
+	moduleDirectivePattern = regexp.MustCompile(`^module\s+("[^"]+"|\S+)`)
+	majorSuffixPattern     = regexp.MustCompile(`/v([2-9]|[1-9][0-9]+)$`)
+)
+
+// GoModule is the Go module found in a product archive
+type GoModule struct {
+	Path string
+	// Dir is the folder of go.mod inside the archive, "" for the archive root
+	Dir   string
+	GoMod []byte
+}
+
+// FindGoModule returns the module declared by the go.mod at the archive root or in its
+// single top-level folder, or nil if the archive isn't a Go module
+func FindGoModule(inspection *ArchiveInspection) *GoModule {
+	var found *GoModule
+	for _, manifest := range inspection.Manifests {
+		if path.Base(manifest.Path) != "go.mod" || strings.Count(manifest.Path, "/") > 1 {
+			continue
+		}
+		modulePath := parseModulePath(manifest.Content)
+		if modulePath == "" {
+			continue
+		}
+		dir := path.Dir(manifest.Path)
+		if dir == "." {
+			dir = ""
+		}
+		if found == nil || len(dir) < len(found.Dir) {
+			found = &GoModule{Path: modulePath, Dir: dir, GoMod: manifest.Content}
+		}
+	}
+	return found
+}
+
+func parseModulePath(goMod []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(goMod))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if match := moduleDirectivePattern.FindStringSubmatch(line); match != nil {
+			modulePath := match[1]
+			if unquoted, err := strconv.Unquote(modulePath); err == nil {
+				modulePath = unquoted
+			}
+			return modulePath
+		}
+	}
+	return ""
+}
+
+// ModuleVersion returns the Go version of a release ("1.2.3" becomes "v1.2.3"), and
+// false when the major version doesn't match the module path: v2 and later need a
+// /vN suffix on the path, and paths without one only carry v0 and v1.
+func ModuleVersion(modulePath, version string) (string, bool) {
+	major := version
+	if i := strings.Index(major, "."); i >= 0 {
+		major = major[:i]
+	}
+
+	if match := majorSuffixPattern.FindStringSubmatch(modulePath); match != nil {
+		return "v" + version, major == match[1]
+	}
+	return "v" + version, major == "0" || major == "1"
+}
+
+// UnescapeModulePath reverses the go command's case encoding of module paths and
+// versions in proxy URLs, where "!x" stands for "X"
+func UnescapeModulePath(escaped string) (string, bool) {
+	var b strings.Builder
+	bang := false
+	for _, r := range escaped {
+		switch {
+		case bang:
+			if r < 'a' || r > 'z' {
+				return "", false
+			}
+			b.WriteRune(unicode.ToUpper(r))
+			bang = false
+		case r == '!':
+			bang = true
+		case r >= 'A' && r <= 'Z':
+			return "", false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String(), !bang
+}
+
+// OpenModuleZip builds the module zip of a product archive: the files of the module
+// folder under "<module>@<version>/", without vendored packages, nested modules and
+// version control folders, following the rules of golang.org/x/mod/zip. Entries are
+// copied without recompression while the returned stream is read.
+func OpenModuleZip(store ObjectStore, key string, module *GoModule, version string) (io.ReadCloser, error) {
+	object, err := store.Get(key, "")
+	if err != nil {
+		return nil, err
+	}
+	defer object.Body.Close()
+
+	tmp, err := os.CreateTemp("", "module-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(tmp, object.Body)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	archive, err := zip.NewReader(tmp, size)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, archiveError("INVALID_ARCHIVE", "File is not a valid ZIP archive")
+	}
+	files, err := moduleFiles(archive.File, module.Dir)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	prefix := module.Path + "@" + version + "/"
+	reader, writer := io.Pipe()
+	go func() {
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		writer.CloseWithError(writeModuleZip(writer, files, prefix))
+	}()
+	return reader, nil
+}
+
+// moduleFile is an archive entry and its path inside the module
+type moduleFile struct {
+	file *zip.File
+	name string
+}
+
+func moduleFiles(entries []*zip.File, dir string) ([]moduleFile, error) {
+	root := ""
+	if dir != "" {
+		root = dir + "/"
+	}
+
+	var candidates []moduleFile
+	submodules := make(map[string]bool)
+	for _, file := range entries {
+		name := path.Clean(strings.TrimPrefix(file.Name, "./"))
+		if !strings.HasPrefix(name, root) || !file.Mode().IsRegular() || strings.HasSuffix(file.Name, "/") {
+			continue
+		}
+		name = strings.TrimPrefix(name, root)
+		if path.Base(name) == "go.mod" && name != "go.mod" {
+			submodules[path.Dir(name)+"/"] = true
+		}
+		candidates = append(candidates, moduleFile{file: file, name: name})
+	}
+
+	var files []moduleFile
+	var total uint64
+	seen := make(map[string]bool)
+	for _, candidate := range candidates {
+		if inSubmodule(candidate.name, submodules) || isVendoredPackage(candidate.name) ||
+			inVCSDir(candidate.name) || !validModuleFilePath(candidate.name) {
+			continue
+		}
+		folded := strings.ToLower(candidate.name)
+		if seen[folded] {
+			continue
+		}
+		seen[folded] = true
+
+		total += candidate.file.UncompressedSize64
+		if total > MaxModuleZipSize {
+			return nil, archiveError("ARCHIVE_TOO_LARGE", "Module exceeds the 500MB limit of the go command")
+		}
+		files = append(files, candidate)
+	}
+	return files, nil
+}
+
+func writeModuleZip(dst io.Writer, files []moduleFile, prefix string) error {
+	buffered := bufio.NewWriterSize(dst, 256*1024)
+	out := zip.NewWriter(buffered)
+	for _, f := range files {
+		header := f.file.FileHeader
+		header.Name = prefix + f.name
+		header.Comment = ""
+		header.Extra = nil
+
+		raw, err := f.file.OpenRaw()
+		if err != nil {
+			return err
+		}
+		entry, err := out.CreateRaw(&header)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(entry, raw); err != nil {
+			return err
+		}
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to finish module zip: %w", err)
+	}
+	return buffered.Flush()
+}
+
+func inSubmodule(name string, submodules map[string]bool) bool {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if submodules[dir+"/"] {
+			return true
+		}
+	}
+	return false
+}
+
+// isVendoredPackage matches the go command's rule, which only keeps files directly in vendor/
+func isVendoredPackage(name string) bool {
+	var i int
+	if strings.HasPrefix(name, "vendor/") {
+		i += len("vendor/")
+	} else if j := strings.Index(name, "/vendor/"); j >= 0 {
+		// Deliberately mirrors an off-by-offset in the go command, module checksums depend on it
+		i += len("/vendor/")
+	} else {
+		return false
+	}
+	return strings.Contains(name[i:], "/")
+}
+
+func inVCSDir(name string) bool {
+	for _, element := range strings.Split(path.Dir(name), "/") {
+		switch element {
+		case ".git", ".hg", ".svn", ".bzr":
+			return true
+		}
+	}
+	return false
+}
+
+// validModuleFilePath applies the go command's file path rules, so a file it would
+// reject can't make the whole module zip unusable
+func validModuleFilePath(name string) bool {
+	for _, element := range strings.Split(name, "/") {
+		if element == "" || element == "." || element == ".." || strings.HasSuffix(element, ".") {
+			return false
+		}
+		for _, r := range element {
+			if !unicode.IsLetter(r) && !('0' <= r && r <= '9') && !strings.ContainsRune("!#$%&()+,-.=@[]^_{}~ ", r) {
+				return false
+			}
+		}
+
+		short := element
+		if i := strings.Index(short, "."); i >= 0 {
+			short = short[:i]
+		}
+		switch strings.ToUpper(short) {
+		case "CON", "PRN", "AUX", "NUL",
+			"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+			"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9":
+			return false
+		}
+		// Windows 8.3 short names such as GIT~1
+		if tilde := strings.LastIndex(short, "~"); tilde >= 0 && tilde < len(short)-1 {
+			if _, err := strconv.Atoi(short[tilde+1:]); err == nil {
+				return false
+			}
+		}
+	}
+	return true
+}
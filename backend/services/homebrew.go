@@ -0,0 +1,186 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// HomebrewTapName is the tap buyers add, so formulas install as vibing/tap/<command>
+const HomebrewTapName = "vibing/tap"
+
+// HomebrewFormula is the data a tap formula is rendered from
+type HomebrewFormula struct {
+	Title       string
+	Command     string
+	Description string
+	Homepage    string
+	Version     string
+	Assets      []InstallAsset
+}
+
+type homebrewArch struct {
+	Block  string
+	URL    string
+	SHA256 string
+}
+
+type homebrewOS struct {
+	Block string
+	Archs []homebrewArch
+}
+
+// HomebrewClassName is the Ruby class of a formula, e.g. my-tool becomes MyTool
+func HomebrewClassName(command string) string {
+	var name strings.Builder
+	for _, part := range strings.FieldsFunc(command, func(r rune) bool {
+		return r == '-' || r == '_' || r == '.'
+	}) {
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		name.WriteString(string(runes))
+	}
+	return name.String()
+}
+
+// RenderHomebrewFormula renders the tap formula of a release. Assets are fetched with the
+// buyer's access token from $HOMEBREW_VIBING_TOKEN; Homebrew checks their SHA-256.
+func RenderHomebrewFormula(formula *HomebrewFormula) ([]byte, error) {
+	var platforms []homebrewOS
+	for _, osBlock := range []struct{ os, block string }{{"darwin", "on_macos"}, {"linux", "on_linux"}} {
+		platform := homebrewOS{Block: osBlock.block}
+		for _, archBlock := range []struct{ arch, block string }{{"arm64", "on_arm"}, {"amd64", "on_intel"}} {
+			for _, asset := range formula.Assets {
+				if asset.Platform == osBlock.os+"-"+archBlock.arch {
+					platform.Archs = append(platform.Archs, homebrewArch{Block: archBlock.block, URL: asset.URL, SHA256: asset.SHA256})
+				}
+			}
+		}
+		if len(platform.Archs) > 0 {
+			platforms = append(platforms, platform)
+		}
+	}
+
+	binaries := make([]InstallAsset, len(formula.Assets))
+	copy(binaries, formula.Assets)
+	sort.Slice(binaries, func(i, j int) bool {
+		return binaries[i].Platform < binaries[j].Platform
+	})
+
+	var out bytes.Buffer
+	err := homebrewFormulaTemplate.Execute(&out, map[string]interface{}{
+		"Formula":   formula,
+		"ClassName": HomebrewClassName(formula.Command),
+		"Desc":      homebrewDescription(formula.Description),
+		"Platforms": platforms,
+		"Binaries":  binaries,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// homebrewDescription fits a description to brew audit's rules: one line, under 80
+// characters and without a trailing period
+func homebrewDescription(description string) string {
+	description = commentText(description)
+	if runes := []rune(description); len(runes) > 79 {
+		description = strings.TrimSpace(string(runes[:79]))
+	}
+	return strings.TrimRight(description, ".")
+}
+
+// rubyString quotes a value as a Ruby string literal without interpolation
+func rubyString(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "#", `\#`, "\n", " ", "\r", " ")
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// BuildHomebrewTap packs formulas, keyed by command, into a tap repository tarball
+// laid out as homebrew-tap/Formula/<command>.rb
+func BuildHomebrewTap(formulas map[string][]byte, readme []byte) ([]byte, error) {
+	commands := make([]string, 0, len(formulas))
+	for command := range formulas {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+
+	var out bytes.Buffer
+	gz := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gz)
+
+	write := func(name string, body []byte) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     path.Join("homebrew-tap", name),
+			Mode:     0644,
+			Size:     int64(len(body)),
+			ModTime:  npmTarballTime,
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			return err
+		}
+		_, err := tw.Write(body)
+		return err
+	}
+
+	if err := write("README.md", readme); err != nil {
+		return nil, err
+	}
+	for _, command := range commands {
+		if err := write("Formula/"+command+".rb", formulas[command]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+var homebrewFormulaTemplate = template.Must(template.New("formula.rb").Funcs(template.FuncMap{
+	"rb":      rubyString,
+	"comment": commentText,
+}).Parse(`# {{comment .Formula.Title}} {{comment .Formula.Version}}, generated by Vibing from the latest release.
+# Set HOMEBREW_VIBING_TOKEN to a personal access token of the account that bought it.
+class {{.ClassName}} < Formula
+  desc {{rb .Desc}}
+  homepage {{rb .Formula.Homepage}}
+  version {{rb .Formula.Version}}
+{{range .Platforms}}
+  {{.Block}} do
+{{- range .Archs}}
+    {{.Block}} do
+      url {{rb .URL}}, headers: ["Authorization: Bearer #{ENV.fetch("HOMEBREW_VIBING_TOKEN", "")}"]
+      sha256 {{rb .SHA256}}
+    end
+{{- end}}
+  end
+{{end}}
+  BINARIES = {
+{{- range .Binaries}}
+    {{rb .Platform}} => {{rb .Binary}},
+{{- end}}
+  }.freeze
+
+  def install
+    platform = "#{OS.mac? ? "darwin" : "linux"}-#{Hardware::CPU.arm? ? "arm64" : "amd64"}"
+    name = File.basename(BINARIES.fetch(platform))
+    binary = Dir["**/#{name}"].find { |f| File.file?(f) }
+    bin.install binary => {{rb .Formula.Command}}
+  end
+
+  test do
+    assert_predicate bin/{{rb .Formula.Command}}, :executable?
+  end
+end
+`))
@@ -0,0 +1,439 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	_ "image/gif" // registers the GIF decoder for image.Decode
+	"image/jpeg"
+	"image/png"
+)
+
+// Limits for uploaded images
+const (
+	MaxImageSize   = 20 * 1024 * 1024 // bytes
+	MaxImagePixels = 40 * 1000 * 1000 // decoded width x height, guards against decompression bombs
+)
+
+// ImageError is returned when an uploaded image is rejected
+type ImageError struct {
+	Code    string
+	Message string
+}
+
+func (e *ImageError) Error() string {
+	return e.Message
+}
+
+// ImageRendition is a resized variant generated for every uploaded product image
+type ImageRendition struct {
+	Name      string
+	MaxWidth  int
+	MaxHeight int
+	// Crop fills the box exactly by cropping the center; otherwise the image is fit inside it
+	Crop bool
+}
+
+// ProductImageRenditions are generated for product images; originals are kept as "original"
+var ProductImageRenditions = []ImageRendition{
+	{Name: "thumb", MaxWidth: 320, MaxHeight: 320, Crop: true},
+	{Name: "card", MaxWidth: 640, MaxHeight: 360, Crop: true},
+	{Name: "detail", MaxWidth: 1600, MaxHeight: 1600},
+}
+
+// ImageVariant is one encoded file produced by ProcessImage
+type ImageVariant struct {
+	Name        string
+	Ext         string
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
+}
+
+// ProcessedImage is a validated image with its metadata stripped and its renditions encoded
+type ProcessedImage struct {
+	Format   string
+	Width    int
+	Height   int
+	Variants []ImageVariant
+}
+
+// DetectImageFormat identifies an image by its magic bytes: "jpeg", "png", "gif", "webp" or ""
+func DetectImageFormat(data []byte) string {
+	switch {
+	case len(data) >= 3 && data[0] == 0xFF && data[1] == 0xD8 && data[2] == 0xFF:
+		return "jpeg"
+	case len(data) >= 8 && bytes.Equal(data[:8], []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case len(data) >= 6 && (bytes.Equal(data[:6], []byte("GIF87a")) || bytes.Equal(data[:6], []byte("GIF89a"))):
+		return "gif"
+	case len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return "webp"
+	}
+	return ""
+}
+
+// ProcessImage validates an uploaded image and prepares it for storage. The original is
+// re-encoded (JPEG, PNG) or rewritten (WebP) without EXIF/XMP metadata, with the EXIF
+// orientation applied. Renditions are encoded as JPEG, or PNG when the image has
+// transparency, plus WebP when an encoder is available. WebP uploads can't be decoded
+// with the standard library, so they are stored without renditions.
+func ProcessImage(data []byte, renditions []ImageRendition, webp WebPEncoder) (*ProcessedImage, error) {
+	if len(data) > MaxImageSize {
+		return nil, &ImageError{Code: "IMAGE_TOO_LARGE", Message: "image size exceeds 20MB limit"}
+	}
+
+	format := DetectImageFormat(data)
+	if format == "" {
+		return nil, &ImageError{Code: "INVALID_IMAGE", Message: "only image files (JPG, PNG, GIF, WebP) are allowed"}
+	}
+
+	if format == "webp" {
+		return processWebP(data)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, &ImageError{Code: "INVALID_IMAGE", Message: "image could not be decoded"}
+	}
+	if config.Width*config.Height > MaxImagePixels {
+		return nil, &ImageError{Code: "IMAGE_TOO_LARGE", Message: "image dimensions are too large"}
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, &ImageError{Code: "INVALID_IMAGE", Message: "image could not be decoded"}
+	}
+
+	img := toRGBA(decoded)
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	opaque := img.Opaque()
+	bounds := img.Bounds()
+
+	result := &ProcessedImage{
+		Format: format,
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+	}
+
+	// Original
+	switch format {
+	case "gif":
+		// GIFs carry no EXIF; keep the file so animations survive
+		result.Variants = append(result.Variants, ImageVariant{
+			Name: "original", Ext: ".gif", ContentType: "image/gif",
+			Width: bounds.Dx(), Height: bounds.Dy(), Data: data,
+		})
+	default:
+		original, err := encodeRaster(img, format == "jpeg" && opaque, 92)
+		if err != nil {
+			return nil, err
+		}
+		original.Name = "original"
+		result.Variants = append(result.Variants, *original)
+	}
+
+	for _, rendition := range renditions {
+		resized := resizeForRendition(img, rendition)
+
+		variant, err := encodeRaster(resized, opaque, 82)
+		if err != nil {
+			return nil, err
+		}
+		variant.Name = rendition.Name
+		result.Variants = append(result.Variants, *variant)
+
+		if webp != nil {
+			encoded, err := webp.Encode(resized)
+			if err != nil {
+				// WebP is an optimization; the JPEG/PNG rendition still serves every client
+				continue
+			}
+			result.Variants = append(result.Variants, ImageVariant{
+				Name: rendition.Name, Ext: ".webp", ContentType: "image/webp",
+				Width: resized.Bounds().Dx(), Height: resized.Bounds().Dy(), Data: encoded,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+func processWebP(data []byte) (*ProcessedImage, error) {
+	width, height, ok := webpDimensions(data)
+	if !ok {
+		return nil, &ImageError{Code: "INVALID_IMAGE", Message: "image could not be decoded"}
+	}
+	if width*height > MaxImagePixels {
+		return nil, &ImageError{Code: "IMAGE_TOO_LARGE", Message: "image dimensions are too large"}
+	}
+
+	stripped, err := stripWebPMetadata(data)
+	if err != nil {
+		return nil, &ImageError{Code: "INVALID_IMAGE", Message: "image could not be decoded"}
+	}
+
+	return &ProcessedImage{
+		Format: "webp",
+		Width:  width,
+		Height: height,
+		Variants: []ImageVariant{{
+			Name: "original", Ext: ".webp", ContentType: "image/webp",
+			Width: width, Height: height, Data: stripped,
+		}},
+	}, nil
+}
+
+func encodeRaster(img *image.RGBA, asJPEG bool, quality int) (*ImageVariant, error) {
+	var buf bytes.Buffer
+	variant := &ImageVariant{Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+
+	if asJPEG {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, err
+		}
+		variant.Ext, variant.ContentType = ".jpg", "image/jpeg"
+	} else {
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := encoder.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		variant.Ext, variant.ContentType = ".png", "image/png"
+	}
+
+	variant.Data = buf.Bytes()
+	return variant, nil
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+	return dst
+}
+
+// resizeForRendition scales an image down to fit (or, when cropping, fill) the rendition
+// box. Images are never scaled up.
+func resizeForRendition(img *image.RGBA, rendition ImageRendition) *image.RGBA {
+	srcW, srcH := img.Bounds().Dx(), img.Bounds().Dy()
+
+	if rendition.Crop {
+		// Largest centered region with the rendition's aspect ratio
+		cropW, cropH := srcW, srcW*rendition.MaxHeight/rendition.MaxWidth
+		if cropH > srcH {
+			cropW, cropH = srcH*rendition.MaxWidth/rendition.MaxHeight, srcH
+		}
+		cropW, cropH = max(cropW, 1), max(cropH, 1)
+		x0, y0 := (srcW-cropW)/2, (srcH-cropH)/2
+		region := image.Rect(x0, y0, x0+cropW, y0+cropH)
+
+		dstW, dstH := rendition.MaxWidth, rendition.MaxHeight
+		if cropW < dstW {
+			dstW, dstH = cropW, cropH
+		}
+		return scaleBox(img, region, max(dstW, 1), max(dstH, 1))
+	}
+
+	dstW, dstH := srcW, srcH
+	if dstW > rendition.MaxWidth {
+		dstW, dstH = rendition.MaxWidth, dstH*rendition.MaxWidth/dstW
+	}
+	if dstH > rendition.MaxHeight {
+		dstW, dstH = dstW*rendition.MaxHeight/dstH, rendition.MaxHeight
+	}
+	return scaleBox(img, img.Bounds(), max(dstW, 1), max(dstH, 1))
+}
+
+// scaleBox downsamples region of src to width x height by averaging the source
+// pixels covered by each destination pixel
+func scaleBox(src *image.RGBA, region image.Rectangle, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	regionW, regionH := region.Dx(), region.Dy()
+
+	for y := 0; y < height; y++ {
+		sy0 := region.Min.Y + y*regionH/height
+		sy1 := max(region.Min.Y+(y+1)*regionH/height, sy0+1)
+		for x := 0; x < width; x++ {
+			sx0 := region.Min.X + x*regionW/width
+			sx1 := max(region.Min.X+(x+1)*regionW/width, sx0+1)
+
+			var r, g, b, a, n uint32
+			for sy := sy0; sy < sy1; sy++ {
+				offset := src.PixOffset(sx0, sy)
+				for sx := sx0; sx < sx1; sx++ {
+					r += uint32(src.Pix[offset])
+					g += uint32(src.Pix[offset+1])
+					b += uint32(src.Pix[offset+2])
+					a += uint32(src.Pix[offset+3])
+					offset += 4
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation tag (1-8) of a JPEG, defaulting to 1
+func jpegOrientation(data []byte) int {
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if marker == 0xDA || length < 2 || pos+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+// applyOrientation rotates and flips an image so it displays upright without its EXIF tag
+func applyOrientation(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotated 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // rotated 90 clockwise
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotated 90 counter-clockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// webpDimensions reads the canvas size from a WebP file's first image chunk
+func webpDimensions(data []byte) (int, int, bool) {
+	if len(data) < 30 {
+		return 0, 0, false
+	}
+
+	chunk, payload := string(data[12:16]), data[20:]
+	switch chunk {
+	case "VP8X":
+		width := int(payload[4]) | int(payload[5])<<8 | int(payload[6])<<16
+		height := int(payload[7]) | int(payload[8])<<8 | int(payload[9])<<16
+		return width + 1, height + 1, true
+	case "VP8 ":
+		width := int(binary.LittleEndian.Uint16(payload[6:])) & 0x3FFF
+		height := int(binary.LittleEndian.Uint16(payload[8:])) & 0x3FFF
+		return width, height, width > 0 && height > 0
+	case "VP8L":
+		bits := binary.LittleEndian.Uint32(payload[1:])
+		return int(bits&0x3FFF) + 1, int(bits>>14&0x3FFF) + 1, true
+	}
+	return 0, 0, false
+}
+
+// stripWebPMetadata removes EXIF and XMP chunks from a WebP container
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+
+	pos := 12
+	for pos+8 <= len(data) {
+		fourCC := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size%2
+		if size < 0 || end > len(data) {
+			if pos+8+size == len(data) {
+				end = len(data) // odd-sized final chunk without padding
+			} else {
+				return nil, &ImageError{Code: "INVALID_IMAGE", Message: "malformed WebP file"}
+			}
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[pos:end]...)
+			chunk[8] &^= 0x08 | 0x04 // clear the EXIF and XMP flags
+			out.Write(chunk)
+		default:
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	result := out.Bytes()
+	binary.LittleEndian.PutUint32(result[4:], uint32(len(result)-8))
+	return result, nil
+}
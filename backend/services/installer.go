@@ -0,0 +1,361 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/google/uuid"
+	"vibing-backend/config"
+)
+
+// MaxReleaseAssetSize caps the size of one per-platform CLI asset
+const MaxReleaseAssetSize = 200 * 1024 * 1024
+
+// StoredAsset is an uploaded and inspected per-platform release asset
+type StoredAsset struct {
+	Key    string
+	Format string
+	Binary string
+	Size   int64
+	SHA256 string
+}
+
+// InstallAsset is one platform offered by an install script or Homebrew formula
+type InstallAsset struct {
+	Platform string
+	URL      string
+	SHA256   string
+	Format   string
+	Binary   string
+}
+
+// InstallScript is the data an install.sh is rendered from
+type InstallScript struct {
+	Title     string
+	Command   string
+	Version   string
+	ScriptURL string
+	KeyURL    string
+	Assets    []InstallAsset
+}
+
+// installSigningKey signs install scripts so buyers can check them before piping them to sh
+var installSigningKey ed25519.PrivateKey
+
+// minInstallSigningKey is the shortest INSTALL_SIGNING_KEY accepted
+const minInstallSigningKey = 32
+
+// InitInstallSigner derives the install script signing key from INSTALL_SIGNING_KEY, so
+// signatures stay valid across restarts and instances. The key must be dedicated to
+// install scripts: buyers pin its public half, so it can't change with other secrets.
+func InitInstallSigner(cfg *config.Config) error {
+	secret := cfg.Install.SigningKey
+	if secret == "" {
+		return fmt.Errorf("INSTALL_SIGNING_KEY is not set")
+	}
+	if len(secret) < minInstallSigningKey {
+		return fmt.Errorf("INSTALL_SIGNING_KEY must be at least %d characters", minInstallSigningKey)
+	}
+	if secret == cfg.JWT.Secret {
+		return fmt.Errorf("INSTALL_SIGNING_KEY must differ from JWT_SECRET")
+	}
+
+	seed := sha256.Sum256([]byte("vibing install script signing key\x00" + secret))
+	installSigningKey = ed25519.NewKeyFromSeed(seed[:])
+	return nil
+}
+
+// SignInstallScript returns the raw Ed25519 signature of a rendered install script
+func SignInstallScript(script []byte) []byte {
+	return ed25519.Sign(installSigningKey, script)
+}
+
+// InstallSigningKeyPEM returns the public key install scripts are verified with, PEM encoded
+func InstallSigningKeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(installSigningKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// UploadReleaseAsset stores a per-platform asset of a CLI tool release. Bare executables,
+// .tar.gz and .zip archives are accepted; archives must contain an executable, preferably
+// named after the command.
+func UploadReleaseAsset(store ObjectStore, file *multipart.FileHeader, productID, version, platform, command string) (*StoredAsset, error) {
+	if file.Size > MaxReleaseAssetSize {
+		return nil, archiveError("FILE_TOO_LARGE", "Release assets are limited to 200MB")
+	}
+
+	format, ok := releaseAssetFormat(file.Filename)
+	if !ok {
+		return nil, archiveError("UNSUPPORTED_FORMAT", "Release assets must be an executable, a .tar.gz or a .zip archive")
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	binary, err := findAssetBinary(src, file.Size, format, command)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(hash, src); err != nil {
+		return nil, err
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("assets/%s/%s/%s/%s_%s", productID, version, platform, uuid.New().String(), path.Base(file.Filename))
+	if err := store.Put(key, src, file.Size, "application/octet-stream"); err != nil {
+		return nil, err
+	}
+
+	return &StoredAsset{
+		Key:    key,
+		Format: format,
+		Binary: binary,
+		Size:   file.Size,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+func releaseAssetFormat(filename string) (string, bool) {
+	name := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tar.gz", true
+	case strings.HasSuffix(name, ".zip"):
+		return "zip", true
+	}
+	for _, ext := range []string{".tar", ".tar.xz", ".tar.bz2", ".txz", ".7z", ".rar", ".gz", ".xz", ".dmg", ".pkg", ".deb", ".rpm"} {
+		if strings.HasSuffix(name, ext) {
+			return "", false
+		}
+	}
+	return "binary", true
+}
+
+// findAssetBinary returns the executable an asset installs: the command name for a bare
+// executable, or the path of the executable inside an archive
+func findAssetBinary(src io.ReaderAt, size int64, format, command string) (string, error) {
+	if format == "binary" {
+		header := make([]byte, 4)
+		n, _ := src.ReadAt(header, 0)
+		if !isExecutableHeader(header[:n]) {
+			return "", archiveError("NOT_EXECUTABLE", "The file is not an executable")
+		}
+		return command, nil
+	}
+
+	var candidates []string
+	consider := func(name string, executableMode bool, body io.Reader) {
+		name = path.Clean(strings.TrimPrefix(name, "./"))
+		if strings.HasPrefix(name, "../") || path.IsAbs(name) {
+			return
+		}
+		header := make([]byte, 4)
+		n, _ := io.ReadFull(body, header)
+		if executableMode || isExecutableHeader(header[:n]) {
+			candidates = append(candidates, name)
+		}
+	}
+
+	switch format {
+	case "zip":
+		archive, err := zip.NewReader(src, size)
+		if err != nil {
+			return "", archiveError("INVALID_ARCHIVE", "File is not a valid ZIP archive")
+		}
+		for _, file := range archive.File {
+			if !file.Mode().IsRegular() {
+				continue
+			}
+			rc, err := file.Open()
+			if err != nil {
+				continue
+			}
+			consider(file.Name, file.Mode()&0111 != 0, rc)
+			rc.Close()
+		}
+
+	case "tar.gz":
+		gz, err := gzip.NewReader(io.NewSectionReader(src, 0, size))
+		if err != nil {
+			return "", archiveError("INVALID_ARCHIVE", "File is not a valid .tar.gz archive")
+		}
+		tr := tar.NewReader(gz)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", archiveError("INVALID_ARCHIVE", "File is not a valid .tar.gz archive")
+			}
+			if header.Typeflag == tar.TypeReg {
+				consider(header.Name, header.Mode&0111 != 0, tr)
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return "", archiveError("NO_EXECUTABLE", "The archive contains no executable")
+	}
+	for _, candidate := range candidates {
+		if path.Base(candidate) == command {
+			return candidate, nil
+		}
+	}
+	return candidates[0], nil
+}
+
+// isExecutableHeader matches ELF and Mach-O binaries and scripts with a shebang
+func isExecutableHeader(header []byte) bool {
+	switch {
+	case bytes.HasPrefix(header, []byte("\x7fELF")),
+		bytes.HasPrefix(header, []byte("#!")),
+		bytes.HasPrefix(header, []byte{0xfe, 0xed, 0xfa, 0xce}),
+		bytes.HasPrefix(header, []byte{0xfe, 0xed, 0xfa, 0xcf}),
+		bytes.HasPrefix(header, []byte{0xce, 0xfa, 0xed, 0xfe}),
+		bytes.HasPrefix(header, []byte{0xcf, 0xfa, 0xed, 0xfe}),
+		bytes.HasPrefix(header, []byte{0xca, 0xfe, 0xba, 0xbe}):
+		return true
+	}
+	return false
+}
+
+// RenderInstallScript renders the POSIX sh installer of a release. It detects the platform,
+// downloads the matching asset with $VIBING_TOKEN and checks its SHA-256 before installing.
+func RenderInstallScript(script *InstallScript) ([]byte, error) {
+	var out bytes.Buffer
+	if err := installScriptTemplate.Execute(&out, script); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// shellQuote quotes a value for a POSIX shell
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// commentText keeps a value on one comment line
+func commentText(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+var installScriptTemplate = template.Must(template.New("install.sh").Funcs(template.FuncMap{
+	"sh":      shellQuote,
+	"comment": commentText,
+}).Parse(`#!/bin/sh
+# Installer for {{comment .Title}} {{comment .Version}}, generated by Vibing.
+#
+#   curl -fsSL {{.ScriptURL}} | VIBING_TOKEN=vbt_... sh
+#
+# The Ed25519 signature of this script is at {{.ScriptURL}}.sig
+# and can be checked against {{.KeyURL}}.
+# Set VIBING_INSTALL_DIR to install somewhere other than ~/.local/bin.
+set -eu
+
+COMMAND={{sh .Command}}
+VERSION={{sh .Version}}
+INSTALL_DIR="${VIBING_INSTALL_DIR:-$HOME/.local/bin}"
+
+fail() {
+	echo "error: $*" >&2
+	exit 1
+}
+
+[ -n "${VIBING_TOKEN:-}" ] || fail "set VIBING_TOKEN to a personal access token of the account that bought $COMMAND"
+
+case "$(uname -s)" in
+	Linux) os=linux ;;
+	Darwin) os=darwin ;;
+	*) fail "unsupported operating system: $(uname -s)" ;;
+esac
+case "$(uname -m)" in
+	x86_64 | amd64) arch=amd64 ;;
+	arm64 | aarch64) arch=arm64 ;;
+	*) fail "unsupported architecture: $(uname -m)" ;;
+esac
+
+case "$os-$arch" in
+{{- range .Assets}}
+	{{.Platform}})
+		url={{sh .URL}}
+		sha256={{sh .SHA256}}
+		format={{sh .Format}}
+		binary={{sh .Binary}}
+		;;
+{{- end}}
+	*) fail "$COMMAND $VERSION is not available for $os-$arch" ;;
+esac
+
+tmp="$(mktemp -d)"
+trap 'rm -rf "$tmp"' EXIT INT TERM
+
+echo "Downloading $COMMAND $VERSION for $os-$arch..."
+if command -v curl >/dev/null 2>&1; then
+	curl -fsSL -H "Authorization: Bearer $VIBING_TOKEN" -o "$tmp/asset" "$url" || fail "download failed"
+elif command -v wget >/dev/null 2>&1; then
+	wget -q --header="Authorization: Bearer $VIBING_TOKEN" -O "$tmp/asset" "$url" || fail "download failed"
+else
+	fail "curl or wget is required"
+fi
+
+if command -v sha256sum >/dev/null 2>&1; then
+	actual="$(sha256sum "$tmp/asset" | cut -d ' ' -f 1)"
+else
+	actual="$(shasum -a 256 "$tmp/asset" | cut -d ' ' -f 1)"
+fi
+[ "$actual" = "$sha256" ] || fail "checksum mismatch: expected $sha256, got $actual"
+
+case "$format" in
+	tar.gz)
+		mkdir "$tmp/unpacked"
+		tar -xzf "$tmp/asset" -C "$tmp/unpacked"
+		src="$tmp/unpacked/$binary"
+		;;
+	zip)
+		command -v unzip >/dev/null 2>&1 || fail "unzip is required"
+		mkdir "$tmp/unpacked"
+		unzip -q "$tmp/asset" -d "$tmp/unpacked"
+		src="$tmp/unpacked/$binary"
+		;;
+	*)
+		src="$tmp/asset"
+		;;
+esac
+
+mkdir -p "$INSTALL_DIR"
+cp "$src" "$INSTALL_DIR/$COMMAND"
+chmod 755 "$INSTALL_DIR/$COMMAND"
+echo "Installed $COMMAND $VERSION to $INSTALL_DIR/$COMMAND"
+
+case ":$PATH:" in
+	*":$INSTALL_DIR:"*) ;;
+	*) echo "Add $INSTALL_DIR to your PATH to run $COMMAND" ;;
+esac
+`))
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalStore is an ObjectStore on the local filesystem, intended for development and tests.
+// Presigned URLs point at the backend's /api/storage endpoint and are HMAC-signed.
+type LocalStore struct {
+	root       string
+	baseURL    string
+	signingKey []byte
+}
+
+// localObject couples a range-limited reader with the underlying file
+type localObject struct {
+	io.Reader
+	file *os.File
+}
+
+func (o *localObject) Close() error {
+	return o.file.Close()
+}
+
+// NewLocalStore creates a local store rooted at dir
+func NewLocalStore(dir, baseURL string, signingKey []byte) (*LocalStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("local storage path is required")
+	}
+
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create local storage directory: %v", err)
+	}
+
+	return &LocalStore{
+		root:       root,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		signingKey: signingKey,
+	}, nil
+}
+
+// Path returns the filesystem path for a key, confined to the storage root
+func (s *LocalStore) Path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+// Put writes an object atomically through a temporary file
+func (s *LocalStore) Put(key string, body io.Reader, size int64, contentType string) error {
+	target := s.Path(key)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
+
+// Get opens an object, optionally limited to a "bytes=start-end" range
+func (s *LocalStore) Get(key, byteRange string) (*Object, error) {
+	info, err := s.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(s.Path(key))
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := int64(0), info.Size-1
+	if byteRange != "" {
+		if _, err := fmt.Sscanf(byteRange, "bytes=%d-%d", &start, &end); err != nil || start < 0 || end < start {
+			file.Close()
+			return nil, fmt.Errorf("invalid byte range: %s", byteRange)
+		}
+		if end > info.Size-1 {
+			end = info.Size - 1
+		}
+	}
+
+	length := end - start + 1
+	return &Object{
+		ObjectInfo: *info,
+		Body: &localObject{
+			Reader: io.NewSectionReader(file, start, length),
+			file:   file,
+		},
+		ContentLength: length,
+	}, nil
+}
+
+// Presign returns a signed URL served by the backend's local storage endpoint
+func (s *LocalStore) Presign(key string, expiry time.Duration) (string, error) {
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", s.sign(key, expires))
+
+	escaped := (&url.URL{Path: key}).EscapedPath()
+	return fmt.Sprintf("%s/api/storage/%s?%s", s.baseURL, escaped, query.Encode()), nil
+}
+
+// KeyFromURL extracts the key from a URL issued by Presign
+func (s *LocalStore) KeyFromURL(rawURL string) string {
+	prefix := s.baseURL + "/api/storage/"
+	if !strings.HasPrefix(rawURL, prefix) {
+		return ""
+	}
+
+	escaped := strings.TrimPrefix(rawURL, prefix)
+	if i := strings.IndexByte(escaped, '?'); i >= 0 {
+		escaped = escaped[:i]
+	}
+	key, err := url.PathUnescape(escaped)
+	if err != nil {
+		return ""
+	}
+	return key
+}
+
+// VerifyPresigned checks a signature produced by Presign
+func (s *LocalStore) VerifyPresigned(key, expires, signature string) bool {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(s.sign(key, expires)))
+}
+
+// Delete removes an object; missing objects are not an error
+func (s *LocalStore) Delete(key string) error {
+	if err := os.Remove(s.Path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Stat returns object metadata
+func (s *LocalStore) Stat(key string) (*ObjectInfo, error) {
+	info, err := os.Stat(s.Path(key))
+	if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.objectInfo(key, info), nil
+}
+
+// List returns all objects whose key starts with prefix
+func (s *LocalStore) List(prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(s.root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, *s.objectInfo(key, info))
+		return nil
+	})
+	return objects, err
+}
+
+func (s *LocalStore) objectInfo(key string, info fs.FileInfo) *ObjectInfo {
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  contentType,
+		LastModified: info.ModTime(),
+	}
+}
+
+func (s *LocalStore) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+	"vibing-backend/config"
+	"vibing-backend/database"
+)
+
+// PublicImageFolder holds product images, which are served without signatures by the media endpoint
+const PublicImageFolder = "images"
+
+var mediaBaseURL string
+
+// SetMediaBaseURL configures the base of stable image URLs
+func SetMediaBaseURL(cfg *config.StorageConfig) {
+	base := cfg.MediaURL
+	if base == "" {
+		base = strings.TrimRight(cfg.PublicURL, "/") + "/api/media"
+	}
+	mediaBaseURL = strings.TrimRight(base, "/")
+}
+
+// IsPublicMediaKey reports whether a key may be served by the public media endpoint
+func IsPublicMediaKey(key string) bool {
+	return strings.HasPrefix(key, PublicImageFolder+"/") || strings.HasPrefix(key, PublicCastFolder+"/")
+}
+
+// MediaURL returns the stable public URL of a media key. Keys without an extension,
+// such as images/{id}/card, are resolved by the media endpoint to the best variant.
+func MediaURL(key string) string {
+	return mediaBaseURL + "/" + key
+}
+
+// MediaKeyFromURL extracts the key from a URL returned by MediaURL
+func MediaKeyFromURL(rawURL string) string {
+	if mediaBaseURL == "" || !strings.HasPrefix(rawURL, mediaBaseURL+"/") {
+		return ""
+	}
+	key := strings.TrimPrefix(rawURL, mediaBaseURL+"/")
+	if i := strings.IndexAny(key, "?#"); i >= 0 {
+		key = key[:i]
+	}
+	return key
+}
+
+// StoredImage is an uploaded image saved as one object per variant under {folder}/{id}/
+type StoredImage struct {
+	ID     string
+	Prefix string
+	// Key is the object key of the original
+	Key    string
+	Width  int
+	Height int
+	// Variants maps variant file names such as "card.webp" to object keys
+	Variants map[string]string
+}
+
+// URL returns the stable URL of a named variant, e.g. "card" or "original"
+func (s *StoredImage) URL(name string) string {
+	return MediaURL(s.Prefix + "/" + name)
+}
+
+// StoreImage validates and processes an uploaded image and stores its variants under a
+// fresh UUID, so concurrent uploads can never overwrite each other
+func StoreImage(store ObjectStore, file *multipart.FileHeader, folder string, renditions []ImageRendition, webp WebPEncoder) (*StoredImage, error) {
+	if file.Size > MaxImageSize {
+		return nil, &ImageError{Code: "IMAGE_TOO_LARGE", Message: "image size exceeds 20MB limit"}
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, MaxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	processed, err := ProcessImage(data, renditions, webp)
+	if err != nil {
+		return nil, err
+	}
+
+	id := uuid.New().String()
+	stored := &StoredImage{
+		ID:       id,
+		Prefix:   fmt.Sprintf("%s/%s", folder, id),
+		Width:    processed.Width,
+		Height:   processed.Height,
+		Variants: make(map[string]string, len(processed.Variants)),
+	}
+
+	for _, variant := range processed.Variants {
+		key := fmt.Sprintf("%s/%s%s", stored.Prefix, variant.Name, variant.Ext)
+		if err := store.Put(key, bytes.NewReader(variant.Data), int64(len(variant.Data)), variant.ContentType); err != nil {
+			for _, written := range stored.Variants {
+				store.Delete(written)
+			}
+			return nil, err
+		}
+		stored.Variants[variant.Name+variant.Ext] = key
+		if variant.Name == "original" {
+			stored.Key = key
+		}
+	}
+
+	return stored, nil
+}
+
+// ResolveMediaKey finds the object to serve for a media key. Keys with an extension are
+// served as is; for extensionless variant keys the WebP rendition is preferred when the
+// client accepts it, then JPEG/PNG, then the original (e.g. for WebP uploads, which have
+// no renditions).
+func ResolveMediaKey(store ObjectStore, key string, acceptWebP bool) (string, *ObjectInfo, error) {
+	if path.Ext(key) != "" {
+		info, err := store.Stat(key)
+		return key, info, err
+	}
+
+	dir, name := path.Split(key)
+	var candidates []string
+	if acceptWebP {
+		candidates = append(candidates, key+".webp")
+	}
+	candidates = append(candidates, key+".jpg", key+".png")
+	if name != "original" {
+		for _, ext := range []string{".jpg", ".png", ".gif", ".webp"} {
+			candidates = append(candidates, dir+"original"+ext)
+		}
+	} else {
+		candidates = append(candidates, key+".gif", key+".webp")
+	}
+
+	for _, candidate := range candidates {
+		info, err := store.Stat(candidate)
+		if err == nil {
+			return candidate, info, nil
+		}
+		if err != ErrObjectNotFound {
+			return "", nil, err
+		}
+	}
+	return "", nil, ErrObjectNotFound
+}
+
+// StableImageURL rewrites a presigned or direct storage URL of a public product image
+// to its stable media URL. Other URLs, such as external images, are returned unchanged.
+func StableImageURL(store ObjectStore, rawURL string) string {
+	if rawURL == "" || store == nil || MediaKeyFromURL(rawURL) != "" {
+		return rawURL
+	}
+
+	key := store.KeyFromURL(rawURL)
+	if !strings.HasPrefix(key, PublicImageFolder+"/") {
+		return rawURL
+	}
+	if _, err := store.Stat(key); err != nil {
+		return rawURL
+	}
+	return MediaURL(key)
+}
+
+// MigrateLegacyImageURLs rewrites product image URLs saved as expiring presigned URLs
+func MigrateLegacyImageURLs(store ObjectStore) error {
+	if store == nil || mediaBaseURL == "" {
+		return nil
+	}
+
+	var rows []struct {
+		ID       string
+		ImageURL string
+	}
+	if err := database.DB.Table("products").
+		Select("id, image_url").
+		Where("image_url <> '' AND image_url NOT LIKE ?", mediaBaseURL+"/%").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	migrated := 0
+	for _, row := range rows {
+		stable := StableImageURL(store, row.ImageURL)
+		if stable == row.ImageURL {
+			continue
+		}
+		if err := database.DB.Table("products").Where("id = ?", row.ID).
+			Update("image_url", stable).Error; err != nil {
+			return err
+		}
+		migrated++
+	}
+
+	if migrated > 0 {
+		log.Printf("Rewrote %d product image URLs to stable media URLs", migrated)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"vibing-backend/database"
+	"vibing-backend/models"
+)
+
+// NpmScope is the scope purchased packages are published under, e.g. @vibing/ui-kit
+const NpmScope = "@vibing"
+
+// npmTarballTime is the modification time npm itself stamps on packed files
+var npmTarballTime = time.Date(1985, time.October, 26, 8, 15, 0, 0, time.UTC)
+
+var npmNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._~-]*$`)
+
+// NpmPackage is the npm package found in a product archive
+type NpmPackage struct {
+	// Name is the scoped name the package is served under
+	Name string
+	// Dir is the folder of package.json inside the archive, "" for the archive root
+	Dir string
+	// Manifest is package.json with its name and version rewritten for the registry
+	Manifest []byte
+}
+
+// NpmTarball describes a packed release stored for the registry
+type NpmTarball struct {
+	Size int64
+	// Shasum and Integrity are the SHA-1 and SHA-512 digests npm verifies
+	Shasum    string
+	Integrity string
+}
+
+// FindNpmPackage returns the package declared by the package.json at the archive root
+// or in its single top-level folder, or nil if the archive isn't an npm package. The
+// package is served as @vibing/<name>, whatever scope it was written with.
+func FindNpmPackage(inspection *ArchiveInspection, version string) *NpmPackage {
+	var found *NpmPackage
+	for _, manifest := range inspection.Manifests {
+		if path.Base(manifest.Path) != "package.json" || strings.Count(manifest.Path, "/") > 1 {
+			continue
+		}
+		dir := path.Dir(manifest.Path)
+		if dir == "." {
+			dir = ""
+		}
+		if found != nil && len(dir) >= len(found.Dir) {
+			continue
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(manifest.Content, &fields); err != nil {
+			continue
+		}
+		var name string
+		if err := json.Unmarshal(fields["name"], &name); err != nil {
+			continue
+		}
+		if i := strings.Index(name, "/"); strings.HasPrefix(name, "@") && i > 0 {
+			name = name[i+1:]
+		}
+		name = strings.ToLower(name)
+		if !npmNamePattern.MatchString(name) || len(name) > 200 {
+			continue
+		}
+
+		scoped := NpmScope + "/" + name
+		rewritten, err := rewritePackageJSON(fields, scoped, version)
+		if err != nil {
+			continue
+		}
+		found = &NpmPackage{Name: scoped, Dir: dir, Manifest: rewritten}
+	}
+	return found
+}
+
+func rewritePackageJSON(fields map[string]json.RawMessage, name, version string) ([]byte, error) {
+	nameJSON, _ := json.Marshal(name)
+	versionJSON, _ := json.Marshal(version)
+	fields["name"] = nameJSON
+	fields["version"] = versionJSON
+	// Buyers install the package, so it can't stay marked unpublishable
+	delete(fields, "private")
+	delete(fields, "publishConfig")
+	return json.MarshalIndent(fields, "", "  ")
+}
+
+// NpmTarballName is the file name npm expects for a version, e.g. ui-kit-1.2.0.tgz
+func NpmTarballName(scopedName, version string) string {
+	return path.Base(scopedName) + "-" + version + ".tgz"
+}
+
+// BuildNpmTarball packs the package folder of the archive at sourceKey into an npm
+// tarball stored under key. The packed package.json is the rewritten manifest, and
+// fixed timestamps make the tarball, and so its integrity, reproducible.
+func BuildNpmTarball(store ObjectStore, sourceKey, key string, pkg *NpmPackage) (*NpmTarball, error) {
+	object, err := store.Get(sourceKey, "")
+	if err != nil {
+		return nil, err
+	}
+	defer object.Body.Close()
+
+	tmp, err := os.CreateTemp("", "npm-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, object.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	sha1Hash, sha512Hash := sha1.New(), sha512.New()
+	counter := &countingWriter{}
+	done := make(chan error, 1)
+	go func() {
+		err := writeNpmTarball(tmp, size, io.MultiWriter(writer, sha1Hash, sha512Hash, counter), pkg)
+		writer.CloseWithError(err)
+		done <- err
+	}()
+
+	if err := store.Put(key, reader, -1, "application/octet-stream"); err != nil {
+		reader.CloseWithError(err)
+		<-done
+		return nil, err
+	}
+	if err := <-done; err != nil {
+		store.Delete(key)
+		return nil, err
+	}
+
+	return &NpmTarball{
+		Size:      counter.n,
+		Shasum:    hex.EncodeToString(sha1Hash.Sum(nil)),
+		Integrity: "sha512-" + base64.StdEncoding.EncodeToString(sha512Hash.Sum(nil)),
+	}, nil
+}
+
+// PackNpmRelease packs the npm package of a release into its tarball and stores the
+// tarball's key and digests on the release
+func PackNpmRelease(store ObjectStore, release *models.ProductRelease) error {
+	pkg := &NpmPackage{
+		Name:     release.NpmPackage,
+		Dir:      release.NpmPackageDir,
+		Manifest: []byte(release.NpmManifest),
+	}
+	key := fmt.Sprintf("npm/%s/%s", release.ProductID, NpmTarballName(release.NpmPackage, release.Version))
+	tarball, err := BuildNpmTarball(store, release.ObjectKey, key, pkg)
+	if err != nil {
+		return err
+	}
+
+	release.NpmTarballKey = key
+	release.NpmTarballSize = tarball.Size
+	release.NpmShasum = tarball.Shasum
+	release.NpmIntegrity = tarball.Integrity
+	return database.DB.Model(release).Select("npm_tarball_key", "npm_tarball_size", "npm_shasum", "npm_integrity").
+		Updates(release).Error
+}
+
+func writeNpmTarball(src io.ReaderAt, size int64, dst io.Writer, pkg *NpmPackage) error {
+	archive, err := zip.NewReader(src, size)
+	if err != nil {
+		return archiveError("INVALID_ARCHIVE", "File is not a valid ZIP archive")
+	}
+
+	root := ""
+	if pkg.Dir != "" {
+		root = pkg.Dir + "/"
+	}
+
+	buffered := bufio.NewWriterSize(dst, 256*1024)
+	gz := gzip.NewWriter(buffered)
+	tw := tar.NewWriter(gz)
+
+	writeEntry := func(name string, mode int64, size int64, body io.Reader) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     "package/" + name,
+			Mode:     mode,
+			Size:     size,
+			ModTime:  npmTarballTime,
+			Typeflag: tar.TypeReg,
+			Format:   tar.FormatPAX,
+		}); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, body)
+		return err
+	}
+
+	if err := writeEntry("package.json", 0644, int64(len(pkg.Manifest)), bytes.NewReader(pkg.Manifest)); err != nil {
+		return err
+	}
+
+	for _, file := range archive.File {
+		name := path.Clean(strings.TrimPrefix(file.Name, "./"))
+		if !strings.HasPrefix(name, root) || !file.Mode().IsRegular() || strings.HasSuffix(file.Name, "/") {
+			continue
+		}
+		name = strings.TrimPrefix(name, root)
+		if name == "package.json" || npmIgnored(name) {
+			continue
+		}
+
+		mode := int64(0644)
+		if file.Mode()&0111 != 0 {
+			mode = 0755
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = writeEntry(name, mode, int64(file.UncompressedSize64), rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// npmIgnored matches the files npm pack always leaves out
+func npmIgnored(name string) bool {
+	for _, element := range strings.Split(name, "/") {
+		switch element {
+		case "node_modules", ".git", ".svn", ".hg", "CVS", ".DS_Store", ".npmrc":
+			return true
+		}
+	}
+	switch path.Base(name) {
+	case "package-lock.json", "npm-debug.log":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"vibing-backend/database"
+	"vibing-backend/models"
+)
+
+// OrphanPrefixes are the storage prefixes reconciled against the database
+var OrphanPrefixes = []string{"images/", "chat-images/", "products/", "uploads/", "casts/", "sboms/", "builds/", "npm/", "assets/", "deltas/"}
+
+const (
+	// OrphanGracePeriod protects fresh uploads that aren't referenced yet, and is also
+	// how long an orphan stays marked before it is deleted
+	OrphanGracePeriod = 24 * time.Hour
+	// orphanSweepInterval is how often the scheduler reconciles storage
+	orphanSweepInterval = 6 * time.Hour
+	// maxReportedOrphans caps the object list in a report; the counts are always complete
+	maxReportedOrphans = 500
+)
+
+// OrphanPrefixStats are the reconciliation metrics of one storage prefix
+type OrphanPrefixStats struct {
+	Prefix        string `json:"prefix"`
+	Objects       int    `json:"objects"`
+	Bytes         int64  `json:"bytes"`
+	Referenced    int    `json:"referenced"`
+	Recent        int    `json:"recent"`
+	Orphaned      int    `json:"orphaned"`
+	OrphanedBytes int64  `json:"orphanedBytes"`
+	Marked        int    `json:"marked"`
+	Deleted       int    `json:"deleted"`
+	DeletedBytes  int64  `json:"deletedBytes"`
+	Errors        int    `json:"errors"`
+}
+
+// OrphanCandidate is an unreferenced object in a report
+type OrphanCandidate struct {
+	Key          string     `json:"key"`
+	Size         int64      `json:"size"`
+	LastModified time.Time  `json:"lastModified"`
+	MarkedAt     *time.Time `json:"markedAt"`
+	DeletableAt  time.Time  `json:"deletableAt"`
+}
+
+// OrphanReport is the result of a reconciliation run
+type OrphanReport struct {
+	DryRun     bool                `json:"dryRun"`
+	StartedAt  time.Time           `json:"startedAt"`
+	FinishedAt time.Time           `json:"finishedAt"`
+	Prefixes   []OrphanPrefixStats `json:"prefixes"`
+	Orphans    []OrphanCandidate   `json:"orphans"`
+	Truncated  bool                `json:"truncated"`
+}
+
+var (
+	orphanMutex      sync.Mutex
+	lastOrphanReport *OrphanReport
+)
+
+// LastOrphanReport returns the report of the last scheduled reconciliation, or nil
+func LastOrphanReport() *OrphanReport {
+	orphanMutex.Lock()
+	defer orphanMutex.Unlock()
+	return lastOrphanReport
+}
+
+// processOrphanedObjects runs the storage reconciliation every orphanSweepInterval
+func (s *SchedulerService) processOrphanedObjects() {
+	if defaultStore == nil {
+		return
+	}
+	if last := LastOrphanReport(); last != nil && time.Since(last.StartedAt) < orphanSweepInterval {
+		return
+	}
+
+	report, err := ReconcileObjects(defaultStore, false)
+	if err != nil {
+		log.Printf("Error reconciling stored objects: %v", err)
+		return
+	}
+
+	for _, stats := range report.Prefixes {
+		if stats.Marked > 0 || stats.Deleted > 0 || stats.Errors > 0 {
+			log.Printf("Orphaned objects under %s: %d objects, %d orphaned, %d newly marked, %d deleted (%d bytes), %d errors",
+				stats.Prefix, stats.Objects, stats.Orphaned, stats.Marked, stats.Deleted, stats.DeletedBytes, stats.Errors)
+		}
+	}
+}
+
+// ReconcileObjects lists every object under OrphanPrefixes and cross-references the
+// database. Unreferenced objects older than the grace period are marked; objects that
+// stay unreferenced for another grace period after being marked are deleted. A dry run
+// only reports what would happen.
+func ReconcileObjects(store ObjectStore, dryRun bool) (*OrphanReport, error) {
+	report := &OrphanReport{DryRun: dryRun, StartedAt: time.Now()}
+
+	refs, err := loadObjectReferences(database.DB, store)
+	if err != nil {
+		return nil, err
+	}
+
+	var marks []models.OrphanedObject
+	if err := database.DB.Where("purged_at IS NULL").Find(&marks).Error; err != nil {
+		return nil, err
+	}
+	marked := make(map[string]*models.OrphanedObject, len(marks))
+	for i := range marks {
+		marked[marks[i].ObjectKey] = &marks[i]
+	}
+
+	cutoff := report.StartedAt.Add(-OrphanGracePeriod)
+	for _, prefix := range OrphanPrefixes {
+		stats := OrphanPrefixStats{Prefix: prefix}
+
+		objects, err := store.List(prefix)
+		if err != nil {
+			log.Printf("Error listing objects under %s: %v", prefix, err)
+			stats.Errors++
+			report.Prefixes = append(report.Prefixes, stats)
+			continue
+		}
+
+		for _, object := range objects {
+			stats.Objects++
+			stats.Bytes += object.Size
+			mark := marked[object.Key]
+
+			if refs.contains(object.Key) {
+				stats.Referenced++
+				if mark != nil && !dryRun {
+					// Referenced again, e.g. a chat image sent late; forget the mark
+					database.DB.Delete(mark)
+				}
+				continue
+			}
+			if object.LastModified.After(cutoff) {
+				stats.Recent++
+				continue
+			}
+
+			stats.Orphaned++
+			stats.OrphanedBytes += object.Size
+
+			candidate := OrphanCandidate{
+				Key:          object.Key,
+				Size:         object.Size,
+				LastModified: object.LastModified,
+				DeletableAt:  report.StartedAt.Add(OrphanGracePeriod),
+			}
+			if mark != nil {
+				markedAt := mark.DetectedAt
+				candidate.MarkedAt = &markedAt
+				candidate.DeletableAt = markedAt.Add(OrphanGracePeriod)
+			}
+			if len(report.Orphans) < maxReportedOrphans {
+				report.Orphans = append(report.Orphans, candidate)
+			} else {
+				report.Truncated = true
+			}
+
+			if dryRun {
+				continue
+			}
+
+			if mark == nil {
+				if err := markOrphan(database.DB, prefix, object); err != nil {
+					log.Printf("Error marking orphaned object %s: %v", object.Key, err)
+					stats.Errors++
+					continue
+				}
+				stats.Marked++
+				continue
+			}
+
+			if candidate.DeletableAt.After(report.StartedAt) {
+				continue
+			}
+			if err := store.Delete(object.Key); err != nil {
+				log.Printf("Error deleting orphaned object %s: %v", object.Key, err)
+				stats.Errors++
+				continue
+			}
+			database.DB.Model(mark).Update("purged_at", time.Now())
+			stats.Deleted++
+			stats.DeletedBytes += object.Size
+		}
+
+		report.Prefixes = append(report.Prefixes, stats)
+	}
+
+	report.FinishedAt = time.Now()
+	if !dryRun {
+		orphanMutex.Lock()
+		lastOrphanReport = report
+		orphanMutex.Unlock()
+	}
+	return report, nil
+}
+
+func markOrphan(db *gorm.DB, prefix string, object ObjectInfo) error {
+	orphan := models.OrphanedObject{
+		ObjectKey:  object.Key,
+		Prefix:     prefix,
+		Size:       object.Size,
+		DetectedAt: time.Now(),
+	}
+	// A purged mark for a key that was uploaded again is restarted
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "object_key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"size":        object.Size,
+			"detected_at": orphan.DetectedAt,
+			"purged_at":   nil,
+			"updated_at":  time.Now(),
+		}),
+	}).Create(&orphan).Error
+}
+
+// objectReferences is the set of object keys the database still points at
+type objectReferences struct {
+	keys map[string]bool
+	// dirs are folders whose objects are all referenced, e.g. the variants of an image
+	dirs map[string]bool
+}
+
+func (r *objectReferences) contains(key string) bool {
+	return r.keys[key] || r.dirs[path.Dir(key)+"/"]
+}
+
+func (r *objectReferences) addKey(key string) {
+	if key == "" {
+		return
+	}
+	r.keys[key] = true
+}
+
+// addURL records the object behind a stored media, presigned or storage URL. Media
+// URLs of processed images reference every variant in the image's folder.
+func (r *objectReferences) addURL(store ObjectStore, rawURL string) {
+	if rawURL == "" {
+		return
+	}
+
+	key := MediaKeyFromURL(rawURL)
+	if key == "" {
+		key = store.KeyFromURL(rawURL)
+	}
+	if key == "" {
+		return
+	}
+
+	r.addKey(key)
+	if strings.Count(key, "/") >= 2 {
+		r.dirs[path.Dir(key)+"/"] = true
+	}
+}
+
+func loadObjectReferences(db *gorm.DB, store ObjectStore) (*objectReferences, error) {
+	refs := &objectReferences{keys: make(map[string]bool), dirs: make(map[string]bool)}
+
+	pluck := func(query *gorm.DB, column string) ([]string, error) {
+		var values []string
+		err := query.Where(column+" IS NOT NULL AND "+column+" <> ''").Pluck(column, &values).Error
+		return values, err
+	}
+
+	// Images of deleted products are still shown in buyers' purchase history
+	imageURLs, err := pluck(db.Model(&models.Product{}), "image_url")
+	if err != nil {
+		return nil, err
+	}
+	for _, url := range imageURLs {
+		refs.addURL(store, url)
+	}
+
+	var media []models.ProductMedia
+	if err := db.Select("url, thumbnail_url, storage_key").Find(&media).Error; err != nil {
+		return nil, err
+	}
+	for _, item := range media {
+		refs.addURL(store, item.URL)
+		if strings.HasSuffix(item.StorageKey, "/") {
+			refs.dirs[item.StorageKey] = true
+		} else {
+			refs.addKey(item.StorageKey)
+		}
+	}
+
+	// Messages sent before image keys were recorded only have the URL
+	chatImageURLs, err := pluck(db.Model(&models.ChatMessage{}).Where("image_key IS NULL"), "image_url")
+	if err != nil {
+		return nil, err
+	}
+	for _, url := range chatImageURLs {
+		refs.addURL(store, url)
+	}
+
+	keyQueries := []struct {
+		query  *gorm.DB
+		column string
+	}{
+		{db.Model(&models.Product{}), "file_key"},
+		{db.Model(&models.ChatMessage{}), "image_key"},
+		{db.Model(&models.ProductRelease{}), "object_key"},
+		{db.Model(&models.ProductRelease{}), "sbom_key"},
+		{db.Model(&models.ProductRelease{}), "npm_tarball_key"},
+		{db.Model(&models.ReleaseAsset{}), "object_key"},
+		{db.Model(&models.ReleaseDelta{}).Where("status = ?", "ready"), "object_key"},
+		// Purged builds are rebuilt on the next download
+		{db.Model(&models.PersonalizedBuild{}).Where("purged_at IS NULL"), "object_key"},
+		{db.Model(&models.UploadSession{}).Where("status IN ?", []string{"initiated", "verifying"}), "object_key"},
+		{db.Model(&models.DownloadToken{}).Where("consumed_at IS NULL AND expires_at > ?", time.Now()), "object_key"},
+		// Retired product files are purged by the retention job
+		{db.Model(&models.FileRetention{}).Where("purged_at IS NULL"), "object_key"},
+		// Infected files are kept for review
+		{db.Model(&models.ScannedAsset{}).Where("status = ?", "infected"), "object_key"},
+	}
+	for _, q := range keyQueries {
+		keys, err := pluck(q.query, q.column)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			refs.addKey(key)
+		}
+	}
+
+	return refs, nil
+}
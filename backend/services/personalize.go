@@ -0,0 +1,286 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"vibing-backend/database"
+	"vibing-backend/models"
+)
+
+// LicenseFileName is the license certificate added to personalized builds
+const LicenseFileName = "LICENSE.vibing"
+
+// maxZipComment is the longest comment the ZIP end of central directory can hold
+const maxZipComment = 65535
+
+var fingerprintPattern = regexp.MustCompile(`VBF-[0-9a-f]{24}`)
+
+// BuildLicense is the purchaser information embedded in a personalized build
+type BuildLicense struct {
+	ProductTitle string
+	Version      string
+	Seller       string
+	LicenseType  string
+	Buyer        string
+	OrderID      string
+	LicenseKey   string
+	Fingerprint  string
+	PurchasedAt  time.Time
+	// IssuedAt is also the modification time of the license entry, so rebuilding
+	// with the same license produces the same bytes
+	IssuedAt time.Time
+	// Watermark also names the purchaser in the archive comment
+	Watermark bool
+}
+
+// BuiltArchive describes a stored personalized build
+type BuiltArchive struct {
+	Size   int64
+	SHA256 string
+}
+
+// BuildPersonalizedArchive streams the archive at sourceKey into key with a generated
+// license file added. Entries are copied without recompression, and the result is
+// uploaded while it is written, so neither archive is ever held in memory.
+func BuildPersonalizedArchive(store ObjectStore, sourceKey, key string, license *BuildLicense) (*BuiltArchive, error) {
+	object, err := store.Get(sourceKey, "")
+	if err != nil {
+		return nil, err
+	}
+	defer object.Body.Close()
+
+	// The central directory is at the end of the archive, so it needs random access
+	tmp, err := os.CreateTemp("", "build-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, object.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	hash := sha256.New()
+	counter := &countingWriter{}
+	done := make(chan error, 1)
+	go func() {
+		err := PersonalizeArchive(tmp, size, io.MultiWriter(writer, hash, counter), license)
+		writer.CloseWithError(err)
+		done <- err
+	}()
+
+	if err := store.Put(key, reader, -1, "application/zip"); err != nil {
+		reader.CloseWithError(err)
+		<-done
+		return nil, err
+	}
+	if err := <-done; err != nil {
+		store.Delete(key)
+		return nil, err
+	}
+
+	return &BuiltArchive{Size: counter.n, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// PersonalizeArchive copies every entry of a ZIP archive to dst and adds the license
+// file next to the archive's top-level folder. An existing license file is replaced.
+func PersonalizeArchive(src io.ReaderAt, size int64, dst io.Writer, license *BuildLicense) error {
+	archive, err := zip.NewReader(src, size)
+	if err != nil {
+		return archiveError("INVALID_ARCHIVE", "File is not a valid ZIP archive")
+	}
+
+	licensePath := path.Join(archiveRoot(archive.File), LicenseFileName)
+
+	buffered := bufio.NewWriterSize(dst, 256*1024)
+	out := zip.NewWriter(buffered)
+	for _, file := range archive.File {
+		if strings.EqualFold(path.Clean(file.Name), licensePath) {
+			continue
+		}
+		if err := out.Copy(file); err != nil {
+			return err
+		}
+	}
+
+	header := &zip.FileHeader{
+		Name:     licensePath,
+		Method:   zip.Deflate,
+		Modified: license.IssuedAt.UTC(),
+	}
+	header.SetMode(0644)
+	entry, err := out.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if _, err := entry.Write(renderLicenseFile(license)); err != nil {
+		return err
+	}
+
+	if license.Watermark {
+		if err := out.SetComment(watermarkComment(license, archive.Comment)); err != nil {
+			return err
+		}
+	} else if archive.Comment != "" {
+		if err := out.SetComment(archive.Comment); err != nil {
+			return err
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// ReadBuildFingerprint finds the fingerprint of a personalized build in its archive
+// comment or license file, or returns "" if the archive doesn't carry one
+func ReadBuildFingerprint(r io.ReaderAt, size int64) (string, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return "", archiveError("INVALID_ARCHIVE", "File is not a valid ZIP archive")
+	}
+
+	if fingerprint := fingerprintPattern.FindString(archive.Comment); fingerprint != "" {
+		return fingerprint, nil
+	}
+
+	for _, file := range archive.File {
+		if !strings.EqualFold(path.Base(file.Name), LicenseFileName) || file.UncompressedSize64 > 64*1024 {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			continue
+		}
+		content, err := io.ReadAll(io.LimitReader(rc, 64*1024))
+		rc.Close()
+		if err != nil {
+			continue
+		}
+		if fingerprint := fingerprintPattern.FindString(string(content)); fingerprint != "" {
+			return fingerprint, nil
+		}
+	}
+
+	return "", nil
+}
+
+// archiveRoot returns the folder that contains every entry, or "" when files sit at the top level
+func archiveRoot(files []*zip.File) string {
+	root := ""
+	for _, file := range files {
+		name := strings.TrimPrefix(file.Name, "./")
+		slash := strings.Index(name, "/")
+		if slash <= 0 {
+			return ""
+		}
+		dir := name[:slash]
+		if root == "" {
+			root = dir
+		} else if dir != root {
+			return ""
+		}
+	}
+	return root
+}
+
+func renderLicenseFile(license *BuildLicense) []byte {
+	var b bytes.Buffer
+
+	field := func(label, value string) {
+		if value == "" {
+			value = "-"
+		}
+		fmt.Fprintf(&b, "%-14s%s\n", label+":", value)
+	}
+
+	b.WriteString("Vibing License Certificate\n")
+	b.WriteString("==========================\n\n")
+	field("Product", license.ProductTitle)
+	field("Version", license.Version)
+	field("Seller", license.Seller)
+	field("License", license.LicenseType)
+	field("Licensed to", license.Buyer)
+	field("Order ID", license.OrderID)
+	field("License key", license.LicenseKey)
+	field("Purchased", license.PurchasedAt.UTC().Format("2006-01-02"))
+	field("Issued", license.IssuedAt.UTC().Format(time.RFC3339))
+	field("Fingerprint", license.Fingerprint)
+	b.WriteString("\nThis copy was built for the purchaser named above and is licensed to them\n")
+	b.WriteString("under the terms of the product license. It carries a fingerprint that\n")
+	b.WriteString("identifies the purchase, so redistributed copies can be traced.\n")
+
+	return b.Bytes()
+}
+
+// watermarkComment names the purchaser, keeping the original comment if it still fits
+func watermarkComment(license *BuildLicense, original string) string {
+	comment := fmt.Sprintf("Licensed to %s (order %s) via Vibing. Fingerprint %s",
+		license.Buyer, license.OrderID, license.Fingerprint)
+	if original != "" && len(comment)+2+len(original) <= maxZipComment {
+		comment += "\n\n" + original
+	}
+	if len(comment) > maxZipComment {
+		comment = comment[:maxZipComment]
+	}
+	return comment
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// processPersonalizedBuilds deletes cached buyer builds that haven't been downloaded
+// for PersonalizedBuildIdleTTL. The build records, and with them the fingerprints,
+// are kept; a later download rebuilds the archive.
+func (s *SchedulerService) processPersonalizedBuilds() {
+	if defaultStore == nil {
+		return
+	}
+
+	var builds []models.PersonalizedBuild
+	if err := database.DB.Where("purged_at IS NULL AND built_at IS NOT NULL AND last_used_at < ?",
+		time.Now().Add(-models.PersonalizedBuildIdleTTL)).Find(&builds).Error; err != nil {
+		log.Printf("Error finding idle personalized builds: %v", err)
+		return
+	}
+
+	purged := 0
+	for _, build := range builds {
+		if err := defaultStore.Delete(build.ObjectKey); err != nil && err != ErrObjectNotFound {
+			log.Printf("Error deleting personalized build %s: %v", build.ObjectKey, err)
+			continue
+		}
+		if err := database.DB.Model(&build).Update("purged_at", time.Now()).Error; err != nil {
+			log.Printf("Error marking personalized build %s as purged: %v", build.ObjectKey, err)
+			continue
+		}
+		purged++
+	}
+
+	if purged > 0 {
+		log.Printf("Purged %d idle personalized builds", purged)
+	}
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"vibing-backend/database"
+	"vibing-backend/models"
+)
+
+const (
+	// MaxRecommendations bounds the stored recommendations of a product
+	MaxRecommendations = 12
+	// recommendationInterval is how often the scheduler recomputes recommendations
+	recommendationInterval = 24 * time.Hour
+	// minCoPurchases is how many customers must have bought both products before one
+	// recommends the other, so a single buyer's library doesn't define the pairs
+	minCoPurchases = 2
+)
+
+// Sources of the "for you" feed
+const (
+	feedSourceHistory = "history"
+	feedSourcePopular = "popular"
+)
+
+// Recommendation is a recommended product with where it came from
+type Recommendation struct {
+	Product models.Product `json:"product"`
+	Source  string         `json:"source"`
+	Score   float64        `json:"score"`
+}
+
+type scoredProduct struct {
+	ID    string
+	Score float64
+}
+
+// coPurchases scores product pairs by the cosine similarity of their buyer sets: the
+// customers who own both over the geometric mean of each product's customers. Only
+// the best MaxRecommendations pairs of a product are returned, ordered by rank.
+const coPurchases = `
+WITH owners AS (
+	SELECT DISTINCT purchases.user_id, purchases.product_id
+	FROM purchases JOIN products ON products.id = purchases.product_id
+	WHERE purchases.status IN @statuses AND purchases.deleted_at IS NULL
+		AND products.status = 'active' AND products.deleted_at IS NULL
+), buyers AS (
+	SELECT product_id, count(*) AS buyers FROM owners GROUP BY product_id
+), pairs AS (
+	SELECT a.product_id, b.product_id AS recommended_id, count(*) AS together
+	FROM owners a JOIN owners b ON b.user_id = a.user_id AND b.product_id <> a.product_id
+	GROUP BY a.product_id, b.product_id
+	HAVING count(*) >= @min
+), ranked AS (
+	SELECT pairs.product_id, pairs.recommended_id,
+		pairs.together / sqrt(ba.buyers::float8 * bb.buyers) AS score,
+		row_number() OVER (PARTITION BY pairs.product_id
+			ORDER BY pairs.together / sqrt(ba.buyers::float8 * bb.buyers) DESC, pairs.together DESC, pairs.recommended_id) AS rank
+	FROM pairs
+	JOIN buyers ba ON ba.product_id = pairs.product_id
+	JOIN buyers bb ON bb.product_id = pairs.recommended_id
+)
+SELECT product_id, recommended_id, score FROM ranked WHERE rank <= @limit ORDER BY product_id, rank`
+
+// processRecommendations recomputes the recommendations every recommendationInterval
+func (s *SchedulerService) processRecommendations() {
+	var last *time.Time
+	if err := database.DB.Model(&models.ProductRecommendation{}).Select("max(updated_at)").Scan(&last).Error; err != nil {
+		log.Printf("Error checking recommendation age: %v", err)
+		return
+	}
+	if last != nil && time.Since(*last) < recommendationInterval {
+		return
+	}
+
+	products, err := RefreshRecommendations(database.DB)
+	if err != nil {
+		log.Printf("Error refreshing recommendations: %v", err)
+		return
+	}
+	log.Printf("Refreshed recommendations of %d products", products)
+}
+
+// RefreshRecommendations replaces the stored recommendations of every active product.
+// Products bought together come first; products sharing tags or the category fill the
+// remaining places. It returns the number of products refreshed.
+func RefreshRecommendations(db *gorm.DB) (int, error) {
+	var pairs []struct {
+		ProductID     string
+		RecommendedID string
+		Score         float64
+	}
+	if err := db.Raw(coPurchases, map[string]interface{}{
+		"statuses": models.OwnedPurchaseStatuses,
+		"min":      minCoPurchases,
+		"limit":    MaxRecommendations,
+	}).Scan(&pairs).Error; err != nil {
+		return 0, err
+	}
+	bought := map[string][]scoredProduct{}
+	for _, pair := range pairs {
+		bought[pair.ProductID] = append(bought[pair.ProductID], scoredProduct{pair.RecommendedID, pair.Score})
+	}
+
+	var products []models.Product
+	if err := db.Select("id", "category", "tags").Where("status = ?", "active").Find(&products).Error; err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	for _, product := range products {
+		var rows []models.ProductRecommendation
+		exclude := []string{product.ID}
+		for _, rec := range bought[product.ID] {
+			rows = append(rows, models.ProductRecommendation{
+				ProductID: product.ID, RecommendedID: rec.ID, Score: rec.Score,
+				Source: models.RecommendationSourcePurchases, Rank: len(rows) + 1, UpdatedAt: now,
+			})
+			exclude = append(exclude, rec.ID)
+		}
+		if len(rows) < MaxRecommendations {
+			similar, err := similarProducts(db, product, exclude, MaxRecommendations-len(rows))
+			if err != nil {
+				return 0, err
+			}
+			for _, rec := range similar {
+				rows = append(rows, models.ProductRecommendation{
+					ProductID: product.ID, RecommendedID: rec.ID, Score: rec.Score,
+					Source: models.RecommendationSourceSimilar, Rank: len(rows) + 1, UpdatedAt: now,
+				})
+			}
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("product_id = ?", product.ID).Delete(&models.ProductRecommendation{}).Error; err != nil {
+				return err
+			}
+			if len(rows) == 0 {
+				return nil
+			}
+			return tx.Create(&rows).Error
+		}); err != nil {
+			return 0, err
+		}
+	}
+
+	// Products that were deactivated since the last run keep no recommendations
+	if err := db.Where("product_id NOT IN (?)",
+		db.Model(&models.Product{}).Select("id").Where("status = ?", "active")).
+		Delete(&models.ProductRecommendation{}).Error; err != nil {
+		return 0, err
+	}
+	return len(products), nil
+}
+
+// similarProducts finds active products sharing tags or the category with product.
+// Half the score is the share of the candidate's tags in common, half is the category.
+func similarProducts(db *gorm.DB, product models.Product, exclude []string, limit int) ([]scoredProduct, error) {
+	tags := tagArray(product.Tags)
+	var similar []scoredProduct
+	err := db.Model(&models.Product{}).
+		Select("products.id, 0.5 * cardinality(ARRAY(SELECT unnest(products.tags) INTERSECT SELECT unnest(?::text[]))) / greatest(cardinality(products.tags), 1)"+
+			" + CASE WHEN products.category = ? THEN 0.5 ELSE 0 END AS score", tags, product.Category).
+		Where("products.status = ?", "active").
+		Where("products.id NOT IN ?", exclude).
+		Where("products.tags && ?::text[] OR products.category = ?", tags, product.Category).
+		Order("score DESC, products.rating DESC, products.downloads DESC, products.id").
+		Limit(limit).
+		Scan(&similar).Error
+	return similar, err
+}
+
+// ProductRecommendations returns up to limit recommendations for product, skipping the
+// products in exclude. Products the scheduler hasn't processed yet, or whose stored
+// recommendations are mostly excluded, are topped up with similar products.
+func ProductRecommendations(db *gorm.DB, product models.Product, exclude []string, limit int) ([]Recommendation, error) {
+	var stored []models.ProductRecommendation
+	if err := db.Where("product_id = ?", product.ID).
+		Preload("Recommended", "status = ?", "active").
+		Order("rank").
+		Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	skip := map[string]bool{product.ID: true}
+	for _, id := range exclude {
+		skip[id] = true
+	}
+	var recs []Recommendation
+	for _, rec := range stored {
+		if len(recs) == limit {
+			return recs, nil
+		}
+		if rec.Recommended.ID == "" || skip[rec.RecommendedID] {
+			continue
+		}
+		recs = append(recs, Recommendation{rec.Recommended, rec.Source, rec.Score})
+		skip[rec.RecommendedID] = true
+	}
+
+	if len(recs) < limit {
+		similar, err := similarProducts(db, product, keys(skip), limit-len(recs))
+		if err != nil {
+			return nil, err
+		}
+		found, err := activeProducts(db, similar)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range similar {
+			if p, ok := found[rec.ID]; ok {
+				recs = append(recs, Recommendation{p, models.RecommendationSourceSimilar, rec.Score})
+			}
+		}
+	}
+	return recs, nil
+}
+
+// RecommendationsFor builds the "for you" feed of a user who owns the products in owned.
+// Products recommended by several owned products add up their scores; popular products
+// the user doesn't own fill the feed when there is little history.
+func RecommendationsFor(db *gorm.DB, owned []string, limit int) ([]Recommendation, error) {
+	var recs []Recommendation
+	skip := map[string]bool{}
+	for _, id := range owned {
+		skip[id] = true
+	}
+
+	if len(owned) > 0 {
+		var scored []scoredProduct
+		if err := db.Model(&models.ProductRecommendation{}).
+			Select("recommended_id AS id, sum(score) AS score").
+			Where("product_id IN ? AND recommended_id NOT IN ?", owned, owned).
+			Group("recommended_id").
+			Order("score DESC, recommended_id").
+			Limit(limit).
+			Scan(&scored).Error; err != nil {
+			return nil, err
+		}
+		found, err := activeProducts(db, scored)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range scored {
+			if p, ok := found[rec.ID]; ok {
+				recs = append(recs, Recommendation{p, feedSourceHistory, rec.Score})
+				skip[rec.ID] = true
+			}
+		}
+	}
+
+	if len(recs) < limit {
+		query := db.Where("status = ?", "active")
+		if len(skip) > 0 {
+			query = query.Where("id NOT IN ?", keys(skip))
+		}
+		var popular []models.Product
+		if err := query.Order("downloads DESC, rating DESC, id").Limit(limit - len(recs)).Find(&popular).Error; err != nil {
+			return nil, err
+		}
+		for _, p := range popular {
+			recs = append(recs, Recommendation{p, feedSourcePopular, 0})
+		}
+	}
+	return recs, nil
+}
+
+// activeProducts loads the active products among scored by ID
+func activeProducts(db *gorm.DB, scored []scoredProduct) (map[string]models.Product, error) {
+	found := map[string]models.Product{}
+	if len(scored) == 0 {
+		return found, nil
+	}
+	ids := make([]string, len(scored))
+	for i, rec := range scored {
+		ids[i] = rec.ID
+	}
+	var products []models.Product
+	if err := db.Where("id IN ? AND status = ?", ids, "active").Find(&products).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range products {
+		found[p.ID] = p
+	}
+	return found, nil
+}
+
+func keys(set map[string]bool) []string {
+	list := make([]string, 0, len(set))
+	for key := range set {
+		list = append(list, key)
+	}
+	return list
+}
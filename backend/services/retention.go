@@ -0,0 +1,130 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"vibing-backend/database"
+	"vibing-backend/models"
+)
+
+// processFileRetention purges retired product files whose retention period
+// has passed and that are no longer referenced by a listing or an entitlement
+func (s *SchedulerService) processFileRetention() {
+	if defaultStore == nil {
+		return
+	}
+
+	var retentions []models.FileRetention
+	if err := database.DB.Where("purged_at IS NULL AND retain_until <= ?", time.Now()).
+		Find(&retentions).Error; err != nil {
+		log.Printf("Error finding retired product files: %v", err)
+		return
+	}
+
+	purged := 0
+	for _, retention := range retentions {
+		inUse, err := isProductFileInUse(database.DB, retention.ObjectKey)
+		if err != nil {
+			log.Printf("Error checking references for %s: %v", retention.ObjectKey, err)
+			continue
+		}
+		if inUse {
+			continue
+		}
+
+		if err := defaultStore.Delete(retention.ObjectKey); err != nil {
+			log.Printf("Error purging retired product file %s: %v", retention.ObjectKey, err)
+			continue
+		}
+
+		now := time.Now()
+		if err := database.DB.Model(&retention).Update("purged_at", now).Error; err != nil {
+			log.Printf("Error marking %s as purged: %v", retention.ObjectKey, err)
+			continue
+		}
+
+		purged++
+		log.Printf("Purged retired product file %s (product %s)", retention.ObjectKey, retention.ProductID)
+	}
+
+	if purged > 0 {
+		log.Printf("Purged %d retired product files", purged)
+	}
+}
+
+// isProductFileInUse reports whether an object is still referenced by a live
+// listing or one of its releases, by a product with buyers holding an active
+// entitlement, or by an outstanding download token
+func isProductFileInUse(db *gorm.DB, objectKey string) (bool, error) {
+	matchesKey := func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("products.file_key = ?", objectKey)
+	}
+
+	var listings int64
+	if err := db.Model(&models.Product{}).Scopes(matchesKey).
+		Where("products.status <> ?", "deleted").
+		Count(&listings).Error; err != nil {
+		return false, err
+	}
+	if listings > 0 {
+		return true, nil
+	}
+
+	var releases int64
+	if err := db.Model(&models.ProductRelease{}).
+		Joins("JOIN products ON product_releases.product_id = products.id").
+		Where("product_releases.object_key = ? OR product_releases.sbom_key = ? OR product_releases.npm_tarball_key = ?", objectKey, objectKey, objectKey).
+		Where("products.status <> ?", "deleted").
+		Count(&releases).Error; err != nil {
+		return false, err
+	}
+	if releases > 0 {
+		return true, nil
+	}
+
+	var assets int64
+	if err := db.Model(&models.ReleaseAsset{}).
+		Joins("JOIN products ON release_assets.product_id = products.id").
+		Where("release_assets.object_key = ?", objectKey).
+		Where("products.status <> ?", "deleted").
+		Count(&assets).Error; err != nil {
+		return false, err
+	}
+	if assets > 0 {
+		return true, nil
+	}
+
+	var deltas int64
+	if err := db.Model(&models.ReleaseDelta{}).
+		Joins("JOIN products ON release_deltas.product_id = products.id").
+		Where("release_deltas.object_key = ?", objectKey).
+		Where("products.status <> ?", "deleted").
+		Count(&deltas).Error; err != nil {
+		return false, err
+	}
+	if deltas > 0 {
+		return true, nil
+	}
+
+	var entitlements int64
+	if err := db.Model(&models.Purchase{}).
+		Joins("JOIN products ON purchases.product_id = products.id").
+		Scopes(matchesKey, models.ActiveEntitlements).
+		Count(&entitlements).Error; err != nil {
+		return false, err
+	}
+	if entitlements > 0 {
+		return true, nil
+	}
+
+	var tokens int64
+	if err := db.Model(&models.DownloadToken{}).
+		Where("object_key = ? AND consumed_at IS NULL AND expires_at > ?", objectKey, time.Now()).
+		Count(&tokens).Error; err != nil {
+		return false, err
+	}
+
+	return tokens > 0, nil
+}
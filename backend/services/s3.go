@@ -1,217 +1,289 @@
 package services
 
 import (
-	"bytes"
 	"fmt"
-	"mime/multipart"
-	"path/filepath"
-	"strings"
+	"io"
+	"log"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"vibing-backend/config"
 )
 
-type S3Service struct {
+// S3Store is an ObjectStore backed by AWS S3 or an S3-compatible service
+// such as MinIO or NCP Object Storage
+type S3Store struct {
 	client *s3.S3
 	bucket string
 }
 
-// NewS3Service creates new S3 service instance
-func NewS3Service(cfg *config.S3Config) (*S3Service, error) {
+// NewS3Store creates a new S3 store. A custom endpoint selects an S3-compatible
+// service; credentials fall back to the default AWS chain when not configured.
+func NewS3Store(cfg *config.S3Config) (*S3Store, error) {
 	// Validate configuration
-	if cfg.Region == "" {
-		return nil, fmt.Errorf("AWS region is required")
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("S3 bucket name is required")
+	}
+
+	region := cfg.Region
+	if region == "" {
+		if cfg.Endpoint == "" {
+			return nil, fmt.Errorf("AWS region is required")
+		}
+		// Most S3-compatible services ignore the region but the SDK needs one for signing
+		region = "us-east-1"
 	}
-	if cfg.AccessKey == "" {
-		return nil, fmt.Errorf("AWS access key is required")
+
+	awsConfig := &aws.Config{
+		Region: aws.String(region),
 	}
-	if cfg.SecretKey == "" {
-		return nil, fmt.Errorf("AWS secret key is required")
+	if cfg.AccessKey != "" || cfg.SecretKey != "" {
+		awsConfig.Credentials = credentials.NewStaticCredentials(cfg.AccessKey, cfg.SecretKey, "")
 	}
-	if cfg.Bucket == "" {
-		return nil, fmt.Errorf("S3 bucket name is required")
+	if cfg.Endpoint != "" {
+		awsConfig.Endpoint = aws.String(cfg.Endpoint)
+		awsConfig.S3ForcePathStyle = aws.Bool(cfg.ForcePathStyle)
 	}
 
-	// Log configuration (without secrets) for debugging
-	fmt.Printf("S3 Config - Region: %s, Bucket: %s, AccessKey: %s...\n", 
-		cfg.Region, cfg.Bucket, cfg.AccessKey[:10])
-
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(cfg.Region),
-		Credentials: credentials.NewStaticCredentials(
-			cfg.AccessKey,
-			cfg.SecretKey,
-			"",
-		),
-	})
+	sess, err := session.NewSession(awsConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create AWS session: %v", err)
 	}
 
-	return &S3Service{
+	log.Printf("Object storage: S3 bucket %s (region %s, endpoint %q, path-style %v)",
+		cfg.Bucket, region, cfg.Endpoint, cfg.ForcePathStyle)
+
+	return &S3Store{
 		client: s3.New(sess),
 		bucket: cfg.Bucket,
 	}, nil
 }
 
-// UploadProductFile uploads a product ZIP file to S3
-func (s *S3Service) UploadProductFile(file *multipart.FileHeader, productID string) (string, int64, error) {
-	// Validate file extension
-	if !isZipFile(file.Filename) {
-		return "", 0, fmt.Errorf("only ZIP files are allowed")
-	}
+// Put streams an object to S3 in parts instead of buffering it in memory
+func (s *S3Store) Put(key string, body io.Reader, size int64, contentType string) error {
+	uploader := s3manager.NewUploaderWithClient(s.client)
+	_, err := uploader.Upload(&s3manager.UploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
 
-	// Validate file size (max 200MB)
-	const maxSize = 200 * 1024 * 1024 // 200MB
-	if file.Size > maxSize {
-		return "", 0, fmt.Errorf("file size exceeds 200MB limit")
+// Get opens an object for streaming, optionally limited to a byte range
+func (s *S3Store) Get(key, byteRange string) (*Object, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	if byteRange != "" {
+		input.Range = aws.String(byteRange)
 	}
 
-	src, err := file.Open()
+	output, err := s.client.GetObject(input)
 	if err != nil {
-		return "", 0, err
+		return nil, translateS3Error(err)
 	}
-	defer src.Close()
 
-	// Read file content
-	buf := new(bytes.Buffer)
-	if _, err := buf.ReadFrom(src); err != nil {
-		return "", 0, err
+	size := aws.Int64Value(output.ContentLength)
+	if output.ContentRange != nil {
+		var start, end int64
+		fmt.Sscanf(aws.StringValue(output.ContentRange), "bytes %d-%d/%d", &start, &end, &size)
 	}
 
-	// Generate unique filename
-	timestamp := time.Now().Unix()
-	filename := fmt.Sprintf("products/%s/%d_%s", productID, timestamp, file.Filename)
+	return &Object{
+		ObjectInfo: ObjectInfo{
+			Key:          key,
+			Size:         size,
+			ContentType:  aws.StringValue(output.ContentType),
+			ETag:         aws.StringValue(output.ETag),
+			LastModified: aws.TimeValue(output.LastModified),
+		},
+		Body:          output.Body,
+		ContentLength: aws.Int64Value(output.ContentLength),
+	}, nil
+}
 
-	// Upload to S3 (product files are private, require signed URLs for download)
-	_, err = s.client.PutObject(&s3.PutObjectInput{
-		Bucket:      aws.String(s.bucket),
-		Key:         aws.String(filename),
-		Body:        bytes.NewReader(buf.Bytes()),
-		ContentType: aws.String("application/zip"),
+// Presign generates a presigned GET URL
+func (s *S3Store) Presign(key string, expiry time.Duration) (string, error) {
+	req, _ := s.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
 	})
-
-	if err != nil {
-		return "", 0, err
-	}
-
-	// Return S3 URL and file size
-	url := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, *s.client.Config.Region, filename)
-	return url, file.Size, nil
+	return req.Presign(expiry)
 }
 
-// UploadImage uploads an image file to S3
-func (s *S3Service) UploadImage(file *multipart.FileHeader, folder string) (string, error) {
-	// Validate image file
-	if !isImageFile(file.Filename) {
-		return "", fmt.Errorf("only image files (JPG, PNG, GIF, WebP) are allowed")
-	}
+// KeyFromURL extracts the object key from a URL pointing at this bucket
+func (s *S3Store) KeyFromURL(rawURL string) string {
+	return ObjectKeyFromURL(rawURL, s.bucket)
+}
 
-	// Validate file size (max 20MB)
-	const maxSize = 20 * 1024 * 1024 // 20MB
-	if file.Size > maxSize {
-		return "", fmt.Errorf("image size exceeds 20MB limit")
-	}
+// Delete deletes an object
+func (s *S3Store) Delete(key string) error {
+	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
 
-	src, err := file.Open()
+// Stat returns object metadata such as size and content type
+func (s *S3Store) Stat(key string) (*ObjectInfo, error) {
+	output, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
 	if err != nil {
-		return "", err
-	}
-	defer src.Close()
-
-	// Read file content
-	buf := new(bytes.Buffer)
-	if _, err := buf.ReadFrom(src); err != nil {
-		return "", err
+		return nil, translateS3Error(err)
 	}
 
-	// Generate unique filename
-	timestamp := time.Now().Unix()
-	ext := filepath.Ext(file.Filename)
-	filename := fmt.Sprintf("%s/%d%s", folder, timestamp, ext)
+	return &ObjectInfo{
+		Key:          key,
+		Size:         aws.Int64Value(output.ContentLength),
+		ContentType:  aws.StringValue(output.ContentType),
+		ETag:         aws.StringValue(output.ETag),
+		LastModified: aws.TimeValue(output.LastModified),
+	}, nil
+}
 
-	// Determine content type
-	contentType := getImageContentType(ext)
+// List returns all objects under a prefix
+func (s *S3Store) List(prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          aws.StringValue(object.Key),
+				Size:         aws.Int64Value(object.Size),
+				ETag:         aws.StringValue(object.ETag),
+				LastModified: aws.TimeValue(object.LastModified),
+			})
+		}
+		return true
+	})
+	return objects, err
+}
 
-	// Upload to S3 (public access controlled by bucket policy)
-	_, err = s.client.PutObject(&s3.PutObjectInput{
+// PresignPut generates a presigned URL for a direct single-part upload
+func (s *S3Store) PresignPut(key, contentType string, expiry time.Duration) (string, error) {
+	req, _ := s.client.PutObjectRequest(&s3.PutObjectInput{
 		Bucket:      aws.String(s.bucket),
-		Key:         aws.String(filename),
-		Body:        bytes.NewReader(buf.Bytes()),
+		Key:         aws.String(key),
 		ContentType: aws.String(contentType),
 	})
+	return req.Presign(expiry)
+}
 
+// CreateMultipartUpload starts a multipart upload and returns its upload ID
+func (s *S3Store) CreateMultipartUpload(key, contentType string) (string, error) {
+	output, err := s.client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
 	if err != nil {
 		return "", err
 	}
+	return aws.StringValue(output.UploadId), nil
+}
 
-	// Return presigned URL (valid for 7 days for images)
-	url, err := s.GeneratePresignedURL(filename, 7*24*time.Hour)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate presigned URL: %v", err)
-	}
-	return url, nil
+// PresignUploadPart generates a presigned URL for uploading one part
+func (s *S3Store) PresignUploadPart(key, uploadID string, partNumber int64, expiry time.Duration) (string, error) {
+	req, _ := s.client.UploadPartRequest(&s3.UploadPartInput{
+		Bucket:     aws.String(s.bucket),
+		Key:        aws.String(key),
+		UploadId:   aws.String(uploadID),
+		PartNumber: aws.Int64(partNumber),
+	})
+	return req.Presign(expiry)
 }
 
-// GeneratePresignedURL generates a presigned URL for secure download
-func (s *S3Service) GeneratePresignedURL(key string, expiry time.Duration) (string, error) {
-	req, _ := s.client.GetObjectRequest(&s3.GetObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
+// ListUploadedParts returns the parts S3 has received so far for a multipart upload
+func (s *S3Store) ListUploadedParts(key, uploadID string) ([]UploadedPart, error) {
+	var parts []UploadedPart
+	err := s.client.ListPartsPages(&s3.ListPartsInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range page.Parts {
+			parts = append(parts, UploadedPart{
+				PartNumber: aws.Int64Value(part.PartNumber),
+				ETag:       aws.StringValue(part.ETag),
+				Size:       aws.Int64Value(part.Size),
+			})
+		}
+		return true
 	})
+	return parts, err
+}
 
-	url, err := req.Presign(expiry)
-	if err != nil {
-		return "", err
+// CompleteMultipartUpload assembles the uploaded parts into the final object
+func (s *S3Store) CompleteMultipartUpload(key, uploadID string, parts []UploadedPart) error {
+	var completed []*s3.CompletedPart
+	for _, part := range parts {
+		completed = append(completed, &s3.CompletedPart{
+			PartNumber: aws.Int64(part.PartNumber),
+			ETag:       aws.String(part.ETag),
+		})
 	}
 
-	return url, nil
+	_, err := s.client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	return err
 }
 
-// DeleteFile deletes a file from S3
-func (s *S3Service) DeleteFile(key string) error {
-	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
+// AbortMultipartUpload discards a multipart upload and any parts already stored
+func (s *S3Store) AbortMultipartUpload(key, uploadID string) error {
+	_, err := s.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
 	})
 	return err
 }
 
-// isZipFile checks if file has ZIP extension
-func isZipFile(filename string) bool {
-	ext := strings.ToLower(filepath.Ext(filename))
-	return ext == ".zip"
+// ListMultipartUploadsBefore lists unfinished multipart uploads under a prefix
+// that were initiated before the given time
+func (s *S3Store) ListMultipartUploadsBefore(prefix string, before time.Time) ([]PendingUpload, error) {
+	var uploads []PendingUpload
+	err := s.client.ListMultipartUploadsPages(&s3.ListMultipartUploadsInput{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+		for _, upload := range page.Uploads {
+			if upload.Initiated != nil && upload.Initiated.Before(before) {
+				uploads = append(uploads, PendingUpload{
+					Key:       aws.StringValue(upload.Key),
+					UploadID:  aws.StringValue(upload.UploadId),
+					Initiated: aws.TimeValue(upload.Initiated),
+				})
+			}
+		}
+		return true
+	})
+	return uploads, err
 }
 
-// isImageFile checks if file is a valid image
-func isImageFile(filename string) bool {
-	ext := strings.ToLower(filepath.Ext(filename))
-	allowedExts := []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
-	
-	for _, allowed := range allowedExts {
-		if ext == allowed {
-			return true
-		}
+// translateS3Error maps missing-object errors to ErrObjectNotFound
+func translateS3Error(err error) error {
+	if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == 404 {
+		return ErrObjectNotFound
 	}
-	return false
-}
-
-// getImageContentType returns content type for image file
-func getImageContentType(ext string) string {
-	switch strings.ToLower(ext) {
-	case ".jpg", ".jpeg":
-		return "image/jpeg"
-	case ".png":
-		return "image/png"
-	case ".gif":
-		return "image/gif"
-	case ".webp":
-		return "image/webp"
-	default:
-		return "application/octet-stream"
+	if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound") {
+		return ErrObjectNotFound
 	}
-}
\ No newline at end of file
+	return err
+}
@@ -0,0 +1,514 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ManifestFile is a dependency manifest found in an archive
+type ManifestFile struct {
+	Path    string
+	Content []byte
+}
+
+// LicenseFile is a license text found in an archive, with the detected SPDX ID ("" if unknown)
+type LicenseFile struct {
+	Path    string
+	License string
+}
+
+// Component is one dependency in the SBOM
+type Component struct {
+	Ecosystem string
+	Name      string
+	Version   string
+	License   string
+	// Source is the manifest or bundled directory the component was found in
+	Source  string
+	Bundled bool
+}
+
+// PURL returns the package URL of the component
+func (c Component) PURL() string {
+	if c.Ecosystem == "" {
+		return ""
+	}
+	purl := fmt.Sprintf("pkg:%s/%s", c.Ecosystem, c.Name)
+	if c.Version != "" {
+		purl += "@" + c.Version
+	}
+	return purl
+}
+
+// DependencyReport is the result of analyzing an archive's manifests and license files
+type DependencyReport struct {
+	Components []Component
+	// RootLicenses are the licenses of the product itself
+	RootLicenses []string
+	// Licenses lists every detected SPDX ID, root and bundled
+	Licenses []string
+}
+
+// bundledDirs are path segments under which third-party code is usually vendored
+var bundledDirs = map[string]bool{
+	"vendor": true, "node_modules": true, "third_party": true, "third-party": true,
+	"thirdparty": true, "external": true, "site-packages": true, "bower_components": true,
+}
+
+func isDependencyManifest(name string) bool {
+	switch path.Base(name) {
+	case "go.mod", "package.json", "requirements.txt", "Cargo.toml":
+		return true
+	}
+	return false
+}
+
+func isLicenseFile(name string) bool {
+	base := strings.ToUpper(path.Base(name))
+	for _, prefix := range []string{"LICENSE", "LICENCE", "COPYING"} {
+		if base == prefix || strings.HasPrefix(base, prefix+".") || strings.HasPrefix(base, prefix+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectLicense identifies common open-source licenses from their text and returns an SPDX ID
+func DetectLicense(text []byte) string {
+	content := strings.ToLower(string(text))
+	content = strings.Join(strings.Fields(content), " ")
+
+	has := func(phrases ...string) bool {
+		for _, phrase := range phrases {
+			if !strings.Contains(content, phrase) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch {
+	case has("gnu affero general public license"):
+		return "AGPL-3.0"
+	case has("gnu lesser general public license", "version 3"):
+		return "LGPL-3.0"
+	case has("gnu lesser general public license") || has("gnu library general public license"):
+		return "LGPL-2.1"
+	case has("gnu general public license", "version 3"):
+		return "GPL-3.0"
+	case has("gnu general public license", "version 2"):
+		return "GPL-2.0"
+	case has("mozilla public license", "2.0"):
+		return "MPL-2.0"
+	case has("eclipse public license"):
+		return "EPL-2.0"
+	case has("apache license", "version 2.0"):
+		return "Apache-2.0"
+	case has("permission is hereby granted, free of charge"):
+		return "MIT"
+	case has("redistribution and use in source and binary forms", "neither the name"):
+		return "BSD-3-Clause"
+	case has("redistribution and use in source and binary forms"):
+		return "BSD-2-Clause"
+	case has("permission to use, copy, modify, and/or distribute this software for any purpose"):
+		return "ISC"
+	case has("this is free and unencumbered software released into the public domain"):
+		return "Unlicense"
+	}
+	return ""
+}
+
+// IsStrongCopyleft reports licenses whose terms extend to works that bundle the code
+func IsStrongCopyleft(license string) bool {
+	return strings.HasPrefix(license, "GPL-") || strings.HasPrefix(license, "AGPL-")
+}
+
+// IsWeakCopyleft reports file- or library-level copyleft licenses
+func IsWeakCopyleft(license string) bool {
+	return strings.HasPrefix(license, "LGPL-") || strings.HasPrefix(license, "MPL-") || strings.HasPrefix(license, "EPL-")
+}
+
+// AnalyzeDependencies builds the component list and license summary of an inspected archive
+func AnalyzeDependencies(inspection *ArchiveInspection) *DependencyReport {
+	report := &DependencyReport{}
+
+	// License files under vendored directories belong to the package directory that holds them
+	bundledLicenses := make(map[string]string)
+	rootDepth := -1
+	var rootFiles []LicenseFile
+	for _, file := range inspection.LicenseFiles {
+		if file.License == "" {
+			continue
+		}
+		if dir, ok := bundledPackageDir(file.Path); ok {
+			bundledLicenses[dir] = file.License
+			continue
+		}
+		depth := strings.Count(file.Path, "/")
+		if rootDepth == -1 || depth < rootDepth {
+			rootDepth = depth
+			rootFiles = nil
+		}
+		if depth == rootDepth {
+			rootFiles = append(rootFiles, file)
+		}
+	}
+	for _, file := range rootFiles {
+		report.RootLicenses = appendUnique(report.RootLicenses, file.License)
+	}
+
+	seen := make(map[string]bool)
+	for _, manifest := range inspection.Manifests {
+		if _, bundled := bundledPackageDir(manifest.Path); bundled {
+			continue
+		}
+		for _, component := range parseManifest(manifest) {
+			if dir := bundledDirFor(component); dir != "" {
+				for licensedDir, license := range bundledLicenses {
+					if strings.HasSuffix(licensedDir, dir) {
+						component.License = license
+						component.Source = licensedDir
+						component.Bundled = true
+					}
+				}
+			}
+			key := component.PURL()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			report.Components = append(report.Components, component)
+		}
+	}
+
+	// Bundled code that no manifest mentions still ships with the product
+	for dir, license := range bundledLicenses {
+		matched := false
+		for _, component := range report.Components {
+			if component.Bundled && component.Source == dir {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			report.Components = append(report.Components, Component{
+				Name:    dir,
+				License: license,
+				Source:  dir,
+				Bundled: true,
+			})
+		}
+	}
+
+	sort.Slice(report.Components, func(i, j int) bool {
+		return report.Components[i].Name < report.Components[j].Name
+	})
+
+	report.Licenses = append(report.Licenses, report.RootLicenses...)
+	for _, component := range report.Components {
+		if component.License != "" {
+			report.Licenses = appendUnique(report.Licenses, component.License)
+		}
+	}
+
+	return report
+}
+
+// productLicenseIDs maps the product license choices to the SPDX families they allow
+var productLicenseIDs = map[string][]string{
+	"MIT":    {"MIT"},
+	"Apache": {"Apache-2.0"},
+	"GPL":    {"GPL-2.0", "GPL-3.0", "AGPL-3.0"},
+	"BSD":    {"BSD-2-Clause", "BSD-3-Clause"},
+}
+
+// LicenseWarnings reports conflicts between the product's declared license and the archive contents
+func LicenseWarnings(productLicense string, report *DependencyReport) []string {
+	var warnings []string
+
+	if allowed, ok := productLicenseIDs[productLicense]; ok {
+		for _, root := range report.RootLicenses {
+			if !containsString(allowed, root) {
+				warnings = append(warnings, fmt.Sprintf(
+					"Archive LICENSE is %s but the product is listed as %s", root, productLicense))
+			}
+		}
+	}
+
+	for _, component := range report.Components {
+		if !component.Bundled || component.License == "" {
+			continue
+		}
+		switch {
+		case IsStrongCopyleft(component.License) && productLicense != "GPL":
+			warnings = append(warnings, fmt.Sprintf(
+				"Bundled %s (%s) is %s, which requires the whole product to be distributed under the same license, but the product is listed as %s",
+				component.Name, component.Source, component.License, displayLicense(productLicense)))
+		case IsWeakCopyleft(component.License) && (productLicense == "Commercial" || productLicense == "Custom"):
+			warnings = append(warnings, fmt.Sprintf(
+				"Bundled %s (%s) is %s; its source and modifications must stay available under that license",
+				component.Name, component.Source, component.License))
+		}
+	}
+
+	return warnings
+}
+
+// BuildCycloneDX renders a CycloneDX 1.5 JSON SBOM for a release
+func BuildCycloneDX(productName, version string, report *DependencyReport) ([]byte, error) {
+	type license struct {
+		License map[string]string `json:"license"`
+	}
+	licensesFor := func(ids ...string) []license {
+		var licenses []license
+		for _, id := range ids {
+			if id != "" {
+				licenses = append(licenses, license{License: map[string]string{"id": id}})
+			}
+		}
+		return licenses
+	}
+
+	type component struct {
+		Type       string              `json:"type"`
+		BOMRef     string              `json:"bom-ref,omitempty"`
+		Name       string              `json:"name"`
+		Version    string              `json:"version,omitempty"`
+		PURL       string              `json:"purl,omitempty"`
+		Licenses   []license           `json:"licenses,omitempty"`
+		Properties []map[string]string `json:"properties,omitempty"`
+	}
+
+	components := make([]component, 0, len(report.Components))
+	for _, dep := range report.Components {
+		properties := []map[string]string{{"name": "vibing:source", "value": dep.Source}}
+		if dep.Bundled {
+			properties = append(properties, map[string]string{"name": "vibing:bundled", "value": "true"})
+		}
+		components = append(components, component{
+			Type:       "library",
+			BOMRef:     dep.PURL(),
+			Name:       dep.Name,
+			Version:    dep.Version,
+			PURL:       dep.PURL(),
+			Licenses:   licensesFor(dep.License),
+			Properties: properties,
+		})
+	}
+
+	bom := map[string]interface{}{
+		"bomFormat":    "CycloneDX",
+		"specVersion":  "1.5",
+		"serialNumber": "urn:uuid:" + uuid.New().String(),
+		"version":      1,
+		"metadata": map[string]interface{}{
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+			"tools": map[string]interface{}{
+				"components": []component{{Type: "application", Name: "vibing-backend"}},
+			},
+			"component": component{
+				Type:     "application",
+				Name:     productName,
+				Version:  version,
+				Licenses: licensesFor(report.RootLicenses...),
+			},
+		},
+		"components": components,
+	}
+
+	return json.MarshalIndent(bom, "", "  ")
+}
+
+// parseManifest extracts direct dependencies from one manifest file
+func parseManifest(manifest ManifestFile) []Component {
+	switch path.Base(manifest.Path) {
+	case "go.mod":
+		return parseGoMod(manifest)
+	case "package.json":
+		return parsePackageJSON(manifest)
+	case "requirements.txt":
+		return parseRequirements(manifest)
+	case "Cargo.toml":
+		return parseCargoToml(manifest)
+	}
+	return nil
+}
+
+var goRequirePattern = regexp.MustCompile(`^([^\s]+)\s+(v[^\s]+)`)
+
+func parseGoMod(manifest ManifestFile) []Component {
+	var components []Component
+	inBlock := false
+	scanner := bufio.NewScanner(bytes.NewReader(manifest.Content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+
+		switch {
+		case line == "require (":
+			inBlock = true
+			continue
+		case inBlock && line == ")":
+			inBlock = false
+			continue
+		case strings.HasPrefix(line, "require "):
+			line = strings.TrimSpace(strings.TrimPrefix(line, "require "))
+		case !inBlock:
+			continue
+		}
+
+		if match := goRequirePattern.FindStringSubmatch(line); match != nil {
+			components = append(components, Component{
+				Ecosystem: "golang",
+				Name:      match[1],
+				Version:   match[2],
+				Source:    manifest.Path,
+			})
+		}
+	}
+	return components
+}
+
+func parsePackageJSON(manifest ManifestFile) []Component {
+	var pkg struct {
+		Dependencies map[string]string `json:"dependencies"`
+	}
+	if err := json.Unmarshal(manifest.Content, &pkg); err != nil {
+		return nil
+	}
+
+	var components []Component
+	for name, version := range pkg.Dependencies {
+		components = append(components, Component{
+			Ecosystem: "npm",
+			Name:      name,
+			Version:   strings.TrimLeft(version, "^~=v "),
+			Source:    manifest.Path,
+		})
+	}
+	return components
+}
+
+var requirementPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)(?:\[[^\]]*\])?\s*(?:(==|>=|~=|<=|>|<)\s*([^\s,;#]+))?`)
+
+func parseRequirements(manifest ManifestFile) []Component {
+	var components []Component
+	scanner := bufio.NewScanner(bytes.NewReader(manifest.Content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "-") {
+			continue
+		}
+		match := requirementPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		version := ""
+		if match[2] == "==" {
+			version = match[3]
+		}
+		components = append(components, Component{
+			Ecosystem: "pypi",
+			Name:      strings.ToLower(match[1]),
+			Version:   version,
+			Source:    manifest.Path,
+		})
+	}
+	return components
+}
+
+var (
+	cargoSimpleDep = regexp.MustCompile(`^([A-Za-z0-9_-]+)\s*=\s*"([^"]+)"`)
+	cargoTableDep  = regexp.MustCompile(`^([A-Za-z0-9_-]+)\s*=\s*\{.*?version\s*=\s*"([^"]+)"`)
+)
+
+func parseCargoToml(manifest ManifestFile) []Component {
+	var components []Component
+	inDependencies := false
+	scanner := bufio.NewScanner(bytes.NewReader(manifest.Content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inDependencies = line == "[dependencies]"
+			continue
+		}
+		if !inDependencies {
+			continue
+		}
+
+		match := cargoSimpleDep.FindStringSubmatch(line)
+		if match == nil {
+			match = cargoTableDep.FindStringSubmatch(line)
+		}
+		if match != nil {
+			components = append(components, Component{
+				Ecosystem: "cargo",
+				Name:      match[1],
+				Version:   strings.TrimLeft(match[2], "^~=v "),
+				Source:    manifest.Path,
+			})
+		}
+	}
+	return components
+}
+
+// bundledPackageDir returns the package directory of a file under a vendored directory,
+// e.g. "app/node_modules/left-pad" for "app/node_modules/left-pad/LICENSE"
+func bundledPackageDir(name string) (string, bool) {
+	segments := strings.Split(path.Dir(name), "/")
+	for i, segment := range segments {
+		if bundledDirs[segment] && i < len(segments)-1 {
+			return strings.Join(segments, "/"), true
+		}
+	}
+	return "", false
+}
+
+// bundledDirFor is the directory a vendored copy of the component would live in
+func bundledDirFor(component Component) string {
+	switch component.Ecosystem {
+	case "golang":
+		return "vendor/" + component.Name
+	case "npm":
+		return "node_modules/" + component.Name
+	case "pypi":
+		return "site-packages/" + component.Name
+	case "cargo":
+		return "vendor/" + component.Name
+	}
+	return ""
+}
+
+func displayLicense(productLicense string) string {
+	if productLicense == "" {
+		return "unspecified"
+	}
+	return productLicense
+}
+
+func appendUnique(values []string, value string) []string {
+	if containsString(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
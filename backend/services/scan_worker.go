@@ -0,0 +1,223 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"vibing-backend/database"
+	"vibing-backend/models"
+)
+
+const (
+	scanPollInterval = time.Minute
+	scanBatchSize    = 20
+	// Scans stuck in "scanning" this long (e.g. after a restart) are retried
+	scanStaleAfter = 15 * time.Minute
+	scanRetryDelay = 5 * time.Minute
+)
+
+// ScanWorker drains the queue of quarantined uploads. The database is the queue;
+// Wake only shortens the wait for newly uploaded files.
+type ScanWorker struct {
+	scanner  FileScanner
+	wake     chan struct{}
+	stopChan chan bool
+}
+
+// NewScanWorker creates a scan worker using the given scanner
+func NewScanWorker(scanner FileScanner) *ScanWorker {
+	return &ScanWorker{
+		scanner:  scanner,
+		wake:     make(chan struct{}, 1),
+		stopChan: make(chan bool),
+	}
+}
+
+// Start begins processing the scan queue
+func (w *ScanWorker) Start() {
+	go w.run()
+}
+
+// Stop terminates the worker
+func (w *ScanWorker) Stop() {
+	w.stopChan <- true
+}
+
+// Wake asks the worker to check the queue now
+func (w *ScanWorker) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *ScanWorker) run() {
+	ticker := time.NewTicker(scanPollInterval)
+	defer ticker.Stop()
+
+	log.Printf("Scan worker started (scanner: %s)", w.scanner.Name())
+
+	w.enqueueUnscannedProductFiles()
+	w.processQueue()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.processQueue()
+		case <-w.wake:
+			w.processQueue()
+		case <-w.stopChan:
+			log.Println("Scan worker stopped")
+			return
+		}
+	}
+}
+
+// enqueueUnscannedProductFiles quarantines current product files that predate scanning
+func (w *ScanWorker) enqueueUnscannedProductFiles() {
+	var products []models.Product
+	if err := database.DB.Select("id, author_id, file_key").
+		Where("file_key <> '' AND file_key NOT IN (?)",
+			database.DB.Model(&models.ScannedAsset{}).Select("object_key")).
+		Find(&products).Error; err != nil {
+		log.Printf("Error finding unscanned product files: %v", err)
+		return
+	}
+
+	for _, product := range products {
+		productID := product.ID
+		if err := models.QuarantineAsset(database.DB, product.FileKey, "product_file", &productID, product.AuthorID); err != nil {
+			log.Printf("Error queueing scan for product %s: %v", product.ID, err)
+			continue
+		}
+		database.DB.Model(&models.Product{}).Where("id = ?", product.ID).Update("scan_status", "quarantined")
+	}
+
+	if len(products) > 0 {
+		log.Printf("Queued %d existing product files for scanning", len(products))
+	}
+}
+
+// processQueue scans quarantined assets until none are left
+func (w *ScanWorker) processQueue() {
+	if defaultStore == nil {
+		return
+	}
+
+	database.DB.Model(&models.ScannedAsset{}).
+		Where("status = ? AND updated_at <= ?", "scanning", time.Now().Add(-scanStaleAfter)).
+		Update("status", "quarantined")
+
+	for {
+		var assets []models.ScannedAsset
+		if err := database.DB.Where("status = ? AND (attempts = 0 OR updated_at <= ?)",
+			"quarantined", time.Now().Add(-scanRetryDelay)).
+			Order("created_at ASC").Limit(scanBatchSize).
+			Find(&assets).Error; err != nil {
+			log.Printf("Error finding quarantined assets: %v", err)
+			return
+		}
+		if len(assets) == 0 {
+			return
+		}
+
+		for i := range assets {
+			w.scanAsset(&assets[i])
+		}
+	}
+}
+
+// scanAsset claims one asset, scans it and records the verdict
+func (w *ScanWorker) scanAsset(asset *models.ScannedAsset) {
+	// Claim atomically so multiple instances never scan the same asset twice
+	result := database.DB.Model(&models.ScannedAsset{}).
+		Where("id = ? AND status = ?", asset.ID, "quarantined").
+		Updates(map[string]interface{}{"status": "scanning", "attempts": asset.Attempts + 1})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+	asset.Attempts++
+	w.syncProductStatus(asset, "scanning", "")
+
+	verdict, err := w.scanObject(asset.ObjectKey)
+	now := time.Now()
+
+	updates := map[string]interface{}{"scanner": w.scanner.Name(), "scanned_at": now}
+	status, reason := "", ""
+	switch {
+	case err == ErrScanSizeLimit:
+		// The same file is rejected on every attempt, so don't retry
+		status = "error"
+		reason = "The file is larger than the malware scanner accepts. Contact support to have it scanned."
+		updates["last_error"] = err.Error()
+		log.Printf("Scan of %s failed: %v; raise clamd's StreamMaxLength and rescan it", asset.ObjectKey, err)
+	case err != nil && asset.Attempts < models.MaxScanAttempts:
+		status = "quarantined"
+		updates["last_error"] = err.Error()
+		log.Printf("Scan of %s failed (attempt %d), will retry: %v", asset.ObjectKey, asset.Attempts, err)
+	case err != nil:
+		status = "error"
+		reason = "The malware scan failed. Contact support to have it scanned again."
+		updates["last_error"] = err.Error()
+		log.Printf("Scan of %s failed permanently: %v", asset.ObjectKey, err)
+	case verdict.Clean:
+		status = "clean"
+		updates["last_error"] = ""
+	default:
+		status = "infected"
+		updates["signature"] = verdict.Signature
+		log.Printf("Infected upload detected: %s (%s) by user %s", asset.ObjectKey, verdict.Signature, asset.UploaderID)
+	}
+	updates["status"] = status
+
+	if err := database.DB.Model(asset).Updates(updates).Error; err != nil {
+		log.Printf("Error saving scan result for %s: %v", asset.ObjectKey, err)
+		return
+	}
+	w.syncProductStatus(asset, status, reason)
+}
+
+func (w *ScanWorker) scanObject(key string) (*ScanResult, error) {
+	object, err := defaultStore.Get(key, "")
+	if err != nil {
+		return nil, err
+	}
+	defer object.Body.Close()
+
+	return w.scanner.Scan(object.Body)
+}
+
+// syncProductStatus mirrors the scan status, and why it failed, onto the product while
+// the asset is its current file
+func (w *ScanWorker) syncProductStatus(asset *models.ScannedAsset, status, reason string) {
+	if asset.Kind != "product_file" || asset.ProductID == nil {
+		return
+	}
+
+	database.DB.Model(&models.Product{}).
+		Where("id = ? AND file_key = ?", *asset.ProductID, asset.ObjectKey).
+		Updates(map[string]interface{}{"scan_status": status, "scan_error": reason})
+}
+
+// Global scan worker instance
+var FileScanWorker *ScanWorker
+
+// InitScanWorker starts the global scan worker
+func InitScanWorker(scanner FileScanner) {
+	FileScanWorker = NewScanWorker(scanner)
+	FileScanWorker.Start()
+}
+
+// StopScanWorker stops the global scan worker
+func StopScanWorker() {
+	if FileScanWorker != nil {
+		FileScanWorker.Stop()
+	}
+}
+
+// WakeScanWorker notifies the worker that new uploads are waiting
+func WakeScanWorker() {
+	if FileScanWorker != nil {
+		FileScanWorker.Wake()
+	}
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"vibing-backend/config"
+)
+
+// ErrScanSizeLimit is returned when a file is larger than the scanner accepts, such as
+// clamd's StreamMaxLength. Retrying gives the same result.
+var ErrScanSizeLimit = errors.New("file is larger than the malware scanner accepts")
+
+// ScanResult is the verdict for one scanned file
+type ScanResult struct {
+	Clean     bool
+	Signature string
+}
+
+// FileScanner scans file contents for malware
+type FileScanner interface {
+	Name() string
+	Scan(r io.Reader) (*ScanResult, error)
+}
+
+// NewFileScanner creates the scanner selected by SCANNER_BACKEND
+func NewFileScanner(cfg *config.ScannerConfig) (FileScanner, error) {
+	switch strings.ToLower(cfg.Backend) {
+	case "", "none":
+		return NoopScanner{}, nil
+	case "clamav", "clamd":
+		timeout, err := time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			timeout = 2 * time.Minute
+		}
+		return NewClamAVScanner(cfg.ClamdAddress, timeout)
+	default:
+		return nil, fmt.Errorf("unknown scanner backend: %s", cfg.Backend)
+	}
+}
+
+// NoopScanner reports every file as clean. It is meant for development
+// environments without a scanning daemon.
+type NoopScanner struct{}
+
+func (NoopScanner) Name() string {
+	return "none"
+}
+
+func (NoopScanner) Scan(r io.Reader) (*ScanResult, error) {
+	return &ScanResult{Clean: true}, nil
+}
+
+// clamdChunkSize is the INSTREAM chunk size; it must stay below clamd's StreamMaxLength
+const clamdChunkSize = 64 * 1024
+
+// ClamAVScanner talks to a clamd daemon using the INSTREAM command. clamd rejects streams
+// longer than its StreamMaxLength (25MB by default), which should be raised to cover the
+// uploads accepted; larger files fail with ErrScanSizeLimit.
+type ClamAVScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamAVScanner creates a scanner for a clamd address such as
+// "tcp://127.0.0.1:3310" or "unix:///var/run/clamav/clamd.ctl"
+func NewClamAVScanner(address string, timeout time.Duration) (*ClamAVScanner, error) {
+	parsed, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clamd address: %v", err)
+	}
+
+	switch parsed.Scheme {
+	case "tcp":
+		return &ClamAVScanner{network: "tcp", address: parsed.Host, timeout: timeout}, nil
+	case "unix":
+		return &ClamAVScanner{network: "unix", address: parsed.Path, timeout: timeout}, nil
+	default:
+		return nil, fmt.Errorf("unsupported clamd address scheme: %s", parsed.Scheme)
+	}
+}
+
+func (s *ClamAVScanner) Name() string {
+	return "clamav"
+}
+
+// Scan streams r to clamd and parses its verdict
+func (s *ClamAVScanner) Scan(r io.Reader) (*ScanResult, error) {
+	conn, err := net.DialTimeout(s.network, s.address, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.timeout))
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return nil, err
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				// clamd closes the connection once the size limit is exceeded;
+				// its reply explains why
+				break
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+
+	// Zero-length chunk terminates the stream
+	binary.BigEndian.PutUint32(size, 0)
+	conn.Write(size)
+
+	reply, err := io.ReadAll(conn)
+	if err != nil && len(reply) == 0 {
+		return nil, fmt.Errorf("failed to read clamd reply: %v", err)
+	}
+
+	return parseClamdReply(string(bytes.TrimRight(reply, "\x00\n")))
+}
+
+// parseClamdReply interprets "stream: OK", "stream: <signature> FOUND", the size limit
+// reply and other error replies
+func parseClamdReply(reply string) (*ScanResult, error) {
+	reply = strings.TrimPrefix(reply, "stream: ")
+
+	switch {
+	case reply == "OK":
+		return &ScanResult{Clean: true}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return &ScanResult{Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	case strings.Contains(reply, "INSTREAM size limit exceeded"):
+		return nil, ErrScanSizeLimit
+	default:
+		return nil, fmt.Errorf("clamd error: %s", reply)
+	}
+}
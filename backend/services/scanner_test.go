@@ -0,0 +1,113 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseClamdReply(t *testing.T) {
+	tests := []struct {
+		reply     string
+		clean     bool
+		signature string
+		err       bool
+	}{
+		{"stream: OK", true, "", false},
+		{"stream: Eicar-Test-Signature FOUND", false, "Eicar-Test-Signature", false},
+		{"stream: Win.Trojan.Agent-123 FOUND", false, "Win.Trojan.Agent-123", false},
+		{"INSTREAM size limit exceeded. ERROR", false, "", true},
+		{"stream: Can't allocate memory ERROR", false, "", true},
+		{"", false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reply, func(t *testing.T) {
+			result, err := parseClamdReply(tt.reply)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("parseClamdReply(%q) = %+v, want an error", tt.reply, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseClamdReply(%q): %v", tt.reply, err)
+			}
+			if result.Clean != tt.clean || result.Signature != tt.signature {
+				t.Errorf("parseClamdReply(%q) = %+v", tt.reply, result)
+			}
+		})
+	}
+}
+
+// fakeClamd answers INSTREAM like clamd with the given StreamMaxLength
+func fakeClamd(t *testing.T, maxLength int) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		command := make([]byte, len("zINSTREAM\x00"))
+		if _, err := io.ReadFull(conn, command); err != nil {
+			return
+		}
+		received := 0
+		size := make([]byte, 4)
+		for {
+			if _, err := io.ReadFull(conn, size); err != nil {
+				return
+			}
+			n := int(binary.BigEndian.Uint32(size))
+			if n == 0 {
+				conn.Write([]byte("stream: OK\x00"))
+				return
+			}
+			if received+n > maxLength {
+				conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+				return
+			}
+			if _, err := io.CopyN(io.Discard, conn, int64(n)); err != nil {
+				return
+			}
+			received += n
+		}
+	}()
+	return "tcp://" + listener.Addr().String()
+}
+
+func TestClamAVScannerSizeLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		err  error
+	}{
+		{"within the limit", 100 * 1024, nil},
+		{"over the limit", 300 * 1024, ErrScanSizeLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner, err := NewClamAVScanner(fakeClamd(t, 200*1024), 5*time.Second)
+			if err != nil {
+				t.Fatalf("NewClamAVScanner: %v", err)
+			}
+			result, err := scanner.Scan(bytes.NewReader(make([]byte, tt.size)))
+			if err != tt.err {
+				t.Fatalf("Scan err = %v, want %v", err, tt.err)
+			}
+			if err == nil && !result.Clean {
+				t.Errorf("Scan = %+v, want clean", result)
+			}
+		})
+	}
+}
@@ -1,12 +1,9 @@
 package services
 
 import (
-	"fmt"
 	"log"
-	"strings"
 	"time"
 
-	"vibing-backend/config"
 	"vibing-backend/database"
 	"vibing-backend/models"
 )
@@ -43,12 +40,34 @@ func (s *SchedulerService) runScheduler() {
 	// Run immediately on start
 	s.processAutoConfirmations()
 	s.processPlatformInterventions()
+	s.processFileRetention()
+	s.processStaleUploads()
+	s.processOrphanedObjects()
+	s.processPersonalizedBuilds()
+	s.processReleaseDeltas()
+	s.processTagUsage()
+	s.processSearchLexicon()
+	s.processRecommendations()
+	s.processTrending()
+	s.processEventRetention()
+	s.processWishlistNotifications()
 
 	for {
 		select {
 		case <-ticker.C:
 			s.processAutoConfirmations()
 			s.processPlatformInterventions()
+			s.processFileRetention()
+			s.processStaleUploads()
+			s.processOrphanedObjects()
+			s.processPersonalizedBuilds()
+			s.processReleaseDeltas()
+			s.processTagUsage()
+			s.processSearchLexicon()
+			s.processRecommendations()
+			s.processTrending()
+			s.processEventRetention()
+			s.processWishlistNotifications()
 		case <-s.stopChan:
 			log.Println("Purchase scheduler stopped")
 			return
@@ -77,12 +96,6 @@ func (s *SchedulerService) processAutoConfirmations() {
 				continue
 			}
 
-			// Delete S3 file after confirmation
-			if err := deleteS3FileForPurchase(purchase); err != nil {
-				log.Printf("Warning: Failed to delete S3 file for purchase %s: %v", purchase.ID, err)
-				// Don't fail the confirmation process if file deletion fails
-			}
-
 			if err := database.DB.Save(&purchase).Error; err != nil {
 				log.Printf("Error saving auto-confirmed purchase %s: %v", purchase.ID, err)
 				continue
@@ -176,12 +189,6 @@ func (s *SchedulerService) ForceAutoConfirm(purchaseID string) error {
 		return err
 	}
 
-	// Delete S3 file after confirmation
-	if err := deleteS3FileForPurchase(purchase); err != nil {
-		log.Printf("Warning: Failed to delete S3 file for purchase %s: %v", purchase.ID, err)
-		// Don't fail the confirmation process if file deletion fails
-	}
-
 	return database.DB.Save(&purchase).Error
 }
 
@@ -214,47 +221,3 @@ func StopScheduler() {
 		PurchaseScheduler.Stop()
 	}
 }
-
-// deleteS3FileForPurchase deletes the S3 file for a purchase
-func deleteS3FileForPurchase(purchase models.Purchase) error {
-	if purchase.Product.FileURL == "" {
-		return nil // No file to delete
-	}
-	
-	// Extract S3 key from the full S3 URL
-	s3Key := extractS3KeyFromURL(purchase.Product.FileURL)
-	if s3Key == "" {
-		return fmt.Errorf("failed to extract S3 key from URL: %s", purchase.Product.FileURL)
-	}
-	
-	// Load S3 configuration
-	cfg, err := config.Load()
-	if err != nil {
-		return fmt.Errorf("failed to load config: %v", err)
-	}
-	
-	// Create S3 service
-	s3Service, err := NewS3Service(&cfg.S3)
-	if err != nil {
-		return fmt.Errorf("failed to create S3 service: %v", err)
-	}
-	
-	// Delete the file
-	if err := s3Service.DeleteFile(s3Key); err != nil {
-		return fmt.Errorf("failed to delete S3 file: %v", err)
-	}
-	
-	log.Printf("Successfully deleted S3 file for purchase %s: %s", purchase.ID, s3Key)
-	return nil
-}
-
-// extractS3KeyFromURL extracts the S3 object key from a full S3 URL
-// Example: https://bucket.s3.region.amazonaws.com/path/to/file.zip -> path/to/file.zip
-func extractS3KeyFromURL(s3URL string) string {
-	// Split by ".amazonaws.com/"
-	parts := strings.Split(s3URL, ".amazonaws.com/")
-	if len(parts) == 2 {
-		return parts[1]
-	}
-	return ""
-}
\ No newline at end of file
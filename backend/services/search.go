@@ -0,0 +1,217 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"vibing-backend/database"
+)
+
+const (
+	// maxSearchTerms bounds the words of a query that are matched
+	maxSearchTerms = 8
+	// SearchSuggestionThreshold is the result count below which a "did you mean" suggestion is looked up
+	SearchSuggestionThreshold = 5
+)
+
+// Highlighted matches are delimited with private-use characters by ts_headline and only
+// turned into <mark> tags after the surrounding text has been HTML-escaped
+const (
+	highlightStart = '\ue000'
+	highlightStop  = '\ue001'
+)
+
+var (
+	titleHeadlineOptions   = fmt.Sprintf("StartSel=%c, StopSel=%c, HighlightAll=true", highlightStart, highlightStop)
+	snippetHeadlineOptions = fmt.Sprintf(`StartSel=%c, StopSel=%c, MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=" … "`, highlightStart, highlightStop)
+)
+
+// ProductSearch is a parsed catalog search query
+type ProductSearch struct {
+	Terms []string
+}
+
+// ProductSearchHit is a matching product with its relevance and highlighted fragments
+type ProductSearchHit struct {
+	ID      string
+	Rank    float64
+	Title   string
+	Snippet string
+}
+
+// ProductHighlight holds HTML fragments with matches wrapped in <mark>
+type ProductHighlight struct {
+	Title   string `json:"title"`
+	Snippet string `json:"snippet"`
+}
+
+// ParseProductSearch splits a query into lowercased words, dropping punctuation so the
+// words can be used in a tsquery as-is
+func ParseProductSearch(input string) ProductSearch {
+	words := strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > maxSearchTerms {
+		words = words[:maxSearchTerms]
+	}
+	return ProductSearch{Terms: words}
+}
+
+// Empty reports whether the query has nothing to match
+func (s ProductSearch) Empty() bool {
+	return len(s.Terms) == 0
+}
+
+// text is the query as matched against search_document
+func (s ProductSearch) text() string {
+	return strings.Join(s.Terms, " ")
+}
+
+// tsQuery requires every word, matching prefixes so Korean words with particles attached
+// in the listing still match
+func (s ProductSearch) tsQuery() string {
+	parts := make([]string, len(s.Terms))
+	for i, term := range s.Terms {
+		parts[i] = term + ":*"
+	}
+	return strings.Join(parts, " & ")
+}
+
+// likePattern matches the query as a substring of search_document
+func (s ProductSearch) likePattern() string {
+	return "%" + s.text() + "%"
+}
+
+// condition matches products: full-text matches on the weighted vector, plus trigram
+// substring and word-similarity matches for text the lexer doesn't split into words,
+// such as Korean without spaces, and for misspellings
+func (s ProductSearch) condition() clause.Expr {
+	return clause.Expr{
+		SQL:  "(products.search_vector @@ to_tsquery('simple', ?) OR products.search_document LIKE ? OR ? <% products.search_document)",
+		Vars: []interface{}{s.tsQuery(), s.likePattern(), s.text()},
+	}
+}
+
+// Hits returns a page of matches from a filtered query in the given order, which may
+// refer to the relevance as rank. Trigram similarity is added to the full-text rank so
+// fallback matches are ordered too.
+func (s ProductSearch) Hits(db *gorm.DB, order string, offset, limit int) ([]ProductSearchHit, error) {
+	tsQuery := s.tsQuery()
+	var hits []ProductSearchHit
+	err := db.Select(
+		`products.id,
+		ts_rank(products.search_vector, to_tsquery('simple', ?), 1) + 0.2 * word_similarity(?, products.search_document) AS rank,
+		ts_headline('simple', products.title, to_tsquery('simple', ?), ?) AS title,
+		ts_headline('simple', products.description, to_tsquery('simple', ?), ?) AS snippet`,
+		tsQuery, s.text(), tsQuery, titleHeadlineOptions, tsQuery, snippetHeadlineOptions,
+	).Order(order).Offset(offset).Limit(limit).Scan(&hits).Error
+	return hits, err
+}
+
+// Highlight renders a hit's fragments as HTML
+func (s ProductSearch) Highlight(hit ProductSearchHit) ProductHighlight {
+	return ProductHighlight{
+		Title:   s.renderHighlight(hit.Title),
+		Snippet: s.renderHighlight(hit.Snippet),
+	}
+}
+
+// renderHighlight escapes a fragment and turns the match delimiters into <mark> tags.
+// Fragments that only matched by trigram have no delimiters from ts_headline, so the
+// query words are marked wherever they occur.
+func (s ProductSearch) renderHighlight(fragment string) string {
+	if !strings.ContainsRune(fragment, highlightStart) {
+		fragment = markTerms(fragment, s.Terms)
+	}
+	escaped := html.EscapeString(fragment)
+	return strings.NewReplacer(string(highlightStart), "<mark>", string(highlightStop), "</mark>").Replace(escaped)
+}
+
+// markTerms delimits case-insensitive occurrences of terms, preferring the longest match
+func markTerms(text string, terms []string) string {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		return text
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		matched := 0
+		for _, term := range terms {
+			if len(term) > matched && strings.HasPrefix(lower[i:], term) {
+				matched = len(term)
+			}
+		}
+		if matched > 0 {
+			b.WriteRune(highlightStart)
+			b.WriteString(text[i : i+matched])
+			b.WriteRune(highlightStop)
+			i += matched
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		b.WriteString(text[i : i+size])
+		i += size
+	}
+	return b.String()
+}
+
+// Suggest returns a corrected query for "did you mean", replacing words that don't start
+// any title or tag word of an active product with the most similar one. Words come from
+// the search_lexicon view, so products listed since its last refresh aren't considered.
+// It returns an empty string when nothing would change.
+func (s ProductSearch) Suggest(db *gorm.DB) string {
+	if s.Empty() {
+		return ""
+	}
+
+	// Terms are letters and digits only, so they are safe in a LIKE pattern
+	var rows []struct {
+		Term string
+		Word string
+	}
+	err := db.Raw(`SELECT t.term, coalesce((
+			SELECT word FROM search_lexicon
+			WHERE word LIKE t.term || '%' OR word % t.term
+			ORDER BY word LIKE t.term || '%' DESC, similarity(word, t.term) DESC, ndoc DESC
+			LIMIT 1
+		), '') AS word
+		FROM unnest(string_to_array(?, ' ')) WITH ORDINALITY AS t(term, n)
+		ORDER BY t.n`, s.text()).Scan(&rows).Error
+	if err != nil || len(rows) != len(s.Terms) {
+		return ""
+	}
+
+	changed := false
+	words := make([]string, len(rows))
+	for i, row := range rows {
+		words[i] = row.Term
+		if row.Word != "" && !strings.HasPrefix(row.Word, row.Term) {
+			words[i] = row.Word
+			changed = true
+		}
+	}
+	if !changed {
+		return ""
+	}
+	return strings.Join(words, " ")
+}
+
+// processSearchLexicon refreshes the words "did you mean" suggestions are picked from
+func (s *SchedulerService) processSearchLexicon() {
+	if err := RefreshSearchLexicon(database.DB); err != nil {
+		log.Printf("Error refreshing search lexicon: %v", err)
+	}
+}
+
+// RefreshSearchLexicon rebuilds the title and tag words of active products without
+// blocking suggestions that read the previous words
+func RefreshSearchLexicon(db *gorm.DB) error {
+	return db.Exec("REFRESH MATERIALIZED VIEW CONCURRENTLY search_lexicon").Error
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Limits for secret scanning of archive entries
+const (
+	MaxSecretScanFileSize = 1024 * 1024 // larger files are skipped
+	MaxSecretFindings     = 200
+)
+
+// SecretFinding is a likely credential found in an archive entry. Match is redacted.
+type SecretFinding struct {
+	Path        string
+	Line        int
+	RuleID      string
+	Description string
+	Match       string
+}
+
+type secretRule struct {
+	id          string
+	description string
+	pattern     *regexp.Regexp
+	// valid rejects placeholder matches; nil accepts every match
+	valid func(match []string) bool
+}
+
+// secretRules only contains high-confidence patterns so sellers aren't buried in noise
+var secretRules = []secretRule{
+	{
+		id:          "aws-access-key",
+		description: "AWS access key ID",
+		pattern:     regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+		valid:       func(m []string) bool { return !strings.Contains(m[0], "EXAMPLE") },
+	},
+	{
+		id:          "aws-secret-key",
+		description: "AWS secret access key",
+		pattern:     regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+]{40})\b`),
+		valid:       func(m []string) bool { return !strings.Contains(m[1], "EXAMPLEKEY") },
+	},
+	{
+		id:          "gcp-service-account",
+		description: "Google Cloud service account key",
+		pattern:     regexp.MustCompile(`"private_key_id"\s*:\s*"[0-9a-f]{40}"`),
+	},
+	{
+		id:          "private-key",
+		description: "Private key",
+		pattern:     regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |PGP |ENCRYPTED )?PRIVATE KEY(?: BLOCK)?-----`),
+	},
+	{
+		id:          "github-token",
+		description: "GitHub token",
+		pattern:     regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{60,})\b`),
+	},
+	{
+		id:          "slack-token",
+		description: "Slack token",
+		pattern:     regexp.MustCompile(`\bxox[baprs]-[0-9]{10,}-[0-9A-Za-z-]{10,}\b`),
+	},
+	{
+		id:          "stripe-secret-key",
+		description: "Stripe secret key",
+		pattern:     regexp.MustCompile(`\b[sr]k_live_[0-9A-Za-z]{24,}\b`),
+	},
+	{
+		id:          "jwt",
+		description: "JSON Web Token",
+		pattern:     regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{20,}\b`),
+	},
+	{
+		id:          "database-url",
+		description: "Database connection URL with password",
+		pattern:     regexp.MustCompile(`\b(?:postgres(?:ql)?|mysql|mariadb|mongodb(?:\+srv)?|redis|rediss|amqps?|mssql|sqlserver)://([^\s:/@'"]+):([^\s@/'"]+)@([^\s/:'"?]+)`),
+		valid:       func(m []string) bool { return !isPlaceholderCredential(m[2]) && !isLocalHost(m[3]) },
+	},
+}
+
+// ScanForSecrets reports likely credentials in one file. name is the slash-separated path
+// inside the archive and content the file contents; binary files yield no findings.
+func ScanForSecrets(name string, content []byte) []SecretFinding {
+	var findings []SecretFinding
+
+	if isDotEnvFile(name) && len(bytes.TrimSpace(content)) > 0 {
+		findings = append(findings, SecretFinding{
+			Path:        name,
+			RuleID:      "dotenv-file",
+			Description: "Environment file (.env) included in the archive",
+		})
+	}
+
+	if isBinary(content) {
+		return findings
+	}
+
+	for lineNumber, line := range strings.Split(string(content), "\n") {
+		for _, rule := range secretRules {
+			for _, match := range rule.pattern.FindAllStringSubmatch(line, -1) {
+				if rule.valid != nil && !rule.valid(match) {
+					continue
+				}
+				findings = append(findings, SecretFinding{
+					Path:        name,
+					Line:        lineNumber + 1,
+					RuleID:      rule.id,
+					Description: rule.description,
+					Match:       redactSecret(match[0]),
+				})
+			}
+		}
+	}
+
+	return findings
+}
+
+// isDotEnvFile matches .env and .env.<stage> but not committed templates like .env.example
+func isDotEnvFile(name string) bool {
+	base := strings.ToLower(path.Base(name))
+	if base != ".env" && !strings.HasPrefix(base, ".env.") {
+		return false
+	}
+	for _, suffix := range []string{".example", ".sample", ".template", ".dist", ".defaults"} {
+		if strings.HasSuffix(base, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// isBinary treats content with NUL bytes near the start as binary
+func isBinary(content []byte) bool {
+	head := content
+	if len(head) > 8000 {
+		head = head[:8000]
+	}
+	return bytes.IndexByte(head, 0) >= 0
+}
+
+func isPlaceholderCredential(password string) bool {
+	lower := strings.ToLower(password)
+	if strings.ContainsAny(lower, "${}<>%") {
+		return true
+	}
+	switch lower {
+	case "password", "pass", "passwd", "secret", "changeme", "example", "postgres", "root", "admin", "user", "xxx", "xxxx", "****":
+		return true
+	}
+	return false
+}
+
+func isLocalHost(host string) bool {
+	switch strings.ToLower(host) {
+	case "localhost", "127.0.0.1", "0.0.0.0", "host", "hostname", "example.com", "db", "postgres", "mysql", "redis", "mongo":
+		return true
+	}
+	return false
+}
+
+// redactSecret keeps just enough of a match to recognise it
+func redactSecret(match string) string {
+	if strings.HasPrefix(match, "-----BEGIN") {
+		return match
+	}
+	if len(match) <= 8 {
+		return strings.Repeat("*", len(match))
+	}
+	return match[:6] + strings.Repeat("*", 8) + match[len(match)-2:]
+}
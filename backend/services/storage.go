@@ -0,0 +1,248 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"vibing-backend/config"
+	"vibing-backend/database"
+)
+
+// ErrObjectNotFound is returned by object stores when a key does not exist
+var ErrObjectNotFound = errors.New("object not found")
+
+// ErrMultipartNotSupported is returned when the configured backend can't do presigned multipart uploads
+var ErrMultipartNotSupported = errors.New("multipart uploads are not supported by the storage backend")
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"contentType"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// Object is an open object body. When a byte range was requested,
+// ContentLength is the length of that range and Size the full object size.
+type Object struct {
+	ObjectInfo
+	Body          io.ReadCloser
+	ContentLength int64
+}
+
+// ObjectStore is the storage backend for product files, images and other uploads.
+// Keys are slash-separated paths such as "products/<id>/<file>.zip".
+type ObjectStore interface {
+	// Put stores body under key. size may be -1 if unknown.
+	Put(key string, body io.Reader, size int64, contentType string) error
+	// Get opens an object; byteRange is an optional HTTP Range value such as "bytes=0-1023"
+	Get(key, byteRange string) (*Object, error)
+	// Presign returns a time-limited URL that allows anyone holding it to read the object
+	Presign(key string, expiry time.Duration) (string, error)
+	// KeyFromURL maps a URL returned by Presign back to its key, or "" if it isn't one of ours
+	KeyFromURL(rawURL string) string
+	Delete(key string) error
+	Stat(key string) (*ObjectInfo, error)
+	List(prefix string) ([]ObjectInfo, error)
+}
+
+// UploadedPart is one part of a multipart upload
+type UploadedPart struct {
+	PartNumber int64  `json:"partNumber"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size,omitempty"`
+}
+
+// PendingUpload is an unfinished multipart upload found in the bucket
+type PendingUpload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
+}
+
+// MultipartStore is implemented by backends that support presigned direct and multipart uploads
+type MultipartStore interface {
+	ObjectStore
+	PresignPut(key, contentType string, expiry time.Duration) (string, error)
+	CreateMultipartUpload(key, contentType string) (string, error)
+	PresignUploadPart(key, uploadID string, partNumber int64, expiry time.Duration) (string, error)
+	ListUploadedParts(key, uploadID string) ([]UploadedPart, error)
+	CompleteMultipartUpload(key, uploadID string, parts []UploadedPart) error
+	AbortMultipartUpload(key, uploadID string) error
+	ListMultipartUploadsBefore(prefix string, before time.Time) ([]PendingUpload, error)
+}
+
+// defaultStore is the shared instance used by background jobs
+var defaultStore ObjectStore
+
+// SetDefaultObjectStore registers the object store used by background jobs
+func SetDefaultObjectStore(store ObjectStore) {
+	defaultStore = store
+}
+
+// DefaultObjectStore returns the object store registered for background jobs
+func DefaultObjectStore() ObjectStore {
+	return defaultStore
+}
+
+// NewObjectStore creates the object store selected by STORAGE_BACKEND:
+// "s3" (AWS), "s3-compatible" (MinIO, NCP Object Storage, ...) or "local"
+func NewObjectStore(cfg *config.Config) (ObjectStore, error) {
+	switch strings.ToLower(cfg.Storage.Backend) {
+	case "", "s3":
+		return NewS3Store(&cfg.S3)
+	case "s3-compatible", "minio", "ncp":
+		if cfg.S3.Endpoint == "" {
+			return nil, fmt.Errorf("S3 endpoint is required for S3-compatible storage")
+		}
+		return NewS3Store(&cfg.S3)
+	case "local":
+		signingKey := []byte(cfg.Storage.SigningKey)
+		if len(signingKey) == 0 {
+			// Presigned local URLs stop working after a restart, which is fine for development
+			signingKey = make([]byte, 32)
+			rand.Read(signingKey)
+			log.Println("Warning: STORAGE_SIGNING_KEY not set, using a random key for local storage URLs")
+		}
+		return NewLocalStore(cfg.Storage.LocalPath, cfg.Storage.PublicURL, signingKey)
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.Storage.Backend)
+	}
+}
+
+// ObjectKeyFromURL extracts an object key from a legacy stored URL. It understands
+// virtual-hosted and path-style S3 URLs, custom endpoints and presigned URLs.
+// Values that are not URLs are assumed to already be keys.
+func ObjectKeyFromURL(rawURL, bucket string) string {
+	if rawURL == "" {
+		return ""
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return strings.TrimPrefix(rawURL, "/")
+	}
+
+	key := strings.TrimPrefix(parsed.Path, "/")
+	if bucket != "" && !strings.HasPrefix(parsed.Host, bucket+".") {
+		// Path-style: https://endpoint/bucket/key
+		key = strings.TrimPrefix(key, bucket+"/")
+	}
+	return key
+}
+
+// MigrateLegacyFileURLs converts product rows that still store a full file URL into object keys
+func MigrateLegacyFileURLs(bucket string) error {
+	if !database.DB.Migrator().HasColumn("products", "file_url") {
+		return nil
+	}
+
+	var rows []struct {
+		ID      string
+		FileURL string
+	}
+	if err := database.DB.Table("products").
+		Select("id, file_url").
+		Where("file_url <> '' AND (file_key IS NULL OR file_key = '')").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		key := ObjectKeyFromURL(row.FileURL, bucket)
+		if key == "" {
+			continue
+		}
+		if err := database.DB.Table("products").Where("id = ?", row.ID).
+			Update("file_key", key).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(rows) > 0 {
+		log.Printf("Migrated %d product file URLs to object keys", len(rows))
+	}
+	return nil
+}
+
+// UploadProductFile inspects a product ZIP file, streams it to storage and returns
+// its key, size and inspection result. Archives that fail inspection are never stored.
+func UploadProductFile(store ObjectStore, file *multipart.FileHeader, productID string) (string, int64, *ArchiveInspection, error) {
+	// Validate file extension
+	if !IsZipFile(file.Filename) {
+		return "", 0, nil, fmt.Errorf("only ZIP files are allowed")
+	}
+
+	// Validate file size (max 200MB)
+	const maxSize = 200 * 1024 * 1024 // 200MB
+	if file.Size > maxSize {
+		return "", 0, nil, fmt.Errorf("file size exceeds 200MB limit")
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return "", 0, nil, err
+	}
+	defer src.Close()
+
+	inspection, err := InspectArchive(src, file.Size)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return "", 0, nil, err
+	}
+
+	key := ProductFileKey(productID, file.Filename)
+
+	// Product files are private, downloads go through tokens
+	if err := store.Put(key, src, file.Size, "application/zip"); err != nil {
+		return "", 0, nil, err
+	}
+
+	return key, file.Size, inspection, nil
+}
+
+// unsafeKeyChars matches what may not appear in the filename part of an object key
+var unsafeKeyChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// SafeZipName turns a client's filename into the name part of an object key. Only the
+// base name is kept, with anything outside letters, digits, dots, dashes and underscores
+// replaced; names that don't end up as a ZIP file become archive.zip.
+func SafeZipName(filename string) string {
+	name := path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	name = strings.Trim(unsafeKeyChars.ReplaceAllString(name, "_"), "._")
+	if !IsZipFile(name) {
+		name = "archive.zip"
+	}
+	return name
+}
+
+// ProductFileKey returns a unique object key for a product file. The random ID keeps
+// uploads of the same filename from overwriting each other's archive.
+func ProductFileKey(productID, filename string) string {
+	return fmt.Sprintf("products/%s/%s_%s", productID, uuid.New().String(), SafeZipName(filename))
+}
+
+// UploadFileKey returns a unique object key for a presigned direct upload
+func UploadFileKey(filename string) string {
+	return fmt.Sprintf("uploads/%s_%s", uuid.New().String(), SafeZipName(filename))
+}
+
+// IsZipFile checks if file has ZIP extension
+func IsZipFile(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".zip"
+}
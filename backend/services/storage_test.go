@@ -0,0 +1,49 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSafeZipName(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"plugin.zip", "plugin.zip"},
+		{"Plugin-1.2_final.ZIP", "Plugin-1.2_final.ZIP"},
+		{"../../users/secret.zip", "secret.zip"},
+		{`..\..\evil.zip`, "evil.zip"},
+		{"my plugin (v2).zip", "my_plugin_v2_.zip"},
+		{"a/b?c=d&e.zip", "b_c_d_e.zip"},
+		{"한글.zip", "archive.zip"},
+		{".zip", "archive.zip"},
+		{"..", "archive.zip"},
+		{"/", "archive.zip"},
+		{"plugin.tar.gz", "archive.zip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			if got := SafeZipName(tt.filename); got != tt.want {
+				t.Errorf("SafeZipName(%q) = %q, want %q", tt.filename, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProductFileKey(t *testing.T) {
+	key := ProductFileKey("p1", "../../users/secret.zip")
+	if !strings.HasPrefix(key, "products/p1/") || !strings.HasSuffix(key, "_secret.zip") {
+		t.Errorf("ProductFileKey = %q, want products/p1/<id>_secret.zip", key)
+	}
+	if strings.Count(key, "/") != 2 {
+		t.Errorf("ProductFileKey = %q escapes the product folder", key)
+	}
+	// Uploads of the same filename in the same second must not share an object
+	if again := ProductFileKey("p1", "../../users/secret.zip"); again == key {
+		t.Errorf("ProductFileKey returned %q twice", key)
+	}
+	if a, b := UploadFileKey("plugin.zip"), UploadFileKey("plugin.zip"); a == b || !strings.HasPrefix(a, "uploads/") {
+		t.Errorf("UploadFileKey = %q, %q, want distinct keys under uploads/", a, b)
+	}
+}
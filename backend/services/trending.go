@@ -0,0 +1,163 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"vibing-backend/database"
+	"vibing-backend/models"
+)
+
+const (
+	// MaxTrendingProducts bounds the trending list
+	MaxTrendingProducts = 50
+	// trendingWindow is how far back activity counts toward trending scores
+	trendingWindow = 14 * 24 * time.Hour
+	// trendingHalfLife is the age at which an event counts half as much as a new one
+	trendingHalfLife = 3 * 24 * time.Hour
+	// trendingPrior is how many products of global average activity each category's
+	// baseline includes, so a category with a few quiet products doesn't inflate them
+	trendingPrior = 5
+	// trendingSnapshots is how many of the top products get a snapshot per run
+	trendingSnapshots = 100
+	// trendingHistory is how long snapshots are kept
+	trendingHistory = 30 * 24 * time.Hour
+)
+
+// trendingSignal is a kind of activity that makes a product trend
+type trendingSignal struct {
+	name   string
+	weight float64
+	// events selects product_id, occurred_at and count of the events since @since
+	events string
+}
+
+// trendingSignals are weighted by how much intent an event shows; one purchase counts
+// as much as ten views
+var trendingSignals = []trendingSignal{
+	{"views", 1, "SELECT product_id, day + interval '12 hours' AS occurred_at, views AS count FROM product_view_days WHERE day >= @since::date"},
+	{"purchases", 10, "SELECT product_id, created_at AS occurred_at, 1 AS count FROM purchases WHERE status IN @owned AND deleted_at IS NULL AND created_at >= @since"},
+	{"reviews", 5, "SELECT product_id, created_at AS occurred_at, 1 AS count FROM reviews WHERE deleted_at IS NULL AND created_at >= @since"},
+	{"wishlists", 3, "SELECT product_id, created_at AS occurred_at, 1 AS count FROM wishlist_items WHERE created_at >= @since"},
+}
+
+// trendingEvents sums the events of every signal per product, each event decayed
+// exponentially by its age
+func trendingEvents() string {
+	selects := make([]string, len(trendingSignals))
+	for i, signal := range trendingSignals {
+		selects[i] = fmt.Sprintf("SELECT '%s' AS signal, product_id, occurred_at, count FROM (%s) AS s%d", signal.name, signal.events, i)
+	}
+	return `SELECT product_id, signal,
+	sum(count * exp(-ln(2) * extract(epoch FROM @now - occurred_at) / @halfLife)) AS decayed
+FROM (` + strings.Join(selects, " UNION ALL ") + `) AS events
+GROUP BY product_id, signal`
+}
+
+// processTrending recomputes the trending scores
+func (s *SchedulerService) processTrending() {
+	if err := RefreshTrendingScores(database.DB); err != nil {
+		log.Printf("Error refreshing trending scores: %v", err)
+	}
+}
+
+// RefreshTrendingScores scores every active product by its decayed activity in the
+// trending window, divided by the average of its category, and snapshots the top ones.
+// Scores above 1 mean a product is busier than what is usual for its category.
+func RefreshTrendingScores(db *gorm.DB) error {
+	now := time.Now()
+	var events []struct {
+		ProductID string
+		Signal    string
+		Decayed   float64
+	}
+	if err := db.Raw(trendingEvents(), map[string]interface{}{
+		"now":      now,
+		"since":    now.Add(-trendingWindow),
+		"halfLife": trendingHalfLife.Seconds(),
+		"owned":    models.OwnedPurchaseStatuses,
+	}).Scan(&events).Error; err != nil {
+		return err
+	}
+
+	var products []models.Product
+	if err := db.Select("id", "category").Where("status = ?", "active").Find(&products).Error; err != nil {
+		return err
+	}
+
+	weights := map[string]float64{}
+	for _, signal := range trendingSignals {
+		weights[signal.name] = signal.weight
+	}
+	signals := map[string]map[string]float64{}
+	raw := map[string]float64{}
+	for _, event := range events {
+		if signals[event.ProductID] == nil {
+			signals[event.ProductID] = map[string]float64{}
+		}
+		signals[event.ProductID][event.Signal] = event.Decayed
+		raw[event.ProductID] += weights[event.Signal] * event.Decayed
+	}
+
+	// Category baselines average over every active product, quiet ones included
+	var total float64
+	sums := map[string]float64{}
+	counts := map[string]int{}
+	for _, product := range products {
+		total += raw[product.ID]
+		sums[product.Category] += raw[product.ID]
+		counts[product.Category]++
+	}
+	global := total / float64(max(len(products), 1))
+
+	var snapshots []models.TrendingSnapshot
+	for _, product := range products {
+		score := raw[product.ID]
+		if score == 0 {
+			continue
+		}
+		baseline := (sums[product.Category] + trendingPrior*global) / float64(counts[product.Category]+trendingPrior)
+		snapshots = append(snapshots, models.TrendingSnapshot{
+			ProductID:  product.ID,
+			Category:   product.Category,
+			Signals:    signals[product.ID],
+			RawScore:   score,
+			Baseline:   baseline,
+			Score:      score / baseline,
+			ComputedAt: now,
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Score > snapshots[j].Score })
+	for i := range snapshots {
+		snapshots[i].Rank = i + 1
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Product{}).Where("trending_score <> 0").UpdateColumn("trending_score", 0).Error; err != nil {
+			return err
+		}
+		for _, snapshot := range snapshots {
+			if err := tx.Model(&models.Product{}).Where("id = ?", snapshot.ProductID).
+				UpdateColumn("trending_score", snapshot.Score).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(snapshots) > trendingSnapshots {
+			snapshots = snapshots[:trendingSnapshots]
+		}
+		if len(snapshots) > 0 {
+			if err := tx.Create(&snapshots).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("computed_at < ?", now.Add(-trendingHistory)).Delete(&models.TrendingSnapshot{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("day < ?", now.Add(-trendingWindow).UTC().Truncate(24*time.Hour)).Delete(&models.ProductViewDay{}).Error
+	})
+}
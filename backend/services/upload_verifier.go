@@ -0,0 +1,236 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"vibing-backend/database"
+	"vibing-backend/models"
+)
+
+const (
+	verifyPollInterval = time.Minute
+	// Verifications stuck this long (e.g. after a restart) are retried
+	verifyStaleAfter  = 30 * time.Minute
+	verifyRetryDelay  = 5 * time.Minute
+	verifyMaxAttempts = 3
+	// verifying_at is refreshed this often while a verification runs
+	verifyHeartbeatInterval = 5 * time.Minute
+)
+
+// UploadAttacher attaches a verified upload to its product. Returning an *ArchiveError
+// fails the upload with its code; other errors are retried. Attaching an upload that is
+// already attached must succeed without attaching it again.
+type UploadAttacher func(session *models.UploadSession, inspection *ArchiveInspection) error
+
+// UploadVerifier checks the checksum of assembled multipart uploads, inspects them and
+// attaches them to their product. Like the scan worker, the database is the queue.
+type UploadVerifier struct {
+	attach   UploadAttacher
+	wake     chan struct{}
+	stopChan chan bool
+}
+
+// NewUploadVerifier creates an upload verifier that attaches uploads with attach
+func NewUploadVerifier(attach UploadAttacher) *UploadVerifier {
+	return &UploadVerifier{
+		attach:   attach,
+		wake:     make(chan struct{}, 1),
+		stopChan: make(chan bool),
+	}
+}
+
+// Start begins processing uploads waiting for verification
+func (v *UploadVerifier) Start() {
+	go v.run()
+}
+
+// Stop terminates the verifier
+func (v *UploadVerifier) Stop() {
+	v.stopChan <- true
+}
+
+// Wake asks the verifier to check for uploads now
+func (v *UploadVerifier) Wake() {
+	select {
+	case v.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (v *UploadVerifier) run() {
+	ticker := time.NewTicker(verifyPollInterval)
+	defer ticker.Stop()
+
+	log.Println("Upload verifier started")
+	v.processQueue()
+
+	for {
+		select {
+		case <-ticker.C:
+			v.processQueue()
+		case <-v.wake:
+			v.processQueue()
+		case <-v.stopChan:
+			log.Println("Upload verifier stopped")
+			return
+		}
+	}
+}
+
+// processQueue verifies waiting uploads one at a time, oldest first
+func (v *UploadVerifier) processQueue() {
+	if defaultStore == nil {
+		return
+	}
+
+	for {
+		var sessions []models.UploadSession
+		if err := database.DB.Where("status = ? AND (verifying_at IS NULL OR verifying_at <= ?)",
+			"verifying", time.Now().Add(-verifyStaleAfter)).
+			Where("verify_attempts = 0 OR updated_at <= ?", time.Now().Add(-verifyRetryDelay)).
+			Order("updated_at ASC").Limit(1).
+			Find(&sessions).Error; err != nil {
+			log.Printf("Error finding uploads to verify: %v", err)
+			return
+		}
+		if len(sessions) == 0 {
+			return
+		}
+		if v.claim(&sessions[0]) {
+			v.verify(&sessions[0])
+		}
+	}
+}
+
+// claim marks the session as being verified so other instances skip it
+func (v *UploadVerifier) claim(session *models.UploadSession) bool {
+	now := time.Now()
+	result := database.DB.Model(&models.UploadSession{}).
+		Where("id = ? AND status = ? AND verify_attempts = ?", session.ID, "verifying", session.VerifyAttempts).
+		Updates(map[string]interface{}{"verifying_at": now, "verify_attempts": session.VerifyAttempts + 1})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	session.VerifyingAt = &now
+	session.VerifyAttempts++
+	return true
+}
+
+// verify compares the upload with its declared checksum, inspects the archive and
+// attaches it. Rejected uploads are deleted, unless already attached, and their session
+// failed.
+func (v *UploadVerifier) verify(session *models.UploadSession) {
+	// Verifications that never finished count as attempts too
+	if session.VerifyAttempts > verifyMaxAttempts {
+		v.reject(session, "UPLOAD_ERROR", "Failed to verify uploaded archive")
+		return
+	}
+
+	stop := v.heartbeat(session)
+
+	inspection, err := InspectStoredArchive(defaultStore, session.ObjectKey)
+	if err == nil && inspection.SHA256 != session.ChecksumSHA256 {
+		err = archiveError("CHECKSUM_MISMATCH", "Uploaded file checksum does not match")
+	}
+	if err == nil {
+		err = v.attach(session, inspection)
+	}
+	stop()
+
+	if archiveErr, ok := err.(*ArchiveError); ok {
+		v.reject(session, archiveErr.Code, archiveErr.Message)
+		return
+	}
+	if err != nil {
+		if session.VerifyAttempts >= verifyMaxAttempts {
+			log.Printf("Verification of upload %s failed permanently: %v", session.ID, err)
+			v.reject(session, "UPLOAD_ERROR", "Failed to verify uploaded archive")
+			return
+		}
+		log.Printf("Verification of upload %s failed (attempt %d), will retry: %v", session.ID, session.VerifyAttempts, err)
+		database.DB.Model(session).Update("verifying_at", nil)
+		return
+	}
+
+	now := time.Now()
+	session.Status = "completed"
+	session.CompletedAt = &now
+	if err := database.DB.Save(session).Error; err != nil {
+		log.Printf("Error completing upload session %s: %v", session.ID, err)
+	}
+}
+
+// heartbeat refreshes verifying_at until stop is called, so a long verification isn't
+// taken for a stalled one and claimed by another instance
+func (v *UploadVerifier) heartbeat(session *models.UploadSession) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(verifyHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				database.DB.Model(&models.UploadSession{}).
+					Where("id = ? AND status = ? AND verify_attempts = ?", session.ID, "verifying", session.VerifyAttempts).
+					Update("verifying_at", time.Now())
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// reject fails the session and deletes its upload, unless a product or release already
+// references the object
+func (v *UploadVerifier) reject(session *models.UploadSession, code, message string) {
+	referenced, err := productObjectReferenced(session.ObjectKey)
+	if err != nil {
+		log.Printf("Failed to check references of rejected upload %s, keeping it: %v", session.ObjectKey, err)
+	} else if !referenced {
+		if err := defaultStore.Delete(session.ObjectKey); err != nil && err != ErrObjectNotFound {
+			log.Printf("Failed to delete rejected upload %s: %v", session.ObjectKey, err)
+		}
+	}
+	session.Fail(code, message)
+	if err := database.DB.Save(session).Error; err != nil {
+		log.Printf("Error failing upload session %s: %v", session.ID, err)
+	}
+}
+
+// productObjectReferenced reports whether a product, deleted ones included, or a release
+// uses the object as its archive
+func productObjectReferenced(key string) (bool, error) {
+	var count int64
+	if err := database.DB.Unscoped().Model(&models.Product{}).Where("file_key = ?", key).Count(&count).Error; err != nil || count > 0 {
+		return count > 0, err
+	}
+	if err := database.DB.Model(&models.ProductRelease{}).Where("object_key = ?", key).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Global upload verifier instance
+var MultipartUploadVerifier *UploadVerifier
+
+// InitUploadVerifier starts the global upload verifier
+func InitUploadVerifier(attach UploadAttacher) {
+	MultipartUploadVerifier = NewUploadVerifier(attach)
+	MultipartUploadVerifier.Start()
+}
+
+// StopUploadVerifier stops the global upload verifier
+func StopUploadVerifier() {
+	if MultipartUploadVerifier != nil {
+		MultipartUploadVerifier.Stop()
+	}
+}
+
+// WakeUploadVerifier notifies the verifier that an upload is waiting
+func WakeUploadVerifier() {
+	if MultipartUploadVerifier != nil {
+		MultipartUploadVerifier.Wake()
+	}
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"vibing-backend/database"
+	"vibing-backend/models"
+)
+
+// processStaleUploads aborts multipart uploads that were never completed,
+// both those tracked by an upload session and any left behind in the bucket
+func (s *SchedulerService) processStaleUploads() {
+	store, ok := defaultStore.(MultipartStore)
+	if !ok {
+		return
+	}
+
+	var sessions []models.UploadSession
+	if err := database.DB.Where("status = ? AND expires_at <= ?", "initiated", time.Now()).
+		Find(&sessions).Error; err != nil {
+		log.Printf("Error finding stale upload sessions: %v", err)
+		return
+	}
+
+	aborted := 0
+	for _, session := range sessions {
+		if err := store.AbortMultipartUpload(session.ObjectKey, session.UploadID); err != nil {
+			// The upload may already be gone on the storage side; still close the session
+			log.Printf("Warning: Failed to abort multipart upload for session %s: %v", session.ID, err)
+		}
+
+		if err := database.DB.Model(&session).Update("status", "aborted").Error; err != nil {
+			log.Printf("Error marking upload session %s as aborted: %v", session.ID, err)
+			continue
+		}
+		aborted++
+	}
+
+	// Uploads started without a session (or whose session row was lost)
+	uploads, err := store.ListMultipartUploadsBefore("products/", time.Now().Add(-models.UploadSessionTTL))
+	if err != nil {
+		log.Printf("Error listing unfinished multipart uploads: %v", err)
+	}
+	for _, upload := range uploads {
+		key, uploadID := upload.Key, upload.UploadID
+		if err := store.AbortMultipartUpload(key, uploadID); err != nil {
+			log.Printf("Error aborting multipart upload %s: %v", key, err)
+			continue
+		}
+		database.DB.Model(&models.UploadSession{}).
+			Where("upload_id = ? AND status = ?", uploadID, "initiated").
+			Update("status", "aborted")
+		aborted++
+	}
+
+	if aborted > 0 {
+		log.Printf("Aborted %d unfinished multipart uploads", aborted)
+	}
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"vibing-backend/config"
+)
+
+// WebPEncoder encodes renditions as WebP
+type WebPEncoder interface {
+	Encode(img image.Image) ([]byte, error)
+}
+
+// CWebPEncoder encodes WebP with the cwebp command-line tool from libwebp.
+// The Go standard library and this module's dependencies only decode WebP.
+type CWebPEncoder struct {
+	path    string
+	quality int
+	timeout time.Duration
+}
+
+// NewWebPEncoder returns a cwebp-backed encoder, or nil when cwebp isn't installed
+func NewWebPEncoder(cfg *config.ImageConfig) WebPEncoder {
+	if cfg.CWebPPath == "" {
+		return nil
+	}
+
+	path, err := exec.LookPath(cfg.CWebPPath)
+	if err != nil {
+		log.Printf("cwebp not found (%s), WebP image renditions are disabled", cfg.CWebPPath)
+		return nil
+	}
+
+	quality := cfg.WebPQuality
+	if quality <= 0 || quality > 100 {
+		quality = 80
+	}
+
+	return &CWebPEncoder{path: path, quality: quality, timeout: 30 * time.Second}
+}
+
+// Encode converts an image to WebP through a temporary lossless PNG
+func (e *CWebPEncoder) Encode(img image.Image) ([]byte, error) {
+	input, err := os.CreateTemp("", "vibing-webp-*.png")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(input.Name())
+
+	if err := png.Encode(input, img); err != nil {
+		input.Close()
+		return nil, err
+	}
+	if err := input.Close(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.path,
+		"-quiet", "-metadata", "none", "-q", strconv.Itoa(e.quality), input.Name(), "-o", "-")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("cwebp failed: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	if DetectImageFormat(stdout.Bytes()) != "webp" {
+		return nil, fmt.Errorf("cwebp produced invalid output")
+	}
+	return stdout.Bytes(), nil
+}
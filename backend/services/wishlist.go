@@ -0,0 +1,94 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"gorm.io/gorm"
+	"vibing-backend/database"
+	"vibing-backend/models"
+)
+
+const wishlistBatchSize = 500
+
+// wishlistChanged matches wishlist items whose product changed since the user was last notified
+const wishlistChanged = `(products.price <> wishlist_items.notified_price
+	OR (products.original_price IS NOT NULL AND products.original_price > products.price) <> wishlist_items.notified_sale
+	OR COALESCE(products.latest_version, '') <> COALESCE(wishlist_items.notified_version, ''))`
+
+// processWishlistNotifications tells users about price drops, sales and releases of
+// the products they liked
+func (s *SchedulerService) processWishlistNotifications() {
+	sent, err := NotifyWishlists(database.DB)
+	if err != nil {
+		log.Printf("Error sending wishlist notifications: %v", err)
+	}
+	if sent > 0 {
+		log.Printf("Sent %d wishlist notifications", sent)
+	}
+}
+
+// NotifyWishlists notifies users of changes to the active products on their wishlists
+// and records the state they were notified of. Price increases and ended sales only
+// update that state. It returns the number of notifications sent.
+func NotifyWishlists(db *gorm.DB) (int, error) {
+	sent := 0
+	var items []models.WishlistItem
+	result := db.Joins("JOIN products ON products.id = wishlist_items.product_id AND products.status = 'active' AND products.deleted_at IS NULL").
+		Where(wishlistChanged).
+		Preload("Product").
+		FindInBatches(&items, wishlistBatchSize, func(tx *gorm.DB, batch int) error {
+			for i := range items {
+				n, err := notifyWishlistItem(db, &items[i])
+				if err != nil {
+					return err
+				}
+				sent += n
+			}
+			return nil
+		})
+	return sent, result.Error
+}
+
+func notifyWishlistItem(db *gorm.DB, item *models.WishlistItem) (int, error) {
+	product := item.Product
+	var notifications []models.Notification
+	notify := func(kind, title, message string) {
+		notifications = append(notifications, models.Notification{
+			UserID: item.UserID, Type: kind, ProductID: product.ID, Title: title, Message: message,
+		})
+	}
+
+	onSale := product.IsOnSale()
+	switch {
+	case onSale && !item.NotifiedSale:
+		notify(models.NotificationSaleStarted, "관심 상품 할인 시작",
+			fmt.Sprintf("%s %.0f%% 할인 중: %s원", product.Title, *product.GetDiscountPercentage(), formatPrice(product.Price)))
+	case product.Price < item.NotifiedPrice:
+		notify(models.NotificationPriceDrop, "관심 상품 가격 인하",
+			fmt.Sprintf("%s 가격이 %s원에서 %s원으로 내렸습니다", product.Title, formatPrice(item.NotifiedPrice), formatPrice(product.Price)))
+	}
+	if product.LatestVersion != "" && product.LatestVersion != item.NotifiedVersion {
+		notify(models.NotificationNewRelease, "관심 상품 새 버전",
+			fmt.Sprintf("%s %s 버전이 출시되었습니다", product.Title, product.LatestVersion))
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if len(notifications) > 0 {
+			if err := tx.Create(&notifications).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(item).Updates(map[string]interface{}{
+			"notified_price":   product.Price,
+			"notified_sale":    onSale,
+			"notified_version": product.LatestVersion,
+		}).Error
+	})
+	return len(notifications), err
+}
+
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', -1, 64)
+}
@@ -7,6 +7,9 @@ import { reviewApi } from '../../services/reviewApi';
 import { handleSessionExpiration } from '../../utils/auth';
 import { formatPrice, convertUsdToKrw } from '../../utils/purchaseUtils';
 
+// How often a download is retried while its personalized copy is being built
+const MAX_DOWNLOAD_ATTEMPTS = 24;
+
 interface Purchase {
   id: string;
   purchaseDate: string;
@@ -199,20 +202,30 @@ export default function PurchaseHistory() {
         throw new Error('Authentication required');
       }
 
-      const response = await fetch(`/api/purchase/${purchaseId}/download`, {
-        headers: {
-          'Authorization': `Bearer ${token}`,
-        },
-      });
+      // Personalized copies are built in the background; 202 means ask again later
+      for (let attempt = 0; attempt < MAX_DOWNLOAD_ATTEMPTS; attempt++) {
+        const response = await fetch(`/api/purchase/${purchaseId}/download`, {
+          headers: {
+            'Authorization': `Bearer ${token}`,
+          },
+        });
 
-      if (!response.ok) {
-        throw new Error('Failed to get download URL');
-      }
+        if (!response.ok) {
+          throw new Error('Failed to get download URL');
+        }
 
-      const data = await response.json();
-      if (data.downloadUrl) {
-        window.open(data.downloadUrl, '_blank');
+        const data = await response.json();
+        if (response.status === 202) {
+          const retryAfter = Number(response.headers.get('Retry-After')) || data.retryAfter || 5;
+          await new Promise((resolve) => setTimeout(resolve, retryAfter * 1000));
+          continue;
+        }
+        if (data.downloadUrl) {
+          window.open(data.downloadUrl, '_blank');
+        }
+        return;
       }
+      throw new Error('Personalized download is still being prepared');
     } catch (error) {
       console.error('Error downloading file:', error);
       alert('다운로드 중 오류가 발생했습니다.');
@@ -7,15 +7,25 @@ import type {
   PurchaseStatusResponse,
 } from '../types/purchase';
 
+// How often a download is retried while its personalized copy is being built
+const MAX_DOWNLOAD_ATTEMPTS = 24;
+
 export const purchaseApi = {
   // Get purchase history with pagination
   async getPurchaseHistory(page = 1, limit = 10): Promise<PurchaseHistoryResponse> {
     return apiClient.get(`/purchase/history?page=${page}&limit=${limit}`);
   },
 
-  // Get secure download URL for a purchase
+  // Get secure download URL for a purchase, waiting for a personalized copy to be built
   async getDownloadUrl(purchaseId: string): Promise<DownloadUrlResponse> {
-    return apiClient.get(`/purchase/${purchaseId}/download`);
+    for (let attempt = 0; attempt < MAX_DOWNLOAD_ATTEMPTS; attempt++) {
+      const response: DownloadUrlResponse = await apiClient.get(`/purchase/${purchaseId}/download`);
+      if (response.status !== 'building') {
+        return response;
+      }
+      await new Promise((resolve) => setTimeout(resolve, (response.retryAfter || 5) * 1000));
+    }
+    throw new Error('Personalized download is still being prepared');
   },
 
   // Generate new license key for a purchase
@@ -30,6 +30,10 @@ export interface PurchaseHistoryResponse {
 export interface DownloadUrlResponse {
   downloadUrl: string;
   expiresAt: string;
+  fileSize?: string;
+  // Set while a personalized copy is being built; ask again after retryAfter seconds
+  status?: 'building';
+  retryAfter?: number;
 }
 
 export interface LicenseResponse {